@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin protects operator endpoints with the shared ADMIN_TOKEN, sent
+// either as X-Admin-Token or as a bearer token. Admin endpoints are disabled
+// entirely when no token is configured.
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader("X-Admin-Token")
+		if provided == "" {
+			provided = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+
+		switch err := checkAdminToken(provided); {
+		case errors.Is(err, errAdminDisabled):
+			respondError(c, http.StatusForbidden, "ADMIN_DISABLED", "Admin endpoints are disabled")
+			c.Abort()
+			return
+		case err != nil:
+			respondError(c, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid admin token")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+var (
+	errAdminDisabled     = errors.New("admin endpoints are disabled")
+	errInvalidAdminToken = errors.New("invalid admin token")
+)
+
+// checkAdminToken compares provided with the configured ADMIN_TOKEN.
+func checkAdminToken(provided string) error {
+	expected := os.Getenv("ADMIN_TOKEN")
+	if expected == "" {
+		return errAdminDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+		return errInvalidAdminToken
+	}
+	return nil
+}
+
+func getDishGenerationHandler(c *gin.Context) {
+	var dish Dish
+	if err := db.Where("id = ?", c.Param("id")).First(&dish).Error; err != nil {
+		respondError(c, http.StatusNotFound, "DISH_NOT_FOUND", "Dish not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dish_id":             dish.ID,
+		"menu_id":             dish.MenuID,
+		"name":                dish.Name,
+		"generation_metadata": dish.GenerationMetadata,
+	})
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// adminCommand is one `menugen admin` subcommand. Commands run against the
+// configured database with the same code paths as the server, and print a
+// summary of what they did to stdout.
+type adminCommand struct {
+	Name    string
+	Summary string
+	NoDB    bool
+	Run     func(args []string, out io.Writer) error
+}
+
+var adminCommands = []adminCommand{
+	{Name: "requeue-stuck", Summary: "resume or fail menus stuck in PENDING/PROCESSING", Run: requeueStuckCommand},
+	{Name: "purge-expired", Summary: "delete menus and webhook deliveries older than a cutoff", Run: purgeExpiredCommand},
+	{Name: "recompute-snapshots", Summary: "rebuild published revision snapshots from menu content", Run: recomputeSnapshotsCommand},
+	{Name: "rehash-images", Summary: "download dish images and record their content hashes", Run: rehashImagesCommand},
+	{Name: "link-catalog", Summary: "link dishes extracted before the catalog to catalog dishes", Run: linkCatalogCommand},
+	{Name: "reprice-usage", Summary: "re-estimate recorded provider spend at the current model rates", Run: repriceUsageCommand},
+	{Name: "create-api-key", Summary: "issue an API key for a client of the /api routes", Run: createAPIKeyCommand},
+	{Name: "check-contracts", Summary: "check API response shapes against contracts.txt", NoDB: true, Run: checkContractsCommand},
+	{Name: "check-openapi", Summary: "check that the OpenAPI spec documents every route", NoDB: true, Run: checkOpenAPICommand},
+}
+
+// runAdminCommand runs `menugen admin <command> [flags]` and returns the
+// process exit code.
+func runAdminCommand(args []string, out io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printAdminUsage(out)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	for _, command := range adminCommands {
+		if command.Name != args[0] {
+			continue
+		}
+		// Help needs no database, so connect only for real runs
+		if !command.NoDB && !adminHelpRequested(args[1:]) {
+			if err := initDB(); err != nil {
+				fmt.Fprintf(out, "%s: %v\n", command.Name, err)
+				return 1
+			}
+		}
+		if err := command.Run(args[1:], out); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			fmt.Fprintf(out, "%s: %v\n", command.Name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(out, "unknown admin command %q\n\n", args[0])
+	printAdminUsage(out)
+	return 2
+}
+
+func printAdminUsage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: menugen admin <command> [flags]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands:")
+	for _, command := range adminCommands {
+		fmt.Fprintf(out, "  %-20s %s\n", command.Name, command.Summary)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Run `menugen admin <command> -h` for a command's flags.")
+}
+
+func adminHelpRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "-h" || arg == "-help" || arg == "--help" {
+			return true
+		}
+	}
+	return false
+}
+
+func newAdminFlagSet(name string, out io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("menugen admin "+name, flag.ContinueOnError)
+	flags.SetOutput(out)
+	return flags
+}
+
+// requeueStuckCommand finishes menus whose processing died with a replica.
+// Menus whose dishes were already extracted resume enrichment of the dishes
+// that never finished. Uploaded images are not stored, so menus stuck before
+// extraction cannot be rerun and are failed with INTERRUPTED instead.
+func requeueStuckCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("requeue-stuck", out)
+	olderThan := flags.Duration("older-than", defaultStuckAge, "only menus not updated for this long")
+	dryRun := flags.Bool("dry-run", false, "list the menus without changing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	menus, err := stuckMenus(*olderThan)
+	if err != nil {
+		return err
+	}
+
+	var resumed, failed int
+	for _, menu := range menus {
+		if menu.TotalDishes == 0 {
+			fmt.Fprintf(out, "%s  %s  fail: stuck before extraction\n", menu.ID, menu.Status)
+			if !*dryRun {
+				failMenuWithCode(menu.ID, "INTERRUPTED", "Processing was interrupted before the menu was read; please upload it again")
+			}
+			failed++
+			continue
+		}
+
+		fmt.Fprintf(out, "%s  %s  resume: %d/%d dishes done\n", menu.ID, menu.Status, menu.ProcessedDishes, menu.TotalDishes)
+		if !*dryRun {
+			if err := resumeMenuProcessing(&menu); err != nil {
+				return fmt.Errorf("failed to resume menu %s: %w", menu.ID, err)
+			}
+		}
+		resumed++
+	}
+
+	fmt.Fprintf(out, "%d menus resumed, %d failed%s\n", resumed, failed, dryRunSuffix(*dryRun))
+	return nil
+}
+
+// resumeMenuProcessing enhances the dishes of menu that never finished and
+// completes it, as processMenu would have.
+func resumeMenuProcessing(menu *Menu) error {
+	var dishes []Dish
+	if err := db.Where("menu_id = ? AND status IN ?", menu.ID, []string{"PENDING", "PROCESSING"}).Order("position").Find(&dishes).Error; err != nil {
+		return err
+	}
+
+	dishIDs := make([]string, len(dishes))
+	dishSections := make(map[string]string, len(dishes))
+	for i, dish := range dishes {
+		dishIDs[i] = dish.ID
+		if dish.SectionID != nil {
+			dishSections[dish.ID] = *dish.SectionID
+		}
+	}
+
+	// Counts kept before the crash may be behind the dishes
+	if err := refreshProgress(menu.ID, ""); err != nil {
+		return err
+	}
+
+	ctx, token := processingJobs.start(menu.ID)
+	defer processingJobs.finish(menu.ID, token)
+	resetProviderBudget(menu.ID)
+	ctx, cancel := withProcessingDeadline(ctx)
+	defer cancel()
+
+	enhanceMenuDishes(ctx, menu.ID, dishIDs, dishSections)
+	if processingAborted(ctx, menu.ID) {
+		return nil
+	}
+	generateMenuSEO(ctx, menu.ID)
+	completeMenu(menu.ID, menu.TotalDishes)
+	return nil
+}
+
+// purgeExpiredCommand deletes menus, with everything hanging off them, and
+// webhook deliveries that are older than the cutoff.
+func purgeExpiredCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("purge-expired", out)
+	olderThan := flags.Duration("older-than", 0, "delete records last updated more than this long ago (required, e.g. 2160h for 90 days)")
+	dryRun := flags.Bool("dry-run", false, "count what would be deleted without deleting it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan <= 0 {
+		return errors.New("-older-than is required")
+	}
+	cutoff := clock.Now().Add(-*olderThan)
+
+	var menuIDs []string
+	if err := db.Model(&Menu{}).Where("updated_at < ?", cutoff).Order("updated_at").Pluck("id", &menuIDs).Error; err != nil {
+		return err
+	}
+	var deliveries int64
+	if err := db.Model(&WebhookDelivery{}).Where("created_at < ?", cutoff).Count(&deliveries).Error; err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		for _, menuID := range menuIDs {
+			if err := deleteMenu(menuID); err != nil {
+				return fmt.Errorf("failed to delete menu %s: %w", menuID, err)
+			}
+		}
+		result := db.Where("created_at < ?", cutoff).Delete(&WebhookDelivery{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deliveries = result.RowsAffected
+	}
+
+	fmt.Fprintf(out, "%d menus and %d webhook deliveries older than %s purged%s\n",
+		len(menuIDs), deliveries, cutoff.Format(time.RFC3339), dryRunSuffix(*dryRun))
+	return nil
+}
+
+// recomputeSnapshotsCommand publishes completed menus that predate the
+// revision workflow and re-freezes published snapshots so they are stored in
+// the current schema. Menus with an open draft are skipped: their working
+// copy holds unpublished edits and is not what was published.
+func recomputeSnapshotsCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("recompute-snapshots", out)
+	menuID := flags.String("menu", "", "only this menu")
+	dryRun := flags.Bool("dry-run", false, "list the menus without changing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := db.Where("status = ?", "COMPLETE")
+	if *menuID != "" {
+		query = query.Where("id = ?", *menuID)
+	}
+	var menus []Menu
+	if err := query.Order("created_at").Find(&menus).Error; err != nil {
+		return err
+	}
+
+	var published, refreshed, skipped int
+	for _, menu := range menus {
+		switch {
+		case menu.DraftRevision != nil:
+			fmt.Fprintf(out, "%s  skip: draft revision %d is open\n", menu.ID, *menu.DraftRevision)
+			skipped++
+		case menu.PublishedRevision == nil:
+			fmt.Fprintf(out, "%s  publish first revision\n", menu.ID)
+			if !*dryRun {
+				if err := publishCompletedMenu(menu.ID); err != nil {
+					return fmt.Errorf("failed to publish menu %s: %w", menu.ID, err)
+				}
+			}
+			published++
+		default:
+			fmt.Fprintf(out, "%s  refresh revision %d\n", menu.ID, *menu.PublishedRevision)
+			if !*dryRun {
+				if err := refreshPublishedSnapshot(menu.ID); err != nil {
+					return fmt.Errorf("failed to refresh menu %s: %w", menu.ID, err)
+				}
+			}
+			refreshed++
+		}
+	}
+
+	fmt.Fprintf(out, "%d menus published, %d snapshots refreshed, %d skipped%s\n", published, refreshed, skipped, dryRunSuffix(*dryRun))
+	return nil
+}
+
+// refreshPublishedSnapshot rewrites the published revision's snapshot from
+// the working copy, rechecking under the menu lock that no draft is open.
+func refreshPublishedSnapshot(menuID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		menu, err := lockMenu(tx, menuID)
+		if err != nil {
+			return err
+		}
+		if menu.DraftRevision != nil || menu.PublishedRevision == nil {
+			return nil
+		}
+
+		snapshot, err := loadMenuSnapshot(tx, menuID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&MenuRevision{}).Where("menu_id = ? AND revision = ?", menuID, *menu.PublishedRevision).Updates(map[string]interface{}{
+			"snapshot":   &snapshot,
+			"updated_at": clock.Now(),
+		}).Error
+	})
+}
+
+// rehashImagesCommand downloads generated dish images and stores the SHA-256
+// of their content. Images that cannot be downloaded (e.g. expired provider
+// URLs) are reported and left unhashed. Original menu uploads are not
+// stored, so their hashes cannot be recomputed.
+func rehashImagesCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("rehash-images", out)
+	all := flags.Bool("all", false, "rehash images that already have a hash")
+	dryRun := flags.Bool("dry-run", false, "count the images without downloading them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := db.Model(&DishImage{})
+	if !*all {
+		query = query.Where("content_hash = ''")
+	}
+	var images []DishImage
+	if err := query.Order("created_at").Find(&images).Error; err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "%d images to hash%s\n", len(images), dryRunSuffix(true))
+		return nil
+	}
+
+	client := newImageFetchClient()
+	var hashed, unreachable int
+	for _, image := range images {
+		data, _, err := fetchImage(client, image.URL)
+		if err != nil {
+			fmt.Fprintf(out, "%s  unreachable: %v\n", image.ID, err)
+			unreachable++
+			continue
+		}
+		hash := fmt.Sprintf("%x", sha256.Sum256(data))
+		if err := db.Model(&DishImage{}).Where("id = ?", image.ID).Update("content_hash", hash).Error; err != nil {
+			return err
+		}
+		hashed++
+	}
+
+	fmt.Fprintf(out, "%d images hashed, %d unreachable\n", hashed, unreachable)
+	return nil
+}
+
+// linkCatalogCommand links dishes without a catalog dish, creating catalog
+// entries as processing would have. Names too long to catalog stay unlinked.
+func linkCatalogCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("link-catalog", out)
+	dryRun := flags.Bool("dry-run", false, "count the dishes without linking them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var dishes []Dish
+	if err := db.Select("id", "name").Where("catalog_dish_id IS NULL").Order("created_at").Find(&dishes).Error; err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "%d dishes to link%s\n", len(dishes), dryRunSuffix(true))
+		return nil
+	}
+
+	linked := 0
+	for _, dish := range dishes {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			catalogDishID, err := linkCatalogDish(tx, dish.Name)
+			if err != nil || catalogDishID == nil {
+				return err
+			}
+			linked++
+			return tx.Model(&Dish{}).Where("id = ?", dish.ID).Update("catalog_dish_id", catalogDishID).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to link dish %s: %w", dish.ID, err)
+		}
+	}
+
+	fmt.Fprintf(out, "%d dishes linked, %d skipped\n", linked, len(dishes)-linked)
+	return nil
+}
+
+// repriceUsageCommand re-estimates the cost of recorded provider requests
+// at the current model rates, for usage recorded before a rate was fixed or
+// configured, and rebuilds the spend rollups it changes.
+func repriceUsageCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("reprice-usage", out)
+	since := flags.String("since", "", "only reprice requests made on or after this date (YYYY-MM-DD)")
+	dryRun := flags.Bool("dry-run", false, "count the requests without repricing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var start time.Time
+	if *since != "" {
+		parsed, err := time.Parse(spendDateLayout, *since)
+		if err != nil {
+			return fmt.Errorf("-since must be a date (YYYY-MM-DD)")
+		}
+		start = parsed
+	}
+
+	var models []struct {
+		Provider string
+		Model    string
+		Requests int64
+	}
+	if err := db.Model(&ProviderUsage{}).Select("provider, model, COUNT(*) AS requests").
+		Where("created_at >= ?", start).Group("provider, model").Order("provider, model").Scan(&models).Error; err != nil {
+		return err
+	}
+
+	var requests int64
+	for _, model := range models {
+		requests += model.Requests
+		if *dryRun {
+			continue
+		}
+		rate := modelRateFor(model.Provider, model.Model)
+		err := db.Exec(`UPDATE provider_usages
+			SET estimated_cost_micros = ROUND(prompt_tokens * ? + completion_tokens * ? + images * ?)
+			WHERE provider = ? AND model = ? AND created_at >= ?`,
+			rate.InputPerMTok, rate.OutputPerMTok, rate.PerImage*1e6, model.Provider, model.Model, start).Error
+		if err != nil {
+			return fmt.Errorf("failed to reprice %s %s: %w", model.Provider, model.Model, err)
+		}
+	}
+	if !*dryRun && requests > 0 {
+		if err := rollupSpend(context.Background(), start); err != nil {
+			return fmt.Errorf("failed to roll up spend: %w", err)
+		}
+	}
+
+	fmt.Fprintf(out, "%d requests of %d models repriced%s\n", requests, len(models), dryRunSuffix(*dryRun))
+	return nil
+}
+
+func dryRunSuffix(dryRun bool) string {
+	if dryRun {
+		return " (dry run)"
+	}
+	return ""
+}
+
+// runAdminCLI is the entry point for `menugen admin`; it exits the process.
+func runAdminCLI(args []string) {
+	code := runAdminCommand(args, os.Stdout)
+	_ = zapLog.Sync()
+	os.Exit(code)
+}
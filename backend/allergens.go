@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Dishes list the allergens they likely contain. They are inferred from the
+// dish's name and description during enhancement, unless
+// ALLERGEN_INFERENCE_ENABLED is false, each with the model's confidence
+// between 0 and 1; those below ALLERGEN_MIN_CONFIDENCE are dropped. Inferred
+// allergens are flagged as such: they are guidance for diners, never a
+// guarantee. A list set through the dish PATCH API confirms the dish's
+// allergens, even an empty one, and is kept when the dish is enhanced again.
+
+// allergens are the allergens dishes can list.
+var allergens = []string{"gluten", "dairy", "eggs", "peanuts", "tree_nuts", "soy", "fish", "shellfish", "sesame", "mustard", "celery", "sulphites"}
+
+// DishAllergen is an allergen a dish contains. Confidence is nil for
+// allergens set by hand.
+type DishAllergen struct {
+	DishID     string    `json:"dish_id" gorm:"primaryKey;type:uuid"`
+	Allergen   string    `json:"allergen" gorm:"primaryKey;type:varchar(20)"`
+	MenuID     string    `json:"menu_id" gorm:"type:uuid;index"`
+	Confidence *float64  `json:"confidence"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DishAllergenResponse is an allergen as returned with its dish.
+type DishAllergenResponse struct {
+	Allergen   string   `json:"allergen"`
+	Confidence *float64 `json:"confidence,omitempty"`
+	AIInferred bool     `json:"ai_inferred"`
+}
+
+func allergenInferenceEnabled() bool {
+	return getEnvBool("ALLERGEN_INFERENCE_ENABLED", true)
+}
+
+// detectAllergens infers the allergens of a dish whose allergens nobody has
+// confirmed and replaces its earlier inferred ones with them. Failures are
+// logged; the dish keeps its old allergens.
+func detectAllergens(ctx context.Context, dish Dish, description string) {
+	if !allergenInferenceEnabled() || dish.AllergensConfirmed {
+		return
+	}
+	found, err := inferAllergens(ctx, dish.MenuID, dish.Name, description)
+	if err != nil {
+		logFor(ctx).Warn("Failed to infer allergens", zap.String("dishID", dish.ID), zap.String("menuID", dish.MenuID), zap.Error(err))
+		return
+	}
+	for i := range found {
+		found[i].DishID = dish.ID
+		found[i].MenuID = dish.MenuID
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return replaceDishAllergens(tx, dish.ID, found)
+	})
+	if err != nil {
+		logFor(ctx).Error("Failed to store allergens", zap.String("dishID", dish.ID), zap.String("menuID", dish.MenuID), zap.Error(err))
+	}
+}
+
+// inferAllergens asks OpenAI which allergens a dish likely contains.
+func inferAllergens(ctx context.Context, menuID, dishName, description string) ([]DishAllergen, error) {
+	systemPrompt := "You identify allergens in restaurant dishes. From the dish name and description, list the allergens the dish as usually prepared contains, " +
+		"each with your confidence from 0 to 1 that it does. tree_nuts covers nuts other than peanuts; gluten covers wheat, barley, and rye."
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"allergens": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"allergen":   map[string]interface{}{"type": "string", "enum": allergens},
+						"confidence": map[string]interface{}{"type": "number"},
+					},
+					"required": []string{"allergen", "confidence"},
+				},
+			},
+		},
+		"required": []string{"allergens"},
+	}
+
+	var result struct {
+		Allergens []struct {
+			Allergen   string  `json:"allergen"`
+			Confidence float64 `json:"confidence"`
+		} `json:"allergens"`
+	}
+	if err := classifyDish(ctx, menuID, "allergens", systemPrompt, dishPrompt(dishName, description), schema, 200, &result); err != nil {
+		return nil, err
+	}
+
+	minConfidence := getEnvFloat("ALLERGEN_MIN_CONFIDENCE", 0.3)
+	var found []DishAllergen
+	for _, item := range result.Allergens {
+		allergen := strings.ToLower(strings.TrimSpace(item.Allergen))
+		confidence := min(max(item.Confidence, 0), 1)
+		if !slices.Contains(allergens, allergen) || confidence < minConfidence || slices.ContainsFunc(found, func(a DishAllergen) bool { return a.Allergen == allergen }) {
+			continue
+		}
+		found = append(found, DishAllergen{Allergen: allergen, Confidence: &confidence, CreatedAt: clock.Now()})
+	}
+	return found, nil
+}
+
+// replaceDishAllergens replaces the allergens of a dish in tx.
+func replaceDishAllergens(tx *gorm.DB, dishID string, dishAllergens []DishAllergen) error {
+	if err := tx.Where("dish_id = ?", dishID).Delete(&DishAllergen{}).Error; err != nil {
+		return err
+	}
+	if len(dishAllergens) == 0 {
+		return nil
+	}
+	return tx.Create(&dishAllergens).Error
+}
+
+// confirmedAllergens builds the allergens of a list set by hand, or returns
+// false if one is unknown.
+func confirmedAllergens(dish Dish, names []string) ([]DishAllergen, bool) {
+	var confirmed []DishAllergen
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(allergens, name) {
+			return nil, false
+		}
+		if slices.ContainsFunc(confirmed, func(a DishAllergen) bool { return a.Allergen == name }) {
+			continue
+		}
+		confirmed = append(confirmed, DishAllergen{DishID: dish.ID, Allergen: name, MenuID: dish.MenuID, CreatedAt: clock.Now()})
+	}
+	return confirmed, true
+}
+
+// attachDishAllergens loads the allergens of the menu's dishes for responses.
+func attachDishAllergens(menu *Menu) error {
+	var dishAllergens []DishAllergen
+	if err := db.Where("menu_id = ?", menu.ID).Order("allergen").Find(&dishAllergens).Error; err != nil {
+		return err
+	}
+
+	byDish := make(map[string][]DishAllergen)
+	for _, allergen := range dishAllergens {
+		byDish[allergen.DishID] = append(byDish[allergen.DishID], allergen)
+	}
+	for i := range menu.Dishes {
+		menu.Dishes[i].Allergens = byDish[menu.Dishes[i].ID]
+	}
+	return nil
+}
+
+func toAllergenResponses(dishAllergens []DishAllergen) []DishAllergenResponse {
+	if len(dishAllergens) == 0 {
+		return nil
+	}
+	responses := make([]DishAllergenResponse, len(dishAllergens))
+	for i, allergen := range dishAllergens {
+		responses[i] = DishAllergenResponse{
+			Allergen:   allergen.Allergen,
+			Confidence: allergen.Confidence,
+			AIInferred: allergen.Confidence != nil,
+		}
+	}
+	return responses
+}
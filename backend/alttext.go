@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dish images get alt text for screen readers, kept on the dish as
+// image_alt. It is the dish's name and the first sentence of its
+// description, written when enhancement or a description regeneration
+// generates them; owners can set their own with PATCH. Edits to the name or
+// description that do not set image_alt clear it, and a dish without one
+// gets it derived again wherever it is shown, so it never describes an old
+// version of the dish.
+
+// maxImageAltLength keeps alt text short enough to be read out whole.
+const maxImageAltLength = 150
+
+// dishImageAlt writes alt text for the image of a dish.
+func dishImageAlt(name string, description *string) string {
+	alt := strings.TrimSpace(name)
+	if description != nil {
+		if sentence := firstSentence(*description); sentence != "" {
+			alt += ": " + sentence
+		}
+	}
+	if utf8.RuneCountInString(alt) <= maxImageAltLength {
+		return alt
+	}
+
+	// Cut at the last word that fits
+	runes := []rune(alt)[:maxImageAltLength-1]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:") + "…"
+}
+
+// imageAltText is the dish's stored alt text, or one derived from its name
+// and description when it has none.
+func imageAltText(dish Dish) string {
+	if dish.ImageAlt != nil && *dish.ImageAlt != "" {
+		return *dish.ImageAlt
+	}
+	return dishImageAlt(dish.Name, dish.Description)
+}
+
+// dishImageAltIfAny is imageAltText for dishes with an image, and nil for
+// those without one.
+func dishImageAltIfAny(dish Dish) *string {
+	if dish.ImageURL == nil {
+		return nil
+	}
+	alt := imageAltText(dish)
+	return &alt
+}
+
+// firstSentence returns text up to the end of its first sentence: a . ! or
+// ? followed by a capitalized word, so abbreviations such as "e.g." do not
+// end it.
+func firstSentence(text string) string {
+	text = strings.TrimSpace(text)
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		end := i + utf8.RuneLen(r)
+		rest := strings.TrimLeft(text[end:], " \n")
+		if len(rest) == len(text[end:]) && rest != "" {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(rest); rest == "" || unicode.IsUpper(next) {
+			return text[:end]
+		}
+	}
+	return text
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// APIKey authenticates a client of the /api routes. Only a hash of the key
+// is stored; the key itself is shown once, when it is created or rotated.
+// After a rotation the previous key keeps working until PreviousExpiresAt,
+// so clients can be switched over without downtime.
+type APIKey struct {
+	ID                string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name              string     `json:"name"`
+	Prefix            string     `json:"prefix"`
+	Plan              string     `json:"plan" gorm:"default:'default'"`
+	MenusPerMonth     *int       `json:"menus_per_month"`
+	DishesPerMenu     *int       `json:"dishes_per_menu"`
+	RetentionDays     *int       `json:"retention_days"`
+	KeyHash           string     `json:"-" gorm:"uniqueIndex"`
+	PreviousKeyHash   *string    `json:"-" gorm:"index"`
+	PreviousExpiresAt *time.Time `json:"previous_expires_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	RotatedAt         *time.Time `json:"rotated_at"`
+	LastUsedAt        *time.Time `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at"`
+}
+
+type APIKeyCreateRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// Plan sets the key's quotas; see quotaPlan
+	Plan string `json:"plan" binding:"max=50"`
+}
+
+type APIKeyRotateRequest struct {
+	// GracePeriodMinutes keeps the old key valid for a while; 0 revokes it at
+	// once.
+	GracePeriodMinutes int `json:"grace_period_minutes" binding:"min=0,max=10080"`
+}
+
+// APIKeySecretResponse carries a newly issued key. This is the only time the
+// key itself is returned.
+type APIKeySecretResponse struct {
+	APIKey APIKey `json:"api_key"`
+	Key    string `json:"key"`
+}
+
+const (
+	apiKeyPrefix = "mgk_"
+	// apiKeyTouchInterval limits how often LastUsedAt is written, so busy
+	// clients do not cause a write per request.
+	apiKeyTouchInterval = time.Minute
+)
+
+// generateAPIKey returns a new key, its hash, and the prefix shown in
+// listings to tell keys apart.
+func generateAPIKey() (key, hash, prefix string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, hashAPIKey(key), key[:len(apiKeyPrefix)+6], nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeysRequired reports whether /api routes need a key. It is on unless
+// REQUIRE_API_KEY=false, which is meant for local development.
+func apiKeysRequired() bool {
+	return getEnvBool("REQUIRE_API_KEY", true)
+}
+
+// requireAPIKey protects the client API with a key sent as X-API-Key. The
+// api_key query parameter is accepted too, for clients that cannot set
+// headers, such as the browser's EventSource.
+func requireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !apiKeysRequired() {
+			c.Next()
+			return
+		}
+
+		provided := c.GetHeader("X-API-Key")
+		if provided == "" {
+			provided = c.Query("api_key")
+		}
+		if provided == "" {
+			respondError(c, http.StatusUnauthorized, "API_KEY_REQUIRED", "An API key is required (X-API-Key header)")
+			c.Abort()
+			return
+		}
+
+		key, err := lookupAPIKey(provided)
+		if err != nil {
+			respondError(c, http.StatusUnauthorized, "INVALID_API_KEY", "Invalid or revoked API key")
+			c.Abort()
+			return
+		}
+
+		c.Set("apiKey", key)
+		c.Next()
+	}
+}
+
+// currentAPIKeyID returns the ID of the API key the request was made with,
+// or "" when it had none.
+func currentAPIKeyID(c *gin.Context) string {
+	if key, ok := c.Get("apiKey"); ok {
+		return key.(*APIKey).ID
+	}
+	return ""
+}
+
+// lookupAPIKey finds the active key matching provided, including a rotated
+// key that is still within its grace period.
+func lookupAPIKey(provided string) (*APIKey, error) {
+	if !strings.HasPrefix(provided, apiKeyPrefix) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	hash := hashAPIKey(provided)
+	now := clock.Now()
+
+	var key APIKey
+	err := db.Where("revoked_at IS NULL").
+		Where("key_hash = ? OR (previous_key_hash = ? AND previous_expires_at > ?)", hash, hash, now).
+		First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := db.Model(&APIKey{}).Where("id = ?", key.ID).Update("last_used_at", now).Error; err != nil {
+			zapLog.Warn("Failed to record API key use", zap.String("apiKeyID", key.ID), zap.Error(err))
+		}
+		key.LastUsedAt = &now
+	}
+	return &key, nil
+}
+
+func listAPIKeysHandler(c *gin.Context) {
+	keys := []APIKey{}
+	if err := db.Order("created_at").Find(&keys).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load API keys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func createAPIKeyHandler(c *gin.Context) {
+	var req APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	key, secret, err := createAPIKey(strings.TrimSpace(req.Name), strings.TrimSpace(req.Plan))
+	if err != nil {
+		zapLog.Error("Failed to create API key", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create API key")
+		return
+	}
+
+	zapLog.Info("API key created", zap.String("apiKeyID", key.ID), zap.String("name", key.Name))
+	c.JSON(http.StatusCreated, APIKeySecretResponse{APIKey: *key, Key: secret})
+}
+
+func createAPIKey(name, plan string) (*APIKey, string, error) {
+	if plan == "" {
+		plan = defaultQuotaPlan
+	}
+	secret, hash, prefix, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := APIKey{
+		ID:        idGen.NewID(),
+		Name:      name,
+		Plan:      plan,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		CreatedAt: clock.Now(),
+	}
+	if err := db.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+	return &key, secret, nil
+}
+
+// rotateAPIKeyHandler issues a new key for the same client. The old key stops
+// working at once, or after the requested grace period.
+func rotateAPIKeyHandler(c *gin.Context) {
+	key, ok := loadAPIKey(c)
+	if !ok {
+		return
+	}
+	if key.RevokedAt != nil {
+		respondError(c, http.StatusConflict, "API_KEY_REVOKED", "A revoked API key cannot be rotated")
+		return
+	}
+
+	var req APIKeyRotateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	secret, hash, prefix, err := generateAPIKey()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate API key")
+		return
+	}
+
+	now := clock.Now()
+	updates := map[string]interface{}{
+		"key_hash":            hash,
+		"prefix":              prefix,
+		"rotated_at":          now,
+		"previous_key_hash":   nil,
+		"previous_expires_at": nil,
+	}
+	if req.GracePeriodMinutes > 0 {
+		updates["previous_key_hash"] = key.KeyHash
+		updates["previous_expires_at"] = now.Add(time.Duration(req.GracePeriodMinutes) * time.Minute)
+	}
+	if err := db.Model(&APIKey{}).Where("id = ?", key.ID).Updates(updates).Error; err != nil {
+		zapLog.Error("Failed to rotate API key", zap.String("apiKeyID", key.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to rotate API key")
+		return
+	}
+
+	if err := db.Where("id = ?", key.ID).First(key).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load API key")
+		return
+	}
+	zapLog.Info("API key rotated", zap.String("apiKeyID", key.ID), zap.Int("gracePeriodMinutes", req.GracePeriodMinutes))
+	c.JSON(http.StatusOK, APIKeySecretResponse{APIKey: *key, Key: secret})
+}
+
+// revokeAPIKeyHandler disables a key for good, including any rotated key
+// still in its grace period. Revoked keys stay listed for auditing.
+func revokeAPIKeyHandler(c *gin.Context) {
+	key, ok := loadAPIKey(c)
+	if !ok {
+		return
+	}
+
+	if key.RevokedAt == nil {
+		now := clock.Now()
+		if err := db.Model(&APIKey{}).Where("id = ?", key.ID).Update("revoked_at", now).Error; err != nil {
+			zapLog.Error("Failed to revoke API key", zap.String("apiKeyID", key.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to revoke API key")
+			return
+		}
+		key.RevokedAt = &now
+		zapLog.Info("API key revoked", zap.String("apiKeyID", key.ID))
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+func loadAPIKey(c *gin.Context) (*APIKey, bool) {
+	var key APIKey
+	if err := db.Where("id = ?", c.Param("id")).First(&key).Error; err != nil {
+		respondError(c, http.StatusNotFound, "API_KEY_NOT_FOUND", "API key not found")
+		return nil, false
+	}
+	return &key, true
+}
+
+// createAPIKeyCommand issues a key from the command line, e.g. the first key
+// of a new deployment.
+func createAPIKeyCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("create-api-key", out)
+	name := flags.String("name", "", "what the key is for, e.g. frontend")
+	plan := flags.String("plan", defaultQuotaPlan, "quota plan of the key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*name) == "" {
+		flags.Usage()
+		return errors.New("-name is required")
+	}
+
+	key, secret, err := createAPIKey(strings.TrimSpace(*name), strings.TrimSpace(*plan))
+	if err != nil {
+		return fmt.Errorf("create API key: %w", err)
+	}
+	fmt.Fprintf(out, "created API key %s (%s)\n%s\n", key.ID, key.Name, secret)
+	return nil
+}
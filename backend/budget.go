@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errBudgetExceeded is returned (and used as the cancellation cause) once a
+// menu has made more outbound provider requests than it is allowed to.
+var errBudgetExceeded = errors.New("outbound request budget exceeded")
+
+// maxProviderCallsPerMenu caps the OpenAI/Replicate requests a single
+// processing run of a menu may make, guarding against runaway retries or
+// model loops. A regeneration outside a run counts as a run of its own.
+func maxProviderCallsPerMenu() int {
+	return getEnvInt("MAX_PROVIDER_CALLS_PER_MENU", 1000)
+}
+
+// resetProviderBudget starts the menu's request budget over as a new run
+// begins, so that a menu resumed or regenerated many times is not failed for
+// the calls of the runs before.
+func resetProviderBudget(menuID string) {
+	if err := db.Model(&Menu{}).Where("id = ?", menuID).Update("provider_calls", 0).Error; err != nil {
+		zapLog.Warn("Failed to reset provider call budget", zap.String("menuID", menuID), zap.Error(err))
+	}
+}
+
+// chargeProviderCall records one outbound request against the menu's budget.
+func chargeProviderCall(ctx context.Context, menuID string) error {
+	var calls int
+	if err := db.WithContext(ctx).Raw("UPDATE menus SET provider_calls = provider_calls + 1 WHERE id = ? RETURNING provider_calls", menuID).
+		Scan(&calls).Error; err != nil {
+		return fmt.Errorf("failed to record provider call: %w", err)
+	}
+
+	if limit := maxProviderCallsPerMenu(); limit > 0 && calls > limit {
+		return fmt.Errorf("%w: %d calls, limit %d", errBudgetExceeded, calls, limit)
+	}
+	return nil
+}
+
+// callProvider performs an outbound provider request on behalf of a menu,
+// charging every attempt against the menu's request budget first and
+// retrying transient failures as loadProviderRetryPolicy says. Calls wait
+// while the provider's rate limits are nearly used up (see providerLimits).
+// Exceeding the request budget or the deployment's spend budget aborts the
+// menu's processing. The request is not made, or is cut off, once its
+// context is cancelled. Demo mode and replays answer it instead (see
+// sendProviderRequest).
+func callProvider(menuID string, client *http.Client, req *http.Request) (*http.Response, error) {
+	policy := loadProviderRetryPolicy()
+	for attempt := 1; ; attempt++ {
+		if err := providerLimits.wait(req.Context(), req.URL.Host); err != nil {
+			return nil, err
+		}
+		err := checkSpendBudget(0)
+		if err == nil {
+			err = chargeProviderCall(req.Context(), menuID)
+		}
+		if err != nil {
+			if errors.Is(err, errBudgetExceeded) && processingJobs.abort(menuID, err) {
+				zapLog.Warn("Aborting menu processing", zap.String("menuID", menuID), zap.Error(err))
+			}
+			return nil, err
+		}
+
+		resp, err := sendProviderRequest(client, req)
+		providerLimits.observe(req.URL.Host, resp)
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+		delay, retry := policy.retryDelay(attempt, resp, err)
+		if !retry {
+			return resp, err
+		}
+		next, ok := rewindRequest(req)
+		if !ok {
+			return resp, err
+		}
+
+		fields := []zap.Field{zap.String("menuID", menuID), zap.String("host", req.URL.Host), zap.Int("attempt", attempt), zap.Duration("delay", delay)}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		} else {
+			fields = append(fields, zap.Int("status", resp.StatusCode))
+		}
+		logFor(req.Context()).Warn("Retrying provider request", fields...)
+		discardResponse(resp)
+
+		select {
+		case <-req.Context().Done():
+			return nil, context.Cause(req.Context())
+		case <-time.After(delay):
+		}
+		req = next
+	}
+}
+
+// sendProviderRequest sends one attempt of a provider request, unless demo
+// mode or a replay answers it instead. Sent requests are recorded when
+// PROVIDER_RECORD_DIR is set.
+func sendProviderRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	if demoMode() {
+		return demoProviderResponse(req)
+	}
+	if dir := providerReplayDir(); dir != "" {
+		return replayProviderCall(dir, req)
+	}
+	if dir := providerRecordDir(); dir != "" {
+		return recordProviderCall(dir, client, req)
+	}
+	return client.Do(req)
+}
+
+// spendBudget caps the estimated provider spend (see ProviderUsage) of a UTC
+// day or month, set in dollars by SPEND_BUDGET_DAILY_USD and
+// SPEND_BUDGET_MONTHLY_USD.
+type spendBudget struct {
+	Period      string
+	LimitMicros int64
+	Start       time.Time
+	ResetsAt    time.Time
+}
+
+func spendBudgets(now time.Time) []spendBudget {
+	now = now.UTC()
+	var budgets []spendBudget
+	if limit := getEnvFloat("SPEND_BUDGET_DAILY_USD", 0); limit > 0 {
+		start := now.Truncate(24 * time.Hour)
+		budgets = append(budgets, spendBudget{Period: "daily", LimitMicros: int64(limit * 1e6), Start: start, ResetsAt: start.AddDate(0, 0, 1)})
+	}
+	if limit := getEnvFloat("SPEND_BUDGET_MONTHLY_USD", 0); limit > 0 {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		budgets = append(budgets, spendBudget{Period: "monthly", LimitMicros: int64(limit * 1e6), Start: start, ResetsAt: start.AddDate(0, 1, 0)})
+	}
+	return budgets
+}
+
+// spendBudgetError stops new work once spend, plus what the work is
+// projected to cost, would pass a budget. It wraps errBudgetExceeded, so
+// aborted menus fail with BUDGET_EXCEEDED like ones over their request budget.
+type spendBudgetError struct {
+	Budget      spendBudget
+	SpentMicros int64
+}
+
+func (e *spendBudgetError) Error() string {
+	return fmt.Sprintf("%s spend budget of $%.2f is used up ($%.2f spent so far); menu processing is paused until %s",
+		e.Budget.Period, float64(e.Budget.LimitMicros)/1e6, float64(e.SpentMicros)/1e6, e.Budget.ResetsAt.Format(time.RFC3339))
+}
+
+func (e *spendBudgetError) Unwrap() error { return errBudgetExceeded }
+
+// checkSpendBudget fails when the spend of any budget period plus
+// projectedMicros would pass its limit.
+func checkSpendBudget(projectedMicros int64) error {
+	for _, budget := range spendBudgets(clock.Now()) {
+		spent, err := spendTracker.since(budget.Start)
+		if err != nil {
+			// Spend accounting is best effort; an outage should not stop menus
+			zapLog.Warn("Failed to check spend budget", zap.String("period", budget.Period), zap.Error(err))
+			continue
+		}
+		if spent+projectedMicros > budget.LimitMicros || spent >= budget.LimitMicros {
+			return &spendBudgetError{Budget: budget, SpentMicros: spent}
+		}
+	}
+	return nil
+}
+
+// projectedMenuCostMicros estimates what a new menu will cost: the average
+// spend per menu over the last 30 days.
+func projectedMenuCostMicros() int64 {
+	if len(spendBudgets(clock.Now())) == 0 {
+		return 0
+	}
+	average, err := spendTracker.averageMenuCost()
+	if err != nil {
+		zapLog.Warn("Failed to estimate menu cost", zap.Error(err))
+		return 0
+	}
+	return average
+}
+
+// spendCache keeps spend totals for SPEND_BUDGET_CHECK_INTERVAL (default
+// 30s), so budget checks on every provider request stay cheap. Budgets can
+// be overshot by what is spent in that window.
+type spendCache struct {
+	mu      sync.Mutex
+	entries map[string]spendCacheEntry
+}
+
+type spendCacheEntry struct {
+	micros    int64
+	fetchedAt time.Time
+}
+
+var spendTracker = &spendCache{entries: make(map[string]spendCacheEntry)}
+
+func (s *spendCache) since(start time.Time) (int64, error) {
+	return s.get("since:"+start.Format(time.RFC3339), func() (int64, error) {
+		var micros int64
+		err := db.Model(&ProviderUsage{}).
+			Select("COALESCE(SUM(estimated_cost_micros), 0)").
+			Where("created_at >= ?", start).
+			Scan(&micros).Error
+		return micros, err
+	})
+}
+
+func (s *spendCache) averageMenuCost() (int64, error) {
+	return s.get("average-menu", func() (int64, error) {
+		var micros float64
+		err := db.Raw(`SELECT COALESCE(AVG(cost), 0) FROM (
+			SELECT SUM(estimated_cost_micros) AS cost FROM provider_usages
+			WHERE created_at >= ? GROUP BY menu_id) AS menus`, clock.Now().AddDate(0, 0, -30)).
+			Scan(&micros).Error
+		return int64(micros), err
+	})
+}
+
+func (s *spendCache) get(key string, load func() (int64, error)) (int64, error) {
+	now := clock.Now()
+	ttl := getEnvDuration("SPEND_BUDGET_CHECK_INTERVAL", 30*time.Second)
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	s.mu.Unlock()
+	if ok && now.Sub(entry.fetchedAt) < ttl {
+		return entry.micros, nil
+	}
+
+	micros, err := load()
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Old periods are never asked for again
+	if len(s.entries) > 100 {
+		s.entries = make(map[string]spendCacheEntry)
+	}
+	s.entries[key] = spendCacheEntry{micros: micros, fetchedAt: now}
+	return micros, nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Operators clear up stuck and failed work across all menus through the
+// admin API, as `admin requeue-stuck` does from the command line. Requeued
+// menus and retried dishes are processed on the replica that answers, in the
+// background, and show up in its /api/admin/jobs. Menus that replica is
+// already processing are left alone.
+
+// AdminMenuSummary is a menu as listed to operators.
+type AdminMenuSummary struct {
+	MenuSummary
+	Priority    string    `json:"priority"`
+	FailureCode *string   `json:"failure_code"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BulkMenusRequest picks the stuck menus a bulk action applies to.
+type BulkMenusRequest struct {
+	OlderThanMinutes int  `json:"older_than_minutes" binding:"omitempty,min=1"`
+	DryRun           bool `json:"dry_run"`
+}
+
+// BulkDishRetryRequest picks the failed dishes to retry. Without menu_ids,
+// FAILED dishes of any COMPLETE menu are retried, up to limit menus.
+type BulkDishRetryRequest struct {
+	MenuIDs     []string `json:"menu_ids" binding:"omitempty,max=1000,dive,uuid"`
+	FailureCode string   `json:"failure_code" binding:"omitempty,max=50"`
+	Limit       int      `json:"limit" binding:"omitempty,min=1,max=1000"`
+	DryRun      bool     `json:"dry_run"`
+}
+
+// BulkMenuAction is what a bulk action did, or would do, to one menu.
+type BulkMenuAction struct {
+	MenuID string `json:"menu_id"`
+	Status string `json:"status"`
+	Action string `json:"action"`
+	Dishes int    `json:"dishes"`
+}
+
+// BulkActionResponse lists the menus a bulk action touched.
+type BulkActionResponse struct {
+	Menus  []BulkMenuAction `json:"menus"`
+	DryRun bool             `json:"dry_run"`
+}
+
+const (
+	BulkActionResume = "resume"
+	BulkActionFail   = "fail"
+	BulkActionRetry  = "retry"
+)
+
+// defaultStuckAge is how long a menu must have gone without an update to
+// count as stuck, unless the request says otherwise.
+const defaultStuckAge = 30 * time.Minute
+
+// stuckMenus returns the PENDING and PROCESSING menus not updated for
+// olderThan, oldest first.
+func stuckMenus(olderThan time.Duration) ([]Menu, error) {
+	var menus []Menu
+	cutoff := clock.Now().Add(-olderThan)
+	err := db.Where("status IN ? AND updated_at < ?", []string{"PENDING", "PROCESSING"}, cutoff).Order("created_at").Find(&menus).Error
+	return menus, err
+}
+
+// forceFailMenu stops the menu's processing on this replica and fails it
+// and its unfinished dishes with CANCELLED.
+func forceFailMenu(menuID string) error {
+	if processingJobs.cancel(menuID) {
+		zapLog.Info("Cancelled in-flight menu processing", zap.String("menuID", menuID))
+	}
+	if err := db.Model(&Dish{}).Where("menu_id = ? AND status IN ?", menuID, []string{"PENDING", "PROCESSING"}).Updates(map[string]interface{}{
+		"status":         "FAILED",
+		"failure_code":   "CANCELLED",
+		"failure_reason": "An operator stopped the menu's processing",
+		"updated_at":     clock.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	failMenuWithCode(menuID, "CANCELLED", "An operator stopped processing; please upload the menu again")
+	return nil
+}
+
+// resumeInBackground resumes the menu's processing without waiting for it.
+func resumeInBackground(menu Menu) {
+	go func() {
+		if err := resumeMenuProcessing(&menu); err != nil {
+			zapLog.Error("Failed to resume menu", zap.String("menuID", menu.ID), zap.Error(err))
+		}
+	}()
+}
+
+func listAdminMenusHandler(c *gin.Context) {
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			respondFieldError(c, "limit", "min", "limit must be a positive number")
+			return
+		}
+		limit = min(parsed, 500)
+	}
+
+	query := db.Order("created_at DESC, id DESC").Limit(limit + 1)
+	if token := c.Query("page_token"); token != "" {
+		createdAt, id, err := decodeMenuPageToken(token)
+		if err != nil {
+			respondFieldError(c, "page_token", "format", "invalid page_token")
+			return
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if value := c.Query("older_than_minutes"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 1 {
+			respondFieldError(c, "older_than_minutes", "min", "older_than_minutes must be a positive number")
+			return
+		}
+		query = query.Where("updated_at < ?", clock.Now().Add(-time.Duration(minutes)*time.Minute))
+	}
+
+	var menus []Menu
+	if err := query.Find(&menus).Error; err != nil {
+		zapLog.Error("Failed to list menus", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list menus")
+		return
+	}
+
+	nextPageToken := ""
+	if len(menus) > limit {
+		menus = menus[:limit]
+		last := menus[len(menus)-1]
+		nextPageToken = encodeMenuPageToken(last.CreatedAt, last.ID)
+	}
+	summaries := make([]AdminMenuSummary, len(menus))
+	for i, menu := range menus {
+		summaries[i] = AdminMenuSummary{
+			MenuSummary: toMenuSummary(menu),
+			Priority:    menu.Priority,
+			FailureCode: menu.FailureCode,
+			UpdatedAt:   menu.UpdatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"menus": summaries, "next_page_token": nextPageToken})
+}
+
+// bindBulkMenus reads a BulkMenusRequest and loads the stuck menus it picks,
+// leaving out those this replica is processing.
+func bindBulkMenus(c *gin.Context) (*BulkMenusRequest, []Menu, bool) {
+	var req BulkMenusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return nil, nil, false
+	}
+	olderThan := defaultStuckAge
+	if req.OlderThanMinutes > 0 {
+		olderThan = time.Duration(req.OlderThanMinutes) * time.Minute
+	}
+
+	menus, err := stuckMenus(olderThan)
+	if err != nil {
+		zapLog.Error("Failed to load stuck menus", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load stuck menus")
+		return nil, nil, false
+	}
+	stuck := menus[:0]
+	for _, menu := range menus {
+		if !processingJobs.running(menu.ID) {
+			stuck = append(stuck, menu)
+		}
+	}
+	return &req, stuck, true
+}
+
+// requeueStuckMenusHandler resumes stuck menus whose dishes were extracted
+// and fails the others with INTERRUPTED, like `admin requeue-stuck`.
+func requeueStuckMenusHandler(c *gin.Context) {
+	req, menus, ok := bindBulkMenus(c)
+	if !ok {
+		return
+	}
+
+	response := BulkActionResponse{Menus: make([]BulkMenuAction, 0, len(menus)), DryRun: req.DryRun}
+	for _, menu := range menus {
+		action := BulkMenuAction{MenuID: menu.ID, Status: menu.Status, Action: BulkActionResume, Dishes: menu.TotalDishes - menu.ProcessedDishes}
+		if menu.TotalDishes == 0 {
+			action.Action = BulkActionFail
+		}
+		response.Menus = append(response.Menus, action)
+		if req.DryRun {
+			continue
+		}
+		if action.Action == BulkActionFail {
+			failMenuWithCode(menu.ID, "INTERRUPTED", "Processing was interrupted before the menu was read; please upload it again")
+		} else {
+			resumeInBackground(menu)
+		}
+	}
+
+	zapLog.Info("Requeued stuck menus", zap.Int("menus", len(menus)), zap.Bool("dryRun", req.DryRun))
+	c.JSON(http.StatusOK, response)
+}
+
+// failStuckMenusHandler fails stuck menus and their unfinished dishes.
+func failStuckMenusHandler(c *gin.Context) {
+	req, menus, ok := bindBulkMenus(c)
+	if !ok {
+		return
+	}
+
+	response := BulkActionResponse{Menus: make([]BulkMenuAction, 0, len(menus)), DryRun: req.DryRun}
+	for _, menu := range menus {
+		response.Menus = append(response.Menus, BulkMenuAction{MenuID: menu.ID, Status: menu.Status, Action: BulkActionFail, Dishes: menu.TotalDishes - menu.ProcessedDishes})
+		if req.DryRun {
+			continue
+		}
+		if err := forceFailMenu(menu.ID); err != nil {
+			zapLog.Error("Failed to fail stuck menu", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fail stuck menus")
+			return
+		}
+	}
+
+	zapLog.Info("Failed stuck menus", zap.Int("menus", len(menus)), zap.Bool("dryRun", req.DryRun))
+	c.JSON(http.StatusOK, response)
+}
+
+// retryFailedDishesHandler sets FAILED dishes of COMPLETE menus back to
+// PENDING and processes them again. The menus stay COMPLETE, so their share
+// links keep serving what was published; the retried dishes are an edit,
+// landing in the menu's draft.
+func retryFailedDishesHandler(c *gin.Context) {
+	var req BulkDishRetryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 100
+	}
+
+	dishFilter := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("dishes.status = ?", "FAILED")
+		if req.FailureCode != "" {
+			tx = tx.Where("dishes.failure_code = ?", req.FailureCode)
+		}
+		return tx
+	}
+
+	var targets []struct {
+		MenuID string
+		Dishes int
+	}
+	query := dishFilter(db.Table("dishes").
+		Select("dishes.menu_id, COUNT(*) AS dishes").
+		Joins("JOIN menus ON menus.id = dishes.menu_id").
+		Where("menus.status = ?", "COMPLETE"))
+	if len(req.MenuIDs) > 0 {
+		query = query.Where("dishes.menu_id IN ?", req.MenuIDs)
+	}
+	if err := query.Group("dishes.menu_id").Order("dishes.menu_id").Limit(limit).Scan(&targets).Error; err != nil {
+		zapLog.Error("Failed to load failed dishes", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load failed dishes")
+		return
+	}
+
+	response := BulkActionResponse{Menus: make([]BulkMenuAction, 0, len(targets)), DryRun: req.DryRun}
+	for _, target := range targets {
+		if processingJobs.running(target.MenuID) {
+			continue
+		}
+		response.Menus = append(response.Menus, BulkMenuAction{MenuID: target.MenuID, Status: "COMPLETE", Action: BulkActionRetry, Dishes: target.Dishes})
+		if req.DryRun {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := beginMenuEdit(tx, target.MenuID, "retry-failed"); err != nil {
+				return err
+			}
+			if err := dishFilter(tx.Model(&Dish{}).Where("menu_id = ?", target.MenuID)).Updates(map[string]interface{}{
+				"status":         "PENDING",
+				"failure_code":   nil,
+				"failure_reason": nil,
+				"updated_at":     clock.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			return touchMenu(tx, target.MenuID)
+		})
+		if err != nil {
+			zapLog.Error("Failed to retry dishes", zap.String("menuID", target.MenuID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to retry failed dishes")
+			return
+		}
+		go retryMenuDishes(target.MenuID)
+	}
+
+	zapLog.Info("Retrying failed dishes", zap.Int("menus", len(response.Menus)), zap.Bool("dryRun", req.DryRun))
+	c.JSON(http.StatusOK, response)
+}
+
+// retryMenuDishes processes the PENDING dishes of a COMPLETE menu, leaving
+// the menu's status alone. Dishes that a stopped retry did not get to are
+// failed again, with the reason it stopped, so they can be retried later.
+func retryMenuDishes(menuID string) {
+	ctx, token := processingJobs.start(menuID)
+	defer processingJobs.finish(menuID, token)
+	resetProviderBudget(menuID)
+	ctx, cancel := withProcessingDeadline(ctx)
+	defer cancel()
+
+	var dishes []Dish
+	if err := db.Select("id", "section_id").Where("menu_id = ? AND status = ?", menuID, "PENDING").Order("position").Find(&dishes).Error; err != nil {
+		zapLog.Error("Failed to load dishes to retry", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+	dishIDs := make([]string, len(dishes))
+	dishSections := make(map[string]string, len(dishes))
+	for i, dish := range dishes {
+		dishIDs[i] = dish.ID
+		if dish.SectionID != nil {
+			dishSections[dish.ID] = *dish.SectionID
+		}
+	}
+
+	enhanceMenuDishes(ctx, menuID, dishIDs, dishSections)
+	if ctx.Err() == nil {
+		return
+	}
+
+	code, reason := "CANCELLED", "An operator stopped the menu's processing"
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errBudgetExceeded):
+		code, reason = "BUDGET_EXCEEDED", cause.Error()
+	case errors.Is(cause, errProcessingDeadline):
+		code, reason = "DEADLINE_EXCEEDED", "The menu's processing deadline passed before the dish was enhanced"
+	case errors.Is(cause, errShuttingDown):
+		code, reason = "INTERRUPTED", "The server stopped before the dish was enhanced"
+	}
+	if err := db.Model(&Dish{}).Where("id IN ? AND status IN ?", dishIDs, []string{"PENDING", "PROCESSING"}).Updates(map[string]interface{}{
+		"status":         "FAILED",
+		"failure_code":   code,
+		"failure_reason": reason,
+		"updated_at":     clock.Now(),
+	}).Error; err != nil {
+		zapLog.Error("Failed to fail unfinished retried dishes", zap.String("menuID", menuID), zap.Error(err))
+	}
+	if err := refreshProgress(menuID, ""); err != nil {
+		zapLog.Error("Failed to update progress", zap.String("menuID", menuID), zap.Error(err))
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Every dish extracted from a menu is linked to a catalog entry keyed by its
+// canonical name and detected cuisine, so that the "Margherita Pizza" of
+// every menu is one catalog dish. Operators correct a catalog dish once
+// through the admin API: its description and image are used for new dishes
+// linked to it instead of generating them, and are copied onto the linked
+// dishes that their owners have not edited, in each menu's draft revision
+// so that owners publish the change as they would their own edits. The
+// catalog is also where shared translations and nutrition data belong once
+// dishes have them. `admin link-catalog` links dishes extracted before the
+// catalog existed.
+
+// CatalogDish is the canonical record of a dish shared by menus.
+type CatalogDish struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid"`
+	Name        string    `json:"name" gorm:"type:varchar(200);uniqueIndex:idx_catalog_dishes_name_cuisine"`
+	Cuisine     string    `json:"cuisine" gorm:"type:varchar(50);uniqueIndex:idx_catalog_dishes_name_cuisine"`
+	DisplayName string    `json:"display_name"`
+	Description *string   `json:"description"`
+	ImageURL    *string   `json:"image_url"`
+	DishCount   int64     `json:"dish_count" gorm:"->;-:migration"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CatalogDishUpdateRequest corrects a catalog dish. Empty strings clear the
+// curated value, so new dishes are generated again; dishes that already
+// copied it keep it.
+type CatalogDishUpdateRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=200"`
+	Description *string `json:"description" binding:"omitempty,max=2000"`
+	ImageURL    *string `json:"image_url" binding:"omitempty,max=2048"`
+}
+
+// CatalogDishUpdateResponse is the corrected catalog dish and how many
+// linked dishes, and the menus they are on, took the correction.
+type CatalogDishUpdateResponse struct {
+	Dish          CatalogDish `json:"dish"`
+	DishesUpdated int64       `json:"dishes_updated"`
+	MenusUpdated  int         `json:"menus_updated"`
+}
+
+// canonicalDishName reduces a dish name to its lowercase words, so that
+// "Margherita Pizza" and "margherita  pizza." are the same dish. Names too
+// long to key on give "".
+func canonicalDishName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	normalized := strings.Join(words, " ")
+	if len(normalized) > 200 {
+		return ""
+	}
+	return normalized
+}
+
+// catalogKey is the canonical name and cuisine a dish name is cataloged
+// under; the name is "" for names that are not.
+func catalogKey(dishName string) (string, string) {
+	cuisine := ""
+	if hint := detectCuisine(dishName); hint != nil {
+		cuisine = hint.Cuisine
+	}
+	return canonicalDishName(dishName), cuisine
+}
+
+// linkCatalogDish returns the ID of the catalog dish for a dish name,
+// creating the entry on first sight. Names that cannot be cataloged give nil.
+func linkCatalogDish(tx *gorm.DB, dishName string) (*string, error) {
+	name, cuisine := catalogKey(dishName)
+	if name == "" {
+		return nil, nil
+	}
+
+	now := clock.Now()
+	entry := CatalogDish{
+		ID:          idGen.NewID(),
+		Name:        name,
+		Cuisine:     cuisine,
+		DisplayName: strings.TrimSpace(dishName),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}, {Name: "cuisine"}},
+		DoNothing: true,
+	}).Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Select("id").Where("name = ? AND cuisine = ?", name, cuisine).Take(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry.ID, nil
+}
+
+// curatedCatalogDish returns the catalog dish for a dish name, or nil when
+// there is none or it cannot be loaded.
+func curatedCatalogDish(ctx context.Context, dishName string) *CatalogDish {
+	name, cuisine := catalogKey(dishName)
+	if name == "" {
+		return nil
+	}
+	var entry CatalogDish
+	if err := db.WithContext(ctx).Where("name = ? AND cuisine = ?", name, cuisine).Take(&entry).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logFor(ctx).Warn("Failed to load catalog dish", zap.String("dish", dishName), zap.Error(err))
+		}
+		return nil
+	}
+	return &entry
+}
+
+// catalogRecord is the generation record of content copied from a catalog
+// dish rather than generated.
+func catalogRecord(entry *CatalogDish) *GenerationRecord {
+	return &GenerationRecord{
+		Provider:    "catalog",
+		Parameters:  map[string]interface{}{"catalog_dish_id": entry.ID},
+		GeneratedAt: clock.Now(),
+	}
+}
+
+func listCatalogHandler(c *gin.Context) {
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			respondFieldError(c, "limit", "min", "limit must be a positive number")
+			return
+		}
+		limit = min(parsed, 500)
+	}
+
+	query := catalogQuery().Order("dish_count DESC, catalog_dishes.name").Limit(limit)
+	if q := canonicalDishName(c.Query("q")); q != "" {
+		query = query.Where("catalog_dishes.name LIKE ?", "%"+q+"%")
+	}
+	if cuisine := c.Query("cuisine"); cuisine != "" {
+		query = query.Where("catalog_dishes.cuisine = ?", cuisine)
+	}
+
+	dishes := []CatalogDish{}
+	if err := query.Find(&dishes).Error; err != nil {
+		zapLog.Error("Failed to list catalog dishes", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list catalog dishes")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dishes": dishes})
+}
+
+func getCatalogDishHandler(c *gin.Context) {
+	entry, ok := loadCatalogDish(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// updateCatalogDishHandler corrects a catalog dish and copies the
+// correction onto its linked dishes that were not edited by hand.
+func updateCatalogDishHandler(c *gin.Context) {
+	entry, ok := loadCatalogDish(c)
+	if !ok {
+		return
+	}
+
+	var req CatalogDishUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	dishUpdates := map[string]interface{}{}
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if displayName == "" {
+			respondFieldError(c, "display_name", "required", "display_name must not be empty")
+			return
+		}
+		updates["display_name"] = displayName
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if description == "" {
+			updates["description"] = nil
+		} else {
+			updates["description"] = description
+			dishUpdates["description"] = description
+			dishUpdates["image_alt"] = nil
+		}
+	}
+	if req.ImageURL != nil {
+		imageURL := strings.TrimSpace(*req.ImageURL)
+		if imageURL == "" {
+			updates["image_url"] = nil
+		} else {
+			parsed, err := url.Parse(imageURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				respondFieldError(c, "image_url", "url", "image_url must be an absolute http(s) URL")
+				return
+			}
+			updates["image_url"] = imageURL
+			dishUpdates["image_url"] = imageURL
+		}
+	}
+	if len(updates) == 0 {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "No fields to update")
+		return
+	}
+
+	now := clock.Now()
+	updates["updated_at"] = now
+	if err := db.Model(&CatalogDish{}).Where("id = ?", entry.ID).Updates(updates).Error; err != nil {
+		zapLog.Error("Failed to update catalog dish", zap.String("catalogDishID", entry.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update catalog dish")
+		return
+	}
+
+	response := CatalogDishUpdateResponse{}
+	if len(dishUpdates) > 0 {
+		dishUpdates["updated_at"] = now
+		dishes, menus, err := propagateCatalogDish(entry.ID, dishUpdates)
+		if err != nil {
+			zapLog.Error("Failed to update dishes from catalog", zap.String("catalogDishID", entry.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update linked dishes")
+			return
+		}
+		response.DishesUpdated, response.MenusUpdated = dishes, menus
+	}
+
+	if err := catalogQuery().Where("catalog_dishes.id = ?", entry.ID).Take(&response.Dish).Error; err != nil {
+		zapLog.Error("Failed to reload catalog dish", zap.String("catalogDishID", entry.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load catalog dish")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// propagateCatalogDish applies updates to the completed dishes linked to a
+// catalog dish that their owners have not edited, one menu at a time, and
+// returns how many dishes and menus changed.
+func propagateCatalogDish(catalogDishID string, updates map[string]interface{}) (int64, int, error) {
+	var menuIDs []string
+	if err := db.Model(&Dish{}).Distinct("menu_id").
+		Where("catalog_dish_id = ? AND edited_by_user = ? AND status = ?", catalogDishID, false, "COMPLETE").
+		Pluck("menu_id", &menuIDs).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var dishesUpdated int64
+	menusUpdated := 0
+	for _, menuID := range menuIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := beginMenuEdit(tx, menuID, "catalog-correction"); err != nil {
+				return err
+			}
+			scope := tx.Model(&Dish{}).Where("menu_id = ? AND catalog_dish_id = ? AND edited_by_user = ? AND status = ?",
+				menuID, catalogDishID, false, "COMPLETE")
+			if _, ok := updates["image_url"]; ok {
+				var dishIDs []string
+				if err := scope.Session(&gorm.Session{}).Pluck("id", &dishIDs).Error; err != nil {
+					return err
+				}
+				// The catalog image replaces whichever generated candidate was active
+				if err := tx.Model(&DishImage{}).Where("dish_id IN ?", dishIDs).Update("active", false).Error; err != nil {
+					return err
+				}
+			}
+			result := scope.Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			dishesUpdated += result.RowsAffected
+			return touchMenu(tx, menuID)
+		})
+		if err != nil {
+			return dishesUpdated, menusUpdated, err
+		}
+		menusUpdated++
+	}
+	return dishesUpdated, menusUpdated, nil
+}
+
+// catalogQuery selects catalog dishes with how many dishes link to each.
+func catalogQuery() *gorm.DB {
+	return db.Model(&CatalogDish{}).Select("catalog_dishes.*, " +
+		"(SELECT COUNT(*) FROM dishes WHERE dishes.catalog_dish_id = catalog_dishes.id) AS dish_count")
+}
+
+func loadCatalogDish(c *gin.Context) (*CatalogDish, bool) {
+	var entry CatalogDish
+	if err := catalogQuery().Where("catalog_dishes.id = ?", c.Param("id")).Take(&entry).Error; err != nil {
+		respondError(c, http.StatusNotFound, "CATALOG_DISH_NOT_FOUND", "Catalog dish not found")
+		return nil, false
+	}
+	return &entry, true
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Clock abstracts the current time so timestamps can be controlled in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator abstracts record ID creation so IDs can be predicted in tests.
+type IDGenerator interface {
+	NewID() string
+}
+
+// clock and idGen are used for every timestamp and ID the service creates,
+// including the ones GORM fills in. Tests may swap them before exercising
+// handlers.
+var (
+	clock Clock       = systemClock{}
+	idGen IDGenerator = uuidGenerator{}
+)
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string { return uuid.New().String() }
+
+// FixedClock is a Clock that only moves when told to.
+type FixedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFixedClock(now time.Time) *FixedClock {
+	return &FixedClock{now: now}
+}
+
+func (c *FixedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FixedClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SequentialIDGenerator hands out valid, increasing UUIDs
+// (00000000-0000-0000-0000-000000000001, ...).
+type SequentialIDGenerator struct {
+	mu   sync.Mutex
+	next int64
+}
+
+func (g *SequentialIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", g.next)
+}
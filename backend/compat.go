@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// currentSchemaVersion is the shape every Menu and Dish is upgraded to on read.
+// Bump it together with a new entry in schemaUpgrades whenever a change needs
+// older rows to be rewritten (new defaults, renamed values, derived fields).
+const currentSchemaVersion = 5
+
+// schemaUpgrade rewrites a record from Version-1 to Version in memory.
+// MenuColumns and DishColumns list every column the upgrade may touch so the
+// backfill knows what to persist. Snapshot upgrades stored menu snapshots
+// beyond the upgrades of the dishes they contain.
+type schemaUpgrade struct {
+	Version     int
+	Description string
+	MenuColumns []string
+	DishColumns []string
+	Menu        func(*Menu)
+	Dish        func(*Dish)
+	Snapshot    func(*MenuSnapshot)
+}
+
+var schemaUpgrades = []schemaUpgrade{
+	{
+		Version:     2,
+		Description: "fill failure codes, currencies and statuses on rows created before they existed",
+		MenuColumns: []string{"failure_code", "status"},
+		DishColumns: []string{"currency", "status"},
+		Menu: func(m *Menu) {
+			if m.Status == "" {
+				m.Status = "PENDING"
+			}
+			if m.Status == "FAILED" && m.FailureCode == nil {
+				m.FailureCode = stringPtr("PROCESSING_FAILED")
+			}
+		},
+		Dish: func(d *Dish) {
+			if d.Currency == "" {
+				d.Currency = "USD"
+			}
+			if d.Status == "" {
+				d.Status = "PENDING"
+			}
+		},
+	},
+	{
+		Version:     3,
+		Description: "fill failure codes on dishes that failed before dishes had them",
+		DishColumns: []string{"failure_code"},
+		Dish: func(d *Dish) {
+			// Description generation was the only way a dish could fail
+			if d.Status == "FAILED" && d.FailureCode == nil {
+				d.FailureCode = stringPtr("DESCRIPTION_FAILED")
+			}
+		},
+	},
+	{
+		Version:     4,
+		Description: "derive price types on dishes priced before price types existed",
+		DishColumns: []string{"price_type"},
+		Dish: func(d *Dish) {
+			d.PriceType = dishPriceType(*d)
+		},
+	},
+	{
+		Version:     5,
+		Description: "drop macros estimated without calories and mark snapshots taken before dish variants, modifiers, tags and allergens were recorded",
+		DishColumns: []string{"protein_grams", "carbs_grams", "fat_grams"},
+		Dish: func(d *Dish) {
+			// Nutrition is all or nothing: responses leave it out without
+			// calories, so exports must not show the macros either
+			if d.Calories == nil {
+				d.ProteinGrams, d.CarbsGrams, d.FatGrams = nil, nil, nil
+			}
+		},
+		Snapshot: func(s *MenuSnapshot) {
+			s.childrenMissing = true
+		},
+	},
+}
+
+// BeforeCreate stamps new menus with the current schema version.
+func (m *Menu) BeforeCreate(tx *gorm.DB) error {
+	m.SchemaVersion = currentSchemaVersion
+	return nil
+}
+
+// AfterFind upgrades older menus so callers only ever see the current shape.
+func (m *Menu) AfterFind(tx *gorm.DB) error {
+	upgradeMenu(m)
+	return nil
+}
+
+// BeforeCreate stamps new dishes with the current schema version.
+func (d *Dish) BeforeCreate(tx *gorm.DB) error {
+	d.SchemaVersion = currentSchemaVersion
+	return nil
+}
+
+// AfterFind upgrades older dishes so callers only ever see the current shape.
+func (d *Dish) AfterFind(tx *gorm.DB) error {
+	upgradeDish(d)
+	return nil
+}
+
+func upgradeMenu(m *Menu) {
+	for _, upgrade := range schemaUpgrades {
+		if m.SchemaVersion < upgrade.Version && upgrade.Menu != nil {
+			upgrade.Menu(m)
+		}
+	}
+	if m.SchemaVersion < currentSchemaVersion {
+		m.SchemaVersion = currentSchemaVersion
+	}
+}
+
+func upgradeDish(d *Dish) {
+	for _, upgrade := range schemaUpgrades {
+		if d.SchemaVersion < upgrade.Version && upgrade.Dish != nil {
+			upgrade.Dish(d)
+		}
+	}
+	if d.SchemaVersion < currentSchemaVersion {
+		d.SchemaVersion = currentSchemaVersion
+	}
+}
+
+// upgradeSnapshot upgrades a stored snapshot and every dish in it, which
+// were decoded from JSON and so never went through AfterFind.
+func upgradeSnapshot(s *MenuSnapshot) {
+	for _, upgrade := range schemaUpgrades {
+		if s.SchemaVersion < upgrade.Version && upgrade.Snapshot != nil {
+			upgrade.Snapshot(s)
+		}
+	}
+	for i := range s.Dishes {
+		upgradeDish(&s.Dishes[i])
+	}
+	if s.SchemaVersion < currentSchemaVersion {
+		s.SchemaVersion = currentSchemaVersion
+	}
+}
+
+// upgradeColumns returns the columns the backfill must persist for a row at
+// version from, always including schema_version itself.
+func upgradeColumns(from int, pick func(schemaUpgrade) []string) []string {
+	seen := map[string]bool{"schema_version": true}
+	columns := []string{"schema_version"}
+	for _, upgrade := range schemaUpgrades {
+		if from >= upgrade.Version {
+			continue
+		}
+		for _, column := range pick(upgrade) {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+// runSchemaBackfill persists the on-read upgrades for every outdated menu and
+// dish in batches, so older rows are eventually stored in the current shape.
+// It is safe to run repeatedly and stops early when ctx is cancelled.
+func runSchemaBackfill(ctx context.Context) error {
+	const batchSize = 200
+	started := clock.Now()
+	var menusUpgraded, dishesUpgraded int
+
+	for ctx.Err() == nil {
+		var menus []Menu
+		if err := db.WithContext(ctx).Where("schema_version < ?", currentSchemaVersion).Limit(batchSize).Find(&menus).Error; err != nil {
+			return err
+		}
+		if len(menus) == 0 {
+			break
+		}
+		for _, menu := range menus {
+			// AfterFind already upgraded the struct; read the stored version back
+			// to know which columns changed.
+			var stored int
+			if err := db.WithContext(ctx).Model(&Menu{}).Where("id = ?", menu.ID).Select("schema_version").Scan(&stored).Error; err != nil {
+				return err
+			}
+			columns := upgradeColumns(stored, func(u schemaUpgrade) []string { return u.MenuColumns })
+			if err := db.WithContext(ctx).Model(&Menu{ID: menu.ID}).Select(columns).UpdateColumns(&menu).Error; err != nil {
+				return err
+			}
+			menusUpgraded++
+		}
+	}
+
+	for ctx.Err() == nil {
+		var dishes []Dish
+		if err := db.WithContext(ctx).Where("schema_version < ?", currentSchemaVersion).Limit(batchSize).Find(&dishes).Error; err != nil {
+			return err
+		}
+		if len(dishes) == 0 {
+			break
+		}
+		for _, dish := range dishes {
+			var stored int
+			if err := db.WithContext(ctx).Model(&Dish{}).Where("id = ?", dish.ID).Select("schema_version").Scan(&stored).Error; err != nil {
+				return err
+			}
+			columns := upgradeColumns(stored, func(u schemaUpgrade) []string { return u.DishColumns })
+			if err := db.WithContext(ctx).Model(&Dish{ID: dish.ID}).Select(columns).UpdateColumns(&dish).Error; err != nil {
+				return err
+			}
+			dishesUpgraded++
+		}
+	}
+
+	if menusUpgraded > 0 || dishesUpgraded > 0 {
+		zapLog.Info("Schema backfill completed",
+			zap.Int("menus", menusUpgraded),
+			zap.Int("dishes", dishesUpgraded),
+			zap.Duration("took", clock.Now().Sub(started)))
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,92 @@
+package main
+
+import "testing"
+
+func TestMenuSnapshotUpgradesV1Payload(t *testing.T) {
+	payload := `{
+		"sections": [{"id": "s1", "menu_id": "m1", "name": "Mains", "position": 0}],
+		"dishes": [
+			{"id": "d1", "menu_id": "m1", "name": "Pad Thai", "price_cents": 1200, "status": "COMPLETE", "schema_version": 1, "protein_grams": 20},
+			{"id": "d2", "menu_id": "m1", "name": "Soup of the day", "status": "FAILED", "schema_version": 1},
+			{"id": "d3", "menu_id": "m1", "name": "Rice", "schema_version": 1, "calories": 200, "protein_grams": 4}
+		]
+	}`
+
+	var snapshot MenuSnapshot
+	if err := snapshot.Scan([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.SchemaVersion != currentSchemaVersion {
+		t.Errorf("snapshot schema_version = %d, want %d", snapshot.SchemaVersion, currentSchemaVersion)
+	}
+	if !snapshot.childrenMissing {
+		t.Error("v1 snapshot should be marked as missing child rows")
+	}
+
+	for _, test := range []struct {
+		dish        Dish
+		priceType   string
+		status      string
+		failureCode string
+		hasMacros   bool
+	}{
+		{snapshot.Dishes[0], PriceTypeFixed, "COMPLETE", "", false},
+		{snapshot.Dishes[1], PriceTypeNone, "FAILED", "DESCRIPTION_FAILED", false},
+		{snapshot.Dishes[2], PriceTypeNone, "PENDING", "", true},
+	} {
+		dish := test.dish
+		if dish.SchemaVersion != currentSchemaVersion {
+			t.Errorf("%s: schema_version = %d, want %d", dish.ID, dish.SchemaVersion, currentSchemaVersion)
+		}
+		if dish.Currency != "USD" {
+			t.Errorf("%s: currency = %q, want USD", dish.ID, dish.Currency)
+		}
+		if dish.PriceType != test.priceType {
+			t.Errorf("%s: price_type = %q, want %q", dish.ID, dish.PriceType, test.priceType)
+		}
+		if dish.Status != test.status {
+			t.Errorf("%s: status = %q, want %q", dish.ID, dish.Status, test.status)
+		}
+		var failureCode string
+		if dish.FailureCode != nil {
+			failureCode = *dish.FailureCode
+		}
+		if failureCode != test.failureCode {
+			t.Errorf("%s: failure_code = %q, want %q", dish.ID, failureCode, test.failureCode)
+		}
+		if got := dish.ProteinGrams != nil; got != test.hasMacros {
+			t.Errorf("%s: has protein_grams = %v, want %v", dish.ID, got, test.hasMacros)
+		}
+	}
+}
+
+func TestMenuSnapshotRoundTripKeepsChildren(t *testing.T) {
+	snapshot := MenuSnapshot{
+		SchemaVersion: currentSchemaVersion,
+		Dishes:        []Dish{{ID: "d1", MenuID: "m1", Name: "Pizza", Currency: "USD", Status: "COMPLETE", PriceType: PriceTypeRange, SchemaVersion: currentSchemaVersion}},
+		Variants:      []DishVariant{{ID: "v1", DishID: "d1", MenuID: "m1", Name: "10\""}},
+		Modifiers:     []DishModifier{},
+		Tags:          []DishTag{{DishID: "d1", Tag: "vegetarian", MenuID: "m1", Source: "menu"}},
+		Allergens:     []DishAllergen{},
+	}
+
+	value, err := snapshot.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MenuSnapshot
+	if err := decoded.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.childrenMissing {
+		t.Error("current snapshot should not be marked as missing child rows")
+	}
+	if len(decoded.Variants) != 1 || len(decoded.Tags) != 1 || decoded.Modifiers == nil || decoded.Allergens == nil {
+		t.Errorf("child rows not round-tripped: %+v", decoded)
+	}
+	if decoded.Dishes[0].PriceType != PriceTypeRange {
+		t.Errorf("price_type = %q, want %q", decoded.Dishes[0].PriceType, PriceTypeRange)
+	}
+}
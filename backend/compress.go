@@ -0,0 +1,228 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// compressionMinSize is the smallest API response worth compressing; smaller
+// ones cost more CPU than they save. -1 turns compression off. It is
+// configured in main, before the router is built.
+var compressionMinSize = -1
+
+// compressibleTypes are the content types worth compressing. Images and PDFs
+// are compressed already, and event streams must reach the client unbuffered.
+var compressibleTypes = []string{
+	"application/json",
+	"application/ld+json",
+	"application/xml",
+	"application/javascript",
+	"text/html",
+	"text/csv",
+	"text/plain",
+}
+
+// encoder is what the middleware needs of gzip.Writer and brotli.Writer.
+type encoder interface {
+	io.Writer
+	Reset(io.Writer)
+	Flush() error
+	Close() error
+}
+
+// encoders are the supported content codings, most preferred first, with
+// pools of their writers.
+var encoders = []struct {
+	coding string
+	pool   *sync.Pool
+}{
+	{"br", &sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}}},
+	{"gzip", &sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}}},
+}
+
+// compressResponses compresses responses of at least minSize bytes with
+// brotli or gzip, whichever the client prefers. Large completed menus are
+// hundreds of KB of JSON.
+func compressResponses(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if minSize < 0 || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Accept-Encoding")
+		coding, pool := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if pool == nil {
+			c.Next()
+			return
+		}
+
+		writer := &compressResponseWriter{ResponseWriter: c.Writer, minSize: minSize, coding: coding, pool: pool}
+		c.Writer = writer
+		defer writer.finish()
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks the supported coding an Accept-Encoding header
+// gives the highest q-value, preferring brotli on ties. "*" stands for the
+// codings the header does not name, and q=0 rules a coding out. It returns
+// a nil pool when no supported coding is acceptable.
+func negotiateEncoding(acceptEncoding string) (string, *sync.Pool) {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(strings.TrimSpace(name), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				quality = parsed
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := -1, 0.0
+	for i, candidate := range encoders {
+		quality, ok := qualities[candidate.coding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = i, quality
+		}
+	}
+	if best < 0 {
+		return "", nil
+	}
+	return encoders[best].coding, encoders[best].pool
+}
+
+// compressResponseWriter holds back the start of a response until it knows
+// whether the response is compressible and at least minSize bytes long.
+type compressResponseWriter struct {
+	gin.ResponseWriter
+	minSize int
+	coding  string
+	pool    *sync.Pool
+	buffer  []byte
+	// decided is set once the response goes out, compressed (encoder !=
+	// nil) or not
+	decided bool
+	encoder encoder
+}
+
+func (w *compressResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	if !w.compressible() {
+		w.decided = true
+		return w.ResponseWriter.Write(data)
+	}
+	w.buffer = append(w.buffer, data...)
+	if len(w.buffer) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what is buffered; a response flushed before reaching minSize
+// goes out uncompressed.
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		w.start(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible reports whether the response may be compressed, judging by
+// what the handler set before writing the body.
+func (w *compressResponseWriter) compressible() bool {
+	header := w.Header()
+	if w.ResponseWriter.Written() || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, compressible := range compressibleTypes {
+		if strings.HasPrefix(contentType, compressible) {
+			return true
+		}
+	}
+	return false
+}
+
+// start sends the buffered start of the response, compressing it and the
+// rest of the response if compress is set.
+func (w *compressResponseWriter) start(compress bool) error {
+	w.decided = true
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", w.coding)
+		header.Del("Content-Length")
+		// The compressed bytes differ from the identity ones
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.encoder = w.pool.Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+		_, err := w.encoder.Write(w.buffer)
+		w.buffer = nil
+		return err
+	}
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
+
+// finish ends the response once the handler returns.
+func (w *compressResponseWriter) finish() {
+	if !w.decided {
+		w.start(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
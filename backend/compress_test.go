@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                             "",
+		"identity":                     "",
+		"gzip":                         "gzip",
+		"br":                           "br",
+		"gzip, deflate, br":            "br",
+		"br;q=0.5, gzip":               "gzip",
+		"br;q=0.8, gzip;q=0.8":         "br",
+		"gzip;q=0":                     "",
+		"br;q=0, gzip;q=0.1":           "gzip",
+		"*":                            "br",
+		"*;q=0.5, br;q=0":              "gzip",
+		"*;q=0":                        "",
+		"GZIP; Q=0.9":                  "gzip",
+		"br;q=1.5, gzip":               "gzip",
+		"br;level=1;q=0.2, gzip;q=0.1": "br",
+	} {
+		if got, _ := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := strings.Repeat(`{"name":"Pad Thai"},`, 100)
+	router := gin.New()
+	router.GET("/large", compressResponses(1024), func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(large))
+	})
+	router.GET("/small", compressResponses(1024), func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(`{}`))
+	})
+
+	for _, test := range []struct {
+		path, acceptEncoding, wantEncoding, body string
+	}{
+		{"/large", "gzip, br", "br", large},
+		{"/large", "gzip", "gzip", large},
+		{"/large", "br;q=0, gzip;q=0", "", large},
+		{"/small", "br", "", `{}`},
+	} {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if got := resp.Header().Get("Content-Encoding"); got != test.wantEncoding {
+			t.Errorf("%s with %q: Content-Encoding %q, want %q", test.path, test.acceptEncoding, got, test.wantEncoding)
+			continue
+		}
+		var reader io.Reader = bytes.NewReader(resp.Body.Bytes())
+		switch test.wantEncoding {
+		case "br":
+			reader = brotli.NewReader(reader)
+		case "gzip":
+			gz, err := gzip.NewReader(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = gz
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%s with %q: %v", test.path, test.acceptEncoding, err)
+		}
+		if string(decoded) != test.body {
+			t.Errorf("%s with %q: body does not round-trip", test.path, test.acceptEncoding)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnvInt reads an integer environment variable, falling back to def when
+// the variable is unset or malformed.
+func getEnvInt(name string, def int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// getEnvBool reads a boolean environment variable ("true", "1", "false", ...),
+// falling back to def when the variable is unset or malformed.
+func getEnvBool(name string, def bool) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// getEnvDuration reads a Go duration ("30s", "5m") from the environment,
+// falling back to def when the variable is unset or malformed.
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// getEnvFloat reads a floating-point environment variable, falling back to def
+// when the variable is unset or malformed.
+func getEnvFloat(name string, def float64) float64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// lookupOpenAIKey returns the OpenAI API key, trying the Choreo-provided
+// connection first. In demo and replay modes, where requests never reach
+// OpenAI, a placeholder stands in when none is set.
+func lookupOpenAIKey() string {
+	key := os.Getenv("CHOREO_OPENAI_CONNECTION_OPENAI_API_KEY")
+	if key == "" {
+		key = os.Getenv("OPENAI_API_KEY")
+	}
+	if key == "" && (demoMode() || providerReplayDir() != "") {
+		key = demoAPIKey
+	}
+	return key
+}
+
+// lookupReplicateKey is lookupOpenAIKey for Replicate.
+func lookupReplicateKey() string {
+	key := os.Getenv("CHOREO_REPLICATE_CONNECTION_REPLICATE_API_KEY")
+	if key == "" {
+		key = os.Getenv("REPLICATE_API_KEY")
+	}
+	if key == "" && (demoMode() || providerReplayDir() != "") {
+		key = demoAPIKey
+	}
+	return key
+}
+
+// openAIBaseURL is where OpenAI requests go: OPENAI_BASE_URL, such as a
+// proxy or FakeProviders, or OpenAI's API.
+func openAIBaseURL() string {
+	if base := strings.TrimRight(os.Getenv("OPENAI_BASE_URL"), "/"); base != "" {
+		return base
+	}
+	return "https://api.openai.com"
+}
+
+// replicateBaseURL is openAIBaseURL for Replicate, set by REPLICATE_BASE_URL.
+func replicateBaseURL() string {
+	if base := strings.TrimRight(os.Getenv("REPLICATE_BASE_URL"), "/"); base != "" {
+		return base
+	}
+	return "https://api.replicate.com"
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiContract names a response body whose JSON shape clients depend on.
+// Shapes are derived from the Go types by reflection and compared against
+// the committed snapshot in contracts.txt, so a change that would break an
+// existing client (a renamed or removed field, a changed type, a field that
+// can suddenly be null or missing) is caught before it ships.
+type apiContract struct {
+	Name string
+	Type reflect.Type
+}
+
+var apiContracts = []apiContract{
+	{"error", reflect.TypeOf(struct {
+		Error ErrorResponse `json:"error"`
+	}{})},
+	{"error.code", reflect.TypeOf(ErrorCode{})},
+	{"upload", reflect.TypeOf(MenuUploadResponse{})},
+	{"upload.near_duplicate", reflect.TypeOf(struct {
+		Error     ErrorResponse     `json:"error"`
+		Duplicate NearDuplicateMenu `json:"duplicate"`
+	}{})},
+	{"menu.status", reflect.TypeOf(MenuStatusResponse{})},
+	{"menu.summary", reflect.TypeOf(MenuSummary{})},
+	{"menu.diff", reflect.TypeOf(MenuDiffResponse{})},
+	{"menu.translation", reflect.TypeOf(MenuTranslationResponse{})},
+	{"menu.export.json", reflect.TypeOf(MenuBackup{})},
+	{"menu.share", reflect.TypeOf(MenuShareResponse{})},
+	{"menu.version", reflect.TypeOf(MenuVersionSummary{})},
+	{"menu.revision", reflect.TypeOf(MenuRevisionSummary{})},
+	{"dish.regenerate", reflect.TypeOf(RegenerateResponse{})},
+	{"dish.image", reflect.TypeOf(DishImage{})},
+	{"dish.rendition", reflect.TypeOf(DishRendition{})},
+	{"dish.social", reflect.TypeOf(SocialPostResponse{})},
+	{"public.menu", reflect.TypeOf(PublicMenu{})},
+	{"auth.session", reflect.TypeOf(SessionResponse{})},
+	{"user", reflect.TypeOf(User{})},
+	{"user.identity", reflect.TypeOf(UserIdentity{})},
+	{"restaurant", reflect.TypeOf(Restaurant{})},
+	{"restaurant.member", reflect.TypeOf(RestaurantMemberResponse{})},
+	{"quota", reflect.TypeOf(QuotaResponse{})},
+	{"webhook", reflect.TypeOf(Webhook{})},
+	{"webhook.delivery", reflect.TypeOf(WebhookDelivery{})},
+	{"webhook.event", reflect.TypeOf(WebhookEvent{})},
+	{"admin.spend", reflect.TypeOf(SpendResponse{})},
+	{"admin.usage", reflect.TypeOf(UsageResponse{})},
+	{"admin.stats", reflect.TypeOf(StatsResponse{})},
+	{"admin.lock", reflect.TypeOf(JobLock{})},
+	{"admin.jobs", reflect.TypeOf(JobMetricsResponse{})},
+	{"admin.debug.runtime", reflect.TypeOf(RuntimeDebugResponse{})},
+	{"admin.api_key", reflect.TypeOf(APIKey{})},
+	{"admin.api_key.secret", reflect.TypeOf(APIKeySecretResponse{})},
+	{"admin.menu", reflect.TypeOf(AdminMenuSummary{})},
+	{"admin.bulk_action", reflect.TypeOf(BulkActionResponse{})},
+	{"admin.purge_receipt", reflect.TypeOf(PurgeReceipt{})},
+	{"admin.catalog_dish", reflect.TypeOf(CatalogDish{})},
+	{"admin.catalog_update", reflect.TypeOf(CatalogDishUpdateResponse{})},
+}
+
+// contractField is the JSON shape of one field, addressed by its path in the
+// body (e.g. "menu.dishes[].name").
+type contractField struct {
+	Type     string
+	Nullable bool
+	Optional bool
+}
+
+type contractShape map[string]contractField
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// contractShapes derives the current shape of every registered contract.
+func contractShapes() map[string]contractShape {
+	shapes := make(map[string]contractShape, len(apiContracts))
+	for _, contract := range apiContracts {
+		shape := contractShape{}
+		describeContractType(shape, "", contract.Type, map[reflect.Type]bool{})
+		shapes[contract.Name] = shape
+	}
+	return shapes
+}
+
+// describeContractType records the fields of t under prefix. seen guards
+// against recursive types.
+func describeContractType(shape contractShape, prefix string, t reflect.Type, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			describeContractType(shape, prefix, field.Type, seen)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		path := prefix + name
+		fieldType := field.Type
+		nullable := false
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+			nullable = true
+		}
+		kind := contractKind(fieldType)
+		if kind == "array" || kind == "object" && fieldType.Kind() == reflect.Map {
+			// Nil slices and maps encode as null
+			nullable = true
+		}
+		shape[path] = contractField{
+			Type:     kind,
+			Nullable: nullable,
+			Optional: strings.Contains(","+options+",", ",omitempty,"),
+		}
+
+		switch kind {
+		case "object":
+			describeContractType(shape, path+".", fieldType, seen)
+		case "array":
+			elem := fieldType.Elem()
+			for elem.Kind() == reflect.Pointer {
+				elem = elem.Elem()
+			}
+			shape[path+"[]"] = contractField{Type: contractKind(elem)}
+			describeContractType(shape, path+"[].", elem, seen)
+		}
+	}
+}
+
+// contractKind maps a Go type to the JSON type it encodes as.
+func contractKind(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case t == rawMessageType:
+		return "any"
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return "any"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte encodes as a base64 string
+			return "string"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	default:
+		return "any"
+	}
+}
+
+// compareContracts lists the changes from old to current that would break
+// existing clients. Added fields and contracts are compatible.
+func compareContracts(old, current map[string]contractShape) []string {
+	var problems []string
+	for name, oldShape := range old {
+		shape, ok := current[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: contract removed", name))
+			continue
+		}
+		for path, was := range oldShape {
+			now, ok := shape[path]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s: field %s removed", name, path))
+			case now.Type != was.Type && was.Type != "any":
+				problems = append(problems, fmt.Sprintf("%s: field %s changed type from %s to %s", name, path, was.Type, now.Type))
+			case now.Nullable && !was.Nullable:
+				problems = append(problems, fmt.Sprintf("%s: field %s can now be null", name, path))
+			case now.Optional && !was.Optional:
+				problems = append(problems, fmt.Sprintf("%s: field %s can now be omitted", name, path))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// loadContractSnapshot reads a committed snapshot. Snapshots are plain text
+// with one field per line, sorted, so changes show up clearly in review:
+//
+//	<contract> <path> <type> [nullable] [optional]
+func loadContractSnapshot(path string) (map[string]contractShape, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	shapes := map[string]contractShape{}
+	for i, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected <contract> <path> <type>", path, i+1)
+		}
+		field := contractField{Type: parts[2]}
+		for _, flag := range parts[3:] {
+			switch flag {
+			case "nullable":
+				field.Nullable = true
+			case "optional":
+				field.Optional = true
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown flag %q", path, i+1, flag)
+			}
+		}
+		if shapes[parts[0]] == nil {
+			shapes[parts[0]] = contractShape{}
+		}
+		shapes[parts[0]][parts[1]] = field
+	}
+	return shapes, nil
+}
+
+func writeContractSnapshot(path string, shapes map[string]contractShape) error {
+	var lines []string
+	for name, shape := range shapes {
+		for fieldPath, field := range shape {
+			line := name + " " + fieldPath + " " + field.Type
+			if field.Nullable {
+				line += " nullable"
+			}
+			if field.Optional {
+				line += " optional"
+			}
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+
+	header := "# API response contracts. Regenerate with: go run . admin check-contracts -update\n"
+	return os.WriteFile(path, []byte(header+strings.Join(lines, "\n")+"\n"), 0o644)
+}
+
+// checkContractsCommand compares the response types against the committed
+// snapshot. With -update it accepts compatible changes (new fields) into the
+// snapshot; breaking changes are only written with -force.
+func checkContractsCommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("check-contracts", out)
+	file := flags.String("file", "contracts.txt", "contract snapshot to compare against")
+	update := flags.Bool("update", false, "rewrite the snapshot when the changes are compatible")
+	force := flags.Bool("force", false, "with -update, also accept breaking changes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	current := contractShapes()
+	old, err := loadContractSnapshot(*file)
+	if errors.Is(err, os.ErrNotExist) && *update {
+		old = map[string]contractShape{}
+	} else if err != nil {
+		return err
+	}
+
+	problems := compareContracts(old, current)
+	for _, problem := range problems {
+		fmt.Fprintln(out, "BREAKING "+problem)
+	}
+	for _, name := range addedContractFields(old, current) {
+		fmt.Fprintln(out, "added    "+name)
+	}
+
+	if *update && (len(problems) == 0 || *force) {
+		if err := writeContractSnapshot(*file, current); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "updated %s\n", *file)
+		return nil
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d breaking changes to API contracts", len(problems))
+	}
+	fmt.Fprintln(out, "API contracts are compatible")
+	return nil
+}
+
+func addedContractFields(old, current map[string]contractShape) []string {
+	var added []string
+	for name, shape := range current {
+		oldShape, ok := old[name]
+		if !ok {
+			added = append(added, fmt.Sprintf("%s (new contract)", name))
+			continue
+		}
+		for path := range shape {
+			if _, ok := oldShape[path]; !ok {
+				added = append(added, fmt.Sprintf("%s: field %s", name, path))
+			}
+		}
+	}
+	sort.Strings(added)
+	return added
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestContracts fails when the response types drift from contracts.txt:
+// breaking changes, and new fields the snapshot has not recorded yet
+// (`go run . admin check-contracts -update` records them).
+func TestContracts(t *testing.T) {
+	snapshot, err := loadContractSnapshot("contracts.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := contractShapes()
+	for _, problem := range compareContracts(snapshot, current) {
+		t.Errorf("breaking change: %s", problem)
+	}
+	for _, added := range addedContractFields(snapshot, current) {
+		t.Errorf("not in contracts.txt: %s", added)
+	}
+}
+
+// TestContractsCamelCase checks that JSON_FIELD_NAMING=camelCase gives
+// every field of a response its own name, and that requests can name them
+// back.
+func TestContractsCamelCase(t *testing.T) {
+	for name, shape := range contractShapes() {
+		renamed := map[string]string{}
+		for path := range shape {
+			segments := strings.Split(path, ".")
+			for i, segment := range segments {
+				key, array := strings.CutSuffix(segment, "[]")
+				segments[i] = snakeToCamel(key)
+				if array {
+					segments[i] += "[]"
+				}
+				if back := camelToSnake(snakeToCamel(key)); back != key && strings.ToLower(key) == key {
+					t.Errorf("%s: field %s comes back from camelCase as %s", name, key, back)
+				}
+			}
+			camel := strings.Join(segments, ".")
+			if other, ok := renamed[camel]; ok {
+				t.Errorf("%s: fields %s and %s are both %s in camelCase", name, path, other, camel)
+			}
+			renamed[camel] = path
+		}
+	}
+}
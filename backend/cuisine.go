@@ -0,0 +1,181 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Menus and dishes are classified into cuisines during extraction, and
+// descriptions and images are written for the dish's cuisine.
+//
+// cuisineHint adds presentation guidance to image prompts for dishes whose
+// names, or failing that whose cuisine, point at a regional cuisine.
+// Keywords are matched as whole words against the lowercased dish name; the
+// first matching entry wins, so list specific dishes before generic ones.
+type cuisineHint struct {
+	Cuisine  string
+	Keywords []string
+	Hint     string
+}
+
+// cuisineHints is the maintained mapping table. Keep keywords lowercase and
+// hints short: they are appended to the prompt as-is.
+var cuisineHints = []cuisineHint{
+	{
+		Cuisine:  "indian",
+		Keywords: []string{"saag paneer", "palak paneer", "paneer", "tikka masala", "biryani", "dal makhani", "dal", "korma", "vindaloo", "rogan josh", "chana masala", "aloo gobi", "naan", "samosa", "dosa", "idli", "pakora", "tandoori"},
+		Hint:     "served Indian style in a copper or steel bowl (katori), garnished with fresh coriander, with naan or basmati rice on the side",
+	},
+	{
+		Cuisine:  "japanese",
+		Keywords: []string{"okonomiyaki", "takoyaki", "ramen", "udon", "soba", "tonkatsu", "katsu", "yakitori", "gyoza", "karaage", "donburi", "sashimi", "sushi", "nigiri", "maki", "tempura", "onigiri", "teriyaki"},
+		Hint:     "plated Japanese style on ceramic ware, minimal garnish such as scallions, nori or bonito flakes, chopsticks nearby",
+	},
+	{
+		Cuisine:  "korean",
+		Keywords: []string{"bibimbap", "bulgogi", "kimchi", "tteokbokki", "japchae", "galbi", "kimbap", "sundubu"},
+		Hint:     "served Korean style in a stone or brass bowl with small banchan side dishes",
+	},
+	{
+		Cuisine:  "thai",
+		Keywords: []string{"pad thai", "pad see ew", "tom yum", "tom kha", "green curry", "red curry", "massaman", "som tam", "larb", "khao soi"},
+		Hint:     "served Thai style with lime wedges, fresh Thai basil and chili, jasmine rice on the side",
+	},
+	{
+		Cuisine:  "vietnamese",
+		Keywords: []string{"pho", "banh mi", "bun cha", "bun bo", "goi cuon", "com tam"},
+		Hint:     "served Vietnamese style with a plate of fresh herbs, bean sprouts and lime",
+	},
+	{
+		Cuisine:  "chinese",
+		Keywords: []string{"dim sum", "har gow", "siu mai", "xiao long bao", "kung pao", "mapo tofu", "char siu", "chow mein", "lo mein", "peking duck", "wonton"},
+		Hint:     "served Chinese style in a bamboo steamer or on a porcelain plate",
+	},
+	{
+		Cuisine:  "mexican",
+		Keywords: []string{"tacos", "taco", "enchiladas", "enchilada", "mole", "pozole", "tamales", "tamale", "chilaquiles", "quesadilla", "carnitas", "al pastor", "elote", "birria"},
+		Hint:     "served Mexican style with warm corn tortillas, salsa, lime and cilantro",
+	},
+	{
+		Cuisine:  "middle eastern",
+		Keywords: []string{"shawarma", "falafel", "hummus", "shakshuka", "tabbouleh", "baba ganoush", "kofta", "kibbeh", "fattoush", "manakish"},
+		Hint:     "served Middle Eastern style on a patterned platter with warm pita, olive oil and sumac",
+	},
+	{
+		Cuisine:  "ethiopian",
+		Keywords: []string{"injera", "doro wat", "tibs", "kitfo", "shiro"},
+		Hint:     "served Ethiopian style on a large round of injera",
+	},
+	{
+		Cuisine:  "italian",
+		Keywords: []string{"risotto", "ossobuco", "carbonara", "cacio e pepe", "amatriciana", "gnocchi", "lasagna", "lasagne", "tiramisu", "arancini", "bruschetta", "burrata"},
+		Hint:     "plated Italian trattoria style on a white ceramic plate, finished with olive oil and fresh herbs",
+	},
+	{
+		Cuisine:  "spanish",
+		Keywords: []string{"paella", "patatas bravas", "gambas al ajillo", "tortilla espanola", "croquetas", "gazpacho", "churros"},
+		Hint:     "served Spanish tapas style in a terracotta cazuela or paella pan",
+	},
+}
+
+var cuisinePatterns = compileCuisinePatterns(cuisineHints)
+
+func compileCuisinePatterns(hints []cuisineHint) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(hints))
+	for i, hint := range hints {
+		quoted := make([]string, len(hint.Keywords))
+		for j, keyword := range hint.Keywords {
+			quoted[j] = regexp.QuoteMeta(keyword)
+		}
+		patterns[i] = regexp.MustCompile(`\b(` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return patterns
+}
+
+// detectCuisine returns the first cuisine hint whose keywords appear in the
+// dish name, or nil when the dish looks generic.
+func detectCuisine(dishName string) *cuisineHint {
+	name := strings.ToLower(dishName)
+	for i, pattern := range cuisinePatterns {
+		if pattern.MatchString(name) {
+			return &cuisineHints[i]
+		}
+	}
+	return nil
+}
+
+// cuisines are the categories menus and dishes are classified into.
+// Extraction picks from these; detectCuisine's keywords only name some.
+var cuisines = []string{
+	"american", "brazilian", "british", "caribbean", "chinese", "ethiopian", "french", "fusion", "german", "greek", "indian", "italian",
+	"japanese", "korean", "mediterranean", "mexican", "middle eastern", "peruvian", "spanish", "thai", "turkish", "vietnamese",
+}
+
+// normalizeCuisine returns cuisine as one of cuisines, or "" if it is not.
+func normalizeCuisine(cuisine string) string {
+	cuisine = strings.ToLower(strings.TrimSpace(cuisine))
+	if slices.Contains(cuisines, cuisine) {
+		return cuisine
+	}
+	return ""
+}
+
+// detectMenuCuisine returns the cuisine extraction found for the menu,
+// falling back to the one most of its dishes' names point at.
+func detectMenuCuisine(structured *StructuredMenu) string {
+	if cuisine := normalizeCuisine(structured.Cuisine); cuisine != "" {
+		return cuisine
+	}
+	counts := make(map[string]int)
+	best := ""
+	for _, section := range structured.Sections {
+		for _, dish := range section.Dishes {
+			hint := detectCuisine(dish.Name)
+			if hint == nil {
+				continue
+			}
+			counts[hint.Cuisine]++
+			if counts[hint.Cuisine] > counts[best] {
+				best = hint.Cuisine
+			}
+		}
+	}
+	return best
+}
+
+// dishCuisine is the cuisine of one extracted dish of a menu in
+// menuCuisine: its own when extraction or its name tells one, else the
+// menu's.
+func dishCuisine(dish StructuredDish, menuCuisine string) string {
+	if cuisine := normalizeCuisine(dish.Cuisine); cuisine != "" {
+		return cuisine
+	}
+	if hint := detectCuisine(dish.Name); hint != nil {
+		return hint.Cuisine
+	}
+	return menuCuisine
+}
+
+// cuisineHintFor returns the presentation hint for a dish: the one its name
+// points at, else its cuisine's, else nil.
+func cuisineHintFor(dishName, cuisine string) *cuisineHint {
+	if hint := detectCuisine(dishName); hint != nil {
+		return hint
+	}
+	for i := range cuisineHints {
+		if cuisineHints[i].Cuisine == cuisine {
+			return &cuisineHints[i]
+		}
+	}
+	return nil
+}
+
+// cuisineLabel writes a cuisine for prompts, e.g. "Middle Eastern".
+func cuisineLabel(cuisine string) string {
+	words := strings.Fields(cuisine)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
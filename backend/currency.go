@@ -0,0 +1,110 @@
+package main
+
+import "strings"
+
+// Dishes are priced in the currency the upload names, else the one
+// extraction reads off the menu (from price symbols, explicit codes, or the
+// language and place the menu is written for), else the restaurant's
+// default, else USD. Dishes the menu prices in another currency than the
+// rest keep theirs, unless the upload named one. The menu records which of
+// these its currency came from.
+
+const (
+	CurrencySourceUpload     = "upload"
+	CurrencySourceDetected   = "detected"
+	CurrencySourceRestaurant = "restaurant"
+	CurrencySourceDefault    = "default"
+)
+
+// currencySymbols maps symbols that name a single currency to it. "$", "¥",
+// and "kr" are shared by several and are left to extraction.
+var currencySymbols = map[string]string{
+	"€": "EUR",
+	"£": "GBP",
+	"₹": "INR",
+	"₩": "KRW",
+	"₺": "TRY",
+	"₽": "RUB",
+	"฿": "THB",
+	"₫": "VND",
+	"₱": "PHP",
+	"₪": "ILS",
+	"₦": "NGN",
+	"₴": "UAH",
+}
+
+// normalizeCurrency returns code as an upper-case ISO 4217 code, or "" if it
+// does not look like one.
+func normalizeCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return ""
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return ""
+		}
+	}
+	return code
+}
+
+// currencyFromPrice returns the currency a raw price's symbol names, or "".
+func currencyFromPrice(raw string) string {
+	for _, r := range raw {
+		if code, ok := currencySymbols[string(r)]; ok {
+			return code
+		}
+	}
+	return ""
+}
+
+// detectMenuCurrency returns the currency extraction found for the menu,
+// falling back to the first price with an unambiguous symbol.
+func detectMenuCurrency(structured *StructuredMenu) string {
+	if code := normalizeCurrency(structured.Currency); code != "" {
+		return code
+	}
+	for _, section := range structured.Sections {
+		for _, dish := range section.Dishes {
+			if dish.Price == nil {
+				continue
+			}
+			if code := currencyFromPrice(*dish.Price); code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// resolveMenuCurrency picks the currency of an extracted menu and where it
+// came from.
+func resolveMenuCurrency(menu Menu, structured *StructuredMenu) (string, string) {
+	if menu.CurrencySource == CurrencySourceUpload && menu.Currency != "" {
+		return menu.Currency, CurrencySourceUpload
+	}
+	if code := detectMenuCurrency(structured); code != "" {
+		return code, CurrencySourceDetected
+	}
+	if code := restaurantCurrency(menu.RestaurantID); code != "" {
+		return code, CurrencySourceRestaurant
+	}
+	return defaultMenuCurrency, CurrencySourceDefault
+}
+
+// dishCurrency is the currency of one extracted dish of a menu priced in
+// menuCurrency.
+func dishCurrency(dish StructuredDish, menuCurrency, source string) string {
+	if source == CurrencySourceUpload {
+		return menuCurrency
+	}
+	if code := normalizeCurrency(dish.Currency); code != "" {
+		return code
+	}
+	if dish.Price != nil {
+		if code := currencyFromPrice(*dish.Price); code != "" {
+			return code
+		}
+	}
+	return menuCurrency
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Debug endpoints expose profiles and runtime state of the replica that
+// answers. They need the admin token and are off unless
+// DEBUG_ENDPOINTS_ENABLED=true, since profiling costs CPU and reveals code
+// paths.
+
+// startedAt is when this process started, for uptime.
+var startedAt = time.Now()
+
+// requireDebugEndpoints hides the debug endpoints while they are turned off.
+func requireDebugEndpoints() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !getEnvBool("DEBUG_ENDPOINTS_ENABLED", false) {
+			respondError(c, http.StatusNotFound, "DEBUG_DISABLED", "Debug endpoints are disabled")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerPprof serves net/http/pprof under /debug/pprof.
+func registerPprof(r *gin.Engine) {
+	debug := r.Group("/debug/pprof", requireAdmin(), requireDebugEndpoints())
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	// heap, goroutine, block, mutex, allocs, threadcreate
+	debug.GET("/:profile", func(c *gin.Context) {
+		pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+	})
+}
+
+type RuntimeDebugResponse struct {
+	Goroutines     int                `json:"goroutines"`
+	GOMAXPROCS     int                `json:"gomaxprocs"`
+	HeapAllocBytes uint64             `json:"heap_alloc_bytes"`
+	HeapObjects    uint64             `json:"heap_objects"`
+	GCRuns         uint32             `json:"gc_runs"`
+	UptimeSeconds  float64            `json:"uptime_seconds"`
+	Jobs           JobMetricsResponse `json:"jobs"`
+	InFlightMenus  []InFlightMenu     `json:"in_flight_menus"`
+}
+
+// getRuntimeDebugHandler reports goroutines, memory, worker slot occupancy,
+// and the menus being processed. A goroutine count that keeps growing while
+// no menu is in flight points at a leak.
+func getRuntimeDebugHandler(c *gin.Context) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	c.JSON(http.StatusOK, RuntimeDebugResponse{
+		Goroutines:     runtime.NumGoroutine(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		HeapAllocBytes: memStats.HeapAlloc,
+		HeapObjects:    memStats.HeapObjects,
+		GCRuns:         memStats.NumGC,
+		UptimeSeconds:  time.Since(startedAt).Seconds(),
+		Jobs:           jobStats.snapshot(),
+		InFlightMenus:  processingJobs.inFlight(),
+	})
+}
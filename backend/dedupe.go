@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"math/bits"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Upload choices for when a near-duplicate menu already exists, sent as the
+// on_duplicate form field.
+const (
+	OnDuplicateWarn  = "warn"
+	OnDuplicateReuse = "reuse"
+	OnDuplicateForce = "force"
+)
+
+// The signature is a small grayscale thumbnail kept for diff previews; the
+// preview compares it in a coarse grid of regions.
+const (
+	imageSignatureSize  = 16
+	diffPreviewGrid     = 4
+	diffRegionThreshold = 12
+)
+
+// imageFingerprint identifies an upload by appearance rather than bytes, so
+// re-photographed or re-encoded copies of a menu can be recognised.
+type imageFingerprint struct {
+	Hash      int64
+	Signature []byte
+}
+
+// NearDuplicateMenu describes an existing menu that looks like the upload.
+type NearDuplicateMenu struct {
+	MenuID       string                    `json:"menu_id"`
+	Status       string                    `json:"status"`
+	OriginalFile string                    `json:"original_filename"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	Similarity   float64                   `json:"similarity"`
+	DishCount    int                       `json:"dish_count"`
+	Sections     []NearDuplicateSection    `json:"sections"`
+	Preview      *NearDuplicateDiffPreview `json:"diff_preview,omitempty"`
+}
+
+type NearDuplicateSection struct {
+	Name      string `json:"name"`
+	DishCount int    `json:"dish_count"`
+}
+
+// NearDuplicateDiffPreview marks which regions of the image differ between the
+// upload and the existing menu, on a grid read row by row from the top left.
+// Changed regions usually hold edited prices or dishes.
+type NearDuplicateDiffPreview struct {
+	Grid            int      `json:"grid"`
+	ChangedRegions  [][]bool `json:"changed_regions"`
+	ChangedFraction float64  `json:"changed_fraction"`
+}
+
+// fingerprintImage computes a 64-bit difference hash and a grayscale
+// signature of an uploaded image. Formats the standard library cannot decode
+// return an error, and such uploads skip near-duplicate detection.
+func fingerprintImage(data []byte) (*imageFingerprint, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// dHash: compare horizontally adjacent pixels of a 9x8 thumbnail
+	small := grayThumbnail(img, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small[y*9+x] > small[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return &imageFingerprint{
+		Hash:      int64(hash),
+		Signature: grayThumbnail(img, imageSignatureSize, imageSignatureSize),
+	}, nil
+}
+
+// grayThumbnail downsamples img to w by h luminance values by averaging a
+// sample of the source pixels that fall in each cell.
+func grayThumbnail(img image.Image, w, h int) []byte {
+	bounds := img.Bounds()
+	out := make([]byte, w*h)
+	for ty := 0; ty < h; ty++ {
+		y0 := bounds.Min.Y + ty*bounds.Dy()/h
+		y1 := max(bounds.Min.Y+(ty+1)*bounds.Dy()/h, y0+1)
+		for tx := 0; tx < w; tx++ {
+			x0 := bounds.Min.X + tx*bounds.Dx()/w
+			x1 := max(bounds.Min.X+(tx+1)*bounds.Dx()/w, x0+1)
+
+			// Large photos are sampled on a sparse grid to bound the cost
+			stepY, stepX := max((y1-y0)/8, 1), max((x1-x0)/8, 1)
+			var sum, count uint64
+			for y := y0; y < y1 && y < bounds.Max.Y; y += stepY {
+				for x := x0; x < x1 && x < bounds.Max.X; x += stepX {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += (299*uint64(r) + 587*uint64(g) + 114*uint64(b)) / 1000
+					count++
+				}
+			}
+			if count > 0 {
+				out[ty*w+tx] = byte((sum / count) >> 8)
+			}
+		}
+	}
+	return out
+}
+
+// findNearDuplicate returns the closest of the menus scopeToOwner gives the
+// uploader whose perceptual hash is within NEAR_DUPLICATE_MAX_DISTANCE bits
+// of the upload, or nil.
+// Failed menus are ignored since reusing them would not help the client.
+func findNearDuplicate(userID, apiKeyID string, fingerprint *imageFingerprint) (*Menu, error) {
+	maxDistance := getEnvInt("NEAR_DUPLICATE_MAX_DISTANCE", 6)
+
+	// Hamming distance: count the set bits of the XOR of both hashes
+	distance := "length(replace(((perceptual_hash # ?)::bit(64))::text, '0', ''))"
+	var menu Menu
+	err := scopeToOwner(db, userID, apiKeyID).
+		Where("perceptual_hash IS NOT NULL AND status <> ?", "FAILED").
+		Where(distance+" <= ?", fingerprint.Hash, maxDistance).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: distance + ", created_at DESC", Vars: []interface{}{fingerprint.Hash}}}).
+		Take(&menu).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &menu, nil
+}
+
+// describeNearDuplicate builds the summary returned to the client so it can
+// decide between reusing the existing menu and processing the upload anew.
+func describeNearDuplicate(existing *Menu, fingerprint *imageFingerprint) NearDuplicateMenu {
+	distance := 0
+	if existing.PerceptualHash != nil {
+		distance = bits.OnesCount64(uint64(*existing.PerceptualHash ^ fingerprint.Hash))
+	}
+	duplicate := NearDuplicateMenu{
+		MenuID:       existing.ID,
+		Status:       existing.Status,
+		OriginalFile: existing.OriginalFile,
+		CreatedAt:    existing.CreatedAt,
+		Similarity:   1 - float64(distance)/64,
+		Sections:     []NearDuplicateSection{},
+		Preview:      diffPreview(existing.ImageSignature, fingerprint.Signature),
+	}
+
+	var sections []NearDuplicateSection
+	err := db.Raw(`SELECT s.name, COUNT(d.id) AS dish_count
+		FROM menu_sections s LEFT JOIN dishes d ON d.section_id = s.id
+		WHERE s.menu_id = ? GROUP BY s.id, s.name, s.position ORDER BY s.position`, existing.ID).Scan(&sections).Error
+	if err != nil {
+		zapLog.Warn("Failed to load sections for duplicate preview", zap.String("menuID", existing.ID), zap.Error(err))
+	} else if sections != nil {
+		duplicate.Sections = sections
+	}
+	var total int64
+	if err := db.Model(&Dish{}).Where("menu_id = ?", existing.ID).Count(&total).Error; err != nil {
+		zapLog.Warn("Failed to count dishes for duplicate preview", zap.String("menuID", existing.ID), zap.Error(err))
+	}
+	duplicate.DishCount = int(total)
+
+	return duplicate
+}
+
+// diffPreview compares two image signatures region by region. It returns nil
+// when either signature is missing.
+func diffPreview(before, after []byte) *NearDuplicateDiffPreview {
+	size := imageSignatureSize
+	if len(before) != size*size || len(after) != size*size {
+		return nil
+	}
+
+	cell := size / diffPreviewGrid
+	preview := &NearDuplicateDiffPreview{Grid: diffPreviewGrid, ChangedRegions: make([][]bool, diffPreviewGrid)}
+	changed := 0
+	for gy := 0; gy < diffPreviewGrid; gy++ {
+		preview.ChangedRegions[gy] = make([]bool, diffPreviewGrid)
+		for gx := 0; gx < diffPreviewGrid; gx++ {
+			total := 0
+			for y := gy * cell; y < (gy+1)*cell; y++ {
+				for x := gx * cell; x < (gx+1)*cell; x++ {
+					delta := int(before[y*size+x]) - int(after[y*size+x])
+					if delta < 0 {
+						delta = -delta
+					}
+					total += delta
+				}
+			}
+			if total/(cell*cell) > diffRegionThreshold {
+				preview.ChangedRegions[gy][gx] = true
+				changed++
+			}
+		}
+	}
+	preview.ChangedFraction = float64(changed) / float64(diffPreviewGrid*diffPreviewGrid)
+	return preview
+}
+
+// respondNearDuplicate answers an upload that matched an existing menu
+// without an explicit on_duplicate choice.
+func respondNearDuplicate(c *gin.Context, duplicate NearDuplicateMenu) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error": ErrorResponse{
+			Code:    "NEAR_DUPLICATE_MENU",
+			Message: "A similar menu has already been uploaded. Resubmit with on_duplicate=reuse or on_duplicate=force",
+		},
+		"duplicate": duplicate,
+	})
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// With DEMO_MODE, no request reaches OpenAI or Replicate: callProvider
+// answers each one from fixtures in the provider's own format, so frontend
+// development and demos need no API keys or budget. Every upload extracts as
+// the same small Italian menu. Descriptions, classifications, captions,
+// translations, and SEO metadata are made from the request, so the same
+// dish always gets the same ones. Images are flat placeholders labelled DEMO
+// that the service draws itself at /public/demo/images, under
+// PUBLIC_BASE_URL, or localhost on PORT when it is not set. Moderation
+// allows everything. The rest of the pipeline (budgets, usage, caches,
+// webhooks) runs as it does against the providers.
+
+// demoAPIKey stands in for provider keys that are not set in demo mode.
+const demoAPIKey = "demo"
+
+func demoMode() bool {
+	return getEnvBool("DEMO_MODE", false)
+}
+
+// demoProviderResponse answers a provider request the way the provider
+// would, from fixtures.
+func demoProviderResponse(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+
+	url := req.URL.String()
+	switch {
+	case strings.HasPrefix(url, openAIBaseURL()+"/"):
+		return demoOpenAIResponse(req, body)
+	case strings.HasPrefix(url, replicateBaseURL()+"/"):
+		return demoReplicateResponse(req, body, demoBaseURL()+"/public/demo/images")
+	}
+	return demoNotFound(req)
+}
+
+// demoOpenAIResponse answers an OpenAI request from fixtures.
+func demoOpenAIResponse(req *http.Request, body []byte) (*http.Response, error) {
+	switch {
+	case req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/v1/chat/completions"):
+		return demoChatCompletion(req, body)
+	case req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/v1/moderations"):
+		return jsonFixtureResponse(req, http.StatusOK, map[string]interface{}{
+			"results": []map[string]interface{}{{"flagged": false, "categories": map[string]bool{}}},
+		})
+	}
+	return demoNotFound(req)
+}
+
+// demoReplicateResponse answers a Replicate request from fixtures, with
+// placeholder images under imageBaseURL.
+func demoReplicateResponse(req *http.Request, body []byte, imageBaseURL string) (*http.Response, error) {
+	if req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/predictions") {
+		return demoPrediction(req, body, imageBaseURL)
+	}
+	return demoNotFound(req)
+}
+
+func demoNotFound(req *http.Request) (*http.Response, error) {
+	return jsonFixtureResponse(req, http.StatusNotFound, map[string]interface{}{
+		"error": fmt.Sprintf("no demo fixture for %s %s", req.Method, req.URL.Path),
+	})
+}
+
+// jsonFixtureResponse is a provider response with v as its JSON body.
+func jsonFixtureResponse(req *http.Request, status int, v interface{}) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return fixtureResponse(req, status, http.Header{"Content-Type": {"application/json"}}, data), nil
+}
+
+// fixtureResponse is a provider response to req that was never sent.
+func fixtureResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// demoChatRequest is the part of a chat completion request the fixtures
+// read. Content is a string for text requests and a list of parts for
+// vision ones.
+type demoChatRequest struct {
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format"`
+}
+
+func demoChatCompletion(req *http.Request, body []byte) (*http.Response, error) {
+	var request demoChatRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return jsonFixtureResponse(req, http.StatusBadRequest, map[string]interface{}{"error": "invalid request"})
+	}
+
+	var system, user string
+	for _, message := range request.Messages {
+		var text string
+		if err := json.Unmarshal(message.Content, &text); err != nil {
+			var parts []OpenAIContent
+			json.Unmarshal(message.Content, &parts)
+			for _, part := range parts {
+				if part.Text != nil {
+					text += *part.Text
+				}
+			}
+		}
+		if message.Role == "system" {
+			system = text
+		} else {
+			user = text
+		}
+	}
+
+	schemaName := ""
+	if request.ResponseFormat != nil {
+		schemaName = request.ResponseFormat.JSONSchema.Name
+	}
+	content, err := demoChatAnswer(schemaName, system, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rough token counts, so demo usage and spend are not all zero
+	return jsonFixtureResponse(req, http.StatusOK, OpenAIResponse{
+		Choices: []OpenAIChoice{{Message: OpenAIResponseMessage{Content: content}}},
+		Usage:   OpenAIUsage{PromptTokens: (len(system) + len(user)) / 4, CompletionTokens: len(content) / 4},
+	})
+}
+
+// demoChatAnswer is the model's answer to a chat request: JSON in the shape
+// of the named schema, or text for plain requests, which are descriptions.
+func demoChatAnswer(schemaName, system, user string) (string, error) {
+	if schemaName == "menu_structure" {
+		return demoMenuStructure, nil
+	}
+	if schemaName == "" {
+		return demoDescription(demoDishName(user)), nil
+	}
+
+	var answer interface{}
+	switch schemaName {
+	case "dish_descriptions":
+		answer = demoDescriptionBatch(user)
+	case "dietary_tags":
+		answer = map[string]interface{}{"tags": demoKeywordMatches(user, demoDietaryKeywords)}
+	case "allergens":
+		found := []map[string]interface{}{}
+		for _, allergen := range demoKeywordMatches(user, demoAllergenKeywords) {
+			found = append(found, map[string]interface{}{"allergen": allergen, "confidence": 0.8})
+		}
+		answer = map[string]interface{}{"allergens": found}
+	case "nutrition":
+		h := demoHash(demoDishName(user))
+		answer = map[string]interface{}{
+			"calories":      350 + int(h%500),
+			"protein_grams": 10 + int(h/7%30),
+			"carbs_grams":   20 + int(h/11%60),
+			"fat_grams":     8 + int(h/13%30),
+		}
+	case "social_post":
+		name := demoDishName(user)
+		answer = socialCaption{
+			Caption:  fmt.Sprintf("Say hello to our %s. Made fresh every day and even better in person. Come hungry!", name),
+			Hashtags: append(strings.Fields(name), "foodie", "eatlocal", "demo"),
+		}
+	case "menu_translation":
+		answer = demoTranslation(system, user)
+	case "menu_seo":
+		answer = demoSEO(user)
+	default:
+		answer = map[string]interface{}{}
+	}
+	data, err := json.Marshal(answer)
+	return string(data), err
+}
+
+// demoDishName finds the dish a prompt is about: the "Dish:" line of the
+// classifier and caption prompts, or what follows the last colon of the
+// first line, as in the default description prompt.
+func demoDishName(prompt string) string {
+	lines := strings.Split(prompt, "\n")
+	for _, line := range lines {
+		if name, ok := strings.CutPrefix(line, "Dish: "); ok {
+			return strings.TrimSpace(name)
+		}
+	}
+	name := lines[0]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return "this dish"
+	}
+	return name
+}
+
+var demoDescriptions = []string{
+	"%s, made fresh to order from seasonal ingredients and served the way our regulars love it.",
+	"A house favourite: %s, generously portioned and full of flavour.",
+	"%s, prepared by our kitchen every morning and plated with care.",
+}
+
+func demoDescription(dishName string) string {
+	return fmt.Sprintf(demoDescriptions[demoHash(dishName)%uint32(len(demoDescriptions))], dishName)
+}
+
+var demoBatchLinePattern = regexp.MustCompile(`^(\d+)\. (.+)$`)
+
+// demoDescriptionBatch describes each numbered dish of a batch prompt.
+func demoDescriptionBatch(user string) interface{} {
+	descriptions := []map[string]interface{}{}
+	for _, line := range strings.Split(user, "\n") {
+		match := demoBatchLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		descriptions = append(descriptions, map[string]interface{}{"number": number, "description": demoDescription(demoDishName(match[2]))})
+	}
+	return map[string]interface{}{"descriptions": descriptions}
+}
+
+var demoDietaryKeywords = map[string][]string{
+	"spicy":      {"diavola", "arrabbiata", "chili", "spicy"},
+	"vegetarian": {"margherita", "bruschetta", "burrata", "arrabbiata", "tiramisu", "affogato", "salad"},
+	"vegan":      {"arrabbiata", "bruschetta"},
+}
+
+var demoAllergenKeywords = map[string][]string{
+	"gluten":    {"bread", "bruschetta", "pizza", "margherita", "diavola", "pasta", "spaghetti", "penne", "linguine", "fritti", "tiramisu"},
+	"dairy":     {"cheese", "burrata", "mozzarella", "cream", "carbonara", "margherita", "diavola", "tiramisu", "affogato"},
+	"eggs":      {"carbonara", "tiramisu"},
+	"shellfish": {"lobster", "shrimp", "prawn"},
+	"fish":      {"anchovy", "salmon", "tuna"},
+}
+
+// demoKeywordMatches returns, in order, the keys of keywords with a word
+// found in the dish name of prompt.
+func demoKeywordMatches(prompt string, keywords map[string][]string) []string {
+	name := strings.ToLower(demoDishName(prompt))
+	matches := []string{}
+	for key, words := range keywords {
+		for _, word := range words {
+			if strings.Contains(name, word) {
+				matches = append(matches, key)
+				break
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+var demoLanguagePattern = regexp.MustCompile(`BCP 47 tag (\S+?)\.`)
+
+// demoTranslation "translates" the items of a translation prompt by tagging
+// them with the target language.
+func demoTranslation(system, user string) interface{} {
+	language := "xx"
+	if match := demoLanguagePattern.FindStringSubmatch(system); match != nil {
+		language = match[1]
+	}
+	var items []translationItem
+	json.Unmarshal([]byte(user), &items)
+	for i := range items {
+		items[i].Name = "[" + language + "] " + items[i].Name
+		if items[i].Description != "" {
+			items[i].Description = "[" + language + "] " + items[i].Description
+		}
+	}
+	return map[string]interface{}{"items": items}
+}
+
+// demoSEO writes page metadata from the restaurant and dishes in an SEO
+// prompt.
+func demoSEO(user string) MenuSEO {
+	name := "Our restaurant"
+	var dishes []string
+	for _, line := range strings.Split(user, "\n") {
+		if value, ok := strings.CutPrefix(line, "Restaurant: "); ok {
+			name = value
+		} else if value, ok := strings.CutPrefix(line, "Menu: "); ok {
+			name = value
+		} else if value, ok := strings.CutPrefix(line, "- "); ok && len(dishes) < 3 {
+			dishes = append(dishes, strings.SplitN(value, ":", 2)[0])
+		}
+	}
+	description := fmt.Sprintf("See the menu of %s", name)
+	if len(dishes) > 0 {
+		description += ": " + strings.Join(dishes, ", ") + " and more"
+	}
+	return MenuSEO{
+		Title:         name + " - Menu",
+		Description:   description + ".",
+		OGTitle:       "The menu of " + name,
+		OGDescription: description + ". Take a look before you visit.",
+	}
+}
+
+// demoPrediction answers a Replicate prediction with placeholder images,
+// finished straight away. Upscaling gives back the image it was given.
+func demoPrediction(req *http.Request, body []byte, imageBaseURL string) (*http.Response, error) {
+	var request struct {
+		Input struct {
+			Prompt      string `json:"prompt"`
+			AspectRatio string `json:"aspect_ratio"`
+			NumOutputs  int    `json:"num_outputs"`
+			Image       string `json:"image"`
+		} `json:"input"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return jsonFixtureResponse(req, http.StatusBadRequest, map[string]interface{}{"detail": "invalid request"})
+	}
+
+	var output []string
+	if request.Input.Image != "" {
+		output = []string{request.Input.Image}
+	} else {
+		width, height := demoImageSize(request.Input.AspectRatio)
+		for i := 0; i < max(request.Input.NumOutputs, 1); i++ {
+			seed := demoHash(fmt.Sprintf("%s#%d", request.Input.Prompt, i))
+			output = append(output, fmt.Sprintf("%s/%d-%dx%d.png", imageBaseURL, seed, width, height))
+		}
+	}
+	return jsonFixtureResponse(req, http.StatusCreated, ReplicateResponse{
+		ID:     fmt.Sprintf("demo-%08x", demoHash(string(body))),
+		Status: "succeeded",
+		Output: output,
+	})
+}
+
+// demoImageSize is the size of a placeholder in aspectRatio, such as 16:9,
+// 1024 pixels on its long side.
+func demoImageSize(aspectRatio string) (int, int) {
+	var w, h int
+	if _, err := fmt.Sscanf(aspectRatio, "%d:%d", &w, &h); err != nil || w <= 0 || h <= 0 {
+		return 1024, 1024
+	}
+	if w >= h {
+		return 1024, max(1024*h/w, 1)
+	}
+	return max(1024*w/h, 1), 1024
+}
+
+func demoBaseURL() string {
+	if base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/"); base != "" {
+		return base
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+// demoImageColors are the placeholder colors, picked by seed.
+var demoImageColors = []color.RGBA{
+	{R: 0xC8, G: 0x4B, B: 0x31, A: 0xFF},
+	{R: 0x6A, G: 0x8D, B: 0x45, A: 0xFF},
+	{R: 0xE3, G: 0xA7, B: 0x2F, A: 0xFF},
+	{R: 0x7B, G: 0x3F, B: 0x61, A: 0xFF},
+	{R: 0x3E, G: 0x6E, B: 0x8E, A: 0xFF},
+	{R: 0xA8, G: 0x6B, B: 0x3C, A: 0xFF},
+	{R: 0x4F, G: 0x7A, B: 0x6B, A: 0xFF},
+	{R: 0xD9, G: 0x7D, B: 0x54, A: 0xFF},
+}
+
+// demoImageHandler serves the placeholder named seed-WxH.png. It is only
+// served in demo mode.
+func demoImageHandler(c *gin.Context) {
+	if !demoMode() {
+		respondError(c, http.StatusNotFound, "IMAGE_NOT_FOUND", "Image not found")
+		return
+	}
+	data, contentType, err := drawDemoImage(c.Param("name"))
+	if errors.Is(err, errDemoImageName) {
+		respondError(c, http.StatusNotFound, "IMAGE_NOT_FOUND", "Image not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to draw image")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+var errDemoImageName = errors.New("not a demo image name")
+
+// drawDemoImage draws the placeholder named seed-WxH.png.
+func drawDemoImage(name string) ([]byte, string, error) {
+	var seed uint32
+	var width, height int
+	_, err := fmt.Sscanf(name, "%d-%dx%d.png", &seed, &width, &height)
+	if err != nil || width < 64 || height < 64 || width > 1024 || height > 1024 {
+		return nil, "", errDemoImageName
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(demoImageColors[seed%uint32(len(demoImageColors))]), image.Point{}, draw.Src)
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, "", err
+	}
+	return stampWatermark(out.Bytes(), "DEMO")
+}
+
+func demoHash(text string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(text))
+	return h.Sum32()
+}
+
+// demoMenuStructure is what every menu extracts as in demo mode.
+const demoMenuStructure = `{
+  "currency": "USD",
+  "cuisine": "italian",
+  "language": "en",
+  "sections": [
+    {
+      "name": "Antipasti",
+      "dishes": [
+        {"name": "Bruschetta al Pomodoro", "price": "9.00", "price_type": "fixed", "dietary_tags": ["vegan"]},
+        {"name": "Calamari Fritti", "price": "14.00", "price_type": "fixed"},
+        {"name": "Burrata", "price": "16.00", "price_type": "fixed", "dietary_tags": ["vegetarian"],
+         "modifiers": [{"type": "add_on", "name": "Prosciutto di Parma", "price": "+$5"}]}
+      ]
+    },
+    {
+      "name": "Pizza",
+      "modifiers": [
+        {"type": "choice", "group": "crust", "name": "Classic", "price": ""},
+        {"type": "choice", "group": "crust", "name": "Gluten-free", "price": "+$3"}
+      ],
+      "dishes": [
+        {"name": "Margherita", "price_type": "range", "dietary_tags": ["vegetarian"],
+         "variants": [{"name": "10\"", "price": "14.00"}, {"name": "14\"", "price": "19.00"}]},
+        {"name": "Diavola", "price_type": "range", "spice_level": 2,
+         "variants": [{"name": "10\"", "price": "16.00"}, {"name": "14\"", "price": "21.00"}]}
+      ]
+    },
+    {
+      "name": "Pasta",
+      "dishes": [
+        {"name": "Spaghetti Carbonara", "price": "18.00", "price_type": "fixed"},
+        {"name": "Penne all'Arrabbiata", "price": "16.00", "price_type": "fixed", "spice_level": 2, "dietary_tags": ["vegan"]},
+        {"name": "Lobster Linguine", "price": "MP", "price_type": "market"}
+      ]
+    },
+    {
+      "name": "Dolci",
+      "dishes": [
+        {"name": "Tiramisu", "price": "9.00", "price_type": "fixed"},
+        {"name": "Affogato", "price": "7.00", "price_type": "fixed", "dietary_tags": ["vegetarian", "gluten_free"]}
+      ]
+    }
+  ]
+}`
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// A menu's dishes are described DESCRIPTION_BATCH_SIZE (15, at most 20) at a
+// time in one structured request rather than one request each, which cuts a
+// long menu's latency and cost. Dishes keep going through the worker pool one
+// by one: the first of a batch to need its description sends the batch, and
+// the others pick theirs up from it. A dish the answer leaves out, one whose
+// description moderation flags, and every dish of a batch that fails are
+// described on their own as before. Dishes with a catalog or cached
+// description are left out of batches. DESCRIPTION_BATCH_SIZE=1 turns
+// batching off.
+
+const (
+	defaultDescriptionBatchSize = 15
+	maxDescriptionBatchSize     = 20
+	// Tokens allowed per dish of a batch, as for a single description
+	descriptionTokensPerDish = 100
+)
+
+func descriptionBatchSize() int {
+	return min(max(getEnvInt("DESCRIPTION_BATCH_SIZE", defaultDescriptionBatchSize), 1), maxDescriptionBatchSize)
+}
+
+// descriptionBatch is a group of a menu's dishes described in one request.
+type descriptionBatch struct {
+	menuID string
+	dishes []batchDish
+
+	once         sync.Once
+	descriptions map[string]string // by descriptionBatchKey
+	record       *GenerationRecord
+}
+
+type batchDish struct {
+	Name    string
+	Cuisine string
+}
+
+func descriptionBatchKey(dishName, cuisine string) string {
+	return dishName + "\x00" + cuisine
+}
+
+// descriptionBatches maps the dishes of a menu being enhanced to their
+// batches, by descriptionBatchKey. It travels in the context.
+type descriptionBatches map[string]*descriptionBatch
+
+type descriptionBatchesKey struct{}
+
+func withDescriptionBatches(ctx context.Context, batches descriptionBatches) context.Context {
+	if len(batches) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, descriptionBatchesKey{}, batches)
+}
+
+// descriptionBatchFor returns the dish's batch, or nil when it has none.
+func descriptionBatchFor(ctx context.Context, dishName, cuisine string) *descriptionBatch {
+	batches, _ := ctx.Value(descriptionBatchesKey{}).(descriptionBatches)
+	return batches[descriptionBatchKey(dishName, cuisine)]
+}
+
+// planDescriptionBatches groups the dishes of dishIDs that will need a new
+// description into batches, in menu order. Dishes of the same name and
+// cuisine share one description.
+func planDescriptionBatches(ctx context.Context, menuID string, dishIDs []string) descriptionBatches {
+	size := descriptionBatchSize()
+	if size < 2 || len(dishIDs) < 2 {
+		return nil
+	}
+
+	var dishes []Dish
+	if err := db.WithContext(ctx).Select("id", "name", "cuisine", "description", "edited_by_user").
+		Where("id IN ?", dishIDs).Find(&dishes).Error; err != nil {
+		logFor(ctx).Warn("Failed to load dishes for description batches", zap.String("menuID", menuID), zap.Error(err))
+		return nil
+	}
+	byID := make(map[string]Dish, len(dishes))
+	for _, dish := range dishes {
+		byID[dish.ID] = dish
+	}
+
+	useCache := descriptionCacheTTL() > 0 && menuUsesDescriptionCache(menuID)
+	batches := descriptionBatches{}
+	var batch *descriptionBatch
+	for _, id := range dishIDs {
+		dish, ok := byID[id]
+		if !ok || dish.EditedByUser && dish.Description != nil {
+			continue
+		}
+		key := descriptionBatchKey(dish.Name, dish.Cuisine)
+		if _, planned := batches[key]; planned || descriptionReusable(ctx, dish.Name, dish.Cuisine, useCache) {
+			continue
+		}
+		if batch == nil || len(batch.dishes) == size {
+			batch = &descriptionBatch{menuID: menuID}
+		}
+		batch.dishes = append(batch.dishes, batchDish{Name: dish.Name, Cuisine: dish.Cuisine})
+		batches[key] = batch
+	}
+	return batches
+}
+
+// describe returns the batch's description of the dish, sending the batch
+// if no dish of it has yet. ok is false when the batch failed or left the
+// dish out.
+func (b *descriptionBatch) describe(ctx context.Context, dishName, cuisine string) (string, *GenerationRecord, bool) {
+	b.once.Do(func() {
+		b.generate(ctx)
+	})
+	description := b.descriptions[descriptionBatchKey(dishName, cuisine)]
+	if description == "" {
+		return "", nil, false
+	}
+
+	// Moderation adds to the parameters, so each dish gets its own
+	record := *b.record
+	record.Parameters = make(map[string]interface{}, len(b.record.Parameters))
+	for name, value := range b.record.Parameters {
+		record.Parameters[name] = value
+	}
+	record.GeneratedAt = clock.Now()
+	return description, &record, true
+}
+
+// generate asks OpenAI for the descriptions of the batch's dishes. Failures
+// are logged; the dishes are then described one by one.
+func (b *descriptionBatch) generate(ctx context.Context) {
+	prompts := loadMenuPrompts(b.menuID)
+	systemPrompt := "You are a food writer. Generate a brief, appetizing description (1-2 sentences) for each of the numbered dishes. Be descriptive but concise. " +
+		"Describe every dish on its own, without comparing it to the others, and answer with each description under its dish's number."
+
+	var prompt strings.Builder
+	for i, dish := range b.dishes {
+		// Templates may span lines; each dish keeps to its own
+		fmt.Fprintf(&prompt, "%d. %s\n", i+1, strings.Join(strings.Fields(prompts.render(promptDescription, dish.Name, dish.Cuisine)), " "))
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"descriptions": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"number":      map[string]interface{}{"type": "integer"},
+						"description": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"number", "description"},
+				},
+			},
+		},
+		"required": []string{"descriptions"},
+	}
+
+	var result struct {
+		Descriptions []struct {
+			Number      int    `json:"number"`
+			Description string `json:"description"`
+		} `json:"descriptions"`
+	}
+	maxTokens := descriptionTokensPerDish * len(b.dishes)
+	err := requestStructured(ctx, b.menuID, structuredRequest{
+		Stage:        stageDescribe,
+		SchemaName:   "dish_descriptions",
+		SystemPrompt: systemPrompt,
+		UserPrompt:   prompt.String(),
+		Schema:       schema,
+		MaxTokens:    maxTokens,
+		Timeout:      loadProviderTimeouts().DescriptionBatch,
+	}, &result)
+	if err != nil {
+		if !interrupted(ctx) {
+			logFor(ctx).Warn("Failed to generate description batch", zap.String("menuID", b.menuID), zap.Int("dishes", len(b.dishes)), zap.Error(err))
+		}
+		return
+	}
+
+	b.descriptions = make(map[string]string, len(b.dishes))
+	for _, answer := range result.Descriptions {
+		if answer.Number < 1 || answer.Number > len(b.dishes) {
+			continue
+		}
+		dish := b.dishes[answer.Number-1]
+		b.descriptions[descriptionBatchKey(dish.Name, dish.Cuisine)] = strings.TrimSpace(answer.Description)
+	}
+	if missing := len(b.dishes) - len(b.descriptions); missing > 0 {
+		logFor(ctx).Warn("Description batch left dishes out", zap.String("menuID", b.menuID), zap.Int("dishes", len(b.dishes)), zap.Int("missing", missing))
+	}
+	b.record = &GenerationRecord{
+		Provider:     "openai",
+		Model:        "gpt-4o-mini",
+		SystemPrompt: systemPrompt,
+		Prompt:       prompt.String(),
+		Parameters:   map[string]interface{}{"max_tokens": maxTokens, "tone": "", "batch_size": len(b.dishes)},
+		GeneratedAt:  clock.Now(),
+	}
+}
+
+// generateBatchedDescription writes a new description for the dish in the
+// default voice, taking it from the dish's batch when it has one. Should
+// moderation flag that one, the dish is described on its own.
+func generateBatchedDescription(ctx context.Context, menuID, dishName, cuisine string) (string, *GenerationRecord, error) {
+	batch := descriptionBatchFor(ctx, dishName, cuisine)
+	if batch == nil {
+		return generateDishDescription(ctx, menuID, dishName, cuisine, "")
+	}
+	fromBatch := true
+	return moderatedDescription(ctx, menuID, func() (string, *GenerationRecord, error) {
+		if fromBatch {
+			fromBatch = false
+			if description, record, ok := batch.describe(ctx, dishName, cuisine); ok {
+				return description, record, nil
+			}
+		}
+		return requestDishDescription(ctx, menuID, dishName, cuisine, "")
+	})
+}
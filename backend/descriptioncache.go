@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The same dishes appear on many menus, so descriptions are cached by
+// normalized dish name and cuisine, language, and tone, and reused for
+// DESCRIPTION_CACHE_TTL (30 days; 0 turns the cache off) instead of asking
+// OpenAI again. Uploads with unique_descriptions=true always get fresh ones,
+// as do regenerations, which are not cached either. The retention janitor
+// deletes expired entries.
+
+// descriptionLanguage is the language descriptions are written in; the
+// prompts ask for English.
+const descriptionLanguage = "en"
+
+// DescriptionCacheEntry is a generated description shared by every dish with
+// the same normalized name.
+type DescriptionCacheEntry struct {
+	Name        string            `gorm:"primaryKey;type:varchar(200)"`
+	Language    string            `gorm:"primaryKey;type:varchar(10)"`
+	Tone        string            `gorm:"primaryKey;type:varchar(20)"`
+	Description string            `gorm:"type:text"`
+	Record      *GenerationRecord `gorm:"type:jsonb"`
+	Hits        int64             `gorm:"default:0"`
+	CreatedAt   time.Time         `gorm:"index"`
+}
+
+func descriptionCacheTTL() time.Duration {
+	return getEnvDuration("DESCRIPTION_CACHE_TTL", 30*24*time.Hour)
+}
+
+// describeDish returns a description for a dish of the menu: the catalog
+// dish's when an operator set one, otherwise from the cache when the menu
+// allows it, otherwise a new one from the dish's batch or its own request.
+func describeDish(ctx context.Context, menuID, dishName, cuisine string) (string, *GenerationRecord, error) {
+	if entry := curatedCatalogDish(ctx, dishName); entry != nil && entry.Description != nil {
+		return *entry.Description, catalogRecord(entry), nil
+	}
+
+	name := descriptionCacheName(dishName, cuisine)
+	ttl := descriptionCacheTTL()
+	if name == "" || ttl <= 0 || !menuUsesDescriptionCache(menuID) {
+		return generateBatchedDescription(ctx, menuID, dishName, cuisine)
+	}
+
+	var entry DescriptionCacheEntry
+	err := db.WithContext(ctx).Where("name = ? AND language = ? AND tone = ? AND created_at > ?", name, descriptionLanguage, "", clock.Now().Add(-ttl)).
+		Take(&entry).Error
+	if err == nil && entry.Record != nil {
+		if err := db.Model(&DescriptionCacheEntry{}).Where("name = ? AND language = ? AND tone = ?", name, descriptionLanguage, "").
+			UpdateColumn("hits", gorm.Expr("hits + 1")).Error; err != nil {
+			logFor(ctx).Warn("Failed to count description cache hit", zap.Error(err))
+		}
+		record := *entry.Record
+		record.Cached = true
+		record.GeneratedAt = clock.Now()
+		return entry.Description, &record, nil
+	}
+
+	description, record, err := generateBatchedDescription(ctx, menuID, dishName, cuisine)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&DescriptionCacheEntry{
+		Name:        name,
+		Language:    descriptionLanguage,
+		Tone:        "",
+		Description: description,
+		Record:      record,
+		CreatedAt:   clock.Now(),
+	}).Error; err != nil {
+		logFor(ctx).Warn("Failed to cache description", zap.String("dish", dishName), zap.Error(err))
+	}
+	return description, record, nil
+}
+
+// descriptionReusable reports whether describeDish has a description for
+// the dish without generating one. useCache is whether the dish's menu
+// allows cached descriptions.
+func descriptionReusable(ctx context.Context, dishName, cuisine string, useCache bool) bool {
+	if entry := curatedCatalogDish(ctx, dishName); entry != nil && entry.Description != nil {
+		return true
+	}
+	name := descriptionCacheName(dishName, cuisine)
+	if !useCache || name == "" {
+		return false
+	}
+	var count int64
+	if err := db.WithContext(ctx).Model(&DescriptionCacheEntry{}).
+		Where("name = ? AND language = ? AND tone = ? AND created_at > ? AND record IS NOT NULL", name, descriptionLanguage, "", clock.Now().Add(-descriptionCacheTTL())).
+		Count(&count).Error; err != nil {
+		logFor(ctx).Warn("Failed to look up cached description", zap.String("dish", dishName), zap.Error(err))
+		return false
+	}
+	return count > 0
+}
+
+// descriptionCacheName is the cache key of a dish name in cuisine, as in
+// "thai: fried rice", or "" for names that are not cached.
+func descriptionCacheName(dishName, cuisine string) string {
+	name := canonicalDishName(dishName)
+	if name == "" || cuisine == "" {
+		return name
+	}
+	if name = cuisine + ": " + name; len(name) > 200 {
+		return ""
+	}
+	return name
+}
+
+// menuUsesDescriptionCache reports whether the menu was uploaded without
+// unique_descriptions or a description prompt of its own.
+func menuUsesDescriptionCache(menuID string) bool {
+	var menu Menu
+	if err := db.Select("id", "unique_descriptions", "prompt_templates").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		zapLog.Warn("Failed to load menu description settings", zap.String("menuID", menuID), zap.Error(err))
+		return false
+	}
+	return !menu.UniqueDescriptions && (menu.PromptTemplates == nil || menu.PromptTemplates.Description == "")
+}
+
+// purgeExpiredDescriptions deletes cache entries past the TTL and returns
+// how many it deleted.
+func purgeExpiredDescriptions(ctx context.Context) (int64, error) {
+	ttl := descriptionCacheTTL()
+	if ttl <= 0 {
+		return 0, nil
+	}
+	result := db.WithContext(ctx).Where("created_at < ?", clock.Now().Add(-ttl)).Delete(&DescriptionCacheEntry{})
+	return result.RowsAffected, result.Error
+}
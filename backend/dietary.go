@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dishes are tagged with the diets they suit. Tags the menu prints, as
+// markers such as "(V)" or "GF" and the legend explaining them, are read
+// during extraction, and markers at the end of a dish name are taken off
+// it. The others are inferred from the dish's name and description during
+// enhancement, unless DIETARY_TAGS_ENABLED is false. Each tag keeps its
+// source, since an inferred tag is a guess that guests with strict diets
+// should not rely on.
+
+const (
+	DishTagSourceMenu     = "menu"
+	DishTagSourceInferred = "inferred"
+)
+
+// dietaryTags are the tags dishes can have.
+var dietaryTags = []string{"vegetarian", "vegan", "gluten_free", "dairy_free", "nut_free", "halal", "kosher", "spicy"}
+
+// dietaryMarkers maps the common menu markers to tags.
+var dietaryMarkers = map[string]string{
+	"v":  "vegetarian",
+	"vg": "vegan",
+	"ve": "vegan",
+	"gf": "gluten_free",
+	"df": "dairy_free",
+	"nf": "nut_free",
+	"h":  "halal",
+}
+
+// dietaryMarkerPattern finds markers at the end of a dish name, as in
+// "Falafel Wrap (V, GF)".
+var dietaryMarkerPattern = regexp.MustCompile(`\s*[(\[]\s*([A-Za-z]{1,2}(?:\s*[,/ ]\s*[A-Za-z]{1,2})*)\s*[)\]]\s*$`)
+
+// DishTag is a diet a dish suits.
+type DishTag struct {
+	DishID    string    `json:"dish_id" gorm:"primaryKey;type:uuid"`
+	Tag       string    `json:"tag" gorm:"primaryKey;type:varchar(20)"`
+	MenuID    string    `json:"menu_id" gorm:"type:uuid;index"`
+	Source    string    `json:"source" gorm:"type:varchar(10)"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DishTagResponse is a tag as returned with its dish.
+type DishTagResponse struct {
+	Tag    string `json:"tag"`
+	Source string `json:"source"`
+}
+
+func dietaryTagsEnabled() bool {
+	return getEnvBool("DIETARY_TAGS_ENABLED", true)
+}
+
+// splitDietaryMarkers takes the markers off the end of a dish name and
+// returns the name without them and the tags they mark. Names whose trailing
+// parentheses are not all known markers are left alone.
+func splitDietaryMarkers(name string) (string, []string) {
+	match := dietaryMarkerPattern.FindStringSubmatchIndex(name)
+	if match == nil {
+		return name, nil
+	}
+	var tags []string
+	for _, marker := range strings.FieldsFunc(name[match[2]:match[3]], func(r rune) bool { return r == ',' || r == '/' || r == ' ' }) {
+		tag, ok := dietaryMarkers[strings.ToLower(marker)]
+		if !ok {
+			return name, nil
+		}
+		tags = append(tags, tag)
+	}
+	if stripped := strings.TrimSpace(name[:match[0]]); stripped != "" {
+		name = stripped
+	}
+	return name, tags
+}
+
+// knownDietaryTags keeps the tags that are dietaryTags, once each.
+func knownDietaryTags(tags []string) []string {
+	var known []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if slices.Contains(dietaryTags, tag) && !slices.Contains(known, tag) {
+			known = append(known, tag)
+		}
+	}
+	return known
+}
+
+// createDishTags stores tags of a dish in tx, keeping tags it already has.
+func createDishTags(tx *gorm.DB, dish Dish, tags []string, source string) error {
+	tags = knownDietaryTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]DishTag, len(tags))
+	for i, tag := range tags {
+		rows[i] = DishTag{DishID: dish.ID, Tag: tag, MenuID: dish.MenuID, Source: source, CreatedAt: clock.Now()}
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// tagDish infers the diets a dish suits and replaces its earlier inferred
+// tags with them. Failures are logged; the dish keeps its old tags.
+func tagDish(ctx context.Context, dish Dish, description string) {
+	if !dietaryTagsEnabled() {
+		return
+	}
+	tags, err := inferDietaryTags(ctx, dish.MenuID, dish.Name, description)
+	if err != nil {
+		logFor(ctx).Warn("Failed to infer dietary tags", zap.String("dishID", dish.ID), zap.String("menuID", dish.MenuID), zap.Error(err))
+		return
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("dish_id = ? AND source = ?", dish.ID, DishTagSourceInferred).Delete(&DishTag{}).Error; err != nil {
+			return err
+		}
+		return createDishTags(tx, dish, tags, DishTagSourceInferred)
+	})
+	if err != nil {
+		logFor(ctx).Error("Failed to store dietary tags", zap.String("dishID", dish.ID), zap.String("menuID", dish.MenuID), zap.Error(err))
+	}
+}
+
+// inferDietaryTags asks OpenAI which diets a dish suits.
+func inferDietaryTags(ctx context.Context, menuID, dishName, description string) ([]string, error) {
+	systemPrompt := "You classify restaurant dishes by diet. From the dish name and description, list the diets the dish as usually prepared suits. " +
+		"Only include a diet when the dish clearly suits it; when unsure, leave it out. spicy means noticeably hot."
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string", "enum": dietaryTags},
+			},
+		},
+		"required": []string{"tags"},
+	}
+
+	var result struct {
+		Tags []string `json:"tags"`
+	}
+	if err := classifyDish(ctx, menuID, "dietary_tags", systemPrompt, dishPrompt(dishName, description), schema, 60, &result); err != nil {
+		return nil, err
+	}
+	return knownDietaryTags(result.Tags), nil
+}
+
+// dishPrompt describes a dish to the classifiers.
+func dishPrompt(dishName, description string) string {
+	prompt := "Dish: " + dishName
+	if description != "" {
+		prompt += "\nDescription: " + description
+	}
+	return prompt
+}
+
+// classifyDish asks OpenAI to answer prompts about a dish in the JSON shape
+// schema describes and decodes the answer into result.
+func classifyDish(ctx context.Context, menuID, schemaName, systemPrompt, userPrompt string, schema map[string]interface{}, maxTokens int, result interface{}) error {
+	return requestStructured(ctx, menuID, structuredRequest{
+		Stage:        stageClassify,
+		SchemaName:   schemaName,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Schema:       schema,
+		MaxTokens:    maxTokens,
+		Timeout:      loadProviderTimeouts().Description,
+	}, result)
+}
+
+// attachDishTags loads the tags of the menu's dishes for responses.
+func attachDishTags(menu *Menu) error {
+	var tags []DishTag
+	if err := db.Where("menu_id = ?", menu.ID).Order("tag").Find(&tags).Error; err != nil {
+		return err
+	}
+
+	byDish := make(map[string][]DishTag)
+	for _, tag := range tags {
+		byDish[tag.DishID] = append(byDish[tag.DishID], tag)
+	}
+	for i := range menu.Dishes {
+		menu.Dishes[i].Tags = byDish[menu.Dishes[i].ID]
+	}
+	return nil
+}
+
+func toTagResponses(tags []DishTag) []DishTagResponse {
+	if len(tags) == 0 {
+		return nil
+	}
+	responses := make([]DishTagResponse, len(tags))
+	for i, tag := range tags {
+		responses[i] = DishTagResponse{Tag: tag.Tag, Source: tag.Source}
+	}
+	return responses
+}
+
+// parseTagFilter reads the ?tag= filters of a request, repeated or
+// comma-separated. It returns false if any is not a known tag.
+func parseTagFilter(values []string) ([]string, bool) {
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" {
+				continue
+			}
+			if !slices.Contains(dietaryTags, tag) {
+				return nil, false
+			}
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags, true
+}
+
+// filterDishesByTags keeps the dishes that have every one of tags.
+func filterDishesByTags(dishes []Dish, tags []string) []Dish {
+	if len(tags) == 0 {
+		return dishes
+	}
+	kept := dishes[:0]
+	for _, dish := range dishes {
+		matches := 0
+		for _, tag := range dish.Tags {
+			if slices.Contains(tags, tag.Tag) {
+				matches++
+			}
+		}
+		if matches == len(tags) {
+			kept = append(kept, dish)
+		}
+	}
+	return kept
+}
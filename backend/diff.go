@@ -0,0 +1,307 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renameSimilarity is the minimum name similarity (0-1) for an unmatched
+// removed/added pair in the same section to be reported as a rename.
+const renameSimilarity = 0.6
+
+type MenuDiffDish struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Section        string  `json:"section,omitempty"`
+	PriceCents     *int    `json:"price_cents"`
+	Currency       string  `json:"currency"`
+	RawPriceString *string `json:"raw_price_string"`
+}
+
+type MenuDiffRename struct {
+	From MenuDiffDish `json:"from"`
+	To   MenuDiffDish `json:"to"`
+}
+
+type MenuDiffPriceChange struct {
+	Name          string `json:"name"`
+	Section       string `json:"section,omitempty"`
+	OldPriceCents *int   `json:"old_price_cents"`
+	NewPriceCents *int   `json:"new_price_cents"`
+	Currency      string `json:"currency"`
+}
+
+type MenuDiffTarget struct {
+	MenuID  string `json:"menu_id"`
+	Version *int   `json:"version,omitempty"`
+}
+
+type MenuDiffSummary struct {
+	Added        int `json:"added"`
+	Removed      int `json:"removed"`
+	Renamed      int `json:"renamed"`
+	PriceChanges int `json:"price_changes"`
+}
+
+type MenuDiffResponse struct {
+	MenuID       string                `json:"menu_id"`
+	Against      MenuDiffTarget        `json:"against"`
+	Added        []MenuDiffDish        `json:"added"`
+	Removed      []MenuDiffDish        `json:"removed"`
+	Renamed      []MenuDiffRename      `json:"renamed"`
+	PriceChanges []MenuDiffPriceChange `json:"price_changes"`
+	Summary      MenuDiffSummary       `json:"summary"`
+}
+
+// menuDiffHandler compares the menu with an older baseline: another menu
+// (?against=<menuId>, e.g. last month's upload) or one of its own versions
+// (?version=<n>). Changes are reported from the baseline to this menu.
+func menuDiffHandler(c *gin.Context) {
+	menu, ok := loadCompleteMenu(c)
+	if !ok {
+		return
+	}
+
+	against := c.Query("against")
+	versionParam := c.Query("version")
+	if (against == "") == (versionParam == "") {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "Specify exactly one of against or version")
+		return
+	}
+
+	response := MenuDiffResponse{MenuID: menu.ID}
+	var baseline []MenuDiffDish
+	byID := false
+
+	if against != "" {
+		// The baseline has to be visible to the caller like the menu itself
+		visible, err := menuVisibleTo(against, currentUserID(c), currentAPIKeyID(c))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load menu")
+			return
+		}
+		if !visible {
+			respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+			return
+		}
+		other, ok := loadCompleteMenuByID(c, against)
+		if !ok {
+			return
+		}
+		response.Against = MenuDiffTarget{MenuID: other.ID}
+		baseline = toMenuDiffDishes(other.Sections, other.Dishes)
+	} else {
+		number, err := strconv.Atoi(versionParam)
+		if err != nil {
+			respondFieldError(c, "version", "type", "version must be a number")
+			return
+		}
+		var version MenuVersion
+		if err := db.Where("menu_id = ? AND version = ?", menu.ID, number).First(&version).Error; err != nil {
+			respondError(c, http.StatusNotFound, "VERSION_NOT_FOUND", "Version not found")
+			return
+		}
+		response.Against = MenuDiffTarget{MenuID: menu.ID, Version: &version.Version}
+		baseline = toMenuDiffDishes(version.Snapshot.Sections, version.Snapshot.Dishes)
+		// Dish IDs are stable across versions of the same menu
+		byID = true
+	}
+
+	diffMenus(&response, baseline, toMenuDiffDishes(menu.Sections, menu.Dishes), byID)
+	c.JSON(http.StatusOK, response)
+}
+
+func toMenuDiffDishes(sections []MenuSection, dishes []Dish) []MenuDiffDish {
+	sectionNames := make(map[string]string, len(sections))
+	for _, section := range sections {
+		sectionNames[section.ID] = section.Name
+	}
+
+	result := make([]MenuDiffDish, len(dishes))
+	for i, dish := range dishes {
+		result[i] = MenuDiffDish{
+			ID:             dish.ID,
+			Name:           dish.Name,
+			PriceCents:     dish.PriceCents,
+			Currency:       dish.Currency,
+			RawPriceString: dish.RawPriceString,
+		}
+		if dish.SectionID != nil {
+			result[i].Section = sectionNames[*dish.SectionID]
+		}
+	}
+	return result
+}
+
+// diffMenus matches baseline dishes to current ones, by ID when byID is set
+// and by normalized name otherwise, then pairs leftovers in the same section
+// with similar names as renames.
+func diffMenus(response *MenuDiffResponse, baseline, current []MenuDiffDish, byID bool) {
+	key := func(dish MenuDiffDish) string {
+		if byID {
+			return dish.ID
+		}
+		return normalizeDishName(dish.Name)
+	}
+
+	currentByKey := make(map[string][]int, len(current))
+	for i, dish := range current {
+		currentByKey[key(dish)] = append(currentByKey[key(dish)], i)
+	}
+
+	matched := make([]bool, len(current))
+	var removed []MenuDiffDish
+	for _, old := range baseline {
+		candidates := currentByKey[key(old)]
+		if len(candidates) == 0 {
+			removed = append(removed, old)
+			continue
+		}
+		i := candidates[0]
+		currentByKey[key(old)] = candidates[1:]
+		matched[i] = true
+
+		if byID && normalizeDishName(old.Name) != normalizeDishName(current[i].Name) {
+			response.Renamed = append(response.Renamed, MenuDiffRename{From: old, To: current[i]})
+		}
+		addPriceChange(response, old, current[i])
+	}
+
+	var added []MenuDiffDish
+	for i, dish := range current {
+		if !matched[i] {
+			added = append(added, dish)
+		}
+	}
+
+	if !byID {
+		added, removed = pairRenames(response, added, removed)
+	}
+
+	response.Added = added
+	response.Removed = removed
+	if response.Added == nil {
+		response.Added = []MenuDiffDish{}
+	}
+	if response.Removed == nil {
+		response.Removed = []MenuDiffDish{}
+	}
+	if response.Renamed == nil {
+		response.Renamed = []MenuDiffRename{}
+	}
+	if response.PriceChanges == nil {
+		response.PriceChanges = []MenuDiffPriceChange{}
+	}
+	response.Summary = MenuDiffSummary{
+		Added:        len(response.Added),
+		Removed:      len(response.Removed),
+		Renamed:      len(response.Renamed),
+		PriceChanges: len(response.PriceChanges),
+	}
+}
+
+// pairRenames greedily pairs removed and added dishes from the same section
+// whose names are similar enough, most similar first.
+func pairRenames(response *MenuDiffResponse, added, removed []MenuDiffDish) ([]MenuDiffDish, []MenuDiffDish) {
+	type candidate struct {
+		removed, added int
+		score          float64
+	}
+
+	var candidates []candidate
+	for r, old := range removed {
+		for a, dish := range added {
+			if !strings.EqualFold(old.Section, dish.Section) {
+				continue
+			}
+			if score := nameSimilarity(old.Name, dish.Name); score >= renameSimilarity {
+				candidates = append(candidates, candidate{removed: r, added: a, score: score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	usedRemoved := make([]bool, len(removed))
+	usedAdded := make([]bool, len(added))
+	for _, pair := range candidates {
+		if usedRemoved[pair.removed] || usedAdded[pair.added] {
+			continue
+		}
+		usedRemoved[pair.removed] = true
+		usedAdded[pair.added] = true
+		response.Renamed = append(response.Renamed, MenuDiffRename{From: removed[pair.removed], To: added[pair.added]})
+		addPriceChange(response, removed[pair.removed], added[pair.added])
+	}
+
+	var remainingAdded, remainingRemoved []MenuDiffDish
+	for i, dish := range added {
+		if !usedAdded[i] {
+			remainingAdded = append(remainingAdded, dish)
+		}
+	}
+	for i, dish := range removed {
+		if !usedRemoved[i] {
+			remainingRemoved = append(remainingRemoved, dish)
+		}
+	}
+	return remainingAdded, remainingRemoved
+}
+
+func addPriceChange(response *MenuDiffResponse, old, current MenuDiffDish) {
+	if samePrice(old.PriceCents, current.PriceCents) && old.Currency == current.Currency {
+		return
+	}
+	response.PriceChanges = append(response.PriceChanges, MenuDiffPriceChange{
+		Name:          current.Name,
+		Section:       current.Section,
+		OldPriceCents: old.PriceCents,
+		NewPriceCents: current.PriceCents,
+		Currency:      current.Currency,
+	})
+}
+
+func samePrice(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func normalizeDishName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// nameSimilarity is 1 minus the normalized edit distance between two names.
+func nameSimilarity(a, b string) float64 {
+	ra := []rune(normalizeDishName(a))
+	rb := []rune(normalizeDishName(b))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
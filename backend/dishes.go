@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DishUpdateRequest carries a partial dish edit; nil fields are left untouched.
+type DishUpdateRequest struct {
+	Name *string `json:"name"`
+	// RomanizedName sets how the name reads in Latin letters; an empty one
+	// clears it. Renaming a dish clears it unless a new one is given.
+	RomanizedName *string `json:"romanized_name"`
+	Price         *string `json:"price"`
+	PriceCents    *int    `json:"price_cents"`
+	Currency      *string `json:"currency"`
+	Description   *string `json:"description"`
+	ImageURL      *string `json:"image_url"`
+	// ImageAlt sets the image's alt text; an empty one derives it again from
+	// the name and description. Changing either clears it unless a new one
+	// is given.
+	ImageAlt  *string `json:"image_alt"`
+	SectionID *string `json:"section_id"`
+	// Allergens replaces the dish's allergens with a confirmed list; an
+	// empty list confirms it has none.
+	Allergens *[]string `json:"allergens"`
+}
+
+func updateDishHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	var req DishUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	updates := map[string]interface{}{}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			respondFieldError(c, "name", "required", "name must not be empty")
+			return
+		}
+		updates["name"] = name
+		if name != dish.Name {
+			updates["romanized_name"] = nil
+		}
+	}
+	if req.RomanizedName != nil {
+		romanized := strings.TrimSpace(*req.RomanizedName)
+		if !usesLatinScript(romanized) {
+			respondFieldError(c, "romanized_name", "latin", "romanized_name must be written in Latin letters")
+			return
+		}
+		if romanized == "" {
+			updates["romanized_name"] = nil
+		} else {
+			updates["romanized_name"] = romanized
+		}
+	}
+
+	// Prices are read in the currency the dish ends up in
+	currency := dish.Currency
+	if req.Currency != nil {
+		currency = strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if len(currency) != 3 {
+			respondFieldError(c, "currency", "iso4217", "currency must be a 3-letter ISO 4217 code")
+			return
+		}
+		updates["currency"] = currency
+	}
+
+	if req.Price != nil {
+		raw := strings.TrimSpace(*req.Price)
+		if raw == "" {
+			updates["raw_price_string"] = nil
+		} else {
+			updates["raw_price_string"] = raw
+		}
+		for column, value := range readPrice(&raw, currency, "", "").columns() {
+			updates[column] = value
+		}
+	}
+
+	if req.PriceCents != nil {
+		if *req.PriceCents < 0 {
+			respondFieldError(c, "price_cents", "min", "price_cents must not be negative")
+			return
+		}
+		// A price set by hand is one fixed price
+		for column, value := range (DishPrice{Type: PriceTypeFixed, Cents: req.PriceCents}).columns() {
+			updates[column] = value
+		}
+	}
+
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if description == "" {
+			updates["description"] = nil
+		} else {
+			updates["description"] = description
+		}
+	}
+
+	if req.ImageURL != nil {
+		imageURL := strings.TrimSpace(*req.ImageURL)
+		if imageURL == "" {
+			updates["image_url"] = nil
+		} else {
+			parsed, err := url.Parse(imageURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				respondFieldError(c, "image_url", "url", "image_url must be an absolute http(s) URL")
+				return
+			}
+			updates["image_url"] = imageURL
+		}
+	}
+
+	if name, ok := updates["name"].(string); ok && name != dish.Name {
+		updates["image_alt"] = nil
+	}
+	if _, ok := updates["description"]; ok {
+		updates["image_alt"] = nil
+	}
+	if req.ImageAlt != nil {
+		imageAlt := strings.TrimSpace(*req.ImageAlt)
+		if utf8.RuneCountInString(imageAlt) > maxImageAltLength {
+			respondFieldError(c, "image_alt", "max", fmt.Sprintf("image_alt must be at most %d characters", maxImageAltLength))
+			return
+		}
+		if imageAlt == "" {
+			updates["image_alt"] = nil
+		} else {
+			updates["image_alt"] = imageAlt
+		}
+	}
+
+	var confirmed []DishAllergen
+	if req.Allergens != nil {
+		var ok bool
+		if confirmed, ok = confirmedAllergens(*dish, *req.Allergens); !ok {
+			respondFieldError(c, "allergens", "oneof", "allergens must be one of: "+strings.Join(allergens, ", "))
+			return
+		}
+		updates["allergens_confirmed"] = true
+	}
+
+	var moveToSection string
+	if req.SectionID != nil && (dish.SectionID == nil || *dish.SectionID != *req.SectionID) {
+		var section MenuSection
+		if err := db.Where("id = ? AND menu_id = ?", *req.SectionID, dish.MenuID).First(&section).Error; err != nil {
+			respondError(c, http.StatusBadRequest, "SECTION_NOT_FOUND", "section_id does not belong to this menu")
+			return
+		}
+		moveToSection = section.ID
+	}
+
+	if len(updates) == 0 && moveToSection == "" {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "No fields to update")
+		return
+	}
+
+	now := clock.Now()
+	updates["edited_by_user"] = true
+	updates["updated_at"] = now
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := beginMenuEdit(tx, dish.MenuID, "dish-edit"); err != nil {
+			return err
+		}
+		if name, ok := updates["name"].(string); ok {
+			catalogDishID, err := linkCatalogDish(tx, name)
+			if err != nil {
+				return err
+			}
+			updates["catalog_dish_id"] = catalogDishID
+		}
+		if err := tx.Model(&Dish{}).Where("id = ?", dish.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if _, ok := updates["image_url"]; ok {
+			// A hand-set image replaces whichever generated candidate was active
+			if err := tx.Model(&DishImage{}).Where("dish_id = ?", dish.ID).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		if req.Allergens != nil {
+			if err := replaceDishAllergens(tx, dish.ID, confirmed); err != nil {
+				return err
+			}
+		}
+		if moveToSection != "" {
+			if err := moveDishesToSection(tx, []string{dish.ID}, moveToSection); err != nil {
+				return err
+			}
+			if err := recountSectionDishes(tx, dish.MenuID); err != nil {
+				return err
+			}
+		}
+		return touchMenu(tx, dish.MenuID)
+	})
+	if err != nil {
+		zapLog.Error("Failed to update dish", zap.String("dishID", dish.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update dish")
+		return
+	}
+
+	if err := db.Where("id = ?", dish.ID).First(dish).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load dish")
+		return
+	}
+	if err := db.Where("dish_id = ?", dish.ID).Order("allergen").Find(&dish.Allergens).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load dish")
+		return
+	}
+
+	c.JSON(http.StatusOK, toDishResponse(*dish))
+}
+
+// loadMenuDish loads the dish named by the :dishId route parameter, making
+// sure it belongs to the menu named by :id.
+func loadMenuDish(c *gin.Context) (*Dish, bool) {
+	var dish Dish
+	if err := db.Where("id = ? AND menu_id = ?", c.Param("dishId"), c.Param("id")).First(&dish).Error; err != nil {
+		respondError(c, http.StatusNotFound, "DISH_NOT_FOUND", "Dish not found")
+		return nil, false
+	}
+	return &dish, true
+}
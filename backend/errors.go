@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// Every error response has the same envelope, {"error": ErrorResponse}, with
+// a code from errorCatalog. Codes are stable: clients branch on them, and
+// only the messages may change. The catalog also lists the failure codes of
+// menus and dishes and the codes of menu warnings.
+
+// FieldError is a problem with one field of a request body.
+type FieldError struct {
+	// Field is the field's JSON path, e.g. "specs[0].name"
+	Field string `json:"field"`
+	// Code is the rule the value broke, such as "required" or "max"
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Scopes of ErrorCode: where a client meets the code.
+const (
+	ErrorScopeResponse = "response"
+	ErrorScopeMenu     = "menu"
+	ErrorScopeDish     = "dish"
+	ErrorScopeWarning  = "warning"
+)
+
+// ErrorCode documents one code of the catalog.
+type ErrorCode struct {
+	Code        string `json:"code"`
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// errorCatalog lists every code the API uses, served at /api/errors. A code
+// that is not listed here is logged when it is sent.
+var errorCatalog = []ErrorCode{
+	// Requests
+	{"INVALID_REQUEST", ErrorScopeResponse, "The request is malformed; fields lists the fields that failed validation"},
+	{"UNSUPPORTED_FORMAT", ErrorScopeResponse, "The requested export format is not supported"},
+	{"MISSING_FILE", ErrorScopeResponse, "The upload has no image file"},
+	{"FILE_TOO_LARGE", ErrorScopeResponse, "The uploaded image is larger than 8MB"},
+	{"INVALID_FILE_TYPE", ErrorScopeResponse, "The uploaded file is not an image"},
+	{"NEAR_DUPLICATE_MENU", ErrorScopeResponse, "The image looks like a menu that was already uploaded; see duplicate"},
+	{"IDEMPOTENCY_KEY_IN_USE", ErrorScopeResponse, "An upload with the same Idempotency-Key is still running"},
+	{"RATE_LIMITED", ErrorScopeResponse, "Too many requests; retry after Retry-After seconds"},
+	{"QUOTA_EXCEEDED", ErrorScopeResponse, "The API key's monthly menu quota is used up"},
+	{"NO_QUOTA", ErrorScopeResponse, "The request has no API key, so it has no quota"},
+	{"BUDGET_EXCEEDED", ErrorScopeResponse, "The service's spend budget is used up; retry after Retry-After seconds"},
+	{"SHUTTING_DOWN", ErrorScopeResponse, "The replica is shutting down; retry the upload"},
+	{"STARTING", ErrorScopeResponse, "The replica is still starting; retry shortly"},
+
+	// Credentials and permissions
+	{"API_KEY_REQUIRED", ErrorScopeResponse, "The request has no X-API-Key header"},
+	{"INVALID_API_KEY", ErrorScopeResponse, "The API key is unknown or revoked"},
+	{"UNAUTHORIZED", ErrorScopeResponse, "The admin token is wrong"},
+	{"ADMIN_DISABLED", ErrorScopeResponse, "Admin endpoints are off because ADMIN_TOKEN is not set"},
+	{"DEBUG_DISABLED", ErrorScopeResponse, "Debug endpoints are off"},
+	{"ACCOUNTS_DISABLED", ErrorScopeResponse, "User accounts are not enabled on this server"},
+	{"LOGIN_REQUIRED", ErrorScopeResponse, "The endpoint needs a session token"},
+	{"INVALID_SESSION", ErrorScopeResponse, "The session token is invalid or expired"},
+	{"INVALID_CREDENTIALS", ErrorScopeResponse, "The email or password is wrong"},
+	{"EMAIL_TAKEN", ErrorScopeResponse, "An account with the email already exists"},
+	{"OAUTH_PROVIDER_NOT_FOUND", ErrorScopeResponse, "The login provider is not configured"},
+	{"INVALID_OAUTH_STATE", ErrorScopeResponse, "The login expired or was started in another browser"},
+	{"OAUTH_DENIED", ErrorScopeResponse, "The user cancelled the login at the provider"},
+	{"OAUTH_FAILED", ErrorScopeResponse, "The login provider could not be reached"},
+	{"IDENTITY_ALREADY_LINKED", ErrorScopeResponse, "The provider account is linked to another user"},
+	{"ACCOUNT_EXISTS", ErrorScopeResponse, "A password account has the provider account's email; sign in with the password and link the provider"},
+	{"INSUFFICIENT_ROLE", ErrorScopeResponse, "The caller's restaurant role does not allow the request"},
+	{"MENU_NOT_OWNED", ErrorScopeResponse, "Only menus uploaded while signed in can be added to a restaurant"},
+	{"LAST_OWNER", ErrorScopeResponse, "The change would leave a restaurant without an owner"},
+
+	// Missing resources
+	{"MENU_NOT_FOUND", ErrorScopeResponse, "The menu does not exist or is not visible to the caller"},
+	{"DISH_NOT_FOUND", ErrorScopeResponse, "The dish does not exist or is not visible to the caller"},
+	{"SECTION_NOT_FOUND", ErrorScopeResponse, "The section does not exist in the menu"},
+	{"IMAGE_NOT_FOUND", ErrorScopeResponse, "The image candidate or stored image does not exist"},
+	{"VERSION_NOT_FOUND", ErrorScopeResponse, "The menu version does not exist"},
+	{"REVISION_NOT_FOUND", ErrorScopeResponse, "The menu revision does not exist"},
+	{"SHARE_NOT_FOUND", ErrorScopeResponse, "The share link does not exist or was revoked"},
+	{"RESTAURANT_NOT_FOUND", ErrorScopeResponse, "The restaurant does not exist or the caller is not a member"},
+	{"MEMBER_NOT_FOUND", ErrorScopeResponse, "The user is not a member of the restaurant"},
+	{"USER_NOT_FOUND", ErrorScopeResponse, "No account uses the email, or the user does not exist"},
+	{"WEBHOOK_NOT_FOUND", ErrorScopeResponse, "The webhook does not exist"},
+	{"DELIVERY_NOT_FOUND", ErrorScopeResponse, "The webhook delivery does not exist"},
+	{"API_KEY_NOT_FOUND", ErrorScopeResponse, "The API key does not exist"},
+	{"RECEIPT_NOT_FOUND", ErrorScopeResponse, "The purge receipt does not exist"},
+	{"CATALOG_DISH_NOT_FOUND", ErrorScopeResponse, "The catalog dish does not exist"},
+	{"TRANSLATION_NOT_FOUND", ErrorScopeResponse, "The menu has not been translated into the language"},
+
+	// Conflicts with the resource's state
+	{"MENU_NOT_READY", ErrorScopeResponse, "The menu has not finished processing"},
+	{"MENU_NOT_AWAITING_REVIEW", ErrorScopeResponse, "The menu is not awaiting review"},
+	{"DELETE_DISABLED", ErrorScopeResponse, "Menu deletion is disabled by policy"},
+	{"SECTION_NOT_EMPTY", ErrorScopeResponse, "The section still has dishes"},
+	{"REGENERATION_IN_PROGRESS", ErrorScopeResponse, "The dish is already being regenerated"},
+	{"IMAGE_GENERATION_DISABLED", ErrorScopeResponse, "Image generation is off for the menu"},
+	{"UPSCALING_DISABLED", ErrorScopeResponse, "Image upscaling is off for the deployment"},
+	{"DISH_HAS_NO_IMAGE", ErrorScopeResponse, "The dish has no image yet"},
+	{"REVISION_NOT_DRAFT", ErrorScopeResponse, "Only the open draft revision can be published or discarded"},
+	{"NO_PUBLISHED_REVISION", ErrorScopeResponse, "The menu has no published revision to reset the draft to"},
+	{"API_KEY_REVOKED", ErrorScopeResponse, "The API key is revoked"},
+
+	// Server faults
+	{"DATABASE_ERROR", ErrorScopeResponse, "The database failed; retrying may help"},
+	{"INTERNAL_ERROR", ErrorScopeResponse, "The server failed unexpectedly"},
+	{"EXPORT_FAILED", ErrorScopeResponse, "The export could not be rendered"},
+	{"GENERATION_FAILED", ErrorScopeResponse, "The AI provider failed to generate content"},
+
+	// Menu failure codes
+	{"PROCESSING_FAILED", ErrorScopeMenu, "The menu could not be read or stored; failure_reason says why"},
+	{"EXTRACTION_TRUNCATED", ErrorScopeMenu, "The menu had more on it than the model could answer, and no dish could be kept; upload it as several photos"},
+	{"DISH_QUOTA_EXCEEDED", ErrorScopeMenu, "The menu has more dishes than the API key's plan allows"},
+	{"BUDGET_EXCEEDED", ErrorScopeMenu, "Processing stopped because the spend budget was used up"},
+	{"INTERRUPTED", ErrorScopeMenu, "The server stopped before the menu was read; upload it again"},
+	{"DEADLINE_EXCEEDED", ErrorScopeMenu, "MENU_PROCESSING_DEADLINE passed before the menu was read"},
+	{"CANCELLED", ErrorScopeMenu, "An operator stopped the menu's processing; upload it again"},
+
+	// Dish failure codes
+	{"DESCRIPTION_FAILED", ErrorScopeDish, "The dish's description could not be generated"},
+	{"MODERATION", ErrorScopeDish, "Moderation rejected every description or image generated for the dish"},
+	{"BUDGET_EXCEEDED", ErrorScopeDish, "The dish was not enhanced because the spend budget was used up"},
+	{"DEADLINE_EXCEEDED", ErrorScopeDish, "The menu's processing deadline passed before the dish was enhanced"},
+	{"CANCELLED", ErrorScopeDish, "An operator stopped the menu's processing before the dish was enhanced"},
+	{"INTERRUPTED", ErrorScopeDish, "The server stopped while the dish was being retried; retry it again"},
+
+	// Menu warnings
+	{"SECTION_NAME_TRUNCATED", ErrorScopeWarning, "A section name was cut to MAX_SECTION_NAME_LENGTH"},
+	{"DISH_NAME_TRUNCATED", ErrorScopeWarning, "A dish name was cut to MAX_DISH_NAME_LENGTH"},
+	{"PRICE_TRUNCATED", ErrorScopeWarning, "A price was cut to MAX_PRICE_STRING_LENGTH"},
+	{"DESCRIPTION_TRUNCATED", ErrorScopeWarning, "A description was cut to MAX_DESCRIPTION_LENGTH"},
+	{"DISH_DROPPED", ErrorScopeWarning, "A dish without a name was left out"},
+	{"PROCESSING_DEADLINE", ErrorScopeWarning, "Processing stopped at MENU_PROCESSING_DEADLINE; some dishes were not enhanced"},
+	{"EXTRACTED_IN_PARTS", ErrorScopeWarning, "The menu photo was long and read in parts; dishes where they meet may need a look"},
+	{"EXTRACTION_TRUNCATED", ErrorScopeWarning, "The menu had more on it than the model could answer; dishes at its end may be missing or incomplete"},
+}
+
+// responseErrorCodes are the catalog's codes of error responses.
+var responseErrorCodes = func() map[string]bool {
+	codes := map[string]bool{}
+	for _, entry := range errorCatalog {
+		if entry.Scope == ErrorScopeResponse {
+			codes[entry.Code] = true
+		}
+	}
+	return codes
+}()
+
+func init() {
+	// Report validation errors by the fields' JSON names
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				for _, tag := range []string{"form", "uri"} {
+					if name, _, _ = strings.Cut(field.Tag.Get(tag), ","); name != "" {
+						break
+					}
+				}
+			}
+			return name
+		})
+	}
+}
+
+func respondError(c *gin.Context, status int, code, message string) {
+	respondErrorWithFields(c, status, code, message, nil)
+}
+
+func respondErrorWithFields(c *gin.Context, status int, code, message string, fields []FieldError) {
+	if !responseErrorCodes[code] {
+		zapLog.Warn("Error code is missing from the catalog", zap.String("code", code))
+	}
+	c.JSON(status, gin.H{
+		"error": ErrorResponse{
+			Code:    code,
+			Message: message,
+			Fields:  fields,
+		},
+	})
+}
+
+// respondFieldError answers 400 INVALID_REQUEST for one bad field.
+func respondFieldError(c *gin.Context, field, code, message string) {
+	respondErrorWithFields(c, http.StatusBadRequest, "INVALID_REQUEST", message, []FieldError{{Field: field, Code: code, Message: message}})
+}
+
+// respondBindError answers 400 INVALID_REQUEST for a body or query that
+// failed to bind, listing the fields at fault.
+func respondBindError(c *gin.Context, err error) {
+	fields := bindFieldErrors(err)
+	message := "Invalid request"
+	if len(fields) == 1 {
+		message = fields[0].Message
+	} else if len(fields) > 1 {
+		message = fmt.Sprintf("%d fields are invalid", len(fields))
+	} else if err != nil {
+		message = err.Error()
+	}
+	respondErrorWithFields(c, http.StatusBadRequest, "INVALID_REQUEST", message, fields)
+}
+
+// bindFieldErrors turns validation and JSON type errors into FieldErrors;
+// other errors, such as malformed JSON, have none.
+func bindFieldErrors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := make([]FieldError, 0, len(validationErrors))
+		for _, fieldErr := range validationErrors {
+			field := fieldPath(fieldErr.Namespace())
+			fields = append(fields, FieldError{Field: field, Code: fieldErr.Tag(), Message: validationMessage(field, fieldErr)})
+		}
+		return fields
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonTypeName(typeErr.Type)),
+		}}
+	}
+	return nil
+}
+
+// fieldPath drops the struct name from a validator namespace such as
+// "GenerateRenditionsRequest.specs[0].name".
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
+
+func validationMessage(field string, err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return field + " is required"
+	case "email":
+		return field + " must be an email address"
+	case "url", "http_url":
+		return field + " must be a URL"
+	case "oneof":
+		return field + " must be one of: " + strings.ReplaceAll(err.Param(), " ", ", ")
+	case "min", "gte":
+		if unit := lengthUnit(err.Kind()); unit != "" {
+			return fmt.Sprintf("%s must have at least %s %s", field, err.Param(), unit)
+		}
+		return fmt.Sprintf("%s must be at least %s", field, err.Param())
+	case "max", "lte":
+		if unit := lengthUnit(err.Kind()); unit != "" {
+			return fmt.Sprintf("%s must have at most %s %s", field, err.Param(), unit)
+		}
+		return fmt.Sprintf("%s must be at most %s", field, err.Param())
+	}
+	return fmt.Sprintf("%s failed the %s check", field, err.Tag())
+}
+
+// lengthUnit names what min and max count for a kind, or "" for numbers.
+func lengthUnit(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "items"
+	}
+	return ""
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	if t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64 {
+		return "integer"
+	}
+	return t.String()
+}
+
+// listErrorCodesHandler serves the catalog so clients can check the codes
+// they handle.
+func listErrorCodesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"codes": errorCatalog})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// menuEventsHandler streams a menu's status as server-sent events. A
+// "progress" event carrying the same body as GET /api/menu/:id is sent
+// whenever it changes, and the stream ends with a "complete" or "failed"
+// event once processing finishes, or an "awaiting_review" event when the
+// menu stops for review.
+func menuEventsHandler(c *gin.Context) {
+	menuID := c.Param("id")
+	if _, err := loadMenuStatus(menuID); err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return
+	}
+
+	pollInterval := getEnvDuration("MENU_EVENTS_POLL_INTERVAL", time.Second)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	var last []byte
+	send := func() bool {
+		menu, err := loadMenuStatus(menuID)
+		if err != nil {
+			// Deleted while streaming
+			c.SSEvent("failed", ErrorResponse{Code: "MENU_NOT_FOUND", Message: "Menu not found"})
+			return false
+		}
+
+		response := buildMenuStatusResponse(menu)
+		data, err := json.Marshal(response)
+		if err != nil {
+			zapLog.Error("Failed to encode menu event", zap.String("menuID", menuID), zap.Error(err))
+			return false
+		}
+
+		switch response.Status {
+		case "COMPLETE":
+			c.SSEvent("complete", json.RawMessage(data))
+			return false
+		case "FAILED":
+			c.SSEvent("failed", json.RawMessage(data))
+			return false
+		case "AWAITING_REVIEW":
+			c.SSEvent("awaiting_review", json.RawMessage(data))
+			return false
+		}
+
+		if !bytes.Equal(data, last) {
+			c.SSEvent("progress", json.RawMessage(data))
+			last = data
+		}
+		return true
+	}
+
+	if !send() {
+		c.Writer.Flush()
+		return
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-stopping:
+			// Shutting down; the client reconnects to another replica
+			return false
+		case <-keepAlive.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+			return true
+		case <-ticker.C:
+			return send()
+		}
+	})
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// menuDocument is the reading-order view of a completed menu shared by all
+// export formats.
+type menuDocument struct {
+	Menu     Menu
+	Title    string
+	Sections []menuDocumentSection
+	// PageURL is the public address of a shared page, for its OpenGraph
+	// tags; "" elsewhere
+	PageURL string
+}
+
+type menuDocumentSection struct {
+	Anchor string
+	Name   string
+	Dishes []menuDocumentDish
+}
+
+type menuDocumentDish struct {
+	Anchor string
+	Dish   Dish
+	Price  string
+	// ImageAlt is the alt text of the dish's image
+	ImageAlt string
+}
+
+func exportMenuHandler(c *gin.Context) {
+	menu, ok := loadCompleteMenu(c)
+	if !ok {
+		return
+	}
+
+	doc := buildMenuDocument(menu)
+	format := c.DefaultQuery("format", "accessible-html")
+
+	switch format {
+	case "accessible-html":
+		var buf bytes.Buffer
+		if err := accessibleMenuTemplate.Execute(&buf, doc); err != nil {
+			zapLog.Error("Failed to render accessible menu", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to render menu")
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+	case "html":
+		published, err := buildPublishedMenuDocument(menu)
+		if err != nil {
+			zapLog.Error("Failed to load published menu", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to render menu")
+			return
+		}
+		page, err := renderMenuPage(published)
+		if err != nil {
+			zapLog.Error("Failed to render menu page", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to render menu")
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.html"`, exportFileBase(menu)))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	case "json-ld":
+		published, err := buildPublishedMenuDocument(menu)
+		if err != nil {
+			zapLog.Error("Failed to load published menu", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to render menu")
+			return
+		}
+		data, err := json.MarshalIndent(buildMenuJSONLD(published), "", "  ")
+		if err != nil {
+			zapLog.Error("Failed to render menu JSON-LD", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to render menu")
+			return
+		}
+		if c.Query("snippet") == "true" {
+			// Ready to paste into a page's <head>; json escapes '<' so the
+			// data cannot close the script element early.
+			snippet := "<script type=\"application/ld+json\">\n" + string(data) + "\n</script>\n"
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(snippet))
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.jsonld"`, exportFileBase(menu)))
+		c.Data(http.StatusOK, "application/ld+json", data)
+	case "large-print-pdf":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-large-print.pdf"`, exportFileBase(menu)))
+		c.Data(http.StatusOK, "application/pdf", renderLargePrintPDF(doc))
+	case "pdf":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, exportFileBase(menu)))
+		c.Data(http.StatusOK, "application/pdf", renderMenuPDF(doc))
+	case "csv":
+		data, err := renderMenuCSV(doc)
+		if err != nil {
+			zapLog.Error("Failed to render menu CSV", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to render menu")
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, exportFileBase(menu)))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	case "json":
+		images := c.DefaultQuery("images", "reference")
+		if images != "reference" && images != "embed" {
+			respondFieldError(c, "images", "oneof", "images must be reference or embed")
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, exportFileBase(menu)))
+		c.IndentedJSON(http.StatusOK, buildMenuBackup(menu, images == "embed"))
+	default:
+		respondError(c, http.StatusBadRequest, "UNSUPPORTED_FORMAT", "Unsupported export format: "+format)
+	}
+}
+
+// loadCompleteMenu loads the menu named by the :id route parameter with its
+// sections and dishes in position order, writing an error response and
+// returning false when it is missing or still processing.
+func loadCompleteMenu(c *gin.Context) (*Menu, bool) {
+	return loadCompleteMenuByID(c, c.Param("id"))
+}
+
+// loadCompleteMenuByID is loadCompleteMenu for an explicit menu ID.
+func loadCompleteMenuByID(c *gin.Context, menuID string) (*Menu, bool) {
+	var menu Menu
+	err := db.
+		Preload("Sections", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Preload("Dishes", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Where("id = ?", menuID).
+		First(&menu).Error
+	if err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return nil, false
+	}
+	if err := attachDishVariants(&menu); err != nil {
+		zapLog.Error("Failed to load dish variants", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load menu")
+		return nil, false
+	}
+	if err := attachDishModifiers(&menu); err != nil {
+		zapLog.Error("Failed to load dish modifiers", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load menu")
+		return nil, false
+	}
+	if err := attachDishTags(&menu); err != nil {
+		zapLog.Error("Failed to load dish tags", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load menu")
+		return nil, false
+	}
+	if err := attachDishAllergens(&menu); err != nil {
+		zapLog.Error("Failed to load dish allergens", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load menu")
+		return nil, false
+	}
+
+	if menu.Status != "COMPLETE" {
+		respondError(c, http.StatusConflict, "MENU_NOT_READY", "Menu has not finished processing")
+		return nil, false
+	}
+
+	return &menu, true
+}
+
+// buildMenuDocument groups dishes under their sections in display order.
+// Dishes without a (known) section are collected into a trailing "Other" section.
+func buildMenuDocument(menu *Menu) menuDocument {
+	doc := menuDocument{Menu: *menu, Title: menuTitle(menu)}
+
+	indexByID := make(map[string]int, len(menu.Sections))
+	for _, section := range menu.Sections {
+		indexByID[section.ID] = len(doc.Sections)
+		doc.Sections = append(doc.Sections, menuDocumentSection{
+			Anchor: fmt.Sprintf("section-%d", len(doc.Sections)+1),
+			Name:   section.Name,
+		})
+	}
+
+	var unsectioned []menuDocumentDish
+	for _, dish := range menu.Dishes {
+		entry := menuDocumentDish{
+			Dish:     dish,
+			Price:    formatPrice(dish),
+			ImageAlt: imageAltText(dish),
+		}
+		if dish.SectionID != nil {
+			if idx, ok := indexByID[*dish.SectionID]; ok {
+				doc.Sections[idx].Dishes = append(doc.Sections[idx].Dishes, entry)
+				continue
+			}
+		}
+		unsectioned = append(unsectioned, entry)
+	}
+
+	if len(unsectioned) > 0 {
+		doc.Sections = append(doc.Sections, menuDocumentSection{
+			Anchor: fmt.Sprintf("section-%d", len(doc.Sections)+1),
+			Name:   "Other",
+			Dishes: unsectioned,
+		})
+	}
+
+	dishNumber := 0
+	for i := range doc.Sections {
+		for j := range doc.Sections[i].Dishes {
+			dishNumber++
+			doc.Sections[i].Dishes[j].Anchor = fmt.Sprintf("dish-%d", dishNumber)
+		}
+	}
+
+	return doc
+}
+
+// menuTitle derives a human-readable title for a menu from its upload.
+func menuTitle(menu *Menu) string {
+	base := strings.TrimSuffix(menu.OriginalFile, filepath.Ext(menu.OriginalFile))
+	base = strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(base))
+	if base == "" {
+		return "Menu"
+	}
+	return base
+}
+
+// exportFileBase returns a filesystem-safe base name for exported files.
+func exportFileBase(menu *Menu) string {
+	return "menu-" + menu.ID
+}
+
+// formatPrice renders a dish's price for display, preferring parsed amounts
+// and falling back to the string printed on the menu.
+func formatPrice(dish Dish) string {
+	money := func(amount int) string {
+		formatted := formatMinorUnits(amount, dish.Currency)
+		if dish.Currency == "" || dish.Currency == "USD" {
+			return "$" + formatted
+		}
+		return formatted + " " + dish.Currency
+	}
+
+	switch {
+	case len(dish.Variants) > 0:
+		return formatVariantPrices(dish)
+	case dish.PriceType == PriceTypeRange && dish.PriceMinCents != nil && dish.PriceMaxCents != nil:
+		return money(*dish.PriceMinCents) + " – " + money(*dish.PriceMaxCents)
+	case dish.PriceType == PriceTypeFrom && dish.PriceCents != nil:
+		return "from " + money(*dish.PriceCents)
+	case dish.PriceType == PriceTypePerUnit && dish.PriceCents != nil && dish.PriceUnit != nil:
+		return money(*dish.PriceCents) + " per " + *dish.PriceUnit
+	case dish.PriceType == PriceTypeMarket && dish.RawPriceString == nil:
+		return "Market price"
+	case dish.PriceCents != nil && dish.PriceType != PriceTypeMarket:
+		return money(*dish.PriceCents)
+	case dish.RawPriceString != nil:
+		return strings.TrimSpace(*dish.RawPriceString)
+	}
+	return ""
+}
+
+func renderLargePrintPDF(doc menuDocument) []byte {
+	pdf := newPDFDocument(doc.Title)
+	pdf.Text(doc.Title, pdfFontBold, 30)
+	pdf.Space(12)
+
+	for _, section := range doc.Sections {
+		pdf.Rule()
+		pdf.Text(section.Name, pdfFontBold, 24)
+		pdf.Space(8)
+		for _, entry := range section.Dishes {
+			heading := entry.Dish.Name
+			if entry.Price != "" {
+				heading += "  -  " + entry.Price
+			}
+			pdf.Text(heading, pdfFontBold, 18)
+			if entry.Dish.Description != nil && *entry.Dish.Description != "" {
+				pdf.Text(*entry.Dish.Description, pdfFontRegular, 16)
+			}
+			pdf.Space(14)
+		}
+	}
+
+	return pdf.Bytes()
+}
+
+var accessibleMenuTemplate = template.Must(template.New("accessible").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: system-ui, sans-serif; font-size: 1.25rem; line-height: 1.6; color: #111; background: #fff; margin: 0 auto; max-width: 48rem; padding: 1rem; }
+  a { color: #0645ad; }
+  a:focus, a:hover { outline: 3px solid #ffbf47; }
+  .skip-link { position: absolute; left: -9999px; }
+  .skip-link:focus { left: 1rem; top: 1rem; background: #fff; padding: 0.5rem; }
+  .visually-hidden { position: absolute; width: 1px; height: 1px; overflow: hidden; clip: rect(0 0 0 0); white-space: nowrap; }
+  ul.dishes { list-style: none; padding: 0; }
+  article { border-top: 1px solid #767676; padding: 1rem 0; }
+  h3 { margin: 0; }
+  .price { font-weight: bold; margin: 0.25rem 0; }
+  img { max-width: 100%; height: auto; }
+</style>
+</head>
+<body>
+<a class="skip-link" href="#menu-content">Skip to menu</a>
+<header>
+  <h1 id="menu-title">{{.Title}}</h1>
+</header>
+<nav aria-label="Menu sections">
+  <ul>
+  {{- range .Sections}}
+    <li><a href="#{{.Anchor}}">{{.Name}}</a></li>
+  {{- end}}
+  </ul>
+</nav>
+<main id="menu-content" aria-labelledby="menu-title">
+{{- range .Sections}}
+  <section aria-labelledby="{{.Anchor}}">
+    <h2 id="{{.Anchor}}">{{.Name}}</h2>
+    <ul class="dishes">
+    {{- range .Dishes}}
+      <li>
+        <article aria-labelledby="{{.Anchor}}">
+          <h3 id="{{.Anchor}}">{{.Dish.Name}}</h3>
+          {{- if .Price}}
+          <p class="price"><span class="visually-hidden">Price: </span>{{.Price}}</p>
+          {{- end}}
+          {{- if .Dish.Description}}
+          <p>{{.Dish.Description}}</p>
+          {{- end}}
+          {{- if .Dish.ImageURL}}
+          <img src="{{.Dish.ImageURL}}" alt="{{.ImageAlt}}" loading="lazy">
+          {{- end}}
+        </article>
+      </li>
+    {{- end}}
+    </ul>
+  </section>
+{{- end}}
+</main>
+</body>
+</html>
+`))
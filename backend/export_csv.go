@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+)
+
+// renderMenuCSV writes one row per dish in reading order, with estimated
+// nutrition when the dish has it. The output starts with a UTF-8 byte order
+// mark so Excel detects the encoding.
+func renderMenuCSV(doc menuDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\ufeff")
+
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"section", "name", "price", "currency", "description", "image_url", "estimated_calories", "estimated_protein_g", "estimated_carbs_g", "estimated_fat_g"}); err != nil {
+		return nil, err
+	}
+
+	for _, section := range doc.Sections {
+		for _, entry := range section.Dishes {
+			dish := entry.Dish
+			price := ""
+			if dish.PriceCents != nil {
+				price = formatMinorUnits(*dish.PriceCents, dish.Currency)
+			} else if dish.RawPriceString != nil {
+				price = *dish.RawPriceString
+			}
+			description := ""
+			if dish.Description != nil {
+				description = *dish.Description
+			}
+			imageURL := ""
+			if dish.ImageURL != nil {
+				imageURL = *dish.ImageURL
+			}
+
+			row := []string{section.Name, dish.Name, price, dish.Currency, description, imageURL,
+				formatOptionalInt(dish.Calories), formatOptionalInt(dish.ProteinGrams), formatOptionalInt(dish.CarbsGrams), formatOptionalInt(dish.FatGrams)}
+			for i := range row {
+				row[i] = escapeCSVFormula(row[i])
+			}
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// escapeCSVFormula stops spreadsheet apps from evaluating model- or
+// user-provided text as a formula.
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
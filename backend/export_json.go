@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// menuBackupFormat identifies JSON exports so an importer can recognise them.
+// Bump menuBackupVersion on incompatible changes to the document shape.
+const (
+	menuBackupFormat  = "menugen.menu"
+	menuBackupVersion = 1
+
+	maxEmbeddedImageBytes = 5 << 20
+)
+
+// MenuBackup is the self-contained JSON export of a completed menu.
+type MenuBackup struct {
+	Format        string              `json:"format"`
+	FormatVersion int                 `json:"format_version"`
+	ExportedAt    time.Time           `json:"exported_at"`
+	Menu          MenuBackupMeta      `json:"menu"`
+	Sections      []MenuBackupSection `json:"sections"`
+	Dishes        []MenuBackupDish    `json:"dishes"`
+}
+
+type MenuBackupMeta struct {
+	ID           string        `json:"id"`
+	Title        string        `json:"title"`
+	OriginalFile string        `json:"original_file"`
+	ImageMode    string        `json:"image_mode"`
+	Warnings     []MenuWarning `json:"warnings"`
+	Language     string        `json:"language,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	CompletedAt  *time.Time    `json:"completed_at"`
+}
+
+type MenuBackupSection struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+type MenuBackupDish struct {
+	ID             string                 `json:"id"`
+	SectionID      *string                `json:"section_id"`
+	Name           string                 `json:"name"`
+	RomanizedName  *string                `json:"romanized_name,omitempty"`
+	PriceCents     *int                   `json:"price_cents"`
+	Currency       string                 `json:"currency"`
+	RawPriceString *string                `json:"raw_price_string"`
+	Description    *string                `json:"description"`
+	Status         string                 `json:"status"`
+	Position       int                    `json:"position"`
+	EditedByUser   bool                   `json:"edited_by_user"`
+	Image          *MenuBackupImage       `json:"image"`
+	Variants       []DishVariantResponse  `json:"variants,omitempty"`
+	Modifiers      []DishModifierResponse `json:"modifiers,omitempty"`
+	Tags           []DishTagResponse      `json:"tags,omitempty"`
+	Allergens      []DishAllergenResponse `json:"allergens,omitempty"`
+	SpiceLevel     *int                   `json:"spice_level,omitempty"`
+	Nutrition      *DishNutrition         `json:"nutrition,omitempty"`
+}
+
+// MenuBackupImage references a dish image by URL and, when embedding was
+// requested and the download succeeded, carries the bytes inline.
+type MenuBackupImage struct {
+	URL         string `json:"url"`
+	Alt         string `json:"alt,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        string `json:"data,omitempty"`
+}
+
+// buildMenuBackup converts a completed menu into its JSON export. With embed
+// set, images are downloaded and inlined as base64; any image that cannot be
+// fetched is left as a plain URL reference.
+func buildMenuBackup(menu *Menu, embed bool) MenuBackup {
+	backup := MenuBackup{
+		Format:        menuBackupFormat,
+		FormatVersion: menuBackupVersion,
+		ExportedAt:    clock.Now(),
+		Menu: MenuBackupMeta{
+			ID:           menu.ID,
+			Title:        menuTitle(menu),
+			OriginalFile: menu.OriginalFile,
+			ImageMode:    menu.ImageMode,
+			Warnings:     menu.Warnings,
+			Language:     menu.Language,
+			CreatedAt:    menu.CreatedAt,
+			CompletedAt:  menu.CompletedAt,
+		},
+		Sections: make([]MenuBackupSection, len(menu.Sections)),
+		Dishes:   make([]MenuBackupDish, len(menu.Dishes)),
+	}
+	if backup.Menu.Warnings == nil {
+		backup.Menu.Warnings = []MenuWarning{}
+	}
+
+	for i, section := range menu.Sections {
+		backup.Sections[i] = MenuBackupSection{ID: section.ID, Name: section.Name, Position: section.Position}
+	}
+	for i, dish := range menu.Dishes {
+		backup.Dishes[i] = MenuBackupDish{
+			ID:             dish.ID,
+			SectionID:      dish.SectionID,
+			Name:           dish.Name,
+			RomanizedName:  dish.RomanizedName,
+			PriceCents:     dish.PriceCents,
+			Currency:       dish.Currency,
+			RawPriceString: dish.RawPriceString,
+			Description:    dish.Description,
+			Status:         dish.Status,
+			Position:       dish.Position,
+			EditedByUser:   dish.EditedByUser,
+			Variants:       toVariantResponses(dish.Variants),
+			Modifiers:      toModifierResponses(dish.Modifiers),
+			Tags:           toTagResponses(dish.Tags),
+			Allergens:      toAllergenResponses(dish.Allergens),
+			SpiceLevel:     dish.SpiceLevel,
+			Nutrition:      dishNutrition(dish),
+		}
+		if dish.ImageURL != nil {
+			backup.Dishes[i].Image = &MenuBackupImage{URL: *dish.ImageURL, Alt: imageAltText(dish)}
+		}
+	}
+
+	if embed {
+		embedBackupImages(menu.ID, backup.Dishes)
+	}
+	return backup
+}
+
+// embedBackupImages downloads dish images a few at a time and inlines them.
+func embedBackupImages(menuID string, dishes []MenuBackupDish) {
+	client := newImageFetchClient()
+	semaphore := make(chan struct{}, 4)
+	var wg sync.WaitGroup
+
+	for i := range dishes {
+		image := dishes[i].Image
+		if image == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(image *MenuBackupImage) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			data, contentType, err := fetchImage(client, image.URL)
+			if err != nil {
+				zapLog.Warn("Failed to embed image in export", zap.String("menuID", menuID), zap.String("url", image.URL), zap.Error(err))
+				return
+			}
+			image.ContentType = contentType
+			image.Data = base64.StdEncoding.EncodeToString(data)
+		}(image)
+	}
+
+	wg.Wait()
+}
+
+// newImageFetchClient returns an HTTP client for downloading dish images
+// during exports. It only connects to public addresses.
+func newImageFetchClient() *http.Client {
+	return &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: publicAddressesOnly}).DialContext,
+		},
+	}
+}
+
+func fetchImage(client *http.Client, imageURL string) ([]byte, string, error) {
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxEmbeddedImageBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxEmbeddedImageBytes {
+		return nil, "", fmt.Errorf("image larger than %d bytes", maxEmbeddedImageBytes)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return data, contentType, nil
+}
+
+// publicAddressesOnly refuses connections to loopback, private and link-local
+// addresses. Image URLs can be set by users, so exports must not be usable to
+// read internal services.
+func publicAddressesOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+// schema.org structured data for a menu, as understood by search engines'
+// rich results. Field names follow https://schema.org/Menu.
+type jsonLDMenu struct {
+	Context  string          `json:"@context"`
+	Type     string          `json:"@type"`
+	Name     string          `json:"name"`
+	Sections []jsonLDSection `json:"hasMenuSection"`
+}
+
+type jsonLDSection struct {
+	Type  string           `json:"@type"`
+	Name  string           `json:"name"`
+	Items []jsonLDMenuItem `json:"hasMenuItem"`
+}
+
+type jsonLDMenuItem struct {
+	Type        string           `json:"@type"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Image       *jsonLDImage     `json:"image,omitempty"`
+	Offers      *jsonLDOffer     `json:"offers,omitempty"`
+	Nutrition   *jsonLDNutrition `json:"nutrition,omitempty"`
+}
+
+type jsonLDImage struct {
+	Type    string `json:"@type"`
+	URL     string `json:"url"`
+	Caption string `json:"caption,omitempty"`
+}
+
+type jsonLDOffer struct {
+	Type          string `json:"@type"`
+	Price         string `json:"price"`
+	PriceCurrency string `json:"priceCurrency"`
+}
+
+type jsonLDNutrition struct {
+	Type                string `json:"@type"`
+	Calories            string `json:"calories"`
+	ProteinContent      string `json:"proteinContent,omitempty"`
+	CarbohydrateContent string `json:"carbohydrateContent,omitempty"`
+	FatContent          string `json:"fatContent,omitempty"`
+}
+
+// buildMenuJSONLD converts a menu document to schema.org Menu markup. Only
+// parsed prices become offers: a raw price string like "market price" is not
+// a valid schema.org price, so those dishes are listed without one.
+func buildMenuJSONLD(doc menuDocument) jsonLDMenu {
+	menu := jsonLDMenu{
+		Context:  "https://schema.org",
+		Type:     "Menu",
+		Name:     doc.Title,
+		Sections: []jsonLDSection{},
+	}
+
+	for _, section := range doc.Sections {
+		if len(section.Dishes) == 0 {
+			continue
+		}
+		entry := jsonLDSection{Type: "MenuSection", Name: section.Name, Items: make([]jsonLDMenuItem, 0, len(section.Dishes))}
+		for _, dish := range section.Dishes {
+			item := jsonLDMenuItem{Type: "MenuItem", Name: dish.Dish.Name}
+			if dish.Dish.Description != nil {
+				item.Description = *dish.Dish.Description
+			}
+			if dish.Dish.ImageURL != nil {
+				item.Image = &jsonLDImage{Type: "ImageObject", URL: *dish.Dish.ImageURL, Caption: dish.ImageAlt}
+			}
+			if dish.Dish.PriceCents != nil {
+				currency := dish.Dish.Currency
+				if currency == "" {
+					currency = "USD"
+				}
+				item.Offers = &jsonLDOffer{
+					Type:          "Offer",
+					Price:         formatMinorUnits(*dish.Dish.PriceCents, currency),
+					PriceCurrency: currency,
+				}
+			}
+			if nutrition := dishNutrition(dish.Dish); nutrition != nil {
+				item.Nutrition = &jsonLDNutrition{
+					Type:                "NutritionInformation",
+					Calories:            formatOptionalInt(nutrition.Calories) + " calories",
+					ProteinContent:      gramsForJSONLD(nutrition.ProteinGrams),
+					CarbohydrateContent: gramsForJSONLD(nutrition.CarbsGrams),
+					FatContent:          gramsForJSONLD(nutrition.FatGrams),
+				}
+			}
+			entry.Items = append(entry.Items, item)
+		}
+		menu.Sections = append(menu.Sections, entry)
+	}
+
+	return menu
+}
+
+// gramsForJSONLD writes a mass as schema.org expects it, e.g. "12 g".
+func gramsForJSONLD(grams *int) string {
+	if grams == nil {
+		return ""
+	}
+	return formatOptionalInt(grams) + " g"
+}
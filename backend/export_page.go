@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+)
+
+// buildPublishedMenuDocument is buildMenuDocument over the menu's published
+// content rather than its working copy, for pages shown to the public.
+func buildPublishedMenuDocument(menu *Menu) (menuDocument, error) {
+	snapshot, err := publishedMenuSnapshot(menu)
+	if err != nil {
+		return menuDocument{}, err
+	}
+	published := *menu
+	published.Sections = snapshot.Sections
+	published.Dishes = snapshot.Dishes
+	return buildMenuDocument(&published), nil
+}
+
+// renderMenuPage renders a standalone responsive HTML page for a menu. All
+// CSS is inline and images point at their stored URLs, so the file can be
+// dropped onto any site as-is or served from a public URL.
+func renderMenuPage(doc menuDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := menuPageTemplate.Execute(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var menuPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{- with .Menu.SEO}}
+<title>{{.Title}}</title>
+<meta name="description" content="{{.Description}}">
+<meta property="og:type" content="website">
+<meta property="og:title" content="{{.OGTitle}}">
+<meta property="og:description" content="{{.OGDescription}}">
+{{- if .OGImage}}
+<meta property="og:image" content="{{.OGImage}}">
+<meta name="twitter:card" content="summary_large_image">
+{{- end}}
+{{- else}}
+<title>{{.Title}}</title>
+{{- end}}
+{{- if .PageURL}}
+<meta property="og:url" content="{{.PageURL}}">
+<link rel="canonical" href="{{.PageURL}}">
+{{- end}}
+<style>
+  *, *::before, *::after { box-sizing: border-box; }
+  body { margin: 0; font-family: Georgia, "Times New Roman", serif; color: #222; background: #faf8f5; line-height: 1.5; }
+  header { text-align: center; padding: 2.5rem 1rem 1rem; }
+  h1 { margin: 0; font-size: clamp(2rem, 6vw, 3rem); font-weight: normal; letter-spacing: 0.02em; }
+  nav { position: sticky; top: 0; z-index: 1; background: #faf8f5; border-bottom: 1px solid #e4ded5; overflow-x: auto; white-space: nowrap; text-align: center; padding: 0.75rem 1rem; }
+  nav a { display: inline-block; margin: 0 0.75rem; color: #8a3b12; text-decoration: none; font-family: system-ui, sans-serif; font-size: 0.95rem; }
+  nav a:hover, nav a:focus { text-decoration: underline; }
+  main { max-width: 72rem; margin: 0 auto; padding: 1rem; }
+  section { padding-top: 1.5rem; scroll-margin-top: 3.5rem; }
+  h2 { font-weight: normal; font-size: 1.75rem; border-bottom: 2px solid #8a3b12; padding-bottom: 0.25rem; margin: 0 0 1rem; }
+  .dishes { display: grid; grid-template-columns: repeat(auto-fill, minmax(16rem, 1fr)); gap: 1.25rem; list-style: none; margin: 0; padding: 0; }
+  .dish { background: #fff; border-radius: 0.5rem; overflow: hidden; box-shadow: 0 1px 3px rgba(0, 0, 0, 0.08); display: flex; flex-direction: column; }
+  .dish img { width: 100%; aspect-ratio: 1 / 1; object-fit: cover; display: block; background: #eee; }
+  .dish-body { padding: 0.9rem 1rem 1.1rem; }
+  .dish-heading { display: flex; justify-content: space-between; align-items: baseline; gap: 0.75rem; }
+  h3 { margin: 0; font-size: 1.15rem; }
+  .price { font-family: system-ui, sans-serif; font-weight: 600; white-space: nowrap; color: #8a3b12; }
+  .description { margin: 0.5rem 0 0; color: #555; font-size: 0.95rem; }
+  @media print {
+    nav { display: none; }
+    body { background: #fff; }
+    .dish { box-shadow: none; border: 1px solid #ddd; break-inside: avoid; }
+  }
+</style>
+</head>
+<body>
+<header>
+  <h1>{{.Title}}</h1>
+</header>
+{{- if gt (len .Sections) 1}}
+<nav aria-label="Menu sections">
+{{- range .Sections}}{{if .Dishes}}
+  <a href="#{{.Anchor}}">{{.Name}}</a>
+{{- end}}{{end}}
+</nav>
+{{- end}}
+<main>
+{{- range .Sections}}{{if .Dishes}}
+  <section id="{{.Anchor}}">
+    <h2>{{.Name}}</h2>
+    <ul class="dishes">
+    {{- range .Dishes}}
+      <li class="dish" id="{{.Anchor}}">
+        {{- if .Dish.ImageURL}}
+        <img src="{{.Dish.ImageURL}}" alt="{{.ImageAlt}}" loading="lazy">
+        {{- end}}
+        <div class="dish-body">
+          <div class="dish-heading">
+            <h3>{{.Dish.Name}}</h3>
+            {{- if .Price}}
+            <span class="price">{{.Price}}</span>
+            {{- end}}
+          </div>
+          {{- if .Dish.Description}}
+          <p class="description">{{.Dish.Description}}</p>
+          {{- end}}
+        </div>
+      </li>
+    {{- end}}
+    </ul>
+  </section>
+{{- end}}{{end}}
+</main>
+</body>
+</html>
+`))
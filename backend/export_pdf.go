@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Print layout for the full menu PDF, in points. Dishes with a photo get a
+// square thumbnail on the left with the text column beside it.
+const (
+	printThumbnailSize = 96
+	printColumnGap     = 14
+)
+
+// renderMenuPDF lays out a print-ready menu: title, then each section with
+// its dishes' names, prices, descriptions and photos. Photos that cannot be
+// fetched or decoded (e.g. WebP) are left out and the dish is set as text.
+func renderMenuPDF(doc menuDocument) []byte {
+	images := loadPrintImages(doc)
+
+	pdf := newPDFDocument(doc.Title)
+	pdf.Text(doc.Title, pdfFontBold, 26)
+	pdf.Space(10)
+
+	for _, section := range doc.Sections {
+		pdf.Reserve(60)
+		pdf.Rule()
+		pdf.Text(section.Name, pdfFontBold, 18)
+		pdf.Space(8)
+
+		for _, entry := range section.Dishes {
+			img, hasImage := pdfImage{}, false
+			if entry.Dish.ImageURL != nil {
+				img, hasImage = images[*entry.Dish.ImageURL]
+			}
+
+			indent := 0.0
+			top := pdf.Y()
+			if hasImage {
+				pdf.Reserve(printThumbnailSize)
+				top = pdf.Y()
+				pdf.Image(img, printThumbnailSize, printThumbnailSize)
+				indent = printThumbnailSize + printColumnGap
+			}
+
+			heading := entry.Dish.Name
+			if entry.Price != "" {
+				heading += "  -  " + entry.Price
+			}
+			pdf.TextIndented(heading, pdfFontBold, 13, indent)
+			if entry.Dish.Description != nil && *entry.Dish.Description != "" {
+				pdf.Space(2)
+				pdf.TextIndented(*entry.Dish.Description, pdfFontRegular, 11, indent)
+			}
+
+			// Continue below the thumbnail when the text column is shorter
+			if hasImage && pdf.Y() > top-printThumbnailSize {
+				pdf.MoveTo(top - printThumbnailSize)
+			}
+			pdf.Space(14)
+		}
+	}
+
+	return pdf.Bytes()
+}
+
+// loadPrintImages downloads the menu's dish photos a few at a time and
+// prepares them for embedding, keyed by URL.
+func loadPrintImages(doc menuDocument) map[string]pdfImage {
+	client := newImageFetchClient()
+	semaphore := make(chan struct{}, 4)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		images = make(map[string]pdfImage)
+		seen   = make(map[string]bool)
+	)
+
+	for _, section := range doc.Sections {
+		for _, entry := range section.Dishes {
+			if entry.Dish.ImageURL == nil || seen[*entry.Dish.ImageURL] {
+				continue
+			}
+			url := *entry.Dish.ImageURL
+			seen[url] = true
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				data, _, err := fetchImage(client, url)
+				if err != nil {
+					zapLog.Warn("Failed to fetch image for PDF export", zap.String("menuID", doc.Menu.ID), zap.String("url", url), zap.Error(err))
+					return
+				}
+				img, err := newPDFImage(data)
+				if err != nil {
+					zapLog.Warn("Skipping image in PDF export", zap.String("menuID", doc.Menu.ID), zap.String("url", url), zap.Error(err))
+					return
+				}
+
+				mu.Lock()
+				images[url] = img
+				mu.Unlock()
+			}()
+		}
+	}
+
+	wg.Wait()
+	return images
+}
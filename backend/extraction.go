@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// The vision model reads the photo scaled down, and answers in a limited
+// number of tokens, so long and dense menus lose dishes. A menu photo more
+// than half again as long as it is wide (or wide as it is tall) is cut along
+// its long side into slightly overlapping parts, EXTRACTION_MAX_PARTS (4) at
+// most, that are read at once and merged: sections of the same name are
+// joined, and dishes the overlap repeats are kept once. Such a menu gets an
+// EXTRACTED_IN_PARTS warning, as dishes cut in two where parts meet may need
+// a look. EXTRACTION_MAX_PARTS=1 reads every menu in one request. Photos that
+// cannot be decoded, such as WebP, are read whole.
+
+const (
+	// maxPartAspectRatio is how much longer than wide a part may be
+	maxPartAspectRatio = 1.5
+	// partOverlap is the share of a part's length it shares with the next
+	partOverlap = 0.08
+)
+
+func extractionMaxParts() int {
+	return max(getEnvInt("EXTRACTION_MAX_PARTS", 4), 1)
+}
+
+// extractionMaxTokens is the answer length first allowed for a menu or a
+// part of one. An answer cut off is asked again once at extractionTokenLimit;
+// a menu still cut off is read once more in as many parts as it may have.
+// When it cannot be, or the parts are cut off too, the menu keeps the dishes
+// the answers got to, with an EXTRACTION_TRUNCATED warning, and fails with
+// that code only when they got to none.
+func extractionMaxTokens() int {
+	return max(getEnvInt("EXTRACTION_MAX_TOKENS", 2000), 1)
+}
+
+func extractionTokenLimit() int {
+	return getEnvInt("EXTRACTION_TOKEN_LIMIT", 8000)
+}
+
+// extractMenuStructure reads the menu photo into sections and dishes, in
+// parts when it is long. A menu cut off is returned with errOutputTruncated
+// when some of it could be read.
+func extractMenuStructure(ctx context.Context, menuID string, imageContent []byte) (*StructuredMenu, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageContent))
+	if err != nil {
+		return requestMenuStructure(ctx, menuID, imageContent, "")
+	}
+	maxParts := extractionMaxParts()
+	parts := menuImageParts(img.Bounds(), maxParts)
+	for {
+		var menu *StructuredMenu
+		if parts < 2 {
+			menu, err = requestMenuStructure(ctx, menuID, imageContent, "")
+		} else {
+			menu, err = extractMenuInParts(ctx, menuID, img, parts)
+		}
+		if !errors.Is(err, errOutputTruncated) || parts >= maxParts {
+			return menu, err
+		}
+		// Too much for one answer; each image sent again costs a request,
+		// so the menu is read in the most parts at once
+		parts = maxParts
+		logFor(ctx).Warn("Menu structure cut off, reading it in more parts", zap.String("menuID", menuID), zap.Int("parts", parts))
+	}
+}
+
+// menuImageParts is the number of parts an image of bounds is read in, at
+// most maxParts.
+func menuImageParts(bounds image.Rectangle, maxParts int) int {
+	long, short := bounds.Dy(), bounds.Dx()
+	if long < short {
+		long, short = short, long
+	}
+	if short == 0 {
+		return 1
+	}
+	parts := int(float64(long)/(float64(short)*maxPartAspectRatio) + 0.999)
+	return min(max(parts, 1), maxParts)
+}
+
+// extractMenuInParts cuts img into parts along its long side, reads them
+// concurrently, and merges what they show. It fails if any part does, but
+// for parts cut off, whose dishes are kept along with errOutputTruncated.
+func extractMenuInParts(ctx context.Context, menuID string, img image.Image, parts int) (*StructuredMenu, error) {
+	pieces, err := splitMenuImage(img, parts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split menu image: %w", err)
+	}
+	direction, edge := "from top to bottom", "top"
+	if img.Bounds().Dx() > img.Bounds().Dy() {
+		direction, edge = "from left to right", "left"
+	}
+	logFor(ctx).Info("Extracting menu in parts", zap.String("menuID", menuID), zap.Int("parts", parts))
+
+	menus := make([]*StructuredMenu, parts)
+	errs := make([]error, parts)
+	var wg sync.WaitGroup
+	for i, piece := range pieces {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			note := fmt.Sprintf("This image is part %d of %d of a menu that was cut %s into slightly overlapping parts. "+
+				"Read only what this part shows. Dishes at the %s of this part under a heading that is not shown in it go in a first section with an empty name.",
+				i+1, parts, direction, edge)
+			menus[i], errs[i] = requestMenuStructure(ctx, menuID, piece, note)
+		}()
+	}
+	wg.Wait()
+	var truncated error
+	read := menus[:0]
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, errOutputTruncated) {
+			return nil, fmt.Errorf("part %d of %d: %w", i+1, parts, err)
+		}
+		if err != nil && truncated == nil {
+			truncated = fmt.Errorf("part %d of %d: %w", i+1, parts, err)
+		}
+		if menus[i] != nil {
+			read = append(read, menus[i])
+		}
+	}
+	if len(read) == 0 {
+		return nil, truncated
+	}
+
+	addMenuWarnings(menuID, MenuWarning{
+		Code:    "EXTRACTED_IN_PARTS",
+		Message: fmt.Sprintf("The menu was read in %d parts; check the dishes where they meet", parts),
+	})
+	return mergeStructuredMenus(read), truncated
+}
+
+// splitMenuImage cuts img into parts overlapping pieces along its long side,
+// encoded as JPEG.
+func splitMenuImage(img image.Image, parts int) ([][]byte, error) {
+	cropper, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("image cannot be cropped")
+	}
+
+	bounds := img.Bounds()
+	vertical := bounds.Dy() >= bounds.Dx()
+	length := bounds.Dx()
+	if vertical {
+		length = bounds.Dy()
+	}
+	step := float64(length) / float64(parts)
+	overlap := int(step * partOverlap)
+
+	pieces := make([][]byte, 0, parts)
+	for i := 0; i < parts; i++ {
+		start := max(int(step*float64(i))-overlap, 0)
+		end := min(int(step*float64(i+1))+overlap, length)
+		rect := image.Rect(bounds.Min.X+start, bounds.Min.Y, bounds.Min.X+end, bounds.Max.Y)
+		if vertical {
+			rect = image.Rect(bounds.Min.X, bounds.Min.Y+start, bounds.Max.X, bounds.Min.Y+end)
+		}
+		var out bytes.Buffer
+		if err := jpeg.Encode(&out, cropper.SubImage(rect), &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, out.Bytes())
+	}
+	return pieces, nil
+}
+
+// mergeStructuredMenus joins the menus read from the parts of one menu, in
+// order. A part's first section without a name continues the section before
+// it; sections of the same name are joined, and dishes of the same name in a
+// section are kept once, with what either part read of them.
+func mergeStructuredMenus(parts []*StructuredMenu) *StructuredMenu {
+	merged := &StructuredMenu{}
+	sectionIndex := map[string]int{}
+	for _, part := range parts {
+		if merged.Currency == "" {
+			merged.Currency = part.Currency
+		}
+		if merged.Language == "" {
+			merged.Language = part.Language
+		}
+		if merged.Cuisine == "" {
+			merged.Cuisine = part.Cuisine
+		} else if part.Cuisine != "" && part.Cuisine != merged.Cuisine {
+			merged.Cuisine = "fusion"
+		}
+
+		for i, section := range part.Sections {
+			key := normalizeDishName(section.Name)
+			index, seen := sectionIndex[key]
+			if key == "" && i == 0 && len(merged.Sections) > 0 {
+				index, seen = len(merged.Sections)-1, true
+			}
+			if !seen {
+				merged.Sections = append(merged.Sections, StructuredSection{Name: section.Name})
+				index = len(merged.Sections) - 1
+				sectionIndex[key] = index
+			}
+			mergeStructuredSection(&merged.Sections[index], section)
+		}
+	}
+	return merged
+}
+
+func mergeStructuredSection(into *StructuredSection, section StructuredSection) {
+	for _, modifier := range section.Modifiers {
+		if !containsModifier(into.Modifiers, modifier) {
+			into.Modifiers = append(into.Modifiers, modifier)
+		}
+	}
+	for _, dish := range section.Dishes {
+		found := false
+		for i := range into.Dishes {
+			if normalizeDishName(into.Dishes[i].Name) == normalizeDishName(dish.Name) {
+				mergeStructuredDish(&into.Dishes[i], dish)
+				found = true
+				break
+			}
+		}
+		if !found {
+			into.Dishes = append(into.Dishes, dish)
+		}
+	}
+}
+
+func containsModifier(modifiers []StructuredModifier, modifier StructuredModifier) bool {
+	for _, m := range modifiers {
+		if m.Type == modifier.Type && m.Group == modifier.Group && normalizeDishName(m.Name) == normalizeDishName(modifier.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeStructuredDish fills in what into lacks from the same dish read in
+// another part, which may have seen the line the first one cut off.
+func mergeStructuredDish(into *StructuredDish, dish StructuredDish) {
+	if into.Price == nil {
+		into.Price = dish.Price
+	}
+	if into.PriceType == "" {
+		into.PriceType = dish.PriceType
+	}
+	if into.PriceUnit == "" {
+		into.PriceUnit = dish.PriceUnit
+	}
+	if into.RomanizedName == "" {
+		into.RomanizedName = dish.RomanizedName
+	}
+	if into.Currency == "" {
+		into.Currency = dish.Currency
+	}
+	if into.Cuisine == "" {
+		into.Cuisine = dish.Cuisine
+	}
+	if into.SpiceLevel == nil {
+		into.SpiceLevel = dish.SpiceLevel
+	}
+	if len(into.Variants) == 0 {
+		into.Variants = dish.Variants
+	}
+	if len(into.Modifiers) == 0 {
+		into.Modifiers = dish.Modifiers
+	}
+	if len(into.DietaryTags) == 0 {
+		into.DietaryTags = dish.DietaryTags
+	}
+}
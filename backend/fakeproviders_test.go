@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// FakeProviders are local OpenAI and Replicate servers that speak the
+// providers' APIs, so the pipeline can run in tests without keys or spend.
+// They answer from the demo fixtures (see demoMode), serve the placeholder
+// images they hand out, and record every request. Tests script other
+// answers, such as errors, with Script. Point the service at them by setting
+// the variables Env returns.
+type FakeProviders struct {
+	OpenAI    *httptest.Server
+	Replicate *httptest.Server
+
+	// AsyncPredictions makes predictions answer "processing" and finish on
+	// their first poll, so polling is exercised too. Set it before use.
+	AsyncPredictions bool
+
+	mu          sync.Mutex
+	requests    []FakeProviderRequest
+	scripted    map[string][]FakeProviderReply
+	predictions map[string]ReplicateResponse
+}
+
+// FakeProviderRequest is a request FakeProviders received.
+type FakeProviderRequest struct {
+	Provider string
+	Method   string
+	Path     string
+	Header   http.Header
+	Body     []byte
+}
+
+// FakeProviderReply is a scripted answer. A string Body is sent as it is;
+// anything else is sent as JSON.
+type FakeProviderReply struct {
+	Status int
+	Body   interface{}
+}
+
+// NewFakeProviders starts the servers; Close stops them.
+func NewFakeProviders() *FakeProviders {
+	f := &FakeProviders{
+		scripted:    map[string][]FakeProviderReply{},
+		predictions: map[string]ReplicateResponse{},
+	}
+	f.OpenAI = httptest.NewServer(http.HandlerFunc(f.serveOpenAI))
+	f.Replicate = httptest.NewServer(http.HandlerFunc(f.serveReplicate))
+	return f
+}
+
+func (f *FakeProviders) Close() {
+	f.OpenAI.Close()
+	f.Replicate.Close()
+}
+
+// Env is the environment that sends the service's provider requests to the
+// fakes.
+func (f *FakeProviders) Env() map[string]string {
+	return map[string]string{
+		"OPENAI_BASE_URL":    f.OpenAI.URL,
+		"OPENAI_API_KEY":     "fake-openai-key",
+		"REPLICATE_BASE_URL": f.Replicate.URL,
+		"REPLICATE_API_KEY":  "fake-replicate-key",
+	}
+}
+
+// Script answers the next requests to method and path, such as
+// "POST /v1/chat/completions", with replies, one each, before going back to
+// the fixtures.
+func (f *FakeProviders) Script(method, path string, replies ...FakeProviderReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := method + " " + path
+	f.scripted[key] = append(f.scripted[key], replies...)
+}
+
+// Requests returns the requests received so far, oldest first.
+func (f *FakeProviders) Requests() []FakeProviderRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeProviderRequest(nil), f.requests...)
+}
+
+// receive records a request and returns its body and scripted reply, if it
+// has one.
+func (f *FakeProviders) receive(provider string, r *http.Request) ([]byte, *FakeProviderReply) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, FakeProviderRequest{Provider: provider, Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	key := r.Method + " " + r.URL.Path
+	if replies := f.scripted[key]; len(replies) > 0 {
+		f.scripted[key] = replies[1:]
+		return body, &replies[0]
+	}
+	return body, nil
+}
+
+func (f *FakeProviders) serveOpenAI(w http.ResponseWriter, r *http.Request) {
+	body, reply := f.receive("openai", r)
+	if reply != nil {
+		writeFakeReply(w, *reply)
+		return
+	}
+	if r.Method == "GET" && r.URL.Path == "/v1/models" {
+		writeFakeReply(w, FakeProviderReply{Status: http.StatusOK, Body: map[string]interface{}{"data": []interface{}{}}})
+		return
+	}
+	resp, err := demoOpenAIResponse(r, body)
+	writeFakeResponse(w, resp, err)
+}
+
+func (f *FakeProviders) serveReplicate(w http.ResponseWriter, r *http.Request) {
+	body, reply := f.receive("replicate", r)
+	if reply != nil {
+		writeFakeReply(w, *reply)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v1/account":
+		writeFakeReply(w, FakeProviderReply{Status: http.StatusOK, Body: map[string]interface{}{"type": "user", "username": "fake"}})
+		return
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/images/"):
+		data, contentType, err := drawDemoImage(strings.TrimPrefix(r.URL.Path, "/images/"))
+		if errors.Is(err, errDemoImageName) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(data)
+		return
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/predictions/"):
+		f.mu.Lock()
+		prediction, ok := f.predictions[strings.TrimPrefix(r.URL.Path, "/v1/predictions/")]
+		f.mu.Unlock()
+		if !ok {
+			writeFakeReply(w, FakeProviderReply{Status: http.StatusNotFound, Body: map[string]interface{}{"detail": "Not found."}})
+			return
+		}
+		writeFakeReply(w, FakeProviderReply{Status: http.StatusOK, Body: prediction})
+		return
+	}
+
+	resp, err := demoReplicateResponse(r, body, f.Replicate.URL+"/images")
+	if err != nil || !f.AsyncPredictions || resp.StatusCode != http.StatusCreated {
+		writeFakeResponse(w, resp, err)
+		return
+	}
+
+	// Hold the output back until the prediction is polled
+	var prediction ReplicateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&prediction); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f.mu.Lock()
+	f.predictions[prediction.ID] = prediction
+	f.mu.Unlock()
+	writeFakeReply(w, FakeProviderReply{Status: http.StatusCreated, Body: ReplicateResponse{
+		ID:     prediction.ID,
+		Status: "processing",
+		URLs:   ReplicateURLs{Get: f.Replicate.URL + "/v1/predictions/" + prediction.ID},
+	}})
+}
+
+func writeFakeReply(w http.ResponseWriter, reply FakeProviderReply) {
+	data, ok := reply.Body.(string)
+	if !ok {
+		encoded, err := json.Marshal(reply.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data = string(encoded)
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(reply.Status)
+	io.WriteString(w, data)
+}
+
+func writeFakeResponse(w http.ResponseWriter, resp *http.Response, err error) {
+	if err != nil {
+		http.Error(w, fmt.Sprintf("fixture failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
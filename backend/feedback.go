@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DishFeedback is a single end-user vote on a dish's generated content.
+type DishFeedback struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DishID    string    `json:"dish_id" gorm:"type:uuid;index"`
+	MenuID    string    `json:"menu_id" gorm:"type:uuid;index"`
+	Vote      string    `json:"vote" gorm:"type:varchar(10)"`
+	Target    string    `json:"target" gorm:"type:varchar(20)"`
+	Comment   *string   `json:"comment"`
+	ClientIP  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DishFeedbackRequest struct {
+	Vote    string  `json:"vote" binding:"required,oneof=up down"`
+	Target  string  `json:"target" binding:"omitempty,oneof=general description image"`
+	Comment *string `json:"comment" binding:"omitempty,max=1000"`
+}
+
+type DishFeedbackSummary struct {
+	DishID          string `json:"dish_id"`
+	Name            string `json:"name"`
+	Up              int    `json:"up"`
+	Down            int    `json:"down"`
+	DescriptionDown int    `json:"description_down"`
+	ImageDown       int    `json:"image_down"`
+	Comments        int    `json:"comments"`
+}
+
+// feedbackLimiter throttles anonymous feedback submissions per client IP.
+// It is configured in main once the environment has been loaded.
+var feedbackLimiter *windowLimiter
+
+func submitDishFeedbackHandler(c *gin.Context) {
+	dishID := c.Param("id")
+
+	if !feedbackLimiter.Allow(c.ClientIP()) {
+		respondError(c, http.StatusTooManyRequests, "RATE_LIMITED", "Too many feedback submissions, try again later")
+		return
+	}
+
+	var req DishFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var dish Dish
+	if err := db.Where("id = ?", dishID).First(&dish).Error; err != nil {
+		respondError(c, http.StatusNotFound, "DISH_NOT_FOUND", "Dish not found")
+		return
+	}
+
+	target := req.Target
+	if target == "" {
+		target = "general"
+	}
+
+	var comment *string
+	if req.Comment != nil {
+		if trimmed := strings.TrimSpace(*req.Comment); trimmed != "" {
+			comment = &trimmed
+		}
+	}
+
+	feedback := DishFeedback{
+		ID:        idGen.NewID(),
+		DishID:    dish.ID,
+		MenuID:    dish.MenuID,
+		Vote:      req.Vote,
+		Target:    target,
+		Comment:   comment,
+		ClientIP:  c.ClientIP(),
+		CreatedAt: clock.Now(),
+	}
+
+	if err := db.Create(&feedback).Error; err != nil {
+		zapLog.Error("Failed to store dish feedback", zap.String("dishID", dishID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to store feedback")
+		return
+	}
+
+	c.JSON(http.StatusCreated, feedback)
+}
+
+func getMenuFeedbackHandler(c *gin.Context) {
+	menuID := c.Param("id")
+
+	var menu Menu
+	if err := db.Where("id = ?", menuID).First(&menu).Error; err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return
+	}
+
+	summaries := []DishFeedbackSummary{}
+	err := db.Table("dish_feedbacks").
+		Select(`dish_feedbacks.dish_id,
+			dishes.name,
+			COUNT(*) FILTER (WHERE vote = 'up') AS up,
+			COUNT(*) FILTER (WHERE vote = 'down') AS down,
+			COUNT(*) FILTER (WHERE vote = 'down' AND target = 'description') AS description_down,
+			COUNT(*) FILTER (WHERE vote = 'down' AND target = 'image') AS image_down,
+			COUNT(comment) AS comments`).
+		Joins("JOIN dishes ON dishes.id = dish_feedbacks.dish_id").
+		Where("dish_feedbacks.menu_id = ?", menuID).
+		Group("dish_feedbacks.dish_id, dishes.name").
+		Order("down DESC").
+		Scan(&summaries).Error
+	if err != nil {
+		zapLog.Error("Failed to summarize feedback", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load feedback")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"menu_id": menuID, "dishes": summaries})
+}
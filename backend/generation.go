@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// GenerationMetadata records exactly how a dish's AI content was produced so
+// bad outputs can be reproduced and investigated.
+type GenerationMetadata struct {
+	Description *GenerationRecord `json:"description,omitempty"`
+	Image       *GenerationRecord `json:"image,omitempty"`
+}
+
+type GenerationRecord struct {
+	Provider     string                 `json:"provider"`
+	Model        string                 `json:"model"`
+	SystemPrompt string                 `json:"system_prompt,omitempty"`
+	Prompt       string                 `json:"prompt"`
+	Seed         *int                   `json:"seed,omitempty"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+	GeneratedAt  time.Time              `json:"generated_at"`
+	// Cached is set when the content was reused from an earlier generation
+	Cached bool `json:"cached,omitempty"`
+}
+
+func (r GenerationRecord) Value() (driver.Value, error) {
+	return marshalJSONColumn(r)
+}
+
+func (r *GenerationRecord) Scan(value interface{}) error {
+	return scanJSONColumn(value, r)
+}
+
+func (m GenerationMetadata) Value() (driver.Value, error) {
+	return marshalJSONColumn(m)
+}
+
+func (m *GenerationMetadata) Scan(value interface{}) error {
+	return scanJSONColumn(value, m)
+}
+
+// mergeGenerationMetadata returns existing with any non-nil records from update applied.
+func mergeGenerationMetadata(existing *GenerationMetadata, description, image *GenerationRecord) GenerationMetadata {
+	merged := GenerationMetadata{}
+	if existing != nil {
+		merged = *existing
+	}
+	if description != nil {
+		merged.Description = description
+	}
+	if image != nil {
+		merged.Image = image
+	}
+	return merged
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+)
+
+// The GraphQL API is a read-only view over the same menus, sections, and
+// dishes as the REST status endpoint, for clients that only need some of the
+// fields. There is deliberately no way to list menus: like the REST API, a
+// menu can only be read by a caller who already knows its ID, and a menu
+// with an owner only by that owner. graph/schema.graphqls is the schema in
+// SDL; this graphql-go schema serves it, and TestGraphQLSchema keeps the two
+// the same.
+
+// graphqlMenu is a menu as seen by the resolvers. Sections and dishes are
+// loaded once with the menu and handed down, so nested fields never query the
+// database again.
+type graphqlMenu struct {
+	Menu *Menu
+}
+
+type graphqlSection struct {
+	Section MenuSection
+	Dishes  []Dish
+}
+
+var graphqlRenditionType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Rendition",
+	Description: "A named image variant of a dish, e.g. card, hero, or social.",
+	Fields: graphql.Fields{
+		"name":        graphqlField(graphql.NewNonNull(graphql.String), func(r DishRendition) interface{} { return r.Name }),
+		"aspectRatio": graphqlField(graphql.NewNonNull(graphql.String), func(r DishRendition) interface{} { return r.AspectRatio }),
+		"size":        graphqlField(graphql.NewNonNull(graphql.String), func(r DishRendition) interface{} { return r.Size }),
+		"url":         graphqlField(graphql.NewNonNull(graphql.String), func(r DishRendition) interface{} { return r.URL }),
+	},
+})
+
+var graphqlDishTagType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "DishTag",
+	Description: "A diet a dish suits, as marked on the menu or inferred.",
+	Fields: graphql.Fields{
+		"tag":    graphqlField(graphql.NewNonNull(graphql.String), func(t DishTag) interface{} { return t.Tag }),
+		"source": graphqlField(graphql.NewNonNull(graphql.String), func(t DishTag) interface{} { return t.Source }),
+	},
+})
+
+var graphqlDishType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Dish",
+	Fields: graphql.Fields{
+		"id":             graphqlField(graphql.NewNonNull(graphql.ID), func(d Dish) interface{} { return d.ID }),
+		"sectionId":      graphqlField(graphql.ID, func(d Dish) interface{} { return d.SectionID }),
+		"name":           graphqlField(graphql.NewNonNull(graphql.String), func(d Dish) interface{} { return d.Name }),
+		"priceCents":     graphqlField(graphql.Int, func(d Dish) interface{} { return d.PriceCents }),
+		"currency":       graphqlField(graphql.NewNonNull(graphql.String), func(d Dish) interface{} { return d.Currency }),
+		"rawPriceString": graphqlField(graphql.String, func(d Dish) interface{} { return d.RawPriceString }),
+		"description":    graphqlField(graphql.String, func(d Dish) interface{} { return d.Description }),
+		"imageUrl":       graphqlField(graphql.String, func(d Dish) interface{} { return d.ImageURL }),
+		"imageAlt":       graphqlField(graphql.String, func(d Dish) interface{} { return dishImageAltIfAny(d) }),
+		"status":         graphqlField(graphql.NewNonNull(graphql.String), func(d Dish) interface{} { return d.Status }),
+		"failureCode":    graphqlField(graphql.String, func(d Dish) interface{} { return d.FailureCode }),
+		"failureReason":  graphqlField(graphql.String, func(d Dish) interface{} { return d.FailureReason }),
+		"romanizedName":  graphqlField(graphql.String, func(d Dish) interface{} { return d.RomanizedName }),
+		"position":       graphqlField(graphql.NewNonNull(graphql.Int), func(d Dish) interface{} { return d.Position }),
+		"editedByUser":   graphqlField(graphql.NewNonNull(graphql.Boolean), func(d Dish) interface{} { return d.EditedByUser }),
+		"spiceLevel":     graphqlField(graphql.Int, func(d Dish) interface{} { return d.SpiceLevel }),
+		"cuisine":        graphqlField(graphql.String, func(d Dish) interface{} { return graphqlOptional(d.Cuisine) }),
+		"renditions": graphqlField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlRenditionType))), func(d Dish) interface{} {
+			if d.Renditions == nil {
+				return []DishRendition{}
+			}
+			return d.Renditions
+		}),
+		"tags": graphqlField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlDishTagType))), func(d Dish) interface{} {
+			if d.Tags == nil {
+				return []DishTag{}
+			}
+			return d.Tags
+		}),
+	},
+})
+
+var graphqlSectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Section",
+	Fields: graphql.Fields{
+		"id":              graphqlField(graphql.NewNonNull(graphql.ID), func(s graphqlSection) interface{} { return s.Section.ID }),
+		"name":            graphqlField(graphql.NewNonNull(graphql.String), func(s graphqlSection) interface{} { return s.Section.Name }),
+		"position":        graphqlField(graphql.NewNonNull(graphql.Int), func(s graphqlSection) interface{} { return s.Section.Position }),
+		"totalDishes":     graphqlField(graphql.NewNonNull(graphql.Int), func(s graphqlSection) interface{} { return s.Section.TotalDishes }),
+		"processedDishes": graphqlField(graphql.NewNonNull(graphql.Int), func(s graphqlSection) interface{} { return s.Section.ProcessedDishes }),
+		"dishes":          graphqlField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlDishType))), func(s graphqlSection) interface{} { return s.Dishes }),
+	},
+})
+
+var graphqlMenuType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Menu",
+	Fields: graphql.Fields{
+		"id":                graphqlField(graphql.NewNonNull(graphql.ID), func(m graphqlMenu) interface{} { return m.Menu.ID }),
+		"status":            graphqlField(graphql.NewNonNull(graphql.String), func(m graphqlMenu) interface{} { return m.Menu.Status }),
+		"originalFilename":  graphqlField(graphql.NewNonNull(graphql.String), func(m graphqlMenu) interface{} { return m.Menu.OriginalFile }),
+		"imageMode":         graphqlField(graphql.NewNonNull(graphql.String), func(m graphqlMenu) interface{} { return m.Menu.ImageMode }),
+		"cuisine":           graphqlField(graphql.String, func(m graphqlMenu) interface{} { return graphqlOptional(m.Menu.Cuisine) }),
+		"language":          graphqlField(graphql.String, func(m graphqlMenu) interface{} { return graphqlOptional(m.Menu.Language) }),
+		"failureCode":       graphqlField(graphql.String, func(m graphqlMenu) interface{} { return m.Menu.FailureCode }),
+		"failureReason":     graphqlField(graphql.String, func(m graphqlMenu) interface{} { return m.Menu.FailureReason }),
+		"totalDishes":       graphqlField(graphql.NewNonNull(graphql.Int), func(m graphqlMenu) interface{} { return m.Menu.TotalDishes }),
+		"processedDishes":   graphqlField(graphql.NewNonNull(graphql.Int), func(m graphqlMenu) interface{} { return m.Menu.ProcessedDishes }),
+		"publishedRevision": graphqlField(graphql.Int, func(m graphqlMenu) interface{} { return m.Menu.PublishedRevision }),
+		"draftRevision":     graphqlField(graphql.Int, func(m graphqlMenu) interface{} { return m.Menu.DraftRevision }),
+		"createdAt":         graphqlField(graphql.NewNonNull(graphql.DateTime), func(m graphqlMenu) interface{} { return m.Menu.CreatedAt }),
+		"updatedAt":         graphqlField(graphql.NewNonNull(graphql.DateTime), func(m graphqlMenu) interface{} { return m.Menu.UpdatedAt }),
+		"completedAt":       graphqlField(graphql.DateTime, func(m graphqlMenu) interface{} { return m.Menu.CompletedAt }),
+		"sections":          graphqlField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlSectionType))), graphqlMenuSections),
+		"dishes": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlDishType))),
+			Description: "The menu's dishes in order, optionally only those of one section and those with all of the given dietary tags.",
+			Args: graphql.FieldConfigArgument{
+				"sectionId": &graphql.ArgumentConfig{Type: graphql.ID},
+				"tags":      &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				menu := p.Source.(graphqlMenu).Menu
+				sectionID, filtered := p.Args["sectionId"].(string)
+				var tagArgs []string
+				if args, ok := p.Args["tags"].([]interface{}); ok {
+					for _, arg := range args {
+						tagArgs = append(tagArgs, arg.(string))
+					}
+				}
+				tags, ok := parseTagFilter(tagArgs)
+				if !ok {
+					return nil, fmt.Errorf("tags must be one of: %s", strings.Join(dietaryTags, ", "))
+				}
+				dishes := []Dish{}
+				for _, dish := range menu.Dishes {
+					if !filtered || dish.SectionID != nil && *dish.SectionID == sectionID {
+						dishes = append(dishes, dish)
+					}
+				}
+				return filterDishesByTags(dishes, tags), nil
+			},
+		},
+	},
+})
+
+var graphqlSchema = func() graphql.Schema {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"menu": &graphql.Field{
+				Type:        graphqlMenuType,
+				Description: "A menu by ID, or null if there is no such menu.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolveGraphQLMenu,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error())
+	}
+	return schema
+}()
+
+// graphqlField builds a field whose value is read from a source of type T.
+func graphqlField[T any](fieldType graphql.Output, value func(T) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return value(p.Source.(T)), nil
+		},
+	}
+}
+
+// graphqlOptional resolves "" to null.
+func graphqlOptional(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// resolveGraphQLMenu loads the menu like the REST status endpoint does; a menu
+// that cannot be loaded or belongs to someone else resolves to null, just as
+// REST answers 404.
+func resolveGraphQLMenu(p graphql.ResolveParams) (interface{}, error) {
+	menuID, _ := p.Args["id"].(string)
+	userID, _ := p.Context.Value(graphqlUserKey{}).(string)
+	apiKeyID, _ := p.Context.Value(graphqlAPIKeyKey{}).(string)
+	if visible, err := menuVisibleTo(menuID, userID, apiKeyID); err != nil || !visible {
+		return nil, nil
+	}
+	menu, err := loadMenuStatus(menuID)
+	if err != nil {
+		return nil, nil
+	}
+	sort.SliceStable(menu.Dishes, func(i, j int) bool { return menu.Dishes[i].Position < menu.Dishes[j].Position })
+	return graphqlMenu{Menu: menu}, nil
+}
+
+// graphqlMenuSections groups the menu's dishes under their sections.
+func graphqlMenuSections(m graphqlMenu) interface{} {
+	bySection := make(map[string][]Dish)
+	for _, dish := range m.Menu.Dishes {
+		if dish.SectionID != nil {
+			bySection[*dish.SectionID] = append(bySection[*dish.SectionID], dish)
+		}
+	}
+	sections := make([]graphqlSection, len(m.Menu.Sections))
+	for i, section := range m.Menu.Sections {
+		dishes := bySection[section.ID]
+		if dishes == nil {
+			dishes = []Dish{}
+		}
+		sections[i] = graphqlSection{Section: section, Dishes: dishes}
+	}
+	return sections
+}
+
+// graphqlUserKey carries the signed-in user's ID into the resolvers, and
+// graphqlAPIKeyKey the ID of the request's API key.
+type (
+	graphqlUserKey   struct{}
+	graphqlAPIKeyKey struct{}
+)
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// graphqlHandler executes a GraphQL query sent as a JSON POST body, or as
+// query parameters on GET. Following GraphQL convention, query errors are
+// returned in the result's "errors" with status 200.
+func graphqlHandler(c *gin.Context) {
+	var req GraphQLRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				respondFieldError(c, "variables", "type", "variables must be a JSON object")
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.Query == "" {
+		respondFieldError(c, "query", "required", "query is required")
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), graphqlUserKey{}, currentUserID(c))
+	ctx = context.WithValue(ctx, graphqlAPIKeyKey{}, currentAPIKeyID(c))
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	c.JSON(http.StatusOK, result)
+}
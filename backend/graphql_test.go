@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// TestGraphQLSchema checks that the schema served by graphqlHandler has
+// exactly the types, fields, and arguments of graph/schema.graphqls.
+func TestGraphQLSchema(t *testing.T) {
+	sdl, err := os.ReadFile("graph/schema.graphqls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := parser.Parse(parser.ParseParams{Source: string(sdl)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	declared := map[string]bool{}
+	for _, definition := range document.Definitions {
+		object, ok := definition.(*ast.ObjectDefinition)
+		if !ok {
+			continue
+		}
+		name := object.Name.Value
+		declared[name] = true
+		served, ok := graphqlSchema.Type(name).(*graphql.Object)
+		if !ok {
+			t.Errorf("type %s is not served", name)
+			continue
+		}
+
+		fields := served.Fields()
+		for _, field := range object.Fields {
+			servedField, ok := fields[field.Name.Value]
+			if !ok {
+				t.Errorf("%s.%s is not served", name, field.Name.Value)
+				continue
+			}
+			if want := graphqlTypeString(field.Type); servedField.Type.String() != want {
+				t.Errorf("%s.%s is served as %s, want %s", name, field.Name.Value, servedField.Type, want)
+			}
+			args := map[string]string{}
+			for _, arg := range servedField.Args {
+				args[arg.Name()] = arg.Type.String()
+			}
+			for _, arg := range field.Arguments {
+				if want := graphqlTypeString(arg.Type); args[arg.Name.Value] != want {
+					t.Errorf("%s.%s(%s) is served as %q, want %s", name, field.Name.Value, arg.Name.Value, args[arg.Name.Value], want)
+				}
+				delete(args, arg.Name.Value)
+			}
+			for arg := range args {
+				t.Errorf("%s.%s(%s) is not in the schema file", name, field.Name.Value, arg)
+			}
+			delete(fields, field.Name.Value)
+		}
+		for field := range fields {
+			t.Errorf("%s.%s is not in the schema file", name, field)
+		}
+	}
+
+	for name, servedType := range graphqlSchema.TypeMap() {
+		if _, ok := servedType.(*graphql.Object); ok && name[0] != '_' && !declared[name] {
+			t.Errorf("type %s is not in the schema file", name)
+		}
+	}
+}
+
+// graphqlTypeString writes a type reference of the schema file as graphql-go
+// prints types, e.g. [Dish!]!.
+func graphqlTypeString(t ast.Type) string {
+	switch t := t.(type) {
+	case *ast.NonNull:
+		return graphqlTypeString(t.Type) + "!"
+	case *ast.List:
+		return "[" + graphqlTypeString(t.Type) + "]"
+	case *ast.Named:
+		return t.Name.Value
+	}
+	return ""
+}
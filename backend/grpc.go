@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"menugen-backend/menugenpb"
+)
+
+// grpcMenuServer implements menugenpb.MenuService, the gRPC API for internal
+// services, on top of the same functions as the REST handlers.
+type grpcMenuServer struct {
+	menugenpb.UnimplementedMenuServiceServer
+}
+
+// startGRPCServer serves MenuService on GRPC_PORT (default 9090) in the
+// background and returns the server, or nil when GRPC_PORT=off disables it.
+func startGRPCServer() *grpc.Server {
+	port := os.Getenv("GRPC_PORT")
+	if port == "" {
+		port = "9090"
+	}
+	if port == "off" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		zapLog.Fatal("Failed to listen for gRPC", zap.String("port", port), zap.Error(err))
+	}
+
+	server := grpc.NewServer(
+		// Leave room for the largest upload plus the rest of the message
+		grpc.MaxRecvMsgSize(maxUploadSize+64*1024),
+		grpc.UnaryInterceptor(grpcAdminUnary),
+		grpc.StreamInterceptor(grpcAdminStream),
+	)
+	menugenpb.RegisterMenuServiceServer(server, &grpcMenuServer{})
+
+	zapLog.Info("Starting gRPC server", zap.String("port", port))
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			zapLog.Fatal("gRPC server stopped", zap.Error(err))
+		}
+	}()
+	return server
+}
+
+// grpcAuthorize checks the admin token sent as "authorization: Bearer" or
+// "x-admin-token" metadata, like requireAdmin does for HTTP.
+func grpcAuthorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	provided := ""
+	if values := md.Get("x-admin-token"); len(values) > 0 {
+		provided = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 {
+		provided = strings.TrimPrefix(values[0], "Bearer ")
+	}
+
+	switch err := checkAdminToken(provided); {
+	case errors.Is(err, errAdminDisabled):
+		return status.Error(codes.PermissionDenied, "gRPC API is disabled: ADMIN_TOKEN is not set")
+	case err != nil:
+		return status.Error(codes.Unauthenticated, "invalid admin token")
+	}
+	return nil
+}
+
+func grpcAdminUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := grpcAuthorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcAdminStream(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := grpcAuthorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+var grpcDuplicatePolicies = map[menugenpb.DuplicatePolicy]string{
+	menugenpb.DuplicatePolicy_DUPLICATE_POLICY_UNSPECIFIED: OnDuplicateWarn,
+	menugenpb.DuplicatePolicy_DUPLICATE_POLICY_WARN:        OnDuplicateWarn,
+	menugenpb.DuplicatePolicy_DUPLICATE_POLICY_REUSE:       OnDuplicateReuse,
+	menugenpb.DuplicatePolicy_DUPLICATE_POLICY_FORCE:       OnDuplicateForce,
+}
+
+func (s *grpcMenuServer) UploadMenu(ctx context.Context, req *menugenpb.UploadMenuRequest) (*menugenpb.UploadMenuResponse, error) {
+	if len(req.GetImage()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no image provided")
+	}
+	if len(req.GetImage()) > maxUploadSize {
+		return nil, status.Error(codes.InvalidArgument, "image exceeds 8MB limit")
+	}
+	if !strings.HasPrefix(req.GetContentType(), "image/") {
+		return nil, status.Error(codes.InvalidArgument, "content_type must be an image type")
+	}
+	onDuplicate, ok := grpcDuplicatePolicies[req.GetOnDuplicate()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "unknown on_duplicate policy")
+	}
+
+	// Like X-Request-ID over HTTP
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	requestID = newRequestID(requestID)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", requestID))
+
+	upload, err := acceptMenuUpload(menuUploadRequest{
+		RequestID:   requestID,
+		Filename:    req.GetFilename(),
+		ContentType: req.GetContentType(),
+		Content:     req.GetImage(),
+		OnDuplicate: onDuplicate,
+		Review:      reviewRequiredByDefault(),
+	})
+	var budgetErr *spendBudgetError
+	if errors.As(err, &budgetErr) {
+		return nil, status.Error(codes.ResourceExhausted, budgetErr.Error())
+	}
+	if errors.Is(err, errShuttingDown) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create menu")
+	}
+	if upload.Duplicate != nil {
+		st := status.New(codes.AlreadyExists, "menu looks like one that was already uploaded")
+		detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+			Reason: "NEAR_DUPLICATE_MENU",
+			Domain: "menugen",
+			Metadata: map[string]string{
+				"menu_id":    upload.Duplicate.MenuID,
+				"status":     upload.Duplicate.Status,
+				"similarity": fmt.Sprintf("%.3f", upload.Duplicate.Similarity),
+			},
+		})
+		if err != nil {
+			return nil, st.Err()
+		}
+		return nil, detailed.Err()
+	}
+
+	return &menugenpb.UploadMenuResponse{
+		MenuId:  upload.Menu.ID,
+		Status:  upload.Menu.Status,
+		Created: upload.Created,
+	}, nil
+}
+
+func (s *grpcMenuServer) GetMenu(ctx context.Context, req *menugenpb.GetMenuRequest) (*menugenpb.Menu, error) {
+	menu, err := loadMenuStatus(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "menu not found")
+	}
+	return toProtoMenu(menu, true), nil
+}
+
+// ListMenus pages through menus newest first. The page token is the creation
+// time and ID of the last menu returned, so pages stay stable while new menus
+// are uploaded.
+func (s *grpcMenuServer) ListMenus(ctx context.Context, req *menugenpb.ListMenusRequest) (*menugenpb.ListMenusResponse, error) {
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	pageSize = min(pageSize, 100)
+
+	query := db.Order("created_at DESC, id DESC").Limit(pageSize + 1)
+	if req.GetPageToken() != "" {
+		createdAt, id, err := decodeMenuPageToken(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+	if req.GetStatus() != "" {
+		query = query.Where("status = ?", req.GetStatus())
+	}
+
+	var menus []Menu
+	if err := query.Find(&menus).Error; err != nil {
+		zapLog.Error("Failed to list menus", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list menus")
+	}
+
+	response := &menugenpb.ListMenusResponse{}
+	if len(menus) > pageSize {
+		menus = menus[:pageSize]
+		last := menus[len(menus)-1]
+		response.NextPageToken = encodeMenuPageToken(last.CreatedAt, last.ID)
+	}
+	for i := range menus {
+		response.Menus = append(response.Menus, toProtoMenu(&menus[i], false))
+	}
+	return response, nil
+}
+
+func encodeMenuPageToken(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeMenuPageToken(token string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	timestamp, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", errors.New("malformed page token")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	return createdAt, id, err
+}
+
+// WatchMenu polls the menu like the SSE endpoint does and sends it whenever
+// it changes.
+func (s *grpcMenuServer) WatchMenu(req *menugenpb.WatchMenuRequest, stream menugenpb.MenuService_WatchMenuServer) error {
+	ticker := time.NewTicker(getEnvDuration("MENU_EVENTS_POLL_INTERVAL", time.Second))
+	defer ticker.Stop()
+
+	var last *menugenpb.Menu
+	for {
+		menu, err := loadMenuStatus(req.GetId())
+		if err != nil {
+			return status.Error(codes.NotFound, "menu not found")
+		}
+
+		current := toProtoMenu(menu, true)
+		if !proto.Equal(current, last) {
+			if err := stream.Send(current); err != nil {
+				return err
+			}
+			last = current
+		}
+		if menu.Status == "COMPLETE" || menu.Status == "FAILED" {
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-stopping:
+			return status.Error(codes.Unavailable, errShuttingDown.Error())
+		case <-ticker.C:
+		}
+	}
+}
+
+// toProtoMenu converts a menu for the gRPC API; withContent adds its sections
+// and dishes, which must have been loaded.
+func toProtoMenu(menu *Menu, withContent bool) *menugenpb.Menu {
+	message := &menugenpb.Menu{
+		Id:               menu.ID,
+		Status:           menu.Status,
+		OriginalFilename: menu.OriginalFile,
+		TotalDishes:      int32(menu.TotalDishes),
+		ProcessedDishes:  int32(menu.ProcessedDishes),
+		ImageMode:        menu.ImageMode,
+		CreatedAt:        timestamppb.New(menu.CreatedAt),
+		UpdatedAt:        timestamppb.New(menu.UpdatedAt),
+	}
+	if menu.CompletedAt != nil {
+		message.CompletedAt = timestamppb.New(*menu.CompletedAt)
+	}
+	if menu.Status == "FAILED" && menu.FailureReason != nil {
+		code := "PROCESSING_FAILED"
+		if menu.FailureCode != nil {
+			code = *menu.FailureCode
+		}
+		message.Error = &menugenpb.Error{Code: code, Message: *menu.FailureReason}
+	}
+	if !withContent {
+		return message
+	}
+
+	for _, section := range menu.Sections {
+		message.Sections = append(message.Sections, &menugenpb.Section{
+			Id:              section.ID,
+			Name:            section.Name,
+			Position:        int32(section.Position),
+			TotalDishes:     int32(section.TotalDishes),
+			ProcessedDishes: int32(section.ProcessedDishes),
+		})
+	}
+
+	dishes := append([]Dish(nil), menu.Dishes...)
+	sort.SliceStable(dishes, func(i, j int) bool { return dishes[i].Position < dishes[j].Position })
+	for _, dish := range dishes {
+		entry := &menugenpb.Dish{
+			Id:             dish.ID,
+			Name:           dish.Name,
+			Currency:       dish.Currency,
+			RawPriceString: dish.RawPriceString,
+			Description:    dish.Description,
+			ImageUrl:       dish.ImageURL,
+			Status:         dish.Status,
+			Position:       int32(dish.Position),
+			EditedByUser:   dish.EditedByUser,
+		}
+		if dish.SectionID != nil {
+			entry.SectionId = *dish.SectionID
+		}
+		if dish.PriceCents != nil {
+			entry.PriceCents = proto.Int32(int32(*dish.PriceCents))
+		}
+		if len(dish.Renditions) > 0 {
+			entry.Renditions = make(map[string]string, len(dish.Renditions))
+			for _, rendition := range dish.Renditions {
+				entry.Renditions[rendition.Name] = rendition.URL
+			}
+		}
+		message.Dishes = append(message.Dishes, entry)
+	}
+	return message
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Harness runs the HTTP API in process against FakeProviders and a
+// temporary schema of the configured database, so the pipeline from upload
+// to completion can be exercised without spending money. It swaps the
+// global db (and, with UseFixedClock, the clock and ID generator) and sets
+// environment variables while it runs, so only one harness may run at a
+// time. API keys are not required in it.
+type Harness struct {
+	Providers *FakeProviders
+	Router    *gin.Engine
+
+	schema     string
+	admin      *gorm.DB
+	previousDB *gorm.DB
+	restore    []func()
+	closed     bool
+}
+
+// NewHarness starts the fake providers and migrates a new schema. Close
+// drops the schema again.
+func NewHarness() (*Harness, error) {
+	h := &Harness{
+		Providers:  NewFakeProviders(),
+		schema:     "harness_" + strings.ReplaceAll(idGen.NewID(), "-", "")[:16],
+		previousDB: db,
+	}
+	for name, value := range h.Providers.Env() {
+		h.setenv(name, value)
+	}
+	h.setenv("DEMO_MODE", "false")
+	h.setenv("REQUIRE_API_KEY", "false")
+
+	if zapLog == nil {
+		zapLog = zap.NewNop()
+	}
+	if dishPool == nil {
+		dishPool = newWorkerPool(getEnvInt("DISH_WORKER_POOL_SIZE", 8), getEnvDuration("PRIORITY_AGING_INTERVAL", 30*time.Second))
+	}
+
+	var err error
+	h.admin, err = gorm.Open(postgres.Open(databaseDSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		h.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := h.admin.Exec("CREATE SCHEMA " + h.schema).Error; err != nil {
+		h.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+	if err := openDatabase(databaseDSN() + " search_path=" + h.schema); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	gin.SetMode(gin.TestMode)
+	h.Router = newRouter()
+	return h, nil
+}
+
+// Close waits for processing to finish, then drops the schema, stops the
+// providers, and restores the database and environment the harness
+// replaced.
+func (h *Harness) Close() error {
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	waitForProcessing(ctx)
+
+	var err error
+	if db != h.previousDB {
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+		db = h.previousDB
+	}
+	if h.admin != nil {
+		err = h.admin.Exec("DROP SCHEMA IF EXISTS " + h.schema + " CASCADE").Error
+		if sqlDB, dbErr := h.admin.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+	}
+	h.Providers.Close()
+	for i := len(h.restore) - 1; i >= 0; i-- {
+		h.restore[i]()
+	}
+	h.restore = nil
+	return err
+}
+
+func (h *Harness) setenv(name, value string) {
+	previous, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	h.restore = append(h.restore, func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// UseFixedClock makes every timestamp the service takes come from a
+// FixedClock at now, and every ID it creates sequential, until Close.
+func (h *Harness) UseFixedClock(now time.Time) *FixedClock {
+	fixed := NewFixedClock(now)
+	previousClock, previousIDGen := clock, idGen
+	clock, idGen = fixed, &SequentialIDGenerator{}
+	h.restore = append(h.restore, func() {
+		clock, idGen = previousClock, previousIDGen
+	})
+	return fixed
+}
+
+// CreateMenu stores a COMPLETE menu with one section holding a COMPLETE
+// dish per name, without running the pipeline. The menu is returned with
+// its sections and dishes.
+func (h *Harness) CreateMenu(dishNames ...string) (*Menu, error) {
+	menu := Menu{
+		ID:              idGen.NewID(),
+		Status:          "COMPLETE",
+		TotalDishes:     len(dishNames),
+		ProcessedDishes: len(dishNames),
+	}
+	menu.ImageHash = menu.ID
+	section := MenuSection{
+		ID:              idGen.NewID(),
+		MenuID:          menu.ID,
+		Name:            "Mains",
+		TotalDishes:     len(dishNames),
+		ProcessedDishes: len(dishNames),
+	}
+	dishes := make([]Dish, len(dishNames))
+	for i, name := range dishNames {
+		dishes[i] = Dish{
+			ID:        idGen.NewID(),
+			MenuID:    menu.ID,
+			SectionID: &section.ID,
+			Name:      name,
+			Currency:  "USD",
+			Status:    "COMPLETE",
+			Position:  i,
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&menu).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&section).Error; err != nil {
+			return err
+		}
+		if len(dishes) == 0 {
+			return nil
+		}
+		return tx.Create(&dishes).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create menu: %w", err)
+	}
+	menu.Sections = []MenuSection{section}
+	menu.Dishes = dishes
+	return &menu, nil
+}
+
+// Do sends a request to the API and returns its response.
+func (h *Harness) Do(method, path string, body io.Reader, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	recorder := httptest.NewRecorder()
+	h.Router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// UploadMenu uploads a PNG menu photo with the given form fields and returns
+// the new menu's ID.
+func (h *Harness) UploadMenu(photo []byte, fields map[string]string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="image"; filename="menu.png"`},
+		"Content-Type":        {"image/png"},
+	})
+	if err != nil {
+		return "", err
+	}
+	part.Write(photo)
+	form.Close()
+
+	resp := h.Do("POST", "/api/menu", &body, http.Header{"Content-Type": {form.FormDataContentType()}})
+	if resp.Code != http.StatusAccepted && resp.Code != http.StatusOK {
+		return "", fmt.Errorf("upload answered %d: %s", resp.Code, resp.Body.String())
+	}
+	var upload MenuUploadResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &upload); err != nil {
+		return "", fmt.Errorf("failed to decode upload response: %w", err)
+	}
+	return upload.MenuID, nil
+}
+
+// WaitForMenu polls the menu until it leaves PENDING and PROCESSING, and
+// returns it as GET /api/menu/:id does.
+func (h *Harness) WaitForMenu(menuID string, timeout time.Duration) (*MenuStatusResponse, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp := h.Do("GET", "/api/menu/"+menuID, nil, nil)
+		if resp.Code != http.StatusOK {
+			return nil, fmt.Errorf("menu answered %d: %s", resp.Code, resp.Body.String())
+		}
+		var menu MenuStatusResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &menu); err != nil {
+			return nil, fmt.Errorf("failed to decode menu: %w", err)
+		}
+		if menu.Status != "PENDING" && menu.Status != "PROCESSING" {
+			return &menu, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("menu still %s after %s", menu.Status, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// SampleMenuPhoto is a PNG to upload. The fake providers extract every photo
+// as the same menu, so its content does not matter, but each call returns a
+// different image so uploads are not taken for duplicates.
+func SampleMenuPhoto() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	seed := demoHash(idGen.NewID())
+	for i := range img.Pix {
+		img.Pix[i] = byte(seed >> (8 * (i % 4)))
+	}
+	var out bytes.Buffer
+	png.Encode(&out, img)
+	return out.Bytes()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// /health answers {"status": "ok"} without touching anything, for cheap
+// liveness probes. With ?deep=true it also pings the database, and with
+// &providers=true it checks that the OpenAI and Replicate keys configured
+// are accepted, using endpoints that cost nothing. Each check is bounded by
+// HEALTH_CHECK_TIMEOUT (2s). A failed database check answers 503; failed
+// provider checks only report the service degraded, since the service
+// still serves menus without them. Uploaded images are not stored, so there
+// is no object storage to check.
+
+// HealthCheck is the outcome of checking one dependency.
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthResponse is "ok", "degraded" when an optional dependency failed, or
+// "down" when the service cannot serve requests.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+	HealthError    = "error"
+)
+
+func healthHandler(c *gin.Context) {
+	if c.Query("deep") != "true" {
+		c.JSON(http.StatusOK, HealthResponse{Status: HealthOK})
+		return
+	}
+
+	timeout := getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+	response := HealthResponse{Status: HealthOK, Checks: map[string]HealthCheck{}}
+	response.Checks["database"] = runHealthCheck(c.Request.Context(), timeout, pingDatabase)
+	if response.Checks["database"].Status != HealthOK {
+		response.Status = HealthDown
+	}
+
+	if c.Query("providers") == "true" {
+		for name, check := range providerHealthChecks() {
+			response.Checks[name] = runHealthCheck(c.Request.Context(), timeout, check)
+			if response.Checks[name].Status != HealthOK && response.Status == HealthOK {
+				response.Status = HealthDegraded
+			}
+		}
+	}
+
+	status := http.StatusOK
+	if response.Status == HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
+
+// runHealthCheck runs check within timeout and times it.
+func runHealthCheck(ctx context.Context, timeout time.Duration, check func(ctx context.Context) error) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	err := check(ctx)
+	result := HealthCheck{Status: HealthOK, LatencyMs: float64(time.Since(started).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = HealthError
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func pingDatabase(ctx context.Context) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// providerHealthChecks returns a check for each provider with a key
+// configured.
+func providerHealthChecks() map[string]func(ctx context.Context) error {
+	checks := map[string]func(ctx context.Context) error{}
+	// Demo mode never calls the providers, so their health does not matter
+	if demoMode() {
+		return checks
+	}
+
+	openaiAPIKey := lookupOpenAIKey()
+	if openaiAPIKey != "" {
+		checks["openai"] = func(ctx context.Context) error {
+			return checkProviderAuth(ctx, openAIBaseURL()+"/v1/models", "Bearer "+openaiAPIKey)
+		}
+	}
+
+	replicateAPIKey := lookupReplicateKey()
+	if replicateAPIKey != "" {
+		checks["replicate"] = func(ctx context.Context) error {
+			return checkProviderAuth(ctx, replicateBaseURL()+"/v1/account", "Bearer "+replicateAPIKey)
+		}
+	}
+
+	return checks
+}
+
+// checkProviderAuth GETs url with the given Authorization and fails unless
+// the provider answers 200.
+func checkProviderAuth(ctx context.Context, url, authorization string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	discardResponse(resp)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("provider answered %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Clients retrying an upload send the same Idempotency-Key header, and get
+// the first attempt's response instead of a second menu. Near-duplicate
+// detection does not catch these retries when only the image's metadata
+// changed between attempts.
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// idempotencyPendingTimeout is how long an upload may hold its key before a
+// retry may assume it died with its server.
+const idempotencyPendingTimeout = time.Minute
+
+// IdempotencyKey maps a client's key to the menu its upload created. Keys
+// are scoped to the API key and user that sent them and expire after
+// IDEMPOTENCY_KEY_TTL (24h by default). MenuID is nil while the first
+// upload is still in flight.
+type IdempotencyKey struct {
+	Scope      string  `gorm:"primaryKey;type:varchar(80)"`
+	Key        string  `gorm:"primaryKey;type:varchar(255)"`
+	MenuID     *string `gorm:"type:uuid"`
+	MenuStatus string  `gorm:"type:varchar(20)"`
+	StatusCode int
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+var errIdempotencyKeyInUse = errors.New("an upload with this Idempotency-Key is still in progress")
+
+// idempotencyScope keeps clients from seeing each other's keys: uploads are
+// told apart by API key and user. Anonymous uploads without an API key share
+// one scope, like the unowned menus they create.
+func idempotencyScope(c *gin.Context) string {
+	scope := currentUserID(c)
+	if value, ok := c.Get("apiKey"); ok {
+		scope = value.(*APIKey).ID + ":" + scope
+	}
+	return scope
+}
+
+// reserveIdempotencyKey claims key for an upload. It returns the stored
+// mapping when an earlier upload already completed with the key, and
+// errIdempotencyKeyInUse while one is still running.
+func reserveIdempotencyKey(scope, key string) (*IdempotencyKey, error) {
+	now := clock.Now()
+	expired := now.Add(-getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour))
+	if err := db.Where("created_at < ?", expired).Delete(&IdempotencyKey{}).Error; err != nil {
+		zapLog.Warn("Failed to delete expired idempotency keys", zap.Error(err))
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&IdempotencyKey{Scope: scope, Key: key, CreatedAt: now})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var existing IdempotencyKey
+		err := db.Where("scope = ? AND key = ?", scope, key).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if existing.MenuID != nil {
+			return &existing, nil
+		}
+		if existing.CreatedAt.After(now.Add(-idempotencyPendingTimeout)) {
+			return nil, errIdempotencyKeyInUse
+		}
+		// The upload holding the key never finished; take it over
+		if err := db.Where("scope = ? AND key = ? AND menu_id IS NULL AND created_at = ?", scope, key, existing.CreatedAt).
+			Delete(&IdempotencyKey{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return nil, errIdempotencyKeyInUse
+}
+
+// completeIdempotencyKey records the response an upload sent, for retries
+// with the same key to replay.
+func completeIdempotencyKey(scope, key string, statusCode int, response MenuUploadResponse) {
+	if err := db.Model(&IdempotencyKey{}).Where("scope = ? AND key = ?", scope, key).Updates(map[string]interface{}{
+		"menu_id":     response.MenuID,
+		"menu_status": response.Status,
+		"status_code": statusCode,
+	}).Error; err != nil {
+		zapLog.Error("Failed to store idempotency key", zap.String("menuID", response.MenuID), zap.Error(err))
+	}
+}
+
+// releaseIdempotencyKey frees the key of an upload that failed, so the client
+// can retry it.
+func releaseIdempotencyKey(scope, key string) {
+	if err := db.Where("scope = ? AND key = ? AND menu_id IS NULL", scope, key).Delete(&IdempotencyKey{}).Error; err != nil {
+		zapLog.Warn("Failed to release idempotency key", zap.Error(err))
+	}
+}
+
+// replayIdempotentUpload answers a retry with the first upload's response.
+func replayIdempotentUpload(c *gin.Context, stored *IdempotencyKey) {
+	c.Header("Idempotent-Replayed", "true")
+	c.JSON(stored.StatusCode, MenuUploadResponse{
+		MenuID: *stored.MenuID,
+		Status: stored.MenuStatus,
+	})
+}
+
+// claimIdempotencyKey handles the Idempotency-Key header of an upload. It
+// returns the key to complete or release once the upload is answered, ""
+// when the request has none, and false when it already answered the request.
+func claimIdempotencyKey(c *gin.Context) (string, bool) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		return "", true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		respondFieldError(c, "Idempotency-Key", "max", "Idempotency-Key must be at most 255 characters")
+		return "", false
+	}
+
+	stored, err := reserveIdempotencyKey(idempotencyScope(c), key)
+	if errors.Is(err, errIdempotencyKeyInUse) {
+		c.Header("Retry-After", "1")
+		respondError(c, http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE", err.Error())
+		return "", false
+	}
+	if err != nil {
+		zapLog.Error("Failed to reserve idempotency key", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to check Idempotency-Key")
+		return "", false
+	}
+	if stored != nil {
+		replayIdempotentUpload(c, stored)
+		return "", false
+	}
+	return key, true
+}
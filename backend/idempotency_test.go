@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestIdempotencyKeyExpiry walks a key through an upload in flight, one
+// that died holding it, a completed upload, and expiry. It needs the
+// configured database, and is skipped when that cannot be reached.
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Skipf("no database for the harness: %v", err)
+	}
+	defer h.Close()
+	h.setenv("IDEMPOTENCY_KEY_TTL", "24h")
+	fixed := h.UseFixedClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	if stored, err := reserveIdempotencyKey("scope", "key"); stored != nil || err != nil {
+		t.Fatalf("first reservation = %v, %v; want it claimed", stored, err)
+	}
+	if _, err := reserveIdempotencyKey("scope", "key"); !errors.Is(err, errIdempotencyKeyInUse) {
+		t.Fatalf("reservation while the upload runs = %v, want errIdempotencyKeyInUse", err)
+	}
+
+	// The upload holding the key never finished
+	fixed.Advance(idempotencyPendingTimeout + time.Second)
+	if stored, err := reserveIdempotencyKey("scope", "key"); stored != nil || err != nil {
+		t.Fatalf("reservation of an abandoned key = %v, %v; want it taken over", stored, err)
+	}
+
+	menuID := idGen.NewID()
+	completeIdempotencyKey("scope", "key", 202, MenuUploadResponse{MenuID: menuID, Status: "PENDING"})
+	fixed.Advance(23 * time.Hour)
+	stored, err := reserveIdempotencyKey("scope", "key")
+	if err != nil || stored == nil || stored.MenuID == nil || *stored.MenuID != menuID {
+		t.Fatalf("reservation of a completed key = %+v, %v; want its menu %s", stored, err, menuID)
+	}
+
+	fixed.Advance(2 * time.Hour)
+	if stored, err := reserveIdempotencyKey("scope", "key"); stored != nil || err != nil {
+		t.Fatalf("reservation of an expired key = %+v, %v; want it claimed again", stored, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dishes whose image prompt matches one generated before, e.g. on another
+// branch of the same chain, can reuse that image instead of generating a new
+// one. The cache is keyed by a hash of the model, prompt, shape, and output
+// format, and is off unless IMAGE_CACHE_TTL is set: Replicate deletes
+// generated files after a while, so the TTL must stay below how long the
+// deployment's image URLs remain reachable. Regenerated images are neither
+// taken from nor added to the cache. The retention janitor deletes expired
+// entries.
+
+// ImageCacheEntry is a generated dish image shared by every dish with the
+// same prompt.
+type ImageCacheEntry struct {
+	PromptHash string            `gorm:"primaryKey;type:varchar(64)"`
+	ImageURL   string            `gorm:"type:text"`
+	Record     *GenerationRecord `gorm:"type:jsonb"`
+	Hits       int64             `gorm:"default:0"`
+	CreatedAt  time.Time         `gorm:"index"`
+}
+
+func imageCacheTTL() time.Duration {
+	return getEnvDuration("IMAGE_CACHE_TTL", 0)
+}
+
+// imagePromptHash identifies the image a dish would be generated with,
+// leaving out the random seed.
+func imagePromptHash(prompts menuPrompts, dishName, cuisine string, shape imageShape) string {
+	// The style's prompt stands for its generation parameters too
+	prompt, _ := dishImagePrompt(prompts, dishName, cuisine, prompts.ImageStyle, "")
+	parts := []string{dishImageModel, prompt, shape.AspectRatio, shape.Megapixels, imageOutputFormat()}
+	// Only watermarked images add the label, so other keys stay as they were
+	if text := watermarkText(); text != "" {
+		parts = append(parts, text)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// imageForDish returns an image for a dish of the menu: the catalog dish's
+// when an operator set one, otherwise from the cache when it is on.
+func imageForDish(ctx context.Context, menuID, dishName, cuisine string) (*string, *GenerationRecord, error) {
+	if entry := curatedCatalogDish(ctx, dishName); entry != nil && entry.ImageURL != nil {
+		return entry.ImageURL, catalogRecord(entry), nil
+	}
+
+	ttl := imageCacheTTL()
+	if ttl <= 0 {
+		return generateDishImage(ctx, menuID, dishName, cuisine, "", "")
+	}
+
+	prompts := loadMenuPrompts(menuID)
+	hash := imagePromptHash(prompts, dishName, cuisine, prompts.ImageShape)
+	var entry ImageCacheEntry
+	err := db.WithContext(ctx).Where("prompt_hash = ? AND created_at > ?", hash, clock.Now().Add(-ttl)).Take(&entry).Error
+	if err == nil && entry.Record != nil {
+		if err := db.Model(&ImageCacheEntry{}).Where("prompt_hash = ?", hash).
+			UpdateColumn("hits", gorm.Expr("hits + 1")).Error; err != nil {
+			logFor(ctx).Warn("Failed to count image cache hit", zap.Error(err))
+		}
+		record := *entry.Record
+		record.Cached = true
+		record.GeneratedAt = clock.Now()
+		return &entry.ImageURL, &record, nil
+	}
+
+	imageURL, record, err := generateDishImage(ctx, menuID, dishName, cuisine, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&ImageCacheEntry{
+		PromptHash: hash,
+		ImageURL:   *imageURL,
+		Record:     record,
+		CreatedAt:  clock.Now(),
+	}).Error; err != nil {
+		logFor(ctx).Warn("Failed to cache image", zap.String("dish", dishName), zap.Error(err))
+	}
+	return imageURL, record, nil
+}
+
+// purgeExpiredImages deletes cache entries past the TTL, and the stored
+// images only they showed, and returns how many entries it deleted. Without
+// a TTL the cache is off and every entry goes.
+func purgeExpiredImages(ctx context.Context) (int64, error) {
+	cutoff := clock.Now().Add(-imageCacheTTL())
+	result := db.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&ImageCacheEntry{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if _, err := deleteOrphanedImages(ctx); err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
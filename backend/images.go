@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DishImage is one generated image candidate for a dish. Exactly one
+// candidate per dish is active; its URL is mirrored into Dish.ImageURL.
+type DishImage struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DishID      string    `json:"dish_id" gorm:"type:uuid;index"`
+	MenuID      string    `json:"menu_id" gorm:"type:uuid;index"`
+	URL         string    `json:"url"`
+	Prompt      string    `json:"prompt"`
+	Seed        *int      `json:"seed"`
+	Active      bool      `json:"active" gorm:"default:false"`
+	ContentHash string    `json:"content_hash"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Image modes recorded on each menu.
+const (
+	ImageModeEnabled  = "ENABLED"
+	ImageModeDisabled = "DISABLED"
+)
+
+// imageGenerationEnabled is the deployment-wide switch for image generation.
+func imageGenerationEnabled() bool {
+	return getEnvBool("IMAGE_GENERATION_ENABLED", true)
+}
+
+// imageOutputFormat is the file format requested from Replicate. WebP keeps
+// images small for the web UI; jpg or png lets PDF exports embed them.
+func imageOutputFormat() string {
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("IMAGE_OUTPUT_FORMAT")))
+	switch format {
+	case "jpg", "png":
+	default:
+		format = "webp"
+	}
+	// Watermarked images are re-encoded, which Go cannot do for WebP
+	if format == "webp" && watermarkText() != "" {
+		format = "jpg"
+	}
+	return format
+}
+
+// imageModeForNewMenu decides whether a new menu gets generated images. It is
+// the single place a per-account or per-tier policy plugs in; today only the
+// deployment switch applies.
+func imageModeForNewMenu() string {
+	if !imageGenerationEnabled() {
+		return ImageModeDisabled
+	}
+	return ImageModeEnabled
+}
+
+// imageGenerationAllowed reports whether images may be generated for a menu
+// right now: the menu must have been created with images enabled and the
+// deployment switch must still be on.
+func imageGenerationAllowed(menuID string) bool {
+	if !imageGenerationEnabled() {
+		return false
+	}
+	var mode string
+	if err := db.Model(&Menu{}).Where("id = ?", menuID).Pluck("image_mode", &mode).Error; err != nil {
+		zapLog.Error("Failed to load image mode", zap.String("menuID", menuID), zap.Error(err))
+		return false
+	}
+	return mode != ImageModeDisabled
+}
+
+// requireImageGeneration writes a 409 and returns false when images cannot be
+// generated for the dish's menu.
+func requireImageGeneration(c *gin.Context, dish *Dish) bool {
+	if !imageGenerationAllowed(dish.MenuID) {
+		respondError(c, http.StatusConflict, "IMAGE_GENERATION_DISABLED", "Image generation is disabled for this menu")
+		return false
+	}
+	return true
+}
+
+func getConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"image_generation_enabled": imageGenerationEnabled(),
+	})
+}
+
+type GenerateImagesRequest struct {
+	Count      int    `json:"count" binding:"omitempty,min=1,max=4"`
+	PromptHint string `json:"prompt_hint" binding:"max=200"`
+	// Style overrides the menu's image style for these candidates
+	Style string `json:"style" binding:"omitempty,oneof=rustic fine_dining street_food flat_lay"`
+}
+
+func listDishImagesHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	images := []DishImage{}
+	if err := db.Where("dish_id = ?", dish.ID).Order("created_at DESC").Find(&images).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load images")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dish_id": dish.ID, "images": images})
+}
+
+// generateDishImagesHandler generates several candidates for a dish in the
+// background. The first candidate becomes active only if the dish has no image
+// yet; otherwise owners pick one with the select endpoint.
+func generateDishImagesHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	var req GenerateImagesRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+	if req.Count == 0 {
+		req.Count = 4
+	}
+
+	if !requireImageGeneration(c, dish) || !beginDishRegeneration(c, dish) {
+		return
+	}
+
+	runInBackground(dish.MenuID, func(ctx context.Context) {
+		dish := *dish
+		imageURLs, record, err := generateDishImages(ctx, dish.MenuID, dish.Name, dish.Cuisine, req.Style, strings.TrimSpace(req.PromptHint), req.Count)
+		if err != nil {
+			zapLog.Error("Failed to generate image candidates", zap.String("dishID", dish.ID), zap.Error(err))
+			finishDishRegeneration(dish, nil)
+			return
+		}
+
+		activate := dish.ImageURL == nil
+		if err := recordDishImages(db, dish, imageURLs, record, activate); err != nil {
+			zapLog.Error("Failed to store image candidates", zap.String("dishID", dish.ID), zap.Error(err))
+		}
+
+		var updates map[string]interface{}
+		if activate {
+			updates = map[string]interface{}{
+				"image_url":           imageURLs[0],
+				"image_alt":           dishImageAlt(dish.Name, dish.Description),
+				"generation_metadata": mergeGenerationMetadata(dish.GenerationMetadata, nil, record),
+			}
+		}
+		finishDishRegeneration(dish, updates)
+	})
+
+	c.JSON(http.StatusAccepted, RegenerateResponse{DishID: dish.ID, Status: "REGENERATING"})
+}
+
+// selectDishImageHandler makes one candidate the dish's active image.
+func selectDishImageHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	var image DishImage
+	if err := db.Where("id = ? AND dish_id = ?", c.Param("imageId"), dish.ID).First(&image).Error; err != nil {
+		respondError(c, http.StatusNotFound, "IMAGE_NOT_FOUND", "Image not found")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := beginMenuEdit(tx, dish.MenuID, "image-select"); err != nil {
+			return err
+		}
+		if err := tx.Model(&DishImage{}).Where("dish_id = ?", dish.ID).Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&DishImage{}).Where("id = ?", image.ID).Update("active", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Dish{}).Where("id = ?", dish.ID).Updates(map[string]interface{}{
+			"image_url":  image.URL,
+			"updated_at": clock.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return touchMenu(tx, dish.MenuID)
+	})
+	if err != nil {
+		zapLog.Error("Failed to select image", zap.String("dishID", dish.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to select image")
+		return
+	}
+
+	image.Active = true
+	c.JSON(http.StatusOK, image)
+}
+
+// recordDishImages stores generated candidates for a dish. When activate is
+// set the first candidate becomes the active one.
+func recordDishImages(tx *gorm.DB, dish Dish, imageURLs []string, record *GenerationRecord, activate bool) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if activate {
+			if err := tx.Model(&DishImage{}).Where("dish_id = ?", dish.ID).Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+
+		for i, imageURL := range imageURLs {
+			image := DishImage{
+				ID:        idGen.NewID(),
+				DishID:    dish.ID,
+				MenuID:    dish.MenuID,
+				URL:       imageURL,
+				Active:    activate && i == 0,
+				CreatedAt: clock.Now(),
+			}
+			if record != nil {
+				image.Prompt = record.Prompt
+				image.Seed = record.Seed
+			}
+			if err := tx.Create(&image).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobRegistry tracks every menu currently being processed, and the
+// regenerations running for each menu, so that other requests (e.g.
+// deletion) can stop them. Stopping cancels the context their provider
+// requests are made with.
+type jobRegistry struct {
+	mu    sync.Mutex
+	jobs  map[string]*processingJob
+	tasks map[string]map[int64]context.CancelCauseFunc
+	// lastTask numbers tasks so that each can deregister itself
+	lastTask int64
+	// lastJob numbers registrations so that a finishing job leaves a newer
+	// registration for the same menu alone
+	lastJob int64
+	// stopped is the cause every job was aborted with on shutdown; jobs
+	// started afterwards are aborted with it straight away
+	stopped error
+}
+
+type processingJob struct {
+	token     int64
+	cancel    context.CancelCauseFunc
+	startedAt time.Time
+}
+
+var processingJobs = &jobRegistry{
+	jobs:  make(map[string]*processingJob),
+	tasks: make(map[string]map[int64]context.CancelCauseFunc),
+}
+
+// start registers menuID and returns the context its processing should
+// observe, with the token to pass to finish.
+func (r *jobRegistry) start(menuID string) (context.Context, int64) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	jobStats.pipelines.Add(1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.jobs[menuID]; ok {
+		existing.cancel(context.Canceled)
+	}
+	r.lastJob++
+	r.jobs[menuID] = &processingJob{token: r.lastJob, cancel: cancel, startedAt: clock.Now()}
+	if r.stopped != nil {
+		cancel(r.stopped)
+	}
+	return ctx, r.lastJob
+}
+
+// finish releases the registration start returned token for once processing
+// has returned. A newer registration for menuID is left running.
+func (r *jobRegistry) finish(menuID string, token int64) {
+	jobStats.pipelines.Add(-1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[menuID]; ok && job.token == token {
+		job.cancel(nil)
+		delete(r.jobs, menuID)
+	}
+}
+
+// startTask registers background work on menuID other than its processing,
+// such as a regeneration. It returns the context the work should observe
+// and the function to call once it is done.
+func (r *jobRegistry) startTask(menuID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastTask++
+	id := r.lastTask
+	if r.tasks[menuID] == nil {
+		r.tasks[menuID] = make(map[int64]context.CancelCauseFunc)
+	}
+	r.tasks[menuID][id] = cancel
+	if r.stopped != nil {
+		cancel(r.stopped)
+	}
+
+	return ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		cancel(nil)
+		delete(r.tasks[menuID], id)
+		if len(r.tasks[menuID]) == 0 {
+			delete(r.tasks, menuID)
+		}
+	}
+}
+
+// cancel stops in-flight processing for menuID and reports whether any was running.
+func (r *jobRegistry) cancel(menuID string) bool {
+	return r.abort(menuID, context.Canceled)
+}
+
+// running reports whether this process is processing menuID.
+func (r *jobRegistry) running(menuID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.jobs[menuID]
+	return ok
+}
+
+// abort stops in-flight processing for menuID with the given cause, which the
+// pipeline inspects via context.Cause to decide how to finish the menu, along
+// with the menu's other tasks. It reports whether processing was running.
+func (r *jobRegistry) abort(menuID string, cause error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cancel := range r.tasks[menuID] {
+		cancel(cause)
+	}
+	job, ok := r.jobs[menuID]
+	if ok {
+		job.cancel(cause)
+		delete(r.jobs, menuID)
+	}
+	return ok
+}
+
+// abortAll stops every in-flight job and task, and any started later, with
+// cause. It returns the menus that were being processed.
+func (r *jobRegistry) abortAll(cause error) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = cause
+	menuIDs := make([]string, 0, len(r.jobs))
+	for menuID, job := range r.jobs {
+		job.cancel(cause)
+		menuIDs = append(menuIDs, menuID)
+	}
+	for _, tasks := range r.tasks {
+		for _, cancel := range tasks {
+			cancel(cause)
+		}
+	}
+	return menuIDs
+}
+
+// InFlightMenu is a menu this process is working on.
+type InFlightMenu struct {
+	MenuID         string    `json:"menu_id"`
+	StartedAt      time.Time `json:"started_at"`
+	RunningSeconds float64   `json:"running_seconds"`
+}
+
+// inFlight lists the registered menus, longest running first.
+func (r *jobRegistry) inFlight() []InFlightMenu {
+	now := clock.Now()
+	r.mu.Lock()
+	menus := make([]InFlightMenu, 0, len(r.jobs))
+	for menuID, job := range r.jobs {
+		menus = append(menus, InFlightMenu{MenuID: menuID, StartedAt: job.startedAt, RunningSeconds: now.Sub(job.startedAt).Seconds()})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(menus, func(i, j int) bool { return menus[i].StartedAt.Before(menus[j].StartedAt) })
+	return menus
+}
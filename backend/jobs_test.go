@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJobRegistryFinishKeepsNewerRegistration(t *testing.T) {
+	r := &jobRegistry{
+		jobs:  make(map[string]*processingJob),
+		tasks: make(map[string]map[int64]context.CancelCauseFunc),
+	}
+
+	first, firstToken := r.start("m1")
+	second, secondToken := r.start("m1")
+	if first.Err() == nil {
+		t.Error("starting a menu again should cancel its earlier registration")
+	}
+
+	r.finish("m1", firstToken)
+	if !r.running("m1") || second.Err() != nil {
+		t.Fatal("finishing an older registration cancelled the newer one")
+	}
+
+	r.finish("m1", secondToken)
+	if r.running("m1") || second.Err() == nil {
+		t.Error("finishing the current registration should release it")
+	}
+}
+
+func TestJobRegistryInFlight(t *testing.T) {
+	fixed := NewFixedClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	previous := clock
+	clock = fixed
+	defer func() { clock = previous }()
+
+	r := &jobRegistry{
+		jobs:  make(map[string]*processingJob),
+		tasks: make(map[string]map[int64]context.CancelCauseFunc),
+	}
+	_, older := r.start("older")
+	defer r.finish("older", older)
+	fixed.Advance(30 * time.Second)
+	_, newer := r.start("newer")
+	defer r.finish("newer", newer)
+	fixed.Advance(15 * time.Second)
+
+	menus := r.inFlight()
+	if len(menus) != 2 || menus[0].MenuID != "older" || menus[1].MenuID != "newer" {
+		t.Fatalf("inFlight() = %+v, want older then newer", menus)
+	}
+	if menus[0].RunningSeconds != 45 || menus[1].RunningSeconds != 15 {
+		t.Errorf("running for %vs and %vs, want 45s and 15s", menus[0].RunningSeconds, menus[1].RunningSeconds)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// marshalJSONColumn and scanJSONColumn implement driver.Valuer/sql.Scanner
+// for types stored in Postgres JSONB columns.
+func marshalJSONColumn(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func scanJSONColumn(value interface{}, dest interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", value)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// StringList is a list of strings stored as a JSONB array.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	return marshalJSONColumn(l)
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSONColumn(value, l)
+}
+
+// RowCounts maps table names to numbers of rows, stored as a JSONB object.
+type RowCounts map[string]int64
+
+func (c RowCounts) Value() (driver.Value, error) {
+	return marshalJSONColumn(c)
+}
+
+func (c *RowCounts) Scan(value interface{}) error {
+	return scanJSONColumn(value, c)
+}
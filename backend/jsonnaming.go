@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The API's JSON fields are snake_case. JSON_FIELD_NAMING=camelCase renames
+// them for clients that expect camelCase: every key of the JSON responses
+// under /api, and of JSON request bodies, which may then use either. Field
+// names are renamed, not values, so error codes, field paths in validation
+// errors, query parameters, and webhook payloads stay snake_case. GraphQL
+// has its own names and is left alone. contracts.txt records the snake_case
+// names; TestContractsCamelCase checks that no two fields of a response get
+// the same camelCase name.
+
+const (
+	fieldNamingSnake = "snake_case"
+	fieldNamingCamel = "camelCase"
+)
+
+// jsonFieldNaming is the naming of JSON fields under /api. It is configured
+// in main, before the router is built.
+var jsonFieldNaming = fieldNamingSnake
+
+// renameJSONFields renames the fields of JSON requests and responses from
+// and to camelCase when naming asks for it.
+func renameJSONFields(naming string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if naming != fieldNamingCamel || c.Request.URL.Path == "/api/graphql" {
+			c.Next()
+			return
+		}
+
+		if c.Request.Body != nil && strings.HasPrefix(strings.ToLower(c.GetHeader("Content-Type")), "application/json") {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "Failed to read request body")
+				c.Abort()
+				return
+			}
+			if renamed, err := renameJSONKeys(body, camelToSnake); err == nil {
+				body = renamed
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Request.ContentLength = int64(len(body))
+		}
+
+		writer := &renamingResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer writer.finish()
+		c.Next()
+	}
+}
+
+// renamingResponseWriter holds back a JSON response to rename its fields
+// once the handler is done. Other responses pass straight through.
+type renamingResponseWriter struct {
+	gin.ResponseWriter
+	buffer   bytes.Buffer
+	decided  bool
+	renaming bool
+}
+
+func (w *renamingResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.renaming = !w.ResponseWriter.Written() &&
+			strings.HasPrefix(strings.ToLower(w.Header().Get("Content-Type")), "application/json")
+	}
+	if w.renaming {
+		return w.buffer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *renamingResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// finish sends the renamed response; one that is not valid JSON goes out
+// as it is.
+func (w *renamingResponseWriter) finish() {
+	if !w.renaming {
+		return
+	}
+	body := w.buffer.Bytes()
+	if renamed, err := renameJSONKeys(body, snakeToCamel); err == nil {
+		body = renamed
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.Write(body)
+}
+
+// renameJSONKeys re-encodes the JSON document data with every object key
+// passed through rename, keeping the order of keys and the values as they
+// are.
+func renameJSONKeys(data []byte, rename func(string) string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	// open counts the tokens read so far in each open array and object, so
+	// that keys and the separators between tokens can be told
+	type container struct {
+		object bool
+		tokens int
+	}
+	var open []container
+	var out bytes.Buffer
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			open = open[:len(open)-1]
+			out.WriteByte(byte(delim))
+			continue
+		}
+
+		isKey := false
+		if len(open) > 0 {
+			top := &open[len(open)-1]
+			switch {
+			case top.object && top.tokens%2 == 1:
+				out.WriteByte(':')
+			case top.tokens > 0:
+				out.WriteByte(',')
+			}
+			isKey = top.object && top.tokens%2 == 0
+			top.tokens++
+		}
+
+		switch value := token.(type) {
+		case json.Delim:
+			out.WriteByte(byte(value))
+			open = append(open, container{object: value == '{'})
+		case string:
+			if isKey {
+				value = rename(value)
+			}
+			encoded, _ := json.Marshal(value)
+			out.Write(encoded)
+		case json.Number:
+			out.WriteString(value.String())
+		case bool:
+			if value {
+				out.WriteString("true")
+			} else {
+				out.WriteString("false")
+			}
+		case nil:
+			out.WriteString("null")
+		}
+	}
+}
+
+// snakeToCamel turns menu_id into menuId.
+func snakeToCamel(name string) string {
+	if !strings.Contains(strings.Trim(name, "_"), "_") {
+		return name
+	}
+	parts := strings.Split(name, "_")
+	var out strings.Builder
+	for i, part := range parts {
+		if i == 0 || part == "" {
+			out.WriteString(part)
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		out.WriteString(string(runes))
+	}
+	return out.String()
+}
+
+// camelToSnake turns menuId, and MenuID, into menu_id. Names without capitals
+// stay as they are.
+func camelToSnake(name string) string {
+	runes := []rune(name)
+	var out strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			previousLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			acronymEnds := i > 0 && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || acronymEnds {
+				out.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
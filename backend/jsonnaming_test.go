@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenameJSONKeys(t *testing.T) {
+	in := `{"menu_id":"a_b","total_dishes":3,"dishes":[{"image_url":null,"spice_level":1.5,"is_new":true}],"empty":{},"list":[]}`
+	want := `{"menuId":"a_b","totalDishes":3,"dishes":[{"imageUrl":null,"spiceLevel":1.5,"isNew":true}],"empty":{},"list":[]}`
+	got, err := renameJSONKeys([]byte(in), snakeToCamel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("renameJSONKeys = %s, want %s", got, want)
+	}
+
+	back, err := renameJSONKeys(got, camelToSnake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != in {
+		t.Errorf("renameJSONKeys back = %s, want %s", back, in)
+	}
+}
+
+func TestCamelToSnake(t *testing.T) {
+	for name, want := range map[string]string{
+		"menuId":         "menu_id",
+		"MenuID":         "menu_id",
+		"imageURLPrefix": "image_url_prefix",
+		"dish2Name":      "dish2_name",
+		"menu_id":        "menu_id",
+	} {
+		if got := camelToSnake(name); got != want {
+			t.Errorf("camelToSnake(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRenameJSONFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(renameJSONFields(fieldNamingCamel))
+	r.POST("/api/echo", func(c *gin.Context) {
+		var req struct {
+			MenuID string `json:"menu_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"menu_id": req.MenuID})
+	})
+	r.GET("/api/text", func(c *gin.Context) {
+		c.String(http.StatusOK, `{"menu_id":1}`)
+	})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/echo", strings.NewReader(`{"menuId":"m1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(recorder, req)
+	if got := recorder.Body.String(); got != `{"menuId":"m1"}` {
+		t.Errorf("JSON response = %s", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/text", nil))
+	if got := recorder.Body.String(); got != `{"menu_id":1}` {
+		t.Errorf("text response = %s", got)
+	}
+}
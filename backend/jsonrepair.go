@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// A menu structure that does not decode is not given up on at once. The
+// mistakes models make most, Markdown code fences, text around the object,
+// and trailing commas, are fixed in place; failing that, gpt-4o-mini is
+// asked to fix the JSON, once. Either way the answer as it came is appended
+// to the menu's raw_extraction, as are answers cut off at the token limit;
+// GET /api/admin/menus/:id/raw-extraction shows them, so prompts and schemas
+// can be debugged from what the model said. The other structured answers get
+// the fixes in place only. JSON_REPAIR_ENABLED=false fails such menus
+// straight away, still keeping the answer. A menu structure still cut off at
+// EXTRACTION_TOKEN_LIMIT keeps the dishes it got to (see
+// salvageMenuStructure).
+
+func jsonRepairEnabled() bool {
+	return getEnvBool("JSON_REPAIR_ENABLED", true)
+}
+
+// repairJSON strips code fences and text around the JSON object in content,
+// and drops trailing commas outside strings.
+func repairJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		// ```json on its own line, and the closing fence
+		if i := strings.IndexByte(content, '\n'); i >= 0 {
+			content = content[i+1:]
+		}
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	}
+	if start, end := strings.IndexByte(content, '{'), strings.LastIndexByte(content, '}'); start >= 0 && end > start {
+		content = content[start : end+1]
+	}
+
+	var out strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			next := strings.TrimLeft(content[i+1:], " \t\r\n")
+			if next == "" || next[0] == '}' || next[0] == ']' {
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+// closeTruncatedJSON cuts content, a JSON object cut off part way, after
+// its last complete value and closes the arrays and objects left open. It
+// returns "" when content has no object.
+func closeTruncatedJSON(content string) string {
+	start := strings.IndexByte(content, '{')
+	if start < 0 {
+		return ""
+	}
+	content = content[start:]
+
+	var open []byte
+	cut, closers := 0, ""
+	// mark records that content may end before i, closing what is open
+	mark := func(i int) {
+		cut = i
+		var b strings.Builder
+		for j := len(open) - 1; j >= 0; j-- {
+			b.WriteByte(open[j])
+		}
+		closers = b.String()
+	}
+	inString, escaped := false, false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			open = append(open, '}')
+			mark(i + 1)
+		case c == '[':
+			open = append(open, ']')
+			mark(i + 1)
+		case c == '}' || c == ']':
+			if len(open) == 0 {
+				return content[:i]
+			}
+			open = open[:len(open)-1]
+			mark(i + 1)
+			if len(open) == 0 {
+				return content[:i+1]
+			}
+		case c == ',':
+			mark(i)
+		}
+	}
+	if cut == 0 {
+		return ""
+	}
+	return content[:cut] + closers
+}
+
+// salvageMenuStructure decodes what a menu structure answer cut off at the
+// token limit got to, dropping the value it was cut off in. ok is false when
+// that has no dishes.
+func salvageMenuStructure(content string) (*StructuredMenu, bool) {
+	var menu StructuredMenu
+	if json.Unmarshal([]byte(repairJSON(closeTruncatedJSON(content))), &menu) != nil {
+		return nil, false
+	}
+	for _, section := range menu.Sections {
+		if len(section.Dishes) > 0 {
+			return &menu, true
+		}
+	}
+	return nil, false
+}
+
+// decodeMenuStructure decodes a menu structure answer, repairing it when it
+// does not decode. schema and maxTokens are those of the request it answers.
+func decodeMenuStructure(ctx context.Context, menuID, content string, schema map[string]interface{}, maxTokens int) (*StructuredMenu, error) {
+	var menu StructuredMenu
+	err := json.Unmarshal([]byte(content), &menu)
+	if err == nil {
+		return &menu, nil
+	}
+	storeRawExtraction(menuID, content)
+	if !jsonRepairEnabled() {
+		return nil, fmt.Errorf("failed to unmarshal structured menu: %w", err)
+	}
+
+	if repaired := repairJSON(content); repaired != content {
+		var fixed StructuredMenu
+		if json.Unmarshal([]byte(repaired), &fixed) == nil {
+			logFor(ctx).Warn("Repaired malformed menu structure", zap.String("menuID", menuID), zap.Error(err))
+			return &fixed, nil
+		}
+	}
+
+	logFor(ctx).Warn("Malformed menu structure, asking the model to fix it", zap.String("menuID", menuID), zap.Error(err))
+	var fixed StructuredMenu
+	if askErr := requestStructured(ctx, menuID, structuredRequest{
+		Stage:      stageExtract,
+		SchemaName: "menu_structure",
+		SystemPrompt: "The user sends JSON describing a restaurant menu that fails to parse, and the parser's error. " +
+			"Answer with the same document as valid JSON. Keep every section, dish, and value as it is; do not add, drop, or reword anything.",
+		UserPrompt: "Error: " + err.Error() + "\n\n" + content,
+		Schema:     schema,
+		MaxTokens:  maxTokens,
+		Timeout:    loadProviderTimeouts().Vision,
+	}, &fixed); askErr != nil {
+		return nil, fmt.Errorf("failed to unmarshal structured menu: %w (repair failed: %v)", err, askErr)
+	}
+	return &fixed, nil
+}
+
+// storeRawExtraction appends a menu structure answer to the menu's
+// raw_extraction. Parts of a menu answer concurrently, so the append is done
+// by the database.
+func storeRawExtraction(menuID, content string) {
+	if err := db.Model(&Menu{}).Where("id = ?", menuID).
+		Update("raw_extraction", gorm.Expr("COALESCE(raw_extraction || ?, '') || ?", "\n\n", content)).Error; err != nil {
+		zapLog.Warn("Failed to store raw extraction", zap.String("menuID", menuID), zap.Error(err))
+	}
+}
+
+type RawExtractionResponse struct {
+	MenuID        string  `json:"menu_id"`
+	Status        string  `json:"status"`
+	RawExtraction *string `json:"raw_extraction"`
+}
+
+// getRawExtractionHandler returns the menu structure answers of the menu
+// that did not decode as they came, or null when there were none.
+func getRawExtractionHandler(c *gin.Context) {
+	var menu Menu
+	if err := db.Select("id", "status", "raw_extraction").Where("id = ?", c.Param("id")).First(&menu).Error; err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return
+	}
+	c.JSON(http.StatusOK, RawExtractionResponse{MenuID: menu.ID, Status: menu.Status, RawExtraction: menu.RawExtraction})
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestCloseTruncatedJSON(t *testing.T) {
+	for content, want := range map[string]string{
+		`{"currency":"USD","sections":[{"name":"Mains","dishes":[{"name":"A"},{"name":"B","pri`: `{"currency":"USD","sections":[{"name":"Mains","dishes":[{"name":"A"},{"name":"B"}]}]}`,
+		`{"sections":[{"name":"Mains","dishes":[{"name":"A, \"B\"}"}],"x":12`:                   `{"sections":[{"name":"Mains","dishes":[{"name":"A, \"B\"}"}]}]}`,
+		"```json\n{\"sections\":[": `{"sections":[]}`,
+		`{"currency":"US`:          `{}`,
+		`{"complete":true} ok`:     `{"complete":true}`,
+		`no object`:                ``,
+	} {
+		if got := closeTruncatedJSON(content); got != want {
+			t.Errorf("closeTruncatedJSON(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestSalvageMenuStructure(t *testing.T) {
+	menu, ok := salvageMenuStructure(`{"sections":[{"name":"Mains","dishes":[{"name":"Pad Thai","price":"12"},{"name":"Green Cu`)
+	if !ok {
+		t.Fatal("salvageMenuStructure kept no dishes")
+	}
+	if len(menu.Sections) != 1 || len(menu.Sections[0].Dishes) != 2 || menu.Sections[0].Dishes[0].Name != "Pad Thai" {
+		t.Errorf("salvageMenuStructure = %+v", menu)
+	}
+
+	if _, ok := salvageMenuStructure(`{"sections":[{"name":"Mai`); ok {
+		t.Error("salvageMenuStructure kept a menu without dishes")
+	}
+}
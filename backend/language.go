@@ -0,0 +1,79 @@
+package main
+
+import (
+	"unicode"
+)
+
+// Extraction tells the language a menu is written in, stored on the menu as
+// a BCP 47 tag. Dishes whose names are in a script other than Latin, such as
+// Thai, Japanese, or Cyrillic, also get a romanized name so diners who cannot
+// read the script can still pronounce and order them.
+
+// scriptLanguages guesses a menu's language from the script of its dish
+// names when extraction does not tell it. Han is checked last, since
+// Japanese menus mix it with kana.
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Thai, "th"},
+	{unicode.Lao, "lo"},
+	{unicode.Khmer, "km"},
+	{unicode.Myanmar, "my"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Bengali, "bn"},
+	{unicode.Tamil, "ta"},
+	{unicode.Sinhala, "si"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Georgian, "ka"},
+	{unicode.Armenian, "hy"},
+	{unicode.Ethiopic, "am"},
+	{unicode.Han, "zh"},
+}
+
+// usesLatinScript reports whether every letter of text is Latin.
+func usesLatinScript(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) && !unicode.Is(unicode.Latin, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// detectMenuLanguage returns the language extraction found for the menu,
+// or else one guessed from the script of its dish names, or "" if neither
+// tells.
+func detectMenuLanguage(structured *StructuredMenu) string {
+	if language, ok := parseLanguage(structured.Language); ok {
+		return language
+	}
+	for _, candidate := range scriptLanguages {
+		for _, section := range structured.Sections {
+			for _, dish := range section.Dishes {
+				for _, r := range dish.Name {
+					if unicode.Is(candidate.script, r) {
+						return candidate.language
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// romanizedDishName returns the romanized name extraction gave a dish named
+// name, or nil when the name is already in Latin script or none was given.
+func romanizedDishName(dish StructuredDish, name string) *string {
+	romanized := dish.RomanizedName
+	if romanized == "" || romanized == name || usesLatinScript(name) || !usesLatinScript(romanized) {
+		return nil
+	}
+	return &romanized
+}
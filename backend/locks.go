@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// Scheduled jobs that must run on only one replica at a time. Each name is
+// also the key of its row in job_locks.
+const (
+	jobSpendRollup    = "spend-rollup"
+	jobSchemaBackfill = "schema-backfill"
+	jobRetention      = "retention"
+	jobRegenSweep     = "regeneration-sweep"
+)
+
+// JobLock records the most recent run of a scheduled job for the admin API.
+// Mutual exclusion itself comes from a Postgres advisory lock, which the
+// database releases if the holding replica dies; this row is only status.
+type JobLock struct {
+	Name           string     `json:"name" gorm:"primaryKey"`
+	AdvisoryLockID int64      `json:"advisory_lock_id"`
+	Holder         string     `json:"holder"`
+	AcquiredAt     *time.Time `json:"acquired_at"`
+	ReleasedAt     *time.Time `json:"released_at"`
+	LastError      string     `json:"last_error"`
+	SkippedAt      *time.Time `json:"skipped_at"`
+	SkippedBy      string     `json:"skipped_by"`
+	Held           bool       `json:"held" gorm:"-"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// instanceName identifies this replica in job lock status.
+var instanceName = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}()
+
+// advisoryLockID maps a job name onto the 64-bit key space of pg advisory locks.
+func advisoryLockID(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("menugen:" + name))
+	return int64(h.Sum64())
+}
+
+// withJobLock runs fn while holding the named advisory lock and reports
+// whether it ran. When another replica holds the lock fn is skipped and
+// withJobLock returns false with no error. The lock is session-scoped, so it
+// is taken on a dedicated connection that is kept for the duration of fn.
+func withJobLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve connection for lock %s: %w", name, err)
+	}
+	defer conn.Close()
+
+	lockID := advisoryLockID(name)
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockID).Scan(&acquired); err != nil {
+		return false, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+	if !acquired {
+		now := clock.Now()
+		recordJobLock(JobLock{Name: name, AdvisoryLockID: lockID, SkippedAt: &now, SkippedBy: instanceName}, "skipped_at", "skipped_by")
+		return false, nil
+	}
+	defer func() {
+		// Unlock even if ctx was cancelled, or the lock outlives the job
+		// until the pooled connection is closed.
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			zapLog.Error("Failed to release job lock", zap.String("job", name), zap.Error(err))
+		}
+	}()
+
+	acquiredAt := clock.Now()
+	recordJobLock(JobLock{Name: name, AdvisoryLockID: lockID, Holder: instanceName, AcquiredAt: &acquiredAt}, "holder", "acquired_at", "released_at", "last_error")
+
+	runErr := fn(ctx)
+
+	releasedAt := clock.Now()
+	status := JobLock{Name: name, AdvisoryLockID: lockID, ReleasedAt: &releasedAt}
+	if runErr != nil {
+		status.LastError = runErr.Error()
+	}
+	recordJobLock(status, "released_at", "last_error")
+	return true, runErr
+}
+
+// recordJobLock upserts the given columns of a job's status row. Failures are
+// only logged: status must never stop a job from running.
+func recordJobLock(status JobLock, columns ...string) {
+	status.UpdatedAt = clock.Now()
+	columns = append(columns, "advisory_lock_id", "updated_at")
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&status).Error
+	if err != nil {
+		zapLog.Warn("Failed to record job lock status", zap.String("job", status.Name), zap.Error(err))
+	}
+}
+
+// listJobLocksHandler reports every scheduled job's last run and whether its
+// advisory lock is held right now by any replica.
+func listJobLocksHandler(c *gin.Context) {
+	var locks []JobLock
+	if err := db.Order("name").Find(&locks).Error; err != nil {
+		zapLog.Error("Failed to list job locks", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list job locks")
+		return
+	}
+
+	// pg_locks splits a bigint advisory key into classid (high half) and
+	// objid (low half) with objsubid 1.
+	var held []int64
+	err := db.Raw(`SELECT (classid::bigint << 32) | objid::bigint FROM pg_locks
+		WHERE locktype = 'advisory' AND objsubid = 1 AND granted`).Scan(&held).Error
+	if err != nil {
+		zapLog.Error("Failed to read advisory locks", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list job locks")
+		return
+	}
+	heldIDs := make(map[int64]bool, len(held))
+	for _, id := range held {
+		heldIDs[id] = true
+	}
+	for i := range locks {
+		locks[i].Held = heldIDs[locks[i].AdvisoryLockID]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"instance": instanceName, "locks": locks})
+}
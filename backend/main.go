@@ -2,22 +2,27 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
@@ -27,42 +32,93 @@ import (
 
 // Database Models
 type Menu struct {
-	ID              string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	OriginalFile    string        `json:"original_filename"`
-	ImageHash       string        `json:"image_hash" gorm:"uniqueIndex"`
-	Status          string        `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
-	FailureReason   *string       `json:"failure_reason"`
-	TotalDishes     int           `json:"total_dishes"`
-	ProcessedDishes int           `json:"processed_dishes"`
-	CreatedAt       time.Time     `json:"created_at"`
-	UpdatedAt       time.Time     `json:"updated_at"`
-	CompletedAt     *time.Time    `json:"completed_at"`
-	Sections        []MenuSection `json:"sections,omitempty" gorm:"foreignKey:MenuID"`
-	Dishes          []Dish        `json:"dishes,omitempty" gorm:"foreignKey:MenuID"`
+	ID                 string           `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID             *string          `json:"-" gorm:"type:uuid;uniqueIndex:idx_menus_owner_image_hash"`
+	RestaurantID       *string          `json:"restaurant_id" gorm:"type:uuid;index"`
+	APIKeyID           *string          `json:"-" gorm:"type:uuid;index"`
+	OriginalFile       string           `json:"original_filename"`
+	ImageHash          string           `json:"image_hash" gorm:"uniqueIndex:idx_menus_owner_image_hash"`
+	PerceptualHash     *int64           `json:"-" gorm:"index"`
+	ImageSignature     []byte           `json:"-"`
+	Status             string           `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
+	FailureCode        *string          `json:"failure_code"`
+	FailureReason      *string          `json:"failure_reason"`
+	TotalDishes        int              `json:"total_dishes"`
+	ProcessedDishes    int              `json:"processed_dishes"`
+	ProviderCalls      int              `json:"provider_calls" gorm:"default:0"`
+	SchemaVersion      int              `json:"schema_version" gorm:"default:1"`
+	Warnings           MenuWarnings     `json:"warnings" gorm:"type:jsonb"`
+	ImageMode          string           `json:"image_mode" gorm:"type:varchar(20);default:'ENABLED'"`
+	Priority           string           `json:"priority" gorm:"type:varchar(10);default:'normal'"`
+	Currency           string           `json:"currency" gorm:"type:varchar(3)"`
+	CurrencySource     string           `json:"currency_source" gorm:"type:varchar(20)"`
+	Cuisine            string           `json:"cuisine,omitempty" gorm:"type:varchar(30)"`
+	Language           string           `json:"language,omitempty" gorm:"type:varchar(20)"`
+	UniqueDescriptions bool             `json:"-"`
+	ReviewRequired     bool             `json:"-"`
+	ImageStyle         string           `json:"image_style,omitempty" gorm:"type:varchar(20)"`
+	ImageAspectRatio   string           `json:"image_aspect_ratio,omitempty" gorm:"type:varchar(10)"`
+	ImageSize          string           `json:"image_size,omitempty" gorm:"type:varchar(10)"`
+	PromptTemplates    *PromptTemplates `json:"-" gorm:"type:jsonb"`
+	RawExtraction      *string          `json:"-" gorm:"type:text"`
+	SEO                *MenuSEO         `json:"seo,omitempty" gorm:"type:jsonb"`
+	PublishedRevision  *int             `json:"published_revision"`
+	DraftRevision      *int             `json:"draft_revision"`
+	CreatedAt          time.Time        `json:"created_at"`
+	UpdatedAt          time.Time        `json:"updated_at"`
+	CompletedAt        *time.Time       `json:"completed_at"`
+	Sections           []MenuSection    `json:"sections,omitempty" gorm:"foreignKey:MenuID"`
+	Dishes             []Dish           `json:"dishes,omitempty" gorm:"foreignKey:MenuID"`
 }
 
 type MenuSection struct {
-	ID       string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	MenuID   string `json:"menu_id"`
-	Name     string `json:"name"`
-	Position int    `json:"position"`
+	ID              string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MenuID          string `json:"menu_id"`
+	Name            string `json:"name"`
+	Position        int    `json:"position"`
+	TotalDishes     int    `json:"total_dishes" gorm:"default:0"`
+	ProcessedDishes int    `json:"processed_dishes" gorm:"default:0"`
 }
 
 type Dish struct {
-	ID             string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	MenuID         string    `json:"menu_id"`
-	SectionID      *string   `json:"section_id"`
-	Name           string    `json:"name"`
-	PriceCents     *int      `json:"price_cents"`
-	Currency       string    `json:"currency" gorm:"default:'USD'"`
-	RawPriceString *string   `json:"raw_price_string"`
-	Description    *string   `json:"description"`
-	ImageURL       *string   `json:"image_url"`
-	Status         string    `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
-	FailureReason  *string   `json:"failure_reason"`
-	Position       int       `json:"position"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID                 string              `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MenuID             string              `json:"menu_id"`
+	SectionID          *string             `json:"section_id"`
+	Name               string              `json:"name"`
+	RomanizedName      *string             `json:"romanized_name" gorm:"type:varchar(200)"`
+	PriceCents         *int                `json:"price_cents"`
+	PriceType          string              `json:"price_type" gorm:"type:varchar(20)"`
+	PriceMinCents      *int                `json:"price_min_cents"`
+	PriceMaxCents      *int                `json:"price_max_cents"`
+	PriceUnit          *string             `json:"price_unit" gorm:"type:varchar(20)"`
+	Currency           string              `json:"currency" gorm:"default:'USD'"`
+	RawPriceString     *string             `json:"raw_price_string"`
+	Description        *string             `json:"description"`
+	ImageURL           *string             `json:"image_url"`
+	ImageAlt           *string             `json:"image_alt" gorm:"type:varchar(150)"`
+	Status             string              `json:"status" gorm:"type:varchar(20);default:'PENDING'"`
+	StatusBeforeRegen  *string             `json:"-" gorm:"type:varchar(20)"`
+	FailureCode        *string             `json:"failure_code"`
+	FailureReason      *string             `json:"failure_reason"`
+	Position           int                 `json:"position"`
+	EditedByUser       bool                `json:"edited_by_user" gorm:"default:false"`
+	SchemaVersion      int                 `json:"schema_version" gorm:"default:1"`
+	GenerationMetadata *GenerationMetadata `json:"generation_metadata,omitempty" gorm:"type:jsonb"`
+	CreatedAt          time.Time           `json:"created_at"`
+	UpdatedAt          time.Time           `json:"updated_at"`
+	CatalogDishID      *string             `json:"catalog_dish_id,omitempty" gorm:"type:uuid;index"`
+	AllergensConfirmed bool                `json:"allergens_confirmed" gorm:"default:false"`
+	SpiceLevel         *int                `json:"spice_level"`
+	Cuisine            string              `json:"cuisine,omitempty" gorm:"type:varchar(30)"`
+	Calories           *int                `json:"calories"`
+	ProteinGrams       *int                `json:"protein_grams"`
+	CarbsGrams         *int                `json:"carbs_grams"`
+	FatGrams           *int                `json:"fat_grams"`
+	Renditions         []DishRendition     `json:"-" gorm:"-"`
+	Variants           []DishVariant       `json:"-" gorm:"-"`
+	Modifiers          []DishModifier      `json:"-" gorm:"-"`
+	Tags               []DishTag           `json:"-" gorm:"-"`
+	Allergens          []DishAllergen      `json:"-" gorm:"-"`
 }
 
 // Request/Response Models
@@ -72,23 +128,47 @@ type MenuUploadResponse struct {
 }
 
 type MenuStatusResponse struct {
-	MenuID   string                 `json:"menu_id"`
-	Status   string                 `json:"status"`
-	Progress *MenuProgress          `json:"progress,omitempty"`
-	Menu     *MenuStructureResponse `json:"menu,omitempty"`
-	Error    *ErrorResponse         `json:"error,omitempty"`
+	MenuID           string                 `json:"menu_id"`
+	Status           string                 `json:"status"`
+	Progress         *MenuProgress          `json:"progress,omitempty"`
+	Menu             *MenuStructureResponse `json:"menu,omitempty"`
+	Warnings         []MenuWarning          `json:"warnings,omitempty"`
+	ImageMode        string                 `json:"image_mode"`
+	ImageStyle       string                 `json:"image_style,omitempty"`
+	ImageAspectRatio string                 `json:"image_aspect_ratio"`
+	ImageSize        string                 `json:"image_size"`
+	Revisions        *MenuRevisionState     `json:"revisions,omitempty"`
+	Error            *ErrorResponse         `json:"error,omitempty"`
+}
+
+type MenuRevisionState struct {
+	Published *int `json:"published"`
+	Draft     *int `json:"draft"`
 }
 
 type MenuProgress struct {
-	ProcessedDishes int `json:"processed_dishes"`
-	TotalDishes     int `json:"total_dishes"`
+	ProcessedDishes int               `json:"processed_dishes"`
+	TotalDishes     int               `json:"total_dishes"`
+	Sections        []SectionProgress `json:"sections"`
+}
+
+type SectionProgress struct {
+	SectionID       string `json:"section_id"`
+	Name            string `json:"name"`
+	ProcessedDishes int    `json:"processed_dishes"`
+	TotalDishes     int    `json:"total_dishes"`
 }
 
 type MenuStructureResponse struct {
-	ID       string                `json:"id"`
-	Status   string                `json:"status"`
-	Sections []MenuSectionResponse `json:"sections"`
-	Dishes   []DishResponse        `json:"dishes"`
+	ID             string                `json:"id"`
+	Status         string                `json:"status"`
+	Currency       string                `json:"currency,omitempty"`
+	Cuisine        string                `json:"cuisine,omitempty"`
+	Language       string                `json:"language,omitempty"`
+	SourceLanguage string                `json:"source_language,omitempty"`
+	SEO            *MenuSEO              `json:"seo,omitempty"`
+	Sections       []MenuSectionResponse `json:"sections"`
+	Dishes         []DishResponse        `json:"dishes"`
 }
 
 type MenuSectionResponse struct {
@@ -98,21 +178,40 @@ type MenuSectionResponse struct {
 }
 
 type DishResponse struct {
-	ID             string  `json:"id"`
-	SectionID      *string `json:"section_id"`
-	Name           string  `json:"name"`
-	PriceCents     *int    `json:"price_cents"`
-	Currency       string  `json:"currency"`
-	RawPriceString *string `json:"raw_price_string"`
-	Description    *string `json:"description"`
-	ImageURL       *string `json:"image_url"`
-	Status         string  `json:"status"`
-	Position       int     `json:"position"`
+	ID                 string                 `json:"id"`
+	SectionID          *string                `json:"section_id"`
+	Name               string                 `json:"name"`
+	RomanizedName      *string                `json:"romanized_name,omitempty"`
+	PriceCents         *int                   `json:"price_cents"`
+	PriceType          string                 `json:"price_type"`
+	PriceMinCents      *int                   `json:"price_min_cents,omitempty"`
+	PriceMaxCents      *int                   `json:"price_max_cents,omitempty"`
+	PriceUnit          *string                `json:"price_unit,omitempty"`
+	Currency           string                 `json:"currency"`
+	RawPriceString     *string                `json:"raw_price_string"`
+	Description        *string                `json:"description"`
+	ImageURL           *string                `json:"image_url"`
+	ImageAlt           *string                `json:"image_alt,omitempty"`
+	Status             string                 `json:"status"`
+	FailureCode        *string                `json:"failure_code,omitempty"`
+	FailureReason      *string                `json:"failure_reason,omitempty"`
+	Position           int                    `json:"position"`
+	EditedByUser       bool                   `json:"edited_by_user"`
+	Renditions         map[string]string      `json:"renditions,omitempty"`
+	Variants           []DishVariantResponse  `json:"variants,omitempty"`
+	Modifiers          []DishModifierResponse `json:"modifiers,omitempty"`
+	Tags               []DishTagResponse      `json:"tags,omitempty"`
+	Allergens          []DishAllergenResponse `json:"allergens,omitempty"`
+	AllergensConfirmed bool                   `json:"allergens_confirmed"`
+	SpiceLevel         *int                   `json:"spice_level"`
+	Cuisine            string                 `json:"cuisine,omitempty"`
+	Nutrition          *DishNutrition         `json:"nutrition,omitempty"`
 }
 
 type ErrorResponse struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
 }
 
 // OpenAI Types
@@ -151,10 +250,17 @@ type OpenAIJSONSchema struct {
 
 type OpenAIResponse struct {
 	Choices []OpenAIChoice `json:"choices"`
+	Usage   OpenAIUsage    `json:"usage"`
+}
+
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 type OpenAIChoice struct {
-	Message OpenAIResponseMessage `json:"message"`
+	Message      OpenAIResponseMessage `json:"message"`
+	FinishReason string                `json:"finish_reason"`
 }
 
 type OpenAIResponseMessage struct {
@@ -202,13 +308,30 @@ type ReplicateInput struct {
 	OutputFormat      string  `json:"output_format"`
 	OutputQuality     int     `json:"output_quality"`
 	GoFast            bool    `json:"go_fast"`
+	Seed              *int    `json:"seed,omitempty"`
+	Megapixels        string  `json:"megapixels,omitempty"`
 }
 
 type ReplicateResponse struct {
-	ID     string        `json:"id"`
-	Status string        `json:"status"`
-	Output []string      `json:"output"`
-	URLs   ReplicateURLs `json:"urls"`
+	ID     string          `json:"id"`
+	Status string          `json:"status"`
+	Output ReplicateOutput `json:"output"`
+	URLs   ReplicateURLs   `json:"urls"`
+}
+
+// ReplicateOutput is a prediction's output URLs. Most models return a list,
+// some (such as the upscaler) a single URL.
+type ReplicateOutput []string
+
+func (o *ReplicateOutput) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*o = ReplicateOutput{single}
+		}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(o))
 }
 
 type ReplicateURLs struct {
@@ -217,17 +340,30 @@ type ReplicateURLs struct {
 
 // Structured Menu Schema for OpenAI
 type StructuredMenu struct {
+	Currency string              `json:"currency"`
+	Cuisine  string              `json:"cuisine"`
+	Language string              `json:"language"`
 	Sections []StructuredSection `json:"sections"`
 }
 
 type StructuredSection struct {
-	Name   string           `json:"name"`
-	Dishes []StructuredDish `json:"dishes"`
+	Name      string               `json:"name"`
+	Dishes    []StructuredDish     `json:"dishes"`
+	Modifiers []StructuredModifier `json:"modifiers"`
 }
 
 type StructuredDish struct {
-	Name  string  `json:"name"`
-	Price *string `json:"price"`
+	Name          string               `json:"name"`
+	RomanizedName string               `json:"romanized_name"`
+	Price         *string              `json:"price"`
+	PriceType     string               `json:"price_type"`
+	PriceUnit     string               `json:"price_unit"`
+	Currency      string               `json:"currency"`
+	Variants      []StructuredVariant  `json:"variants"`
+	Modifiers     []StructuredModifier `json:"modifiers"`
+	DietaryTags   []string             `json:"dietary_tags"`
+	SpiceLevel    *int                 `json:"spice_level"`
+	Cuisine       string               `json:"cuisine"`
 }
 
 // Global variables
@@ -250,49 +386,266 @@ func main() {
 	}
 	defer zapLog.Sync()
 
+	// Shared by the server and `admin requeue-stuck`
+	dishPool = newWorkerPool(getEnvInt("DISH_WORKER_POOL_SIZE", 8), getEnvDuration("PRIORITY_AGING_INTERVAL", 30*time.Second))
+
+	// Maintenance commands share the service's setup but not its server
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		runAdminCLI(os.Args[2:])
+	}
+
+	// Listen straight away, so that probes can tell the replica is starting
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	serving.Store(newStartupRouter())
+	srv := &http.Server{Addr: ":" + port, Handler: http.HandlerFunc(serveHTTP)}
+	zapLog.Info("Starting server", zap.String("port", port))
+	if demoMode() {
+		zapLog.Warn("Demo mode is on; provider requests are answered from fixtures")
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zapLog.Fatal("Failed to start server", zap.Error(err))
+		}
+	}()
+
 	// Initialize database
 	if err := initDB(); err != nil {
 		zapLog.Fatal("Failed to initialize database", zap.Error(err))
 	}
 
-	// Initialize Gin router
+	feedbackLimiter = newWindowLimiter(getEnvInt("FEEDBACK_RATE_LIMIT_PER_HOUR", 30), time.Hour)
+	uploadRateLimit = newRateLimit("UPLOAD", 5, 60)
+	regenerateRateLimit = newRateLimit("REGENERATE", 10, 120)
+	if getEnvBool("COMPRESSION_ENABLED", true) {
+		compressionMinSize = getEnvInt("COMPRESSION_MIN_SIZE", 1024)
+	}
+	switch naming := os.Getenv("JSON_FIELD_NAMING"); naming {
+	case "", fieldNamingSnake:
+	case fieldNamingCamel:
+		jsonFieldNaming = naming
+	default:
+		zapLog.Warn("Ignoring unknown JSON_FIELD_NAMING", zap.String("naming", naming))
+	}
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Persist schema-on-read upgrades for older rows in the background
+	if getEnvBool("SCHEMA_BACKFILL_ON_STARTUP", true) {
+		go func() {
+			if _, err := withJobLock(context.Background(), jobSchemaBackfill, runSchemaBackfill); err != nil {
+				zapLog.Error("Schema backfill failed", zap.Error(err))
+			}
+		}()
+	}
+
+	// Roll provider usage up into daily spend for /api/admin/spend
+	go runSpendRollups(signals, getEnvDuration("SPEND_ROLLUP_INTERVAL", time.Hour))
+
+	// Reset dishes whose regeneration died with the process running it
+	if interval := getEnvDuration("REGENERATION_SWEEP_INTERVAL", 5*time.Minute); interval > 0 {
+		go runRegenerationSweeper(signals, interval)
+	}
+
+	// Delete menus past their retention
+	if interval := getEnvDuration("RETENTION_SWEEP_INTERVAL", time.Hour); interval > 0 {
+		go runRetentionJanitor(signals, interval)
+	}
+
+	serving.Store(newRouter())
+	startupComplete.Store(true)
+
+	grpcServer := startGRPCServer()
+
+	// Drain in-flight processing before exiting on SIGTERM
+	<-signals.Done()
+	stopSignals()
+	shutdown(srv, grpcServer)
+}
+
+// newRouter builds the HTTP API. It has no side effects beyond registering
+// routes, so tooling such as `admin check-openapi` can inspect it.
+func newRouter() *gin.Engine {
 	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		// A bad entry must not leave every forwarded address trusted
+		zapLog.Warn("Ignoring invalid TRUSTED_PROXIES", zap.Error(err))
+		r.SetTrustedProxies(nil)
+	}
+	r.Use(assignRequestID())
 
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "Idempotent-Replayed", requestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	// Routes
-	api := r.Group("/api")
+	api := r.Group("/api", compressResponses(compressionMinSize), renameJSONFields(jsonFieldNaming))
+	{
+		api.GET("/config", getConfigHandler)
+		api.GET("/openapi.json", openAPIHandler)
+		api.GET("/docs", apiDocsHandler)
+		api.GET("/errors", listErrorCodesHandler)
+		// The browser arrives here from the provider without an API key; the
+		// signed state stands in for it.
+		oauth := api.Group("/auth/oauth/:provider", authenticateUser())
+		oauth.GET("/start", startOAuthHandler)
+		oauth.GET("/callback", oauthCallbackHandler)
+	}
+
+	// Client endpoints, which need an API key. A session token identifies
+	// the user; menus are only visible to their owner.
+	client := api.Group("", requireAPIKey(), authenticateUser())
+	{
+		client.POST("/auth/register", registerHandler)
+		client.POST("/auth/login", loginHandler)
+		client.GET("/auth/me", requireUser(), getCurrentUserHandler)
+		client.GET("/auth/identities", requireUser(), listIdentitiesHandler)
+		client.GET("/graphql", graphqlHandler)
+		client.POST("/graphql", graphqlHandler)
+		client.GET("/menus", requireUser(), listMenusHandler)
+		client.GET("/quota", getQuotaHandler)
+		client.GET("/restaurants", requireUser(), listRestaurantsHandler)
+		client.POST("/restaurants", requireUser(), createRestaurantHandler)
+		client.POST("/menu", limitRate(uploadRateLimit), uploadMenuHandler)
+		// Diners vote on dishes of menus they do not own
+		client.POST("/dish/:id/feedback", submitDishFeedbackHandler)
+	}
+
+	// Members of a restaurant work on its menus as their role allows
+	restaurant := client.Group("/restaurants/:id", requireUser())
 	{
-		api.POST("/menu", uploadMenuHandler)
-		api.GET("/menu/:id", getMenuHandler)
+		restaurant.GET("", requireRestaurantRole(RoleViewer), getRestaurantHandler)
+		restaurant.PATCH("", requireRestaurantRole(RoleOwner), updateRestaurantHandler)
+		restaurant.DELETE("", requireRestaurantRole(RoleOwner), deleteRestaurantHandler)
+		restaurant.GET("/members", requireRestaurantRole(RoleViewer), listMembersHandler)
+		restaurant.POST("/members", requireRestaurantRole(RoleOwner), addMemberHandler)
+		restaurant.PATCH("/members/:userId", requireRestaurantRole(RoleOwner), updateMemberHandler)
+		restaurant.DELETE("/members/:userId", requireRestaurantRole(RoleViewer), removeMemberHandler)
 	}
 
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	// Reads need a viewer role on the menu and changes an editor
+	menu := client.Group("/menu/:id", requireMenuAccess())
+	{
+		menu.GET("", getMenuHandler)
+		menu.GET("/events", menuEventsHandler)
+		menu.DELETE("", requireMenuRole(RoleOwner), deleteMenuHandler)
+		menu.PUT("/restaurant", requireUser(), requireMenuRole(RoleOwner), setMenuRestaurantHandler)
+		menu.GET("/export", exportMenuHandler)
+		menu.GET("/diff", menuDiffHandler)
+		menu.POST("/translate", limitRate(regenerateRateLimit), translateMenuHandler)
+		menu.POST("/approve", limitRate(uploadRateLimit), approveMenuHandler)
+		menu.GET("/shares", listMenuSharesHandler)
+		menu.POST("/share", createMenuShareHandler)
+		menu.DELETE("/share/:slug", revokeMenuShareHandler)
+		menu.PATCH("/dishes/:dishId", updateDishHandler)
+		menu.POST("/dishes/:dishId/regenerate-image", limitRate(regenerateRateLimit), regenerateDishImageHandler)
+		menu.POST("/dishes/:dishId/regenerate-description", limitRate(regenerateRateLimit), regenerateDishDescriptionHandler)
+		menu.GET("/dishes/:dishId/images", listDishImagesHandler)
+		menu.POST("/dishes/:dishId/images", limitRate(regenerateRateLimit), generateDishImagesHandler)
+		menu.POST("/dishes/:dishId/images/:imageId/select", selectDishImageHandler)
+		menu.GET("/dishes/:dishId/renditions", listDishRenditionsHandler)
+		menu.POST("/dishes/:dishId/renditions", limitRate(regenerateRateLimit), generateDishRenditionsHandler)
+		menu.POST("/dishes/:dishId/upscale", limitRate(regenerateRateLimit), upscaleDishImageHandler)
+		menu.POST("/reorder", reorderMenuHandler)
+		menu.GET("/versions", listMenuVersionsHandler)
+		menu.GET("/versions/:version", getMenuVersionHandler)
+		menu.POST("/versions/:version/restore", restoreMenuVersionHandler)
+		menu.GET("/revisions", listMenuRevisionsHandler)
+		menu.GET("/revisions/:rev", getMenuRevisionHandler)
+		menu.POST("/revisions/:rev/publish", publishMenuRevisionHandler)
+		menu.DELETE("/revisions/:rev", discardMenuRevisionHandler)
+		menu.GET("/sections", listSectionsHandler)
+		menu.POST("/sections", createSectionHandler)
+		menu.PATCH("/sections/:sectionId", updateSectionHandler)
+		menu.DELETE("/sections/:sectionId", deleteSectionHandler)
+		menu.POST("/sections/:sectionId/dishes", moveDishesIntoSectionHandler)
+		menu.GET("/feedback", getMenuFeedbackHandler)
+	}
+
+	dish := client.Group("/dish/:id", requireDishAccess())
+	{
+		dish.POST("/social", limitRate(regenerateRateLimit), createDishSocialPostHandler)
+	}
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	webhooks := client.Group("/webhooks", requireWebhookOwner())
+	{
+		webhooks.GET("", listWebhooksHandler)
+		webhooks.POST("", createWebhookHandler)
+		webhooks.GET("/:id", getWebhookHandler)
+		webhooks.PATCH("/:id", updateWebhookHandler)
+		webhooks.DELETE("/:id", deleteWebhookHandler)
+		webhooks.GET("/:id/deliveries", listWebhookDeliveriesHandler)
+		webhooks.POST("/:id/deliveries/:deliveryId/redeliver", redeliverWebhookHandler)
 	}
 
-	zapLog.Info("Starting server", zap.String("port", port))
-	if err := r.Run(":" + port); err != nil {
-		zapLog.Fatal("Failed to start server", zap.Error(err))
+	// Operator endpoints
+	admin := api.Group("/admin", requireAdmin())
+	{
+		admin.GET("/dishes/:id/generation", getDishGenerationHandler)
+		admin.GET("/spend", getSpendHandler)
+		admin.GET("/usage", getUsageHandler)
+		admin.GET("/stats", getStatsHandler)
+		admin.GET("/locks", listJobLocksHandler)
+		admin.GET("/jobs", getJobMetricsHandler)
+		admin.GET("/metrics", prometheusMetricsHandler)
+		admin.GET("/debug/runtime", requireDebugEndpoints(), getRuntimeDebugHandler)
+		admin.GET("/api-keys", listAPIKeysHandler)
+		admin.POST("/api-keys", createAPIKeyHandler)
+		admin.POST("/api-keys/:id/rotate", rotateAPIKeyHandler)
+		admin.DELETE("/api-keys/:id", revokeAPIKeyHandler)
+		admin.GET("/api-keys/:id/quota", getAPIKeyQuotaHandler)
+		admin.PUT("/api-keys/:id/quota", setAPIKeyQuotaHandler)
+		admin.GET("/menus", listAdminMenusHandler)
+		admin.GET("/menus/:id/raw-extraction", getRawExtractionHandler)
+		admin.POST("/menus/requeue-stuck", requeueStuckMenusHandler)
+		admin.POST("/menus/fail-stuck", failStuckMenusHandler)
+		admin.POST("/dishes/retry-failed", retryFailedDishesHandler)
+		admin.POST("/menus/:id/purge", purgeMenuHandler)
+		admin.POST("/users/:id/purge", purgeUserHandler)
+		admin.GET("/purges/:id", getPurgeReceiptHandler)
+		admin.GET("/catalog", listCatalogHandler)
+		admin.GET("/catalog/:id", getCatalogDishHandler)
+		admin.PATCH("/catalog/:id", updateCatalogDishHandler)
+	}
+
+	// Read-only pages for share links
+	public := r.Group("/public")
+	{
+		public.GET("/menu/:slug", publicMenuHandler)
+		public.GET("/menu/:slug/widget", publicMenuWidgetHandler)
+		public.GET("/images/:id", storedImageHandler)
+		public.GET("/demo/images/:name", demoImageHandler)
 	}
+
+	registerPprof(r)
+
+	// Health check and probes
+	r.GET("/health", healthHandler)
+	r.GET("/livez", livezHandler)
+	r.GET("/readyz", readyzHandler)
+
+	return r
 }
 
 func initDB() error {
+	if err := openDatabase(databaseDSN()); err != nil {
+		return err
+	}
+	zapLog.Info("Database initialized successfully")
+	return nil
+}
+
+// databaseDSN is the connection string of the configured database.
+func databaseDSN() string {
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
 	dbUser := os.Getenv("DB_USER")
@@ -316,59 +669,105 @@ func initDB() error {
 		dbSSLMode = "require"
 	}
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
 		dbHost, dbUser, dbPassword, dbName, dbPort, dbSSLMode)
+}
 
+// openDatabase connects db to dsn and migrates its schema.
+func openDatabase(dsn string) error {
 	var err error
 	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+		Logger:  logger.Default.LogMode(logger.Silent),
+		NowFunc: func() time.Time { return clock.Now() },
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	// Auto-migrate the schema
-	if err := db.AutoMigrate(&Menu{}, &MenuSection{}, &Dish{}); err != nil {
+	if err := db.AutoMigrate(&Menu{}, &MenuSection{}, &Dish{}, &DishFeedback{}, &DishImage{}, &Webhook{}, &WebhookDelivery{}, &MenuVersion{}, &MenuRevision{}, &ProviderUsage{}, &ProviderSpendRollup{}, &JobLock{}, &MenuShare{}, &DishRendition{}, &APIKey{}, &User{}, &UserIdentity{}, &Restaurant{}, &RestaurantMember{}, &QuotaUsage{}, &IdempotencyKey{}, &PurgeReceipt{}, &DescriptionCacheEntry{}, &ImageCacheEntry{}, &CatalogDish{}, &DishVariant{}, &DishModifier{}, &DishTag{}, &DishAllergen{}, &DishTranslation{}, &SectionTranslation{}, &StoredImage{}); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	// Accounts created through a provider may have no email
+	if db.Migrator().HasIndex(&User{}, "idx_users_email") {
+		if err := db.Migrator().DropIndex(&User{}, "idx_users_email"); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+	// Accounts created through a provider before emails were marked verified
+	// got theirs from it
+	if err := db.Exec("UPDATE users SET email_verified = true WHERE email <> '' AND password_hash = '' AND NOT email_verified").Error; err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	// Restaurants created before memberships existed are owned by their creator
+	if err := db.Exec(`INSERT INTO restaurant_members (id, restaurant_id, user_id, role, created_at, updated_at)
+		SELECT gen_random_uuid(), r.id, r.user_id, ?, r.created_at, r.created_at FROM restaurants r
+		WHERE NOT EXISTS (SELECT 1 FROM restaurant_members m WHERE m.restaurant_id = r.id)`, RoleOwner).Error; err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	// Image hashes are unique per owner now, so users can upload the same menu
+	if db.Migrator().HasIndex(&Menu{}, "idx_menus_image_hash") {
+		if err := db.Migrator().DropIndex(&Menu{}, "idx_menus_image_hash"); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+	// Menus stored without warnings had a JSON null, to which appending
+	// warnings added a null warning
+	if err := db.Exec(`UPDATE menus SET warnings = (
+			SELECT COALESCE(jsonb_agg(e.warning ORDER BY e.position), '[]'::jsonb)
+			FROM jsonb_array_elements(CASE WHEN jsonb_typeof(warnings) = 'array' THEN warnings ELSE '[]'::jsonb END)
+				WITH ORDINALITY AS e(warning, position)
+			WHERE e.warning <> 'null'::jsonb)
+		WHERE warnings = 'null'::jsonb OR warnings @> '[null]'::jsonb`).Error; err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	// Deliveries no longer keep the bodies of webhook responses
+	if db.Migrator().HasColumn(&WebhookDelivery{}, "response_body") {
+		if err := db.Migrator().DropColumn(&WebhookDelivery{}, "response_body"); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+	// Webhooks created before they had owners heard of every menu; they are
+	// dropped rather than left deployment-wide
+	if err := db.Exec("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE user_id IS NULL AND api_key_id IS NULL)").Error; err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err := db.Exec("DELETE FROM webhooks WHERE user_id IS NULL AND api_key_id IS NULL").Error; err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
-
-	zapLog.Info("Database initialized successfully")
 	return nil
 }
 
+// maxUploadSize is the largest menu image accepted.
+const maxUploadSize = 8 * 1024 * 1024
+
 func uploadMenuHandler(c *gin.Context) {
+	idempotencyKey, ok := claimIdempotencyKey(c)
+	if !ok {
+		return
+	}
+	if idempotencyKey != "" {
+		// Does nothing once the upload's response is stored
+		defer releaseIdempotencyKey(idempotencyScope(c), idempotencyKey)
+	}
+
 	file, header, err := c.Request.FormFile("image")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": ErrorResponse{
-				Code:    "MISSING_FILE",
-				Message: "No image file provided",
-			},
-		})
+		respondError(c, http.StatusBadRequest, "MISSING_FILE", "No image file provided")
 		return
 	}
 	defer file.Close()
 
 	// Validate file size (8MB limit)
-	if header.Size > 8*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": ErrorResponse{
-				Code:    "FILE_TOO_LARGE",
-				Message: "File size exceeds 8MB limit",
-			},
-		})
+	if header.Size > maxUploadSize {
+		respondError(c, http.StatusBadRequest, "FILE_TOO_LARGE", "File size exceeds 8MB limit")
 		return
 	}
 
 	// Validate file type
 	contentType := header.Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "image/") {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": ErrorResponse{
-				Code:    "INVALID_FILE_TYPE",
-				Message: "File must be an image",
-			},
-		})
+		respondError(c, http.StatusBadRequest, "INVALID_FILE_TYPE", "File must be an image")
 		return
 	}
 
@@ -376,161 +775,577 @@ func uploadMenuHandler(c *gin.Context) {
 	fileContent, err := io.ReadAll(file)
 	if err != nil {
 		zapLog.Error("Failed to read file", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": ErrorResponse{
-				Code:    "INTERNAL_ERROR",
-				Message: "Failed to process file",
-			},
-		})
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process file")
+		return
+	}
+
+	onDuplicate := c.DefaultPostForm("on_duplicate", OnDuplicateWarn)
+	if onDuplicate != OnDuplicateWarn && onDuplicate != OnDuplicateReuse && onDuplicate != OnDuplicateForce {
+		respondFieldError(c, "on_duplicate", "oneof", "on_duplicate must be warn, reuse, or force")
+		return
+	}
+
+	priority, ok := uploadPriority(c)
+	if !ok {
+		return
+	}
+
+	review := reviewRequiredByDefault()
+	if value := c.PostForm("review"); value != "" {
+		if value != "true" && value != "false" {
+			respondFieldError(c, "review", "boolean", "review must be true or false")
+			return
+		}
+		review = value == "true"
+	}
+
+	uniqueDescriptions := c.PostForm("unique_descriptions")
+	if uniqueDescriptions != "" && uniqueDescriptions != "true" && uniqueDescriptions != "false" {
+		respondFieldError(c, "unique_descriptions", "boolean", "unique_descriptions must be true or false")
+		return
+	}
+
+	style := strings.TrimSpace(c.PostForm("style"))
+	if !validImageStyle(style) {
+		respondFieldError(c, "style", "oneof", "style must be one of: "+strings.Join(imageStyleNames(), ", "))
+		return
+	}
+
+	aspectRatio := strings.TrimSpace(c.PostForm("aspect_ratio"))
+	if aspectRatio != "" && !renditionAspectRatios[aspectRatio] {
+		respondFieldError(c, "aspect_ratio", "oneof", "unsupported aspect_ratio: "+aspectRatio)
+		return
+	}
+	imageSize := strings.TrimSpace(c.PostForm("image_size"))
+	if _, ok := renditionSizes[imageSize]; imageSize != "" && !ok {
+		respondFieldError(c, "image_size", "oneof", "image_size must be standard or small")
+		return
+	}
+
+	var promptTemplates PromptTemplates
+	for _, field := range []struct {
+		name     string
+		template *string
+	}{
+		{"extraction_prompt", &promptTemplates.Extraction},
+		{"description_prompt", &promptTemplates.Description},
+		{"image_prompt", &promptTemplates.Image},
+	} {
+		source := strings.TrimSpace(c.PostForm(field.name))
+		if source == "" {
+			continue
+		}
+		if err := validatePromptTemplate(source); err != nil {
+			respondFieldError(c, field.name, "template", field.name+" is not a valid prompt template: "+err.Error())
+			return
+		}
+		*field.template = source
+	}
+
+	currency := ""
+	if value := c.PostForm("currency"); value != "" {
+		if currency = normalizeCurrency(value); currency == "" {
+			respondFieldError(c, "currency", "iso4217", "currency must be a 3-letter ISO 4217 code")
+			return
+		}
+	}
+
+	restaurantID := c.PostForm("restaurant_id")
+	if restaurantID != "" {
+		if !canAddMenus(restaurantID, currentUserID(c)) {
+			respondError(c, http.StatusBadRequest, "RESTAURANT_NOT_FOUND", "restaurant_id is not a restaurant you edit")
+			return
+		}
+	}
+
+	request := menuUploadRequest{
+		RequestID:          c.GetString("requestID"),
+		UserID:             currentUserID(c),
+		RestaurantID:       restaurantID,
+		Filename:           header.Filename,
+		ContentType:        contentType,
+		Content:            fileContent,
+		OnDuplicate:        onDuplicate,
+		Priority:           priority,
+		UniqueDescriptions: uniqueDescriptions == "true",
+		Currency:           currency,
+		Review:             review,
+		PromptTemplates:    promptTemplates,
+		ImageStyle:         style,
+		ImageAspectRatio:   aspectRatio,
+		ImageSize:          imageSize,
+	}
+	if key, ok := c.Get("apiKey"); ok {
+		request.APIKey = key.(*APIKey)
+	}
+	upload, err := acceptMenuUpload(request)
+	var quotaErr *quotaExceededError
+	if errors.As(err, &quotaErr) {
+		respondError(c, http.StatusForbidden, "QUOTA_EXCEEDED", quotaErr.Error())
+		return
+	}
+	var budgetErr *spendBudgetError
+	if errors.As(err, &budgetErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(budgetErr.Budget.ResetsAt.Sub(clock.Now()).Seconds()))))
+		respondError(c, http.StatusServiceUnavailable, "BUDGET_EXCEEDED", budgetErr.Error())
 		return
 	}
+	if errors.Is(err, errShuttingDown) {
+		c.Header("Retry-After", "1")
+		respondError(c, http.StatusServiceUnavailable, "SHUTTING_DOWN", "The server is shutting down; retry the upload")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create menu")
+		return
+	}
+	if upload.Duplicate != nil {
+		respondNearDuplicate(c, *upload.Duplicate)
+		return
+	}
+
+	status := http.StatusOK
+	if upload.Created {
+		status = http.StatusAccepted
+	}
+	response := MenuUploadResponse{
+		MenuID: upload.Menu.ID,
+		Status: upload.Menu.Status,
+	}
+	if idempotencyKey != "" {
+		completeIdempotencyKey(idempotencyScope(c), idempotencyKey, status, response)
+	}
+	c.JSON(status, response)
+}
+
+// menuUploadRequest is an uploaded menu image and who uploaded it.
+type menuUploadRequest struct {
+	// RequestID is logged with the menu's processing
+	RequestID string
+	// UserID owns the menu; "" for anonymous uploads
+	UserID       string
+	RestaurantID string
+	// APIKey is the client the upload counts against for quotas, if any
+	APIKey      *APIKey
+	Filename    string
+	ContentType string
+	Content     []byte
+	OnDuplicate string
+	// Priority orders the menu's processing against other menus'; "" is normal
+	Priority string
+	// UniqueDescriptions skips the description cache for the menu's dishes
+	UniqueDescriptions bool
+	// Currency overrides the currency detected on the menu; "" detects it
+	Currency string
+	// Review stops the menu for review once its dishes are extracted
+	Review bool
+	// PromptTemplates replace the deployment's prompt templates for the menu
+	PromptTemplates PromptTemplates
+	// ImageStyle is one of imageStyles, or "" for plain product photos
+	ImageStyle string
+	// ImageAspectRatio and ImageSize shape the menu's dish images; "" keeps
+	// square standard ones
+	ImageAspectRatio string
+	ImageSize        string
+}
+
+// menuUpload is the outcome of acceptMenuUpload: the menu the image belongs
+// to, or the near duplicate the caller has to decide about.
+type menuUpload struct {
+	Menu      *Menu
+	Created   bool
+	Duplicate *NearDuplicateMenu
+}
 
+// acceptMenuUpload creates a menu for an uploaded image and starts processing
+// it. An identical image resolves to the owner's existing menu; a near
+// duplicate is handled as OnDuplicate says. New menus fail with a
+// *spendBudgetError while the spend budget is used up, and count against the
+// API key's monthly quota, failing with a *quotaExceededError past it.
+// Uploads fail with errShuttingDown once the server is shutting down.
+func acceptMenuUpload(request menuUploadRequest) (menuUpload, error) {
+	if shuttingDown.Load() {
+		return menuUpload{}, errShuttingDown
+	}
+	userID, fileContent := request.UserID, request.Content
+	apiKeyID := ""
+	if request.APIKey != nil {
+		apiKeyID = request.APIKey.ID
+	}
 	hash := sha256.Sum256(fileContent)
 	imageHash := fmt.Sprintf("%x", hash)
 
 	// Check if menu with same hash already exists
 	var existingMenu Menu
-	if err := db.Where("image_hash = ?", imageHash).First(&existingMenu).Error; err == nil {
-		c.JSON(http.StatusOK, MenuUploadResponse{
-			MenuID: existingMenu.ID,
-			Status: existingMenu.Status,
-		})
-		return
+	if err := scopeToOwner(db, userID, apiKeyID).Where("image_hash = ?", imageHash).First(&existingMenu).Error; err == nil {
+		return menuUpload{Menu: &existingMenu}, nil
+	}
+
+	// Look for the same menu photographed or encoded differently
+	fingerprint, err := fingerprintImage(fileContent)
+	if err != nil {
+		zapLog.Info("Skipping near-duplicate check for undecodable upload", zap.String("contentType", request.ContentType), zap.Error(err))
+	} else if request.OnDuplicate != OnDuplicateForce {
+		duplicate, err := findNearDuplicate(userID, apiKeyID, fingerprint)
+		if err != nil {
+			zapLog.Error("Near-duplicate lookup failed", zap.Error(err))
+		} else if duplicate != nil {
+			if request.OnDuplicate == OnDuplicateReuse {
+				return menuUpload{Menu: duplicate}, nil
+			}
+			described := describeNearDuplicate(duplicate, fingerprint)
+			return menuUpload{Duplicate: &described}, nil
+		}
+	}
+
+	if err := checkSpendBudget(projectedMenuCostMicros()); err != nil {
+		return menuUpload{}, err
+	}
+	if err := reserveMenuQuota(request.APIKey); err != nil {
+		return menuUpload{}, err
 	}
 
 	// Create new menu record
 	menu := Menu{
-		ID:              uuid.New().String(),
-		OriginalFile:    header.Filename,
+		ID:              idGen.NewID(),
+		OriginalFile:    request.Filename,
 		ImageHash:       imageHash,
 		Status:          "PENDING",
+		ImageMode:       imageModeForNewMenu(),
+		Priority:        PriorityNormal,
 		TotalDishes:     0,
 		ProcessedDishes: 0,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
+		CreatedAt:       clock.Now(),
+		UpdatedAt:       clock.Now(),
+	}
+	if userID != "" {
+		menu.UserID = &userID
+	}
+	if request.RestaurantID != "" {
+		menu.RestaurantID = &request.RestaurantID
+	}
+	if request.Priority != "" {
+		menu.Priority = request.Priority
+	}
+	menu.UniqueDescriptions = request.UniqueDescriptions
+	menu.ReviewRequired = request.Review
+	menu.ImageStyle = request.ImageStyle
+	menu.ImageAspectRatio = request.ImageAspectRatio
+	menu.ImageSize = request.ImageSize
+	if request.PromptTemplates != (PromptTemplates{}) {
+		menu.PromptTemplates = &request.PromptTemplates
+	}
+	if request.Currency != "" {
+		menu.Currency = request.Currency
+		menu.CurrencySource = CurrencySourceUpload
+	}
+	if request.APIKey != nil {
+		menu.APIKeyID = &request.APIKey.ID
+	}
+	if fingerprint != nil {
+		menu.PerceptualHash = &fingerprint.Hash
+		menu.ImageSignature = fingerprint.Signature
 	}
 
 	if err := db.Create(&menu).Error; err != nil {
 		zapLog.Error("Failed to create menu", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": ErrorResponse{
-				Code:    "DATABASE_ERROR",
-				Message: "Failed to create menu",
-			},
-		})
-		return
+		releaseMenuQuota(request.APIKey)
+		return menuUpload{}, err
 	}
 
 	// Start async processing
-	go processMenu(menu.ID, fileContent)
+	ctx, token := processingJobs.start(menu.ID)
+	ctx = withRequestID(ctx, request.RequestID)
+	resetProviderBudget(menu.ID)
+	go processMenu(ctx, token, menu.ID, fileContent)
 
-	c.JSON(http.StatusAccepted, MenuUploadResponse{
-		MenuID: menu.ID,
-		Status: menu.Status,
-	})
+	return menuUpload{Menu: &menu, Created: true}, nil
 }
 
 func getMenuHandler(c *gin.Context) {
 	menuID := c.Param("id")
+	tags, ok := parseTagFilter(c.QueryArray("tag"))
+	if !ok {
+		respondFieldError(c, "tag", "oneof", "tag must be one of: "+strings.Join(dietaryTags, ", "))
+		return
+	}
+	language := ""
+	if raw := c.Query("lang"); raw != "" {
+		if language, ok = parseLanguage(raw); !ok {
+			respondFieldError(c, "lang", "bcp47", "lang must be a language tag such as es or pt-BR")
+			return
+		}
+	}
 
-	var menu Menu
-	if err := db.Preload("Sections").Preload("Dishes").Where("id = ?", menuID).First(&menu).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": ErrorResponse{
-				Code:    "MENU_NOT_FOUND",
-				Message: "Menu not found",
-			},
-		})
+	// Polling clients send back the ETag and skip the dish list until the
+	// menu changes
+	etag, err := menuETag(menuID)
+	if err != nil {
+		zapLog.Warn("Failed to compute menu ETag", zap.String("menuID", menuID), zap.Error(err))
+	} else {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "no-cache")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	menu, err := loadMenuStatus(menuID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
 		return
 	}
+	menu.Dishes = filterDishesByTags(menu.Dishes, tags)
+	if language != "" {
+		translated, err := localizeMenu(menu, language)
+		if err != nil {
+			zapLog.Error("Failed to load translations", zap.String("menuID", menuID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load menu")
+			return
+		}
+		if !translated {
+			respondError(c, http.StatusNotFound, "TRANSLATION_NOT_FOUND", "Menu has not been translated into "+language)
+			return
+		}
+	}
+
+	response := buildMenuStatusResponse(menu)
+	// Language is the language of the returned text; SourceLanguage stays
+	// the menu's own
+	if response.Menu != nil && language != "" {
+		response.Menu.Language = language
+	}
+	c.JSON(http.StatusOK, response)
+}
 
+// loadMenuStatus loads a menu with its sections (in order) and dishes.
+func loadMenuStatus(menuID string) (*Menu, error) {
+	var menu Menu
+	err := db.
+		Preload("Sections", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Preload("Dishes").
+		Where("id = ?", menuID).
+		First(&menu).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := attachDishRenditions(&menu); err != nil {
+		return nil, err
+	}
+	if err := attachDishVariants(&menu); err != nil {
+		return nil, err
+	}
+	if err := attachDishModifiers(&menu); err != nil {
+		return nil, err
+	}
+	if err := attachDishTags(&menu); err != nil {
+		return nil, err
+	}
+	if err := attachDishAllergens(&menu); err != nil {
+		return nil, err
+	}
+	return &menu, nil
+}
+
+func buildMenuStatusResponse(menu *Menu) MenuStatusResponse {
 	response := MenuStatusResponse{
-		MenuID: menu.ID,
-		Status: menu.Status,
+		MenuID:           menu.ID,
+		Status:           menu.Status,
+		Warnings:         menu.Warnings,
+		ImageMode:        menu.ImageMode,
+		ImageStyle:       menu.ImageStyle,
+		ImageAspectRatio: menuImageShape(*menu).AspectRatio,
+		ImageSize:        menu.ImageSize,
+	}
+	if response.ImageSize == "" {
+		response.ImageSize = "standard"
+	}
+
+	if menu.PublishedRevision != nil || menu.DraftRevision != nil {
+		response.Revisions = &MenuRevisionState{Published: menu.PublishedRevision, Draft: menu.DraftRevision}
 	}
 
 	if menu.Status == "PROCESSING" || menu.Status == "COMPLETE" {
 		response.Progress = &MenuProgress{
 			ProcessedDishes: menu.ProcessedDishes,
 			TotalDishes:     menu.TotalDishes,
+			Sections:        make([]SectionProgress, len(menu.Sections)),
 		}
-	}
-
-	if menu.Status == "COMPLETE" {
-		sections := make([]MenuSectionResponse, len(menu.Sections))
 		for i, section := range menu.Sections {
-			sections[i] = MenuSectionResponse{
-				ID:       section.ID,
-				Name:     section.Name,
-				Position: section.Position,
+			response.Progress.Sections[i] = SectionProgress{
+				SectionID:       section.ID,
+				Name:            section.Name,
+				ProcessedDishes: section.ProcessedDishes,
+				TotalDishes:     section.TotalDishes,
 			}
 		}
+	}
+
+	// Menus awaiting review show their extracted dishes to the reviewer
+	if menu.Status == "COMPLETE" || menu.Status == "AWAITING_REVIEW" {
+		sections := toSectionResponses(menu.Sections)
 
 		dishes := make([]DishResponse, len(menu.Dishes))
 		for i, dish := range menu.Dishes {
-			dishes[i] = DishResponse{
-				ID:             dish.ID,
-				SectionID:      dish.SectionID,
-				Name:           dish.Name,
-				PriceCents:     dish.PriceCents,
-				Currency:       dish.Currency,
-				RawPriceString: dish.RawPriceString,
-				Description:    dish.Description,
-				ImageURL:       dish.ImageURL,
-				Status:         dish.Status,
-				Position:       dish.Position,
-			}
+			dishes[i] = toDishResponse(dish)
 		}
 
 		response.Menu = &MenuStructureResponse{
-			ID:       menu.ID,
-			Status:   menu.Status,
-			Sections: sections,
-			Dishes:   dishes,
+			ID:             menu.ID,
+			Status:         menu.Status,
+			Currency:       menu.Currency,
+			Cuisine:        menu.Cuisine,
+			Language:       menu.Language,
+			SourceLanguage: menu.Language,
+			SEO:            menu.SEO,
+			Sections:       sections,
+			Dishes:         dishes,
 		}
 	}
 
 	if menu.Status == "FAILED" && menu.FailureReason != nil {
+		code := "PROCESSING_FAILED"
+		if menu.FailureCode != nil {
+			code = *menu.FailureCode
+		}
 		response.Error = &ErrorResponse{
-			Code:    "PROCESSING_FAILED",
+			Code:    code,
 			Message: *menu.FailureReason,
 		}
 	}
 
-	c.JSON(http.StatusOK, response)
+	return response
+}
+
+func toDishResponse(dish Dish) DishResponse {
+	var renditions map[string]string
+	if len(dish.Renditions) > 0 {
+		renditions = make(map[string]string, len(dish.Renditions))
+		for _, rendition := range dish.Renditions {
+			renditions[rendition.Name] = rendition.URL
+		}
+	}
+	return DishResponse{
+		ID:                 dish.ID,
+		SectionID:          dish.SectionID,
+		Name:               dish.Name,
+		RomanizedName:      dish.RomanizedName,
+		PriceCents:         dish.PriceCents,
+		PriceType:          dishPriceType(dish),
+		PriceMinCents:      dish.PriceMinCents,
+		PriceMaxCents:      dish.PriceMaxCents,
+		PriceUnit:          dish.PriceUnit,
+		Currency:           dish.Currency,
+		RawPriceString:     dish.RawPriceString,
+		Description:        dish.Description,
+		ImageURL:           dish.ImageURL,
+		ImageAlt:           dishImageAltIfAny(dish),
+		Status:             dish.Status,
+		FailureCode:        dish.FailureCode,
+		FailureReason:      dish.FailureReason,
+		Position:           dish.Position,
+		EditedByUser:       dish.EditedByUser,
+		Renditions:         renditions,
+		Variants:           toVariantResponses(dish.Variants),
+		Modifiers:          toModifierResponses(dish.Modifiers),
+		Tags:               toTagResponses(dish.Tags),
+		Allergens:          toAllergenResponses(dish.Allergens),
+		AllergensConfirmed: dish.AllergensConfirmed,
+		SpiceLevel:         dish.SpiceLevel,
+		Cuisine:            dish.Cuisine,
+		Nutrition:          dishNutrition(dish),
+	}
 }
 
-func processMenu(menuID string, imageContent []byte) {
-	zapLog.Info("Starting menu processing", zap.String("menuID", menuID))
+func processMenu(ctx context.Context, token int64, menuID string, imageContent []byte) {
+	defer processingJobs.finish(menuID, token)
+	ctx, cancel := withProcessingDeadline(ctx)
+	defer cancel()
+	logFor(ctx).Info("Starting menu processing", zap.String("menuID", menuID))
 
 	// Update status to PROCESSING
 	if err := db.Model(&Menu{}).Where("id = ?", menuID).Updates(map[string]interface{}{
 		"status":     "PROCESSING",
-		"updated_at": time.Now(),
+		"updated_at": clock.Now(),
 	}).Error; err != nil {
-		zapLog.Error("Failed to update menu status", zap.String("menuID", menuID), zap.Error(err))
+		logFor(ctx).Error("Failed to update menu status", zap.String("menuID", menuID), zap.Error(err))
 		return
 	}
 
 	// Step 1: OCR + Structure using OpenAI Vision
-	structuredMenu, err := extractMenuStructure(imageContent)
+	structuredMenu, err := extractMenuStructure(ctx, menuID, imageContent)
+	if processingAborted(ctx, menuID) {
+		return
+	}
+	if errors.Is(err, errOutputTruncated) && structuredMenu != nil {
+		logFor(ctx).Warn("Keeping the dishes of a menu structure cut off", zap.String("menuID", menuID), zap.Error(err))
+		addMenuWarnings(menuID, MenuWarning{
+			Code:    "EXTRACTION_TRUNCATED",
+			Message: "The menu had more on it than the model could answer; dishes at its end may be missing or incomplete",
+		})
+		err = nil
+	}
+	if errors.Is(err, errOutputTruncated) {
+		failMenuWithCode(menuID, "EXTRACTION_TRUNCATED", "Failed to extract menu structure: "+err.Error())
+		return
+	}
 	if err != nil {
 		failMenu(menuID, "Failed to extract menu structure: "+err.Error())
 		return
 	}
 
+	// Clean model output before anything is persisted
+	addMenuWarnings(menuID, sanitizeStructuredMenu(structuredMenu)...)
+
+	dishCount := 0
+	for _, section := range structuredMenu.Sections {
+		dishCount += len(section.Dishes)
+	}
+	if !checkDishQuota(menuID, dishCount) {
+		return
+	}
+
 	// Step 2: Create menu sections and dishes
+	var menu Menu
+	if err := db.Select("id", "restaurant_id", "currency", "currency_source", "review_required").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		failMenu(menuID, "Failed to load menu: "+err.Error())
+		return
+	}
+	currency, currencySource := resolveMenuCurrency(menu, structuredMenu)
+	cuisine := detectMenuCuisine(structuredMenu)
+	language := detectMenuLanguage(structuredMenu)
 	var totalDishes int
 	var dishIDs []string
+	dishSections := make(map[string]string)
 
 	tx := db.Begin()
 
+	// Deleting a menu locks its row first, so while the lock is held the menu
+	// cannot be deleted under the insert, and a menu deleted or cancelled
+	// before it was taken gets nothing inserted
+	if _, err := lockMenu(tx, menuID); errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		logFor(ctx).Info("Menu deleted during processing", zap.String("menuID", menuID))
+		return
+	} else if err != nil {
+		tx.Rollback()
+		failMenu(menuID, "Failed to lock menu: "+err.Error())
+		return
+	}
+	if ctx.Err() != nil {
+		tx.Rollback()
+		processingAborted(ctx, menuID)
+		return
+	}
+
 	for sectionIdx, section := range structuredMenu.Sections {
 		menuSection := MenuSection{
-			ID:       uuid.New().String(),
-			MenuID:   menuID,
-			Name:     section.Name,
-			Position: sectionIdx,
+			ID:          idGen.NewID(),
+			MenuID:      menuID,
+			Name:        section.Name,
+			Position:    sectionIdx,
+			TotalDishes: len(section.Dishes),
 		}
 
 		if err := tx.Create(&menuSection).Error; err != nil {
@@ -540,25 +1355,49 @@ func processMenu(menuID string, imageContent []byte) {
 		}
 
 		for dishIdx, dish := range section.Dishes {
-			var priceCents *int
-			if dish.Price != nil && *dish.Price != "" {
-				if cents := extractPriceCents(*dish.Price); cents > 0 {
-					priceCents = &cents
-				}
+			name, markedTags := splitDietaryMarkers(dish.Name)
+			spiceLevel := clampSpiceLevel(dish.SpiceLevel)
+			if spiceLevel == nil {
+				spiceLevel = spiceLevelFromText(name)
+			}
+			if spiceLevel != nil && *spiceLevel > 0 {
+				markedTags = append(markedTags, "spicy")
+			}
+			priceCurrency := dishCurrency(dish, currency, currencySource)
+			price := readPrice(dish.Price, priceCurrency, dish.PriceType, dish.PriceUnit)
+			dishID := idGen.NewID()
+			variants := newDishVariants(Dish{ID: dishID, MenuID: menuID, Currency: priceCurrency}, dish.Variants)
+			if price.Type == PriceTypeNone && len(variants) > 0 {
+				price = priceFromVariants(variants)
+			}
+
+			catalogDishID, err := linkCatalogDish(tx, name)
+			if err != nil {
+				tx.Rollback()
+				failMenu(menuID, "Failed to link dish to catalog: "+err.Error())
+				return
 			}
 
 			dishRecord := Dish{
-				ID:             uuid.New().String(),
+				ID:             dishID,
 				MenuID:         menuID,
 				SectionID:      &menuSection.ID,
-				Name:           dish.Name,
-				PriceCents:     priceCents,
-				Currency:       "USD",
+				Name:           name,
+				RomanizedName:  romanizedDishName(dish, name),
+				PriceCents:     price.Cents,
+				PriceType:      price.Type,
+				PriceMinCents:  price.MinCents,
+				PriceMaxCents:  price.MaxCents,
+				PriceUnit:      price.Unit,
+				Currency:       priceCurrency,
 				RawPriceString: dish.Price,
 				Status:         "PENDING",
 				Position:       dishIdx,
-				CreatedAt:      time.Now(),
-				UpdatedAt:      time.Now(),
+				CatalogDishID:  catalogDishID,
+				SpiceLevel:     spiceLevel,
+				Cuisine:        dishCuisine(dish, cuisine),
+				CreatedAt:      clock.Now(),
+				UpdatedAt:      clock.Now(),
 			}
 
 			if err := tx.Create(&dishRecord).Error; err != nil {
@@ -566,16 +1405,36 @@ func processMenu(menuID string, imageContent []byte) {
 				failMenu(menuID, "Failed to create dish: "+err.Error())
 				return
 			}
+			if err := createDishVariants(tx, variants); err != nil {
+				tx.Rollback()
+				failMenu(menuID, "Failed to create dish variants: "+err.Error())
+				return
+			}
+			if err := createDishModifiers(tx, newDishModifiers(dishRecord, dish.Modifiers, section.Modifiers)); err != nil {
+				tx.Rollback()
+				failMenu(menuID, "Failed to create dish modifiers: "+err.Error())
+				return
+			}
+			if err := createDishTags(tx, dishRecord, append(markedTags, dish.DietaryTags...), DishTagSourceMenu); err != nil {
+				tx.Rollback()
+				failMenu(menuID, "Failed to create dish tags: "+err.Error())
+				return
+			}
 
 			dishIDs = append(dishIDs, dishRecord.ID)
+			dishSections[dishRecord.ID] = menuSection.ID
 			totalDishes++
 		}
 	}
 
 	// Update menu with total dishes count
 	if err := tx.Model(&Menu{}).Where("id = ?", menuID).Updates(map[string]interface{}{
-		"total_dishes": totalDishes,
-		"updated_at":   time.Now(),
+		"total_dishes":    totalDishes,
+		"currency":        currency,
+		"currency_source": currencySource,
+		"cuisine":         cuisine,
+		"language":        language,
+		"updated_at":      clock.Now(),
 	}).Error; err != nil {
 		tx.Rollback()
 		failMenu(menuID, "Failed to update menu: "+err.Error())
@@ -584,34 +1443,91 @@ func processMenu(menuID string, imageContent []byte) {
 
 	tx.Commit()
 
+	if menu.ReviewRequired {
+		awaitReview(ctx, menuID, totalDishes)
+		return
+	}
+
 	// Step 3: Enhance each dish with description and image
-	var processedCount int
+	enhanceMenuDishes(ctx, menuID, dishIDs, dishSections)
+
+	if processingAborted(ctx, menuID) {
+		return
+	}
+
+	generateMenuSEO(ctx, menuID)
+	completeMenu(menuID, totalDishes)
+}
+
+// enhanceMenuDishes generates descriptions and images for dishIDs as
+// dishPool hands out slots, refreshing the menu's progress after each dish.
+// Descriptions are written in batches (see planDescriptionBatches).
+func enhanceMenuDishes(ctx context.Context, menuID string, dishIDs []string, dishSections map[string]string) {
+	priority := menuPriorityLevel(menuID)
+	ctx = withDescriptionBatches(ctx, planDescriptionBatches(ctx, menuID, dishIDs))
 	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, 3) // Limit concurrent processing
 
 	for _, dishID := range dishIDs {
 		wg.Add(1)
+		jobStats.workers.Add(1)
 		go func(id string) {
 			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+			defer jobStats.workers.Add(-1)
+			if dishPool.acquire(ctx, menuID, priority) != nil {
+				return
+			}
+			defer dishPool.release()
 
-			if enhanceDish(id) {
-				processedCount++
+			// Skip remaining dishes once the menu has been cancelled
+			if ctx.Err() != nil {
+				return
 			}
 
-			// Update progress
-			db.Model(&Menu{}).Where("id = ?", menuID).Updates(map[string]interface{}{
-				"processed_dishes": processedCount,
-				"updated_at":       time.Now(),
-			})
+			enhanceDish(ctx, id)
+			if err := refreshProgress(menuID, dishSections[id]); err != nil {
+				logFor(ctx).Error("Failed to update progress", zap.String("menuID", menuID), zap.Error(err))
+			}
 		}(dishID)
 	}
 
 	wg.Wait()
+}
+
+// unprocessedDishStatuses are the dish statuses that do not count towards a
+// menu's progress.
+var unprocessedDishStatuses = []string{"PENDING", "PROCESSING", "FAILED"}
 
-	// Complete the menu
-	completedAt := time.Now()
+// refreshProgress recounts the dishes and processed dishes of the menu's
+// section sectionID ("" for all of them), and the menu's processed dishes,
+// from the dishes themselves. Counting rather than incrementing keeps
+// progress right when dishes finish concurrently, when processing is resumed
+// after a crash, and after reviewers moved or dropped dishes.
+func refreshProgress(menuID, sectionID string) error {
+	var err error
+	if sectionID != "" {
+		err = db.Exec(`UPDATE menu_sections SET
+				total_dishes = (SELECT COUNT(*) FROM dishes WHERE section_id = ?),
+				processed_dishes = (SELECT COUNT(*) FROM dishes WHERE section_id = ? AND status NOT IN ?)
+			WHERE id = ?`,
+			sectionID, sectionID, unprocessedDishStatuses, sectionID).Error
+	} else {
+		err = db.Exec(`UPDATE menu_sections SET
+				total_dishes = (SELECT COUNT(*) FROM dishes WHERE dishes.section_id = menu_sections.id),
+				processed_dishes = (SELECT COUNT(*) FROM dishes WHERE dishes.section_id = menu_sections.id AND dishes.status NOT IN ?)
+			WHERE menu_id = ?`,
+			unprocessedDishStatuses, menuID).Error
+	}
+	if err != nil {
+		return err
+	}
+	return db.Exec("UPDATE menus SET processed_dishes = (SELECT COUNT(*) FROM dishes WHERE menu_id = ? AND status NOT IN ?), updated_at = ? WHERE id = ?",
+		menuID, unprocessedDishStatuses, clock.Now(), menuID).Error
+}
+
+// completeMenu marks a processed menu COMPLETE, publishes it, and notifies
+// webhook subscribers.
+func completeMenu(menuID string, totalDishes int) {
+	completedAt := clock.Now()
 	if err := db.Model(&Menu{}).Where("id = ?", menuID).Updates(map[string]interface{}{
 		"status":       "COMPLETE",
 		"updated_at":   completedAt,
@@ -621,15 +1537,43 @@ func processMenu(menuID string, imageContent []byte) {
 		return
 	}
 
+	if err := publishCompletedMenu(menuID); err != nil {
+		zapLog.Error("Failed to publish menu", zap.String("menuID", menuID), zap.Error(err))
+	}
+
 	zapLog.Info("Menu processing completed", zap.String("menuID", menuID), zap.Int("totalDishes", totalDishes))
+	emitEvent(EventMenuCompleted, menuEventOwner(menuID), gin.H{
+		"menu_id":      menuID,
+		"total_dishes": totalDishes,
+		"completed_at": completedAt,
+	})
 }
 
-func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
-	// Try Choreo-provided environment variables first, then fall back to direct env vars
-	openaiAPIKey := os.Getenv("CHOREO_OPENAI_CONNECTION_OPENAI_API_KEY")
-	if openaiAPIKey == "" {
-		openaiAPIKey = os.Getenv("OPENAI_API_KEY")
+// processingAborted reports whether the menu's processing context has been
+// cancelled, failing or finishing the menu when the cause calls for it.
+func processingAborted(ctx context.Context, menuID string) bool {
+	if ctx.Err() == nil {
+		return false
 	}
+
+	if cause := context.Cause(ctx); errors.Is(cause, errBudgetExceeded) {
+		failMenuWithCode(menuID, "BUDGET_EXCEEDED", cause.Error())
+	} else if errors.Is(cause, errShuttingDown) {
+		handBackMenu(ctx, menuID)
+	} else if errors.Is(cause, errProcessingDeadline) {
+		finishAtDeadline(ctx, menuID)
+	} else {
+		logFor(ctx).Info("Menu processing cancelled", zap.String("menuID", menuID))
+	}
+	return true
+}
+
+// requestMenuStructure reads a menu image, or a part of one, in a single
+// vision request. note, when set, follows the extraction prompt.
+func requestMenuStructure(ctx context.Context, menuID string, imageContent []byte, note string) (*StructuredMenu, error) {
+	defer jobStats.beginStage(stageExtract)()
+
+	openaiAPIKey := lookupOpenAIKey()
 	if openaiAPIKey == "" {
 		return nil, fmt.Errorf("OPENAI_API_KEY not set")
 	}
@@ -639,9 +1583,45 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 	imageURL := "data:image/jpeg;base64," + base64Image
 
 	// Define the schema for structured response
+	modifiersSchema := map[string]interface{}{
+		"type":        "array",
+		"description": "Add-ons such as add chicken +$4, and choices such as choice of fries or salad, one entry per option",
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type": map[string]interface{}{
+					"type": "string",
+					"enum": []string{ModifierTypeAddOn, ModifierTypeChoice},
+				},
+				"group": map[string]interface{}{
+					"type":        "string",
+					"description": "What the options of a choice choose, e.g. side; the same for every option of the choice",
+				},
+				"name": map[string]interface{}{"type": "string"},
+				"price": map[string]interface{}{
+					"type":        "string",
+					"description": "What the option adds to the price as printed, e.g. +$4; empty when included",
+				},
+			},
+			"required": []string{"type", "name"},
+		},
+	}
 	schema := map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
+			"currency": map[string]interface{}{
+				"type":        "string",
+				"description": "ISO 4217 code of the currency the menu's prices are in, or empty if it cannot be told",
+			},
+			"cuisine": map[string]interface{}{
+				"type":        "string",
+				"enum":        append([]string{""}, cuisines...),
+				"description": "The menu's cuisine, fusion when it mixes several, or empty if it cannot be told",
+			},
+			"language": map[string]interface{}{
+				"type":        "string",
+				"description": "BCP 47 tag of the language the menu is written in, e.g. en, th, or zh-Hant; the main one when it mixes several",
+			},
 			"sections": map[string]interface{}{
 				"type": "array",
 				"items": map[string]interface{}{
@@ -650,6 +1630,7 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 						"name": map[string]interface{}{
 							"type": "string",
 						},
+						"modifiers": modifiersSchema,
 						"dishes": map[string]interface{}{
 							"type": "array",
 							"items": map[string]interface{}{
@@ -658,8 +1639,55 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 									"name": map[string]interface{}{
 										"type": "string",
 									},
+									"romanized_name": map[string]interface{}{
+										"type":        "string",
+										"description": "Only when the name is in a non-Latin script: the name in Latin letters as it is pronounced, e.g. pad kra pao for ผัดกะเพรา",
+									},
 									"price": map[string]interface{}{
-										"type": "string",
+										"type":        "string",
+										"description": "The price exactly as printed, e.g. 12.50, 12/18, MP, $14 per lb, or from $10",
+									},
+									"price_type": map[string]interface{}{
+										"type":        "string",
+										"enum":        priceTypes,
+										"description": "fixed for one price, range for several alternatives or a span, from for a starting price, per_unit for a price per weight or measure, market for market price",
+									},
+									"price_unit": map[string]interface{}{
+										"type":        "string",
+										"description": "The unit a per_unit price is for, e.g. lb, 100g, or glass",
+									},
+									"modifiers": modifiersSchema,
+									"variants": map[string]interface{}{
+										"type":        "array",
+										"description": "Sizes or versions with their own price, e.g. from size columns such as 10\" and 14\"; leave price empty when they are the only prices",
+										"items": map[string]interface{}{
+											"type": "object",
+											"properties": map[string]interface{}{
+												"name":  map[string]interface{}{"type": "string"},
+												"price": map[string]interface{}{"type": "string"},
+											},
+											"required": []string{"name"},
+										},
+									},
+									"currency": map[string]interface{}{
+										"type":        "string",
+										"description": "ISO 4217 code, only when this dish is priced in another currency than the menu",
+									},
+									"dietary_tags": map[string]interface{}{
+										"type":        "array",
+										"description": "Diets the menu marks this dish as suiting, e.g. with (V) or GF and a legend explaining them; only as marked on the menu",
+										"items":       map[string]interface{}{"type": "string", "enum": dietaryTags},
+									},
+									"cuisine": map[string]interface{}{
+										"type":        "string",
+										"enum":        append([]string{""}, cuisines...),
+										"description": "Only when this dish is from another cuisine than the menu's",
+									},
+									"spice_level": map[string]interface{}{
+										"type":        "integer",
+										"minimum":     0,
+										"maximum":     maxSpiceLevel,
+										"description": "How hot the menu marks the dish, from chili icons or words such as spicy or extra hot: 1 mild, 2 hot, 3 very hot, 0 when marked not spicy; leave out when the menu says nothing",
 									},
 								},
 								"required": []string{"name"},
@@ -673,6 +1701,11 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 		"required": []string{"sections"},
 	}
 
+	prompt := loadMenuPrompts(menuID).render(promptExtraction, "", "")
+	if note != "" {
+		prompt += "\n\n" + note
+	}
+
 	request := OpenAIVisionRequest{
 		Model: "gpt-4o",
 		Messages: []OpenAIMessage{
@@ -681,7 +1714,7 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 				Content: []OpenAIContent{
 					{
 						Type: "text",
-						Text: stringPtr("Extract the menu structure from this image. Organize dishes into sections. Include dish names and prices if visible. Return the data as structured JSON."),
+						Text: stringPtr(prompt),
 					},
 					{
 						Type: "image_url",
@@ -700,15 +1733,45 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 				Schema: schema,
 			},
 		},
-		MaxTokens: 2000,
+		MaxTokens: extractionMaxTokens(),
 	}
 
+	// An answer cut off is asked again once, with EXTRACTION_TOKEN_LIMIT;
+	// what one cut off there got to is kept
+	limit := max(extractionTokenLimit(), request.MaxTokens)
+	for {
+		openaiResp, err := sendVisionRequest(ctx, menuID, openaiAPIKey, request)
+		if err != nil {
+			return nil, err
+		}
+		choice := openaiResp.Choices[0]
+		if choice.FinishReason == finishReasonLength {
+			if request.MaxTokens < limit {
+				logFor(ctx).Warn("Menu structure cut off, asking again with more tokens", zap.String("menuID", menuID), zap.Int("maxTokens", request.MaxTokens))
+				request.MaxTokens = limit
+				continue
+			}
+			storeRawExtraction(menuID, choice.Message.Content)
+			err := fmt.Errorf("%w at %d tokens", errOutputTruncated, request.MaxTokens)
+			if menu, ok := salvageMenuStructure(choice.Message.Content); ok {
+				return menu, err
+			}
+			return nil, err
+		}
+
+		return decodeMenuStructure(ctx, menuID, choice.Message.Content, schema, request.MaxTokens)
+	}
+}
+
+// sendVisionRequest sends request to OpenAI and returns its answer, which
+// has at least one choice.
+func sendVisionRequest(ctx context.Context, menuID, openaiAPIKey string, request OpenAIVisionRequest) (*OpenAIResponse, error) {
 	jsonData, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL()+"/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -716,8 +1779,8 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+openaiAPIKey)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	client := &http.Client{Timeout: loadProviderTimeouts().Vision}
+	resp, err := callProvider(menuID, client, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
@@ -732,80 +1795,167 @@ func extractMenuStructure(imageContent []byte) (*StructuredMenu, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	recordProviderUsage(menuID, "openai", request.Model, openaiResp.Usage.PromptTokens, openaiResp.Usage.CompletionTokens, 0)
 
 	if len(openaiResp.Choices) == 0 {
 		return nil, fmt.Errorf("no choices in OpenAI response")
 	}
-
-	var structuredMenu StructuredMenu
-	if err := json.Unmarshal([]byte(openaiResp.Choices[0].Message.Content), &structuredMenu); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal structured menu: %w", err)
-	}
-
-	return &structuredMenu, nil
+	return &openaiResp, nil
 }
 
-func enhanceDish(dishID string) bool {
+// enhanceDish generates the dish's description and image. A dish whose
+// menu is interrupted mid-way is left as it was, for whoever resumes the
+// menu; one that runs out of budget or time keeps what it got.
+func enhanceDish(ctx context.Context, dishID string) bool {
 	var dish Dish
-	if err := db.Where("id = ?", dishID).First(&dish).Error; err != nil {
-		zapLog.Error("Failed to find dish", zap.String("dishID", dishID), zap.Error(err))
+	if err := db.WithContext(ctx).Where("id = ?", dishID).First(&dish).Error; err != nil {
+		logFor(ctx).Error("Failed to find dish", zap.String("dishID", dishID), zap.Error(err))
 		return false
 	}
 
-	// Generate description
-	description, err := generateDishDescription(dish.Name)
-	if err != nil {
-		zapLog.Error("Failed to generate description", zap.String("dishID", dishID), zap.Error(err))
-		markDishFailed(dishID, "Failed to generate description: "+err.Error())
-		return false
+	// Keep anything the user has corrected by hand
+	keepDescription := dish.EditedByUser && dish.Description != nil
+	keepImage := dish.EditedByUser && dish.ImageURL != nil
+
+	// Update dish
+	updates := map[string]interface{}{
+		"status":     "COMPLETE",
+		"updated_at": clock.Now(),
 	}
 
-	// Generate image
-	imageURL, err := generateDishImage(dish.Name)
-	if err != nil {
-		zapLog.Error("Failed to generate image", zap.String("dishID", dishID), zap.Error(err))
-		// Continue with description but no image
+	// Generate description
+	var descriptionRecord, imageRecord *GenerationRecord
+	if !keepDescription {
+		description, record, err := describeDish(ctx, dish.MenuID, dish.Name, dish.Cuisine)
+		if err != nil && interrupted(ctx) {
+			return false
+		}
+		if err != nil {
+			logFor(ctx).Error("Failed to generate description", zap.String("dishID", dishID), zap.String("menuID", dish.MenuID), zap.Error(err))
+			code := "DESCRIPTION_FAILED"
+			if errors.Is(err, errContentFlagged) {
+				code = "MODERATION"
+			} else if errors.Is(err, errBudgetExceeded) || errors.Is(context.Cause(ctx), errBudgetExceeded) {
+				code = "BUDGET_EXCEEDED"
+			} else if errors.Is(context.Cause(ctx), errProcessingDeadline) {
+				code = "DEADLINE_EXCEEDED"
+			}
+			markDishFailed(dishID, code, "Failed to generate description: "+err.Error())
+			return false
+		}
+		description, truncated := sanitizeText(description, loadSanitizeLimits().Description)
+		if truncated {
+			addMenuWarnings(dish.MenuID, MenuWarning{
+				Code:    "DESCRIPTION_TRUNCATED",
+				Message: fmt.Sprintf("Description for %q was truncated", dish.Name),
+			})
+		}
+		updates["description"] = description
+		descriptionRecord = record
+	}
+
+	// Classify by diet, allergens, and heat from the name and the
+	// description it now has
+	description := ""
+	if text, ok := updates["description"].(string); ok {
+		description = text
+	} else if dish.Description != nil {
+		description = *dish.Description
+	}
+	tagDish(ctx, dish, description)
+	detectAllergens(ctx, dish, description)
+	if dish.SpiceLevel == nil {
+		if level := spiceLevelFromText(dish.Name, description); level != nil {
+			updates["spice_level"] = *level
+		}
+	}
+	estimateNutrition(ctx, dish, description, updates)
+
+	// Generate image, unless image generation is off for this menu
+	var imageURL *string
+	if !keepImage && !imageGenerationAllowed(dish.MenuID) {
+		updates["status"] = "IMAGE_DISABLED"
+	} else if !keepImage {
+		var err error
+		imageURL, imageRecord, err = imageForDish(ctx, dish.MenuID, dish.Name, dish.Cuisine)
+		if err != nil && interrupted(ctx) {
+			return false
+		}
+		if errors.Is(err, errContentFlagged) {
+			// The description is kept; the dish fails so owners can see
+			// why it has no image
+			logFor(ctx).Warn("Dish image rejected by moderation", zap.String("dishID", dishID), zap.String("menuID", dish.MenuID), zap.Error(err))
+			updates["status"] = "FAILED"
+			updates["failure_code"] = "MODERATION"
+			updates["failure_reason"] = "Failed to generate image: " + err.Error()
+		} else if err != nil {
+			logFor(ctx).Error("Failed to generate image", zap.String("dishID", dishID), zap.String("menuID", dish.MenuID), zap.Error(err))
+			// Continue with description but no image
+		}
 	}
 
-	// Update dish
-	updates := map[string]interface{}{
-		"description": description,
-		"status":      "COMPLETE",
-		"updated_at":  time.Now(),
+	// Alt text goes with the image, from the name and the description it
+	// now has; one the owner set is kept
+	if (imageURL != nil || keepImage) && !(dish.EditedByUser && dish.ImageAlt != nil) {
+		var altDescription *string
+		if description != "" {
+			altDescription = &description
+		}
+		updates["image_alt"] = dishImageAlt(dish.Name, altDescription)
 	}
 
 	if imageURL != nil {
 		updates["image_url"] = *imageURL
+		if err := recordDishImages(db, dish, []string{*imageURL}, imageRecord, true); err != nil {
+			logFor(ctx).Error("Failed to store image candidate", zap.String("dishID", dishID), zap.String("menuID", dish.MenuID), zap.Error(err))
+		}
+	}
+
+	if descriptionRecord != nil || imageRecord != nil {
+		updates["generation_metadata"] = mergeGenerationMetadata(dish.GenerationMetadata, descriptionRecord, imageRecord)
 	}
 
 	if err := db.Model(&Dish{}).Where("id = ?", dishID).Updates(updates).Error; err != nil {
-		zapLog.Error("Failed to update dish", zap.String("dishID", dishID), zap.Error(err))
+		logFor(ctx).Error("Failed to update dish", zap.String("dishID", dishID), zap.String("menuID", dish.MenuID), zap.Error(err))
 		return false
 	}
 
 	return true
 }
 
-func generateDishDescription(dishName string) (string, error) {
-	// Try Choreo-provided environment variables first, then fall back to direct env vars
-	openaiAPIKey := os.Getenv("CHOREO_OPENAI_CONNECTION_OPENAI_API_KEY")
+// generateDishDescription writes menu copy for the dish. tone is one of
+// descriptionTones; empty keeps the default voice.
+func generateDishDescription(ctx context.Context, menuID, dishName, cuisine, tone string) (string, *GenerationRecord, error) {
+	return moderatedDescription(ctx, menuID, func() (string, *GenerationRecord, error) {
+		return requestDishDescription(ctx, menuID, dishName, cuisine, tone)
+	})
+}
+
+// requestDishDescription asks OpenAI for a description, unmoderated.
+func requestDishDescription(ctx context.Context, menuID, dishName, cuisine, tone string) (string, *GenerationRecord, error) {
+	defer jobStats.beginStage(stageDescribe)()
+
+	openaiAPIKey := lookupOpenAIKey()
 	if openaiAPIKey == "" {
-		openaiAPIKey = os.Getenv("OPENAI_API_KEY")
+		return "", nil, fmt.Errorf("OPENAI_API_KEY not set")
 	}
-	if openaiAPIKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY not set")
+
+	systemPrompt := "You are a food writer. Generate a brief, appetizing description (1-2 sentences) for the given dish name. Be descriptive but concise."
+	if style, ok := descriptionTones[tone]; ok {
+		systemPrompt += " " + style
 	}
+	userPrompt := loadMenuPrompts(menuID).render(promptDescription, dishName, cuisine)
 
 	request := OpenAITextRequest{
 		Model: "gpt-4o-mini",
 		Messages: []OpenAITextMessage{
 			{
 				Role:    "system",
-				Content: "You are a food writer. Generate a brief, appetizing description (1-2 sentences) for the given dish name. Be descriptive but concise.",
+				Content: systemPrompt,
 			},
 			{
 				Role:    "user",
-				Content: fmt.Sprintf("Generate a description for this dish: %s", dishName),
+				Content: userPrompt,
 			},
 		},
 		MaxTokens: 100,
@@ -813,116 +1963,262 @@ func generateDishDescription(dishName string) (string, error) {
 
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL()+"/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+openaiAPIKey)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	client := &http.Client{Timeout: loadProviderTimeouts().Description}
+	resp, err := callProvider(menuID, client, req)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return "", nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("OpenAI API error: %s", string(body))
+		return "", nil, fmt.Errorf("OpenAI API error: %s", string(body))
 	}
 
 	var openaiResp OpenAIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return "", nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	recordProviderUsage(menuID, "openai", request.Model, openaiResp.Usage.PromptTokens, openaiResp.Usage.CompletionTokens, 0)
 
 	if len(openaiResp.Choices) == 0 {
-		return "", fmt.Errorf("no choices in OpenAI response")
+		return "", nil, fmt.Errorf("no choices in OpenAI response")
 	}
 
-	return strings.TrimSpace(openaiResp.Choices[0].Message.Content), nil
+	record := &GenerationRecord{
+		Provider:     "openai",
+		Model:        request.Model,
+		SystemPrompt: systemPrompt,
+		Prompt:       userPrompt,
+		Parameters:   map[string]interface{}{"max_tokens": request.MaxTokens, "tone": tone},
+		GeneratedAt:  clock.Now(),
+	}
+
+	return strings.TrimSpace(openaiResp.Choices[0].Message.Content), record, nil
 }
 
-func generateDishImage(dishName string) (*string, error) {
-	// Try Choreo-provided environment variables first, then fall back to direct env vars
-	replicateAPIKey := os.Getenv("CHOREO_REPLICATE_CONNECTION_REPLICATE_API_KEY")
-	if replicateAPIKey == "" {
-		replicateAPIKey = os.Getenv("REPLICATE_API_KEY")
+// generateDishImage creates a photo for the dish. style is one of
+// imageStyles, or "" for the menu's. promptHint is optional user guidance
+// (e.g. "no cilantro, white plate") appended to the prompt.
+func generateDishImage(ctx context.Context, menuID, dishName, cuisine, style, promptHint string) (*string, *GenerationRecord, error) {
+	imageURLs, record, err := generateDishImages(ctx, menuID, dishName, cuisine, style, promptHint, 1)
+	if err != nil {
+		return nil, nil, err
 	}
+	return &imageURLs[0], record, nil
+}
+
+// imageShape is the aspect ratio and resolution of generated images.
+type imageShape struct {
+	AspectRatio string
+	Megapixels  string
+}
+
+// defaultImageShape is the square image used on dish cards.
+var defaultImageShape = imageShape{AspectRatio: "1:1", Megapixels: "1"}
+
+// menuImageShape is the shape of the menu's dish images, set at upload with
+// aspect_ratio and image_size.
+func menuImageShape(menu Menu) imageShape {
+	shape := defaultImageShape
+	if menu.ImageAspectRatio != "" {
+		shape.AspectRatio = menu.ImageAspectRatio
+	}
+	if megapixels, ok := renditionSizes[menu.ImageSize]; ok {
+		shape.Megapixels = megapixels
+	}
+	return shape
+}
+
+// generateDishImages creates count (1-4) candidate photos for the dish in a
+// single prediction, in the menu's image shape.
+func generateDishImages(ctx context.Context, menuID, dishName, cuisine, style, promptHint string, count int) ([]string, *GenerationRecord, error) {
+	return generateShapedDishImages(ctx, menuID, dishName, cuisine, style, promptHint, count, imageShape{})
+}
+
+// dishImageModel is the Replicate model dish images are generated with.
+const dishImageModel = "black-forest-labs/flux-dev"
+
+// dishImagePrompt builds the image prompt for a dish of cuisine in style
+// from the menu's image template and returns it with the cuisine it was
+// styled for, if any.
+func dishImagePrompt(prompts menuPrompts, dishName, cuisine, style, promptHint string) (string, string) {
+	prompt := prompts.render(promptImage, dishName, cuisine)
+	// Regional dishes get cuisine-specific presentation so they look authentic
+	if hint := cuisineHintFor(dishName, cuisine); hint != nil {
+		cuisine = hint.Cuisine
+		prompt += ", " + hint.Hint
+	} else if cuisine != "" && cuisine != "fusion" {
+		prompt += ", " + cuisineLabel(cuisine) + "-style presentation"
+	}
+	if preset, ok := imageStyles[style]; ok {
+		prompt += ", " + preset.Prompt
+	}
+	if promptHint != "" {
+		prompt += ", " + promptHint
+	}
+	// The deployment's constraints come last so nothing above overrides them
+	if constraints := imageConstraints(); constraints != "" {
+		prompt += ", " + constraints
+	}
+	return prompt, cuisine
+}
+
+// generateShapedDishImages creates count photos for the dish in shape, or
+// in the menu's shape when shape is zero. Fewer come back when moderation
+// flags some of them.
+func generateShapedDishImages(ctx context.Context, menuID, dishName, cuisine, style, promptHint string, count int, shape imageShape) ([]string, *GenerationRecord, error) {
+	imageURLs, record, err := moderatedImages(ctx, menuID, func() ([]string, *GenerationRecord, error) {
+		return requestDishImages(ctx, menuID, dishName, cuisine, style, promptHint, count, shape)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if text := watermarkText(); text != "" {
+		imageURLs, err = watermarkImages(ctx, menuID, imageURLs, text)
+		if err != nil {
+			return nil, nil, err
+		}
+		record.Parameters["watermark"] = text
+	}
+	return imageURLs, record, nil
+}
+
+// requestDishImages asks Replicate for the images, unmoderated and without
+// a watermark.
+func requestDishImages(ctx context.Context, menuID, dishName, cuisine, style, promptHint string, count int, shape imageShape) ([]string, *GenerationRecord, error) {
+	defer jobStats.beginStage(stageImage)()
+
+	replicateAPIKey := lookupReplicateKey()
 	if replicateAPIKey == "" {
-		return nil, fmt.Errorf("REPLICATE_API_KEY not set")
+		return nil, nil, fmt.Errorf("REPLICATE_API_KEY not set")
 	}
 
-	prompt := fmt.Sprintf("A beautiful, appetizing photo of %s, food photography, professional lighting, clean background", dishName)
+	prompts := loadMenuPrompts(menuID)
+	if style == "" {
+		style = prompts.ImageStyle
+	}
+	if shape == (imageShape{}) {
+		shape = prompts.ImageShape
+	}
+	prompt, cuisine := dishImagePrompt(prompts, dishName, cuisine, style, promptHint)
+	guidance, steps := imageStyleParameters(style)
+
+	// Pick the seed ourselves so the image can be reproduced later
+	seed := rand.Intn(1 << 31)
 
 	request := ReplicateRequest{
 		Input: ReplicateInput{
 			Prompt:            prompt,
-			AspectRatio:       "1:1",
-			NumOutputs:        1,
-			NumInferenceSteps: 28,
-			Guidance:          3.5,
-			OutputFormat:      "webp",
+			AspectRatio:       shape.AspectRatio,
+			Megapixels:        shape.Megapixels,
+			NumOutputs:        count,
+			NumInferenceSteps: steps,
+			Guidance:          guidance,
+			OutputFormat:      imageOutputFormat(),
 			OutputQuality:     80,
 			GoFast:            true,
+			Seed:              &seed,
 		},
 	}
 
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.replicate.com/v1/models/black-forest-labs/flux-dev/predictions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", replicateBaseURL()+"/v1/models/"+dishImageModel+"/predictions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+replicateAPIKey)
 	req.Header.Set("Prefer", "wait")
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
+	client := &http.Client{Timeout: loadProviderTimeouts().Image}
+	resp, err := callProvider(menuID, client, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Replicate API error: %s", string(body))
+		return nil, nil, fmt.Errorf("Replicate API error: %s", string(body))
 	}
 
 	var replicateResp ReplicateResponse
 	if err := json.NewDecoder(resp.Body).Decode(&replicateResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	// If image is ready immediately
-	if len(replicateResp.Output) > 0 {
-		return &replicateResp.Output[0], nil
+		return nil, nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	record := &GenerationRecord{
+		Provider: "replicate",
+		Model:    dishImageModel,
+		Prompt:   prompt,
+		Seed:     &seed,
+		Parameters: map[string]interface{}{
+			"prediction_id":       replicateResp.ID,
+			"aspect_ratio":        request.Input.AspectRatio,
+			"megapixels":          request.Input.Megapixels,
+			"num_outputs":         request.Input.NumOutputs,
+			"num_inference_steps": request.Input.NumInferenceSteps,
+			"guidance":            request.Input.Guidance,
+			"output_format":       request.Input.OutputFormat,
+			"output_quality":      request.Input.OutputQuality,
+			"go_fast":             request.Input.GoFast,
+			"cuisine":             cuisine,
+			"style":               style,
+		},
+		GeneratedAt: clock.Now(),
 	}
 
-	// Poll for completion if not ready
-	if replicateResp.URLs.Get != "" {
-		return pollReplicateResult(replicateResp.URLs.Get, replicateAPIKey)
+	imageURLs := replicateResp.Output
+	if len(imageURLs) == 0 {
+		// Poll for completion if not ready
+		if replicateResp.URLs.Get == "" {
+			return nil, nil, fmt.Errorf("no output or polling URL available")
+		}
+		imageURLs, err = pollReplicateResult(ctx, menuID, replicateResp.URLs.Get, replicateAPIKey)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return nil, fmt.Errorf("no output or polling URL available")
+	recordProviderUsage(menuID, "replicate", record.Model, 0, 0, len(imageURLs))
+	return imageURLs, record, nil
 }
 
-func pollReplicateResult(pollURL, apiKey string) (*string, error) {
-	maxAttempts := 10
-	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(time.Duration(i+1) * time.Second)
+// pollReplicateResult waits for a prediction's images, backing off between
+// polls, for up to IMAGE_POLL_TIMEOUT.
+func pollReplicateResult(ctx context.Context, menuID, pollURL, apiKey string) ([]string, error) {
+	pollCtx, cancel := context.WithTimeout(ctx, loadProviderTimeouts().Poll)
+	defer cancel()
+
+	for i := 1; ; i++ {
+		select {
+		case <-pollCtx.Done():
+			if ctx.Err() != nil {
+				return nil, context.Cause(ctx)
+			}
+			return nil, fmt.Errorf("polling timeout")
+		case <-time.After(time.Duration(min(i, 5)) * time.Second):
+		}
 
-		req, err := http.NewRequest("GET", pollURL, nil)
+		req, err := http.NewRequestWithContext(pollCtx, "GET", pollURL, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create polling request: %w", err)
 		}
@@ -930,7 +2226,10 @@ func pollReplicateResult(pollURL, apiKey string) (*string, error) {
 		req.Header.Set("Authorization", "Bearer "+apiKey)
 
 		client := &http.Client{Timeout: 30 * time.Second}
-		resp, err := client.Do(req)
+		resp, err := callProvider(menuID, client, req)
+		if errors.Is(err, errBudgetExceeded) || ctx.Err() != nil {
+			return nil, err
+		}
 		if err != nil {
 			continue
 		}
@@ -943,45 +2242,44 @@ func pollReplicateResult(pollURL, apiKey string) (*string, error) {
 		resp.Body.Close()
 
 		if result.Status == "succeeded" && len(result.Output) > 0 {
-			return &result.Output[0], nil
+			return result.Output, nil
 		}
 
 		if result.Status == "failed" {
 			return nil, fmt.Errorf("image generation failed")
 		}
 	}
-
-	return nil, fmt.Errorf("polling timeout")
 }
 
-func extractPriceCents(priceStr string) int {
-	// Simple price extraction - look for numbers
-	cleaned := strings.ReplaceAll(priceStr, "$", "")
-	cleaned = strings.ReplaceAll(cleaned, ",", "")
-	cleaned = strings.TrimSpace(cleaned)
-
-	if price, err := strconv.ParseFloat(cleaned, 64); err == nil {
-		return int(price * 100) // Convert to cents
-	}
-
-	return 0
+func failMenu(menuID, reason string) {
+	failMenuWithCode(menuID, "PROCESSING_FAILED", reason)
 }
 
-func failMenu(menuID, reason string) {
+func failMenuWithCode(menuID, code, reason string) {
 	if err := db.Model(&Menu{}).Where("id = ?", menuID).Updates(map[string]interface{}{
 		"status":         "FAILED",
+		"failure_code":   code,
 		"failure_reason": reason,
-		"updated_at":     time.Now(),
+		"updated_at":     clock.Now(),
 	}).Error; err != nil {
 		zapLog.Error("Failed to update menu failure", zap.String("menuID", menuID), zap.Error(err))
+		return
 	}
+
+	emitEvent(EventMenuFailed, menuEventOwner(menuID), gin.H{
+		"menu_id":        menuID,
+		"failure_code":   code,
+		"failure_reason": reason,
+	})
 }
 
-func markDishFailed(dishID, reason string) {
+// markDishFailed fails a dish with a code from the catalog's dish scope.
+func markDishFailed(dishID, code, reason string) {
 	if err := db.Model(&Dish{}).Where("id = ?", dishID).Updates(map[string]interface{}{
 		"status":         "FAILED",
+		"failure_code":   code,
 		"failure_reason": reason,
-		"updated_at":     time.Now(),
+		"updated_at":     clock.Now(),
 	}).Error; err != nil {
 		zapLog.Error("Failed to update dish failure", zap.String("dishID", dishID), zap.Error(err))
 	}
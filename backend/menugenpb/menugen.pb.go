@@ -0,0 +1,983 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: menugen.proto
+
+package menugenpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DuplicatePolicy int32
+
+const (
+	// Same as DUPLICATE_POLICY_WARN.
+	DuplicatePolicy_DUPLICATE_POLICY_UNSPECIFIED DuplicatePolicy = 0
+	// Fail with ALREADY_EXISTS.
+	DuplicatePolicy_DUPLICATE_POLICY_WARN DuplicatePolicy = 1
+	// Return the existing menu.
+	DuplicatePolicy_DUPLICATE_POLICY_REUSE DuplicatePolicy = 2
+	// Process the image as a new menu.
+	DuplicatePolicy_DUPLICATE_POLICY_FORCE DuplicatePolicy = 3
+)
+
+// Enum value maps for DuplicatePolicy.
+var (
+	DuplicatePolicy_name = map[int32]string{
+		0: "DUPLICATE_POLICY_UNSPECIFIED",
+		1: "DUPLICATE_POLICY_WARN",
+		2: "DUPLICATE_POLICY_REUSE",
+		3: "DUPLICATE_POLICY_FORCE",
+	}
+	DuplicatePolicy_value = map[string]int32{
+		"DUPLICATE_POLICY_UNSPECIFIED": 0,
+		"DUPLICATE_POLICY_WARN":        1,
+		"DUPLICATE_POLICY_REUSE":       2,
+		"DUPLICATE_POLICY_FORCE":       3,
+	}
+)
+
+func (x DuplicatePolicy) Enum() *DuplicatePolicy {
+	p := new(DuplicatePolicy)
+	*p = x
+	return p
+}
+
+func (x DuplicatePolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DuplicatePolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_menugen_proto_enumTypes[0].Descriptor()
+}
+
+func (DuplicatePolicy) Type() protoreflect.EnumType {
+	return &file_menugen_proto_enumTypes[0]
+}
+
+func (x DuplicatePolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DuplicatePolicy.Descriptor instead.
+func (DuplicatePolicy) EnumDescriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{0}
+}
+
+type UploadMenuRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The menu photo, at most 8 MB.
+	Image    []byte `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	Filename string `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Must be an image/* type.
+	ContentType   string          `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	OnDuplicate   DuplicatePolicy `protobuf:"varint,4,opt,name=on_duplicate,json=onDuplicate,proto3,enum=menugen.v1.DuplicatePolicy" json:"on_duplicate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadMenuRequest) Reset() {
+	*x = UploadMenuRequest{}
+	mi := &file_menugen_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadMenuRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadMenuRequest) ProtoMessage() {}
+
+func (x *UploadMenuRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadMenuRequest.ProtoReflect.Descriptor instead.
+func (*UploadMenuRequest) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UploadMenuRequest) GetImage() []byte {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *UploadMenuRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *UploadMenuRequest) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *UploadMenuRequest) GetOnDuplicate() DuplicatePolicy {
+	if x != nil {
+		return x.OnDuplicate
+	}
+	return DuplicatePolicy_DUPLICATE_POLICY_UNSPECIFIED
+}
+
+type UploadMenuResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	MenuId string                 `protobuf:"bytes,1,opt,name=menu_id,json=menuId,proto3" json:"menu_id,omitempty"`
+	Status string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// False when the upload resolved to an existing menu.
+	Created       bool `protobuf:"varint,3,opt,name=created,proto3" json:"created,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadMenuResponse) Reset() {
+	*x = UploadMenuResponse{}
+	mi := &file_menugen_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadMenuResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadMenuResponse) ProtoMessage() {}
+
+func (x *UploadMenuResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadMenuResponse.ProtoReflect.Descriptor instead.
+func (*UploadMenuResponse) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UploadMenuResponse) GetMenuId() string {
+	if x != nil {
+		return x.MenuId
+	}
+	return ""
+}
+
+func (x *UploadMenuResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *UploadMenuResponse) GetCreated() bool {
+	if x != nil {
+		return x.Created
+	}
+	return false
+}
+
+type GetMenuRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMenuRequest) Reset() {
+	*x = GetMenuRequest{}
+	mi := &file_menugen_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMenuRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMenuRequest) ProtoMessage() {}
+
+func (x *GetMenuRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMenuRequest.ProtoReflect.Descriptor instead.
+func (*GetMenuRequest) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetMenuRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListMenusRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// At most 100; defaults to 20.
+	PageSize int32 `protobuf:"varint,1,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token from the previous page.
+	PageToken string `protobuf:"bytes,2,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// Only menus with this status, e.g. COMPLETE.
+	Status        string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMenusRequest) Reset() {
+	*x = ListMenusRequest{}
+	mi := &file_menugen_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMenusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMenusRequest) ProtoMessage() {}
+
+func (x *ListMenusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMenusRequest.ProtoReflect.Descriptor instead.
+func (*ListMenusRequest) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListMenusRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListMenusRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *ListMenusRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type ListMenusResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Menus []*Menu                `protobuf:"bytes,1,rep,name=menus,proto3" json:"menus,omitempty"`
+	// Empty on the last page.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMenusResponse) Reset() {
+	*x = ListMenusResponse{}
+	mi := &file_menugen_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMenusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMenusResponse) ProtoMessage() {}
+
+func (x *ListMenusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMenusResponse.ProtoReflect.Descriptor instead.
+func (*ListMenusResponse) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListMenusResponse) GetMenus() []*Menu {
+	if x != nil {
+		return x.Menus
+	}
+	return nil
+}
+
+func (x *ListMenusResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type WatchMenuRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchMenuRequest) Reset() {
+	*x = WatchMenuRequest{}
+	mi := &file_menugen_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchMenuRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchMenuRequest) ProtoMessage() {}
+
+func (x *WatchMenuRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchMenuRequest.ProtoReflect.Descriptor instead.
+func (*WatchMenuRequest) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *WatchMenuRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Menu struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// PENDING, PROCESSING, COMPLETE, or FAILED.
+	Status           string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	OriginalFilename string `protobuf:"bytes,3,opt,name=original_filename,json=originalFilename,proto3" json:"original_filename,omitempty"`
+	TotalDishes      int32  `protobuf:"varint,4,opt,name=total_dishes,json=totalDishes,proto3" json:"total_dishes,omitempty"`
+	ProcessedDishes  int32  `protobuf:"varint,5,opt,name=processed_dishes,json=processedDishes,proto3" json:"processed_dishes,omitempty"`
+	// ENABLED or DISABLED.
+	ImageMode string     `protobuf:"bytes,6,opt,name=image_mode,json=imageMode,proto3" json:"image_mode,omitempty"`
+	Sections  []*Section `protobuf:"bytes,7,rep,name=sections,proto3" json:"sections,omitempty"`
+	// In menu order. Available while the menu is processing; each dish has its
+	// own status.
+	Dishes []*Dish `protobuf:"bytes,8,rep,name=dishes,proto3" json:"dishes,omitempty"`
+	// Set when the menu FAILED.
+	Error         *Error                 `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	CompletedAt   *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=completed_at,json=completedAt,proto3" json:"completed_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Menu) Reset() {
+	*x = Menu{}
+	mi := &file_menugen_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Menu) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Menu) ProtoMessage() {}
+
+func (x *Menu) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Menu.ProtoReflect.Descriptor instead.
+func (*Menu) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Menu) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Menu) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Menu) GetOriginalFilename() string {
+	if x != nil {
+		return x.OriginalFilename
+	}
+	return ""
+}
+
+func (x *Menu) GetTotalDishes() int32 {
+	if x != nil {
+		return x.TotalDishes
+	}
+	return 0
+}
+
+func (x *Menu) GetProcessedDishes() int32 {
+	if x != nil {
+		return x.ProcessedDishes
+	}
+	return 0
+}
+
+func (x *Menu) GetImageMode() string {
+	if x != nil {
+		return x.ImageMode
+	}
+	return ""
+}
+
+func (x *Menu) GetSections() []*Section {
+	if x != nil {
+		return x.Sections
+	}
+	return nil
+}
+
+func (x *Menu) GetDishes() []*Dish {
+	if x != nil {
+		return x.Dishes
+	}
+	return nil
+}
+
+func (x *Menu) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *Menu) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Menu) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Menu) GetCompletedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CompletedAt
+	}
+	return nil
+}
+
+type Section struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name            string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Position        int32                  `protobuf:"varint,3,opt,name=position,proto3" json:"position,omitempty"`
+	TotalDishes     int32                  `protobuf:"varint,4,opt,name=total_dishes,json=totalDishes,proto3" json:"total_dishes,omitempty"`
+	ProcessedDishes int32                  `protobuf:"varint,5,opt,name=processed_dishes,json=processedDishes,proto3" json:"processed_dishes,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Section) Reset() {
+	*x = Section{}
+	mi := &file_menugen_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Section) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Section) ProtoMessage() {}
+
+func (x *Section) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Section.ProtoReflect.Descriptor instead.
+func (*Section) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Section) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Section) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Section) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *Section) GetTotalDishes() int32 {
+	if x != nil {
+		return x.TotalDishes
+	}
+	return 0
+}
+
+func (x *Section) GetProcessedDishes() int32 {
+	if x != nil {
+		return x.ProcessedDishes
+	}
+	return 0
+}
+
+type Dish struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	SectionId      string                 `protobuf:"bytes,2,opt,name=section_id,json=sectionId,proto3" json:"section_id,omitempty"`
+	Name           string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	PriceCents     *int32                 `protobuf:"varint,4,opt,name=price_cents,json=priceCents,proto3,oneof" json:"price_cents,omitempty"`
+	Currency       string                 `protobuf:"bytes,5,opt,name=currency,proto3" json:"currency,omitempty"`
+	RawPriceString *string                `protobuf:"bytes,6,opt,name=raw_price_string,json=rawPriceString,proto3,oneof" json:"raw_price_string,omitempty"`
+	Description    *string                `protobuf:"bytes,7,opt,name=description,proto3,oneof" json:"description,omitempty"`
+	ImageUrl       *string                `protobuf:"bytes,8,opt,name=image_url,json=imageUrl,proto3,oneof" json:"image_url,omitempty"`
+	Status         string                 `protobuf:"bytes,9,opt,name=status,proto3" json:"status,omitempty"`
+	Position       int32                  `protobuf:"varint,10,opt,name=position,proto3" json:"position,omitempty"`
+	EditedByUser   bool                   `protobuf:"varint,11,opt,name=edited_by_user,json=editedByUser,proto3" json:"edited_by_user,omitempty"`
+	// Rendition name to image URL, e.g. "hero".
+	Renditions    map[string]string `protobuf:"bytes,12,rep,name=renditions,proto3" json:"renditions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Dish) Reset() {
+	*x = Dish{}
+	mi := &file_menugen_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Dish) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dish) ProtoMessage() {}
+
+func (x *Dish) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dish.ProtoReflect.Descriptor instead.
+func (*Dish) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Dish) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Dish) GetSectionId() string {
+	if x != nil {
+		return x.SectionId
+	}
+	return ""
+}
+
+func (x *Dish) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Dish) GetPriceCents() int32 {
+	if x != nil && x.PriceCents != nil {
+		return *x.PriceCents
+	}
+	return 0
+}
+
+func (x *Dish) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *Dish) GetRawPriceString() string {
+	if x != nil && x.RawPriceString != nil {
+		return *x.RawPriceString
+	}
+	return ""
+}
+
+func (x *Dish) GetDescription() string {
+	if x != nil && x.Description != nil {
+		return *x.Description
+	}
+	return ""
+}
+
+func (x *Dish) GetImageUrl() string {
+	if x != nil && x.ImageUrl != nil {
+		return *x.ImageUrl
+	}
+	return ""
+}
+
+func (x *Dish) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Dish) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *Dish) GetEditedByUser() bool {
+	if x != nil {
+		return x.EditedByUser
+	}
+	return false
+}
+
+func (x *Dish) GetRenditions() map[string]string {
+	if x != nil {
+		return x.Renditions
+	}
+	return nil
+}
+
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_menugen_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_menugen_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_menugen_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_menugen_proto protoreflect.FileDescriptor
+
+const file_menugen_proto_rawDesc = "" +
+	"\n" +
+	"\rmenugen.proto\x12\n" +
+	"menugen.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa8\x01\n" +
+	"\x11UploadMenuRequest\x12\x14\n" +
+	"\x05image\x18\x01 \x01(\fR\x05image\x12\x1a\n" +
+	"\bfilename\x18\x02 \x01(\tR\bfilename\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12>\n" +
+	"\fon_duplicate\x18\x04 \x01(\x0e2\x1b.menugen.v1.DuplicatePolicyR\vonDuplicate\"_\n" +
+	"\x12UploadMenuResponse\x12\x17\n" +
+	"\amenu_id\x18\x01 \x01(\tR\x06menuId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x18\n" +
+	"\acreated\x18\x03 \x01(\bR\acreated\" \n" +
+	"\x0eGetMenuRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"f\n" +
+	"\x10ListMenusRequest\x12\x1b\n" +
+	"\tpage_size\x18\x01 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x02 \x01(\tR\tpageToken\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\"c\n" +
+	"\x11ListMenusResponse\x12&\n" +
+	"\x05menus\x18\x01 \x03(\v2\x10.menugen.v1.MenuR\x05menus\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\"\n" +
+	"\x10WatchMenuRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x81\x04\n" +
+	"\x04Menu\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12+\n" +
+	"\x11original_filename\x18\x03 \x01(\tR\x10originalFilename\x12!\n" +
+	"\ftotal_dishes\x18\x04 \x01(\x05R\vtotalDishes\x12)\n" +
+	"\x10processed_dishes\x18\x05 \x01(\x05R\x0fprocessedDishes\x12\x1d\n" +
+	"\n" +
+	"image_mode\x18\x06 \x01(\tR\timageMode\x12/\n" +
+	"\bsections\x18\a \x03(\v2\x13.menugen.v1.SectionR\bsections\x12(\n" +
+	"\x06dishes\x18\b \x03(\v2\x10.menugen.v1.DishR\x06dishes\x12'\n" +
+	"\x05error\x18\t \x01(\v2\x11.menugen.v1.ErrorR\x05error\x129\n" +
+	"\n" +
+	"created_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12=\n" +
+	"\fcompleted_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\vcompletedAt\"\x97\x01\n" +
+	"\aSection\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1a\n" +
+	"\bposition\x18\x03 \x01(\x05R\bposition\x12!\n" +
+	"\ftotal_dishes\x18\x04 \x01(\x05R\vtotalDishes\x12)\n" +
+	"\x10processed_dishes\x18\x05 \x01(\x05R\x0fprocessedDishes\"\xa1\x04\n" +
+	"\x04Dish\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"section_id\x18\x02 \x01(\tR\tsectionId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12$\n" +
+	"\vprice_cents\x18\x04 \x01(\x05H\x00R\n" +
+	"priceCents\x88\x01\x01\x12\x1a\n" +
+	"\bcurrency\x18\x05 \x01(\tR\bcurrency\x12-\n" +
+	"\x10raw_price_string\x18\x06 \x01(\tH\x01R\x0erawPriceString\x88\x01\x01\x12%\n" +
+	"\vdescription\x18\a \x01(\tH\x02R\vdescription\x88\x01\x01\x12 \n" +
+	"\timage_url\x18\b \x01(\tH\x03R\bimageUrl\x88\x01\x01\x12\x16\n" +
+	"\x06status\x18\t \x01(\tR\x06status\x12\x1a\n" +
+	"\bposition\x18\n" +
+	" \x01(\x05R\bposition\x12$\n" +
+	"\x0eedited_by_user\x18\v \x01(\bR\feditedByUser\x12@\n" +
+	"\n" +
+	"renditions\x18\f \x03(\v2 .menugen.v1.Dish.RenditionsEntryR\n" +
+	"renditions\x1a=\n" +
+	"\x0fRenditionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x0e\n" +
+	"\f_price_centsB\x13\n" +
+	"\x11_raw_price_stringB\x0e\n" +
+	"\f_descriptionB\f\n" +
+	"\n" +
+	"_image_url\"5\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage*\x86\x01\n" +
+	"\x0fDuplicatePolicy\x12 \n" +
+	"\x1cDUPLICATE_POLICY_UNSPECIFIED\x10\x00\x12\x19\n" +
+	"\x15DUPLICATE_POLICY_WARN\x10\x01\x12\x1a\n" +
+	"\x16DUPLICATE_POLICY_REUSE\x10\x02\x12\x1a\n" +
+	"\x16DUPLICATE_POLICY_FORCE\x10\x032\x9c\x02\n" +
+	"\vMenuService\x12K\n" +
+	"\n" +
+	"UploadMenu\x12\x1d.menugen.v1.UploadMenuRequest\x1a\x1e.menugen.v1.UploadMenuResponse\x127\n" +
+	"\aGetMenu\x12\x1a.menugen.v1.GetMenuRequest\x1a\x10.menugen.v1.Menu\x12H\n" +
+	"\tListMenus\x12\x1c.menugen.v1.ListMenusRequest\x1a\x1d.menugen.v1.ListMenusResponse\x12=\n" +
+	"\tWatchMenu\x12\x1c.menugen.v1.WatchMenuRequest\x1a\x10.menugen.v1.Menu0\x01B\x1bZ\x19menugen-backend/menugenpbb\x06proto3"
+
+var (
+	file_menugen_proto_rawDescOnce sync.Once
+	file_menugen_proto_rawDescData []byte
+)
+
+func file_menugen_proto_rawDescGZIP() []byte {
+	file_menugen_proto_rawDescOnce.Do(func() {
+		file_menugen_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_menugen_proto_rawDesc), len(file_menugen_proto_rawDesc)))
+	})
+	return file_menugen_proto_rawDescData
+}
+
+var file_menugen_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_menugen_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_menugen_proto_goTypes = []any{
+	(DuplicatePolicy)(0),          // 0: menugen.v1.DuplicatePolicy
+	(*UploadMenuRequest)(nil),     // 1: menugen.v1.UploadMenuRequest
+	(*UploadMenuResponse)(nil),    // 2: menugen.v1.UploadMenuResponse
+	(*GetMenuRequest)(nil),        // 3: menugen.v1.GetMenuRequest
+	(*ListMenusRequest)(nil),      // 4: menugen.v1.ListMenusRequest
+	(*ListMenusResponse)(nil),     // 5: menugen.v1.ListMenusResponse
+	(*WatchMenuRequest)(nil),      // 6: menugen.v1.WatchMenuRequest
+	(*Menu)(nil),                  // 7: menugen.v1.Menu
+	(*Section)(nil),               // 8: menugen.v1.Section
+	(*Dish)(nil),                  // 9: menugen.v1.Dish
+	(*Error)(nil),                 // 10: menugen.v1.Error
+	nil,                           // 11: menugen.v1.Dish.RenditionsEntry
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+}
+var file_menugen_proto_depIdxs = []int32{
+	0,  // 0: menugen.v1.UploadMenuRequest.on_duplicate:type_name -> menugen.v1.DuplicatePolicy
+	7,  // 1: menugen.v1.ListMenusResponse.menus:type_name -> menugen.v1.Menu
+	8,  // 2: menugen.v1.Menu.sections:type_name -> menugen.v1.Section
+	9,  // 3: menugen.v1.Menu.dishes:type_name -> menugen.v1.Dish
+	10, // 4: menugen.v1.Menu.error:type_name -> menugen.v1.Error
+	12, // 5: menugen.v1.Menu.created_at:type_name -> google.protobuf.Timestamp
+	12, // 6: menugen.v1.Menu.updated_at:type_name -> google.protobuf.Timestamp
+	12, // 7: menugen.v1.Menu.completed_at:type_name -> google.protobuf.Timestamp
+	11, // 8: menugen.v1.Dish.renditions:type_name -> menugen.v1.Dish.RenditionsEntry
+	1,  // 9: menugen.v1.MenuService.UploadMenu:input_type -> menugen.v1.UploadMenuRequest
+	3,  // 10: menugen.v1.MenuService.GetMenu:input_type -> menugen.v1.GetMenuRequest
+	4,  // 11: menugen.v1.MenuService.ListMenus:input_type -> menugen.v1.ListMenusRequest
+	6,  // 12: menugen.v1.MenuService.WatchMenu:input_type -> menugen.v1.WatchMenuRequest
+	2,  // 13: menugen.v1.MenuService.UploadMenu:output_type -> menugen.v1.UploadMenuResponse
+	7,  // 14: menugen.v1.MenuService.GetMenu:output_type -> menugen.v1.Menu
+	5,  // 15: menugen.v1.MenuService.ListMenus:output_type -> menugen.v1.ListMenusResponse
+	7,  // 16: menugen.v1.MenuService.WatchMenu:output_type -> menugen.v1.Menu
+	13, // [13:17] is the sub-list for method output_type
+	9,  // [9:13] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_menugen_proto_init() }
+func file_menugen_proto_init() {
+	if File_menugen_proto != nil {
+		return
+	}
+	file_menugen_proto_msgTypes[8].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_menugen_proto_rawDesc), len(file_menugen_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_menugen_proto_goTypes,
+		DependencyIndexes: file_menugen_proto_depIdxs,
+		EnumInfos:         file_menugen_proto_enumTypes,
+		MessageInfos:      file_menugen_proto_msgTypes,
+	}.Build()
+	File_menugen_proto = out.File
+	file_menugen_proto_goTypes = nil
+	file_menugen_proto_depIdxs = nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func deleteMenuHandler(c *gin.Context) {
+	menuID := c.Param("id")
+
+	if !getEnvBool("MENU_DELETE_ENABLED", true) {
+		respondError(c, http.StatusConflict, "DELETE_DISABLED", "Menu deletion is disabled by policy")
+		return
+	}
+
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	if err := deleteMenu(menu.ID); err != nil {
+		zapLog.Error("Failed to delete menu", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete menu")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// loadMenu loads the menu named by the :id route parameter, writing a 404
+// response and returning false when it does not exist.
+func loadMenu(c *gin.Context) (*Menu, bool) {
+	var menu Menu
+	if err := db.Where("id = ?", c.Param("id")).First(&menu).Error; err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return nil, false
+	}
+	return &menu, true
+}
+
+// touchMenu bumps the menu's updated_at after one of its children changed.
+func touchMenu(tx *gorm.DB, menuID string) error {
+	return tx.Model(&Menu{}).Where("id = ?", menuID).Update("updated_at", clock.Now()).Error
+}
+
+// menuETag identifies the current state of a menu's status response without
+// loading its dishes. Edits bump menus.updated_at through touchMenu; dish
+// progress and renditions are covered by their own timestamps.
+func menuETag(menuID string) (string, error) {
+	var state struct {
+		UpdatedAt           time.Time
+		Dishes              int64
+		DishesUpdatedAt     time.Time
+		RenditionsCreatedAt time.Time
+	}
+	err := db.Raw(`SELECT m.updated_at,
+			(SELECT COUNT(*) FROM dishes d WHERE d.menu_id = m.id) AS dishes,
+			(SELECT COALESCE(MAX(d.updated_at), m.created_at) FROM dishes d WHERE d.menu_id = m.id) AS dishes_updated_at,
+			(SELECT COALESCE(MAX(r.created_at), m.created_at) FROM dish_renditions r WHERE r.menu_id = m.id) AS renditions_created_at
+		FROM menus m WHERE m.id = ?`, menuID).Scan(&state).Error
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%d|%d",
+		state.UpdatedAt.UnixNano(), state.Dishes, state.DishesUpdatedAt.UnixNano(), state.RenditionsCreatedAt.UnixNano())))
+	return `"` + hex.EncodeToString(sum[:12]) + `"`, nil
+}
+
+// etagMatches reports whether an If-None-Match header names etag. Weak
+// validators match too, as they do for GET.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteMenu cancels any in-flight processing for the menu and removes it
+// together with everything that hangs off it.
+func deleteMenu(menuID string) error {
+	if processingJobs.cancel(menuID) {
+		zapLog.Info("Cancelled in-flight menu processing", zap.String("menuID", menuID))
+	}
+
+	owner := menuEventOwner(menuID)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := deleteMenuRows(tx, []string{menuID})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	emitEvent(EventMenuDeleted, owner, gin.H{"menu_id": menuID})
+	return nil
+}
+
+// menuTables are the tables holding a menu's rows by menu_id, children
+// first.
+var menuTables = []struct {
+	name  string
+	model interface{}
+}{
+	{"menu_shares", &MenuShare{}},
+	{"dish_feedbacks", &DishFeedback{}},
+	{"menu_revisions", &MenuRevision{}},
+	{"menu_versions", &MenuVersion{}},
+	{"dish_renditions", &DishRendition{}},
+	{"dish_images", &DishImage{}},
+	{"dish_variants", &DishVariant{}},
+	{"dish_modifiers", &DishModifier{}},
+	{"dish_tags", &DishTag{}},
+	{"dish_allergens", &DishAllergen{}},
+	{"dish_translations", &DishTranslation{}},
+	{"section_translations", &SectionTranslation{}},
+	{"dishes", &Dish{}},
+	{"menu_sections", &MenuSection{}},
+}
+
+// deleteMenuRows deletes the menus and everything that hangs off them in tx,
+// and returns how many rows it deleted per table.
+func deleteMenuRows(tx *gorm.DB, menuIDs []string) (map[string]int64, error) {
+	deleted := make(map[string]int64)
+	if len(menuIDs) == 0 {
+		return deleted, nil
+	}
+	// Lock the menus before touching their rows, so processing cannot insert
+	// sections and dishes into a menu being deleted (see processMenu)
+	var locked []string
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Menu{}).Where("id IN ?", menuIDs).Pluck("id", &locked).Error; err != nil {
+		return nil, err
+	}
+	for _, table := range menuTables {
+		result := tx.Where("menu_id IN ?", menuIDs).Delete(table.model)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		deleted[table.name] += result.RowsAffected
+	}
+	images, err := deleteUnsharedImages(tx, menuIDs)
+	if err != nil {
+		return nil, err
+	}
+	deleted["stored_images"] += images
+	result := tx.Where("id IN ?", menuIDs).Delete(&Menu{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	deleted["menus"] += result.RowsAffected
+	return deleted, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Generation stages tracked by jobMetrics.
+const (
+	stageExtract   = "extract"
+	stageDescribe  = "describe"
+	stageImage     = "image"
+	stageCaption   = "caption"
+	stageClassify  = "classify"
+	stageTranslate = "translate"
+	stageModerate  = "moderate"
+	stageSEO       = "seo"
+)
+
+// jobMetrics counts the work in flight in this process. Values are gauges of
+// what is running right now, except throttled and the *Started counters,
+// which only grow.
+// Every replica keeps its own counts.
+type jobMetrics struct {
+	pipelines  atomic.Int64 // menus being processed
+	workers    atomic.Int64 // dish goroutines, waiting or running
+	queued     atomic.Int64 // dish goroutines waiting for a worker slot
+	slotsInUse atomic.Int64
+	slotsTotal atomic.Int64
+	background atomic.Int64 // regenerations started from the API
+	throttled  atomic.Int64 // provider calls held back by providerLimits
+
+	mu     sync.Mutex
+	stages map[string]*stageMetrics
+}
+
+type stageMetrics struct {
+	inFlight int64
+	started  int64
+}
+
+var jobStats = &jobMetrics{stages: map[string]*stageMetrics{
+	stageExtract:   {},
+	stageDescribe:  {},
+	stageImage:     {},
+	stageCaption:   {},
+	stageClassify:  {},
+	stageTranslate: {},
+	stageModerate:  {},
+	stageSEO:       {},
+}}
+
+// beginStage records a provider call for stage and returns the function that
+// ends it.
+func (m *jobMetrics) beginStage(stage string) func() {
+	m.mu.Lock()
+	stats := m.stages[stage]
+	stats.inFlight++
+	stats.started++
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		stats.inFlight--
+		m.mu.Unlock()
+	}
+}
+
+// runInBackground runs fn on its own goroutine, counted as background work.
+// fn's context is cancelled when menuID is cancelled or deleted. Work on a
+// menu that is not being processed gets a fresh request budget; otherwise it
+// counts against the processing run.
+func runInBackground(menuID string, fn func(ctx context.Context)) {
+	jobStats.background.Add(1)
+	if !processingJobs.running(menuID) {
+		resetProviderBudget(menuID)
+	}
+	ctx, done := processingJobs.startTask(menuID)
+	go func() {
+		defer jobStats.background.Add(-1)
+		defer done()
+		fn(ctx)
+	}()
+}
+
+type JobMetricsResponse struct {
+	Pipelines         int64                         `json:"pipelines"`
+	DishWorkers       int64                         `json:"dish_workers"`
+	QueueDepth        int64                         `json:"queue_depth"`
+	WorkerSlotsInUse  int64                         `json:"worker_slots_in_use"`
+	WorkerSlotsTotal  int64                         `json:"worker_slots_total"`
+	Saturation        float64                       `json:"saturation"`
+	BackgroundJobs    int64                         `json:"background_jobs"`
+	ProviderThrottled int64                         `json:"provider_throttled"`
+	Stages            map[string]StageMetricsResult `json:"stages"`
+}
+
+type StageMetricsResult struct {
+	InFlight int64 `json:"in_flight"`
+	Started  int64 `json:"started"`
+}
+
+// snapshot reads the current values. Saturation is the share of dishPool's
+// worker slots in use.
+func (m *jobMetrics) snapshot() JobMetricsResponse {
+	response := JobMetricsResponse{
+		Pipelines:         m.pipelines.Load(),
+		DishWorkers:       m.workers.Load(),
+		QueueDepth:        m.queued.Load(),
+		WorkerSlotsInUse:  m.slotsInUse.Load(),
+		WorkerSlotsTotal:  m.slotsTotal.Load(),
+		BackgroundJobs:    m.background.Load(),
+		ProviderThrottled: m.throttled.Load(),
+		Stages:            make(map[string]StageMetricsResult, len(m.stages)),
+	}
+	if response.WorkerSlotsTotal > 0 {
+		response.Saturation = float64(response.WorkerSlotsInUse) / float64(response.WorkerSlotsTotal)
+	}
+
+	m.mu.Lock()
+	for name, stats := range m.stages {
+		response.Stages[name] = StageMetricsResult{InFlight: stats.inFlight, Started: stats.started}
+	}
+	m.mu.Unlock()
+	return response
+}
+
+func getJobMetricsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, jobStats.snapshot())
+}
+
+// prometheusMetricsHandler serves the same values in the Prometheus text
+// exposition format, for scraping with the admin token as a bearer token.
+func prometheusMetricsHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(formatPrometheusMetrics(jobStats.snapshot())))
+}
+
+func formatPrometheusMetrics(snapshot JobMetricsResponse) string {
+	var b strings.Builder
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+	}
+	metric("menugen_pipelines_active", "gauge", "Menus being processed.", float64(snapshot.Pipelines))
+	metric("menugen_dish_workers", "gauge", "Dish goroutines, waiting or running.", float64(snapshot.DishWorkers))
+	metric("menugen_dish_queue_depth", "gauge", "Dish goroutines waiting for a worker slot.", float64(snapshot.QueueDepth))
+	metric("menugen_worker_slots_in_use", "gauge", "Dish worker slots in use.", float64(snapshot.WorkerSlotsInUse))
+	metric("menugen_worker_slots_total", "gauge", "Dish worker slots in the shared pool.", float64(snapshot.WorkerSlotsTotal))
+	metric("menugen_worker_saturation", "gauge", "Share of dish worker slots in use.", snapshot.Saturation)
+	metric("menugen_background_jobs", "gauge", "Regenerations running in the background.", float64(snapshot.BackgroundJobs))
+	metric("menugen_provider_throttled_total", "counter", "Provider calls held back to stay within provider rate limits.", float64(snapshot.ProviderThrottled))
+
+	stages := make([]string, 0, len(snapshot.Stages))
+	for name := range snapshot.Stages {
+		stages = append(stages, name)
+	}
+	sort.Strings(stages)
+
+	b.WriteString("# HELP menugen_stage_in_flight Provider calls in flight by generation stage.\n# TYPE menugen_stage_in_flight gauge\n")
+	for _, name := range stages {
+		fmt.Fprintf(&b, "menugen_stage_in_flight{stage=%q} %d\n", name, snapshot.Stages[name].InFlight)
+	}
+	b.WriteString("# HELP menugen_stage_started_total Provider calls started by generation stage.\n# TYPE menugen_stage_started_total counter\n")
+	for _, name := range stages {
+		fmt.Fprintf(&b, "menugen_stage_started_total{stage=%q} %d\n", name, snapshot.Stages[name].Started)
+	}
+	return b.String()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// With MODERATION_ENABLED, generated descriptions and images go through
+// OpenAI's moderation endpoint before they are stored. Flagged content is
+// thrown away and generated again, up to MODERATION_MAX_ATTEMPTS generations
+// in all; when every attempt is flagged the generation fails with
+// errContentFlagged, and menu processing marks the dish FAILED with the
+// MODERATION code. A moderation request that fails fails the generation too,
+// so unchecked content is never served.
+
+const moderationModel = "omni-moderation-latest"
+
+// errContentFlagged is returned when every generated attempt was flagged.
+var errContentFlagged = errors.New("generated content was flagged by moderation")
+
+func moderationEnabled() bool {
+	return getEnvBool("MODERATION_ENABLED", false)
+}
+
+// moderationAttempts is how many times content is generated before giving
+// up on flagged results.
+func moderationAttempts() int {
+	return max(1, getEnvInt("MODERATION_MAX_ATTEMPTS", 3))
+}
+
+type moderationInput struct {
+	Type     string              `json:"type"`
+	Text     string              `json:"text,omitempty"`
+	ImageURL *moderationImageURL `json:"image_url,omitempty"`
+}
+
+type moderationImageURL struct {
+	URL string `json:"url"`
+}
+
+type moderationRequest struct {
+	Model string            `json:"model"`
+	Input []moderationInput `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderatedDescription runs generate until it writes a description
+// moderation allows.
+func moderatedDescription(ctx context.Context, menuID string, generate func() (string, *GenerationRecord, error)) (string, *GenerationRecord, error) {
+	if !moderationEnabled() {
+		return generate()
+	}
+
+	attempts := moderationAttempts()
+	for attempt := 1; ; attempt++ {
+		description, record, err := generate()
+		if err != nil {
+			return "", nil, err
+		}
+		categories, err := moderate(ctx, menuID, moderationInput{Type: "text", Text: description})
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to moderate description: %w", err)
+		}
+		if len(categories) == 0 {
+			record.Parameters["moderation_attempts"] = attempt
+			return description, record, nil
+		}
+
+		logFor(ctx).Warn("Generated description flagged by moderation", zap.String("menuID", menuID), zap.Strings("categories", categories), zap.Int("attempt", attempt))
+		if attempt >= attempts {
+			return "", nil, fmt.Errorf("%w: description flagged for %s", errContentFlagged, strings.Join(categories, ", "))
+		}
+	}
+}
+
+// moderatedImages runs generate until it makes at least one image moderation
+// allows, and returns the allowed ones.
+func moderatedImages(ctx context.Context, menuID string, generate func() ([]string, *GenerationRecord, error)) ([]string, *GenerationRecord, error) {
+	if !moderationEnabled() {
+		return generate()
+	}
+
+	attempts := moderationAttempts()
+	for attempt := 1; ; attempt++ {
+		imageURLs, record, err := generate()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var allowed, flagged []string
+		for _, imageURL := range imageURLs {
+			categories, err := moderate(ctx, menuID, moderationInput{Type: "image_url", ImageURL: &moderationImageURL{URL: imageURL}})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to moderate image: %w", err)
+			}
+			if len(categories) == 0 {
+				allowed = append(allowed, imageURL)
+				continue
+			}
+			logFor(ctx).Warn("Generated image flagged by moderation", zap.String("menuID", menuID), zap.Strings("categories", categories), zap.Int("attempt", attempt))
+			flagged = append(flagged, categories...)
+		}
+		if len(allowed) > 0 {
+			record.Parameters["moderation_attempts"] = attempt
+			return allowed, record, nil
+		}
+
+		if attempt >= attempts {
+			return nil, nil, fmt.Errorf("%w: image flagged for %s", errContentFlagged, strings.Join(flagged, ", "))
+		}
+	}
+}
+
+// moderate returns the categories moderation flags input for, or none when
+// it is allowed.
+func moderate(ctx context.Context, menuID string, input moderationInput) ([]string, error) {
+	defer jobStats.beginStage(stageModerate)()
+
+	openaiAPIKey := lookupOpenAIKey()
+	if openaiAPIKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not set")
+	}
+
+	jsonData, err := json.Marshal(moderationRequest{Model: moderationModel, Input: []moderationInput{input}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL()+"/v1/moderations", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+openaiAPIKey)
+
+	client := &http.Client{Timeout: loadProviderTimeouts().Description}
+	resp, err := callProvider(menuID, client, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OpenAI API error: %s", string(body))
+	}
+
+	var moderationResp moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&moderationResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	recordProviderUsage(menuID, "openai", moderationModel, 0, 0, 0)
+
+	if len(moderationResp.Results) == 0 {
+		return nil, fmt.Errorf("no results in moderation response")
+	}
+	var categories []string
+	for _, result := range moderationResp.Results {
+		if !result.Flagged {
+			continue
+		}
+		for category, flagged := range result.Categories {
+			if flagged {
+				categories = append(categories, category)
+			}
+		}
+		if len(categories) == 0 {
+			categories = append(categories, "unspecified")
+		}
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
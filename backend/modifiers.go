@@ -0,0 +1,146 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Modifiers are the options printed with a dish: add-ons such as "add
+// chicken +$4", and choices such as "choice of fries or salad", one modifier
+// per option with the options of one choice sharing a group. Add-ons printed
+// for a whole section ("add avocado to any salad +$2") are given to each of
+// its dishes. Prices are what the option adds to the dish's price, in the
+// dish's currency; included options have none.
+
+const (
+	ModifierTypeAddOn  = "add_on"
+	ModifierTypeChoice = "choice"
+)
+
+// DishModifier is one add-on or choice option of a dish.
+type DishModifier struct {
+	ID             string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DishID         string    `json:"dish_id" gorm:"type:uuid;index"`
+	MenuID         string    `json:"menu_id" gorm:"type:uuid;index"`
+	Type           string    `json:"type" gorm:"type:varchar(10)"`
+	Group          string    `json:"group" gorm:"column:modifier_group;type:varchar(50)"`
+	Name           string    `json:"name" gorm:"type:varchar(100)"`
+	PriceCents     *int      `json:"price_cents"`
+	RawPriceString *string   `json:"raw_price_string"`
+	Position       int       `json:"position"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DishModifierResponse is a modifier as returned with its dish.
+type DishModifierResponse struct {
+	Type           string  `json:"type"`
+	Group          string  `json:"group,omitempty"`
+	Name           string  `json:"name"`
+	PriceCents     *int    `json:"price_cents"`
+	RawPriceString *string `json:"raw_price_string"`
+}
+
+// StructuredModifier is a modifier as extracted from the menu image.
+type StructuredModifier struct {
+	Type  string  `json:"type"`
+	Group string  `json:"group"`
+	Name  string  `json:"name"`
+	Price *string `json:"price"`
+}
+
+const (
+	maxModifierGroupLength = 50
+	maxModifierNameLength  = 100
+)
+
+// newDishModifiers builds the modifiers of an extracted dish, its own
+// followed by its section's, priced in the dish's currency.
+func newDishModifiers(dish Dish, extracted ...[]StructuredModifier) []DishModifier {
+	var modifiers []DishModifier
+	for _, list := range extracted {
+		for _, modifier := range list {
+			modifierType := modifier.Type
+			if modifierType != ModifierTypeChoice {
+				modifierType = ModifierTypeAddOn
+			}
+			modifiers = append(modifiers, DishModifier{
+				ID:             idGen.NewID(),
+				DishID:         dish.ID,
+				MenuID:         dish.MenuID,
+				Type:           modifierType,
+				Group:          modifier.Group,
+				Name:           modifier.Name,
+				PriceCents:     optionPrice(modifier.Price, dish.Currency),
+				RawPriceString: modifier.Price,
+				Position:       len(modifiers),
+				CreatedAt:      clock.Now(),
+			})
+		}
+	}
+	return modifiers
+}
+
+// sanitizeModifiers cleans extracted modifiers in place, dropping those
+// without a name.
+func sanitizeModifiers(modifiers []StructuredModifier, limits sanitizeLimits) []StructuredModifier {
+	kept := modifiers[:0]
+	for _, modifier := range modifiers {
+		modifier.Name, _ = sanitizeText(modifier.Name, maxModifierNameLength)
+		if modifier.Name == "" {
+			continue
+		}
+		modifier.Group, _ = sanitizeText(modifier.Group, maxModifierGroupLength)
+		if modifier.Price != nil {
+			price, _ := sanitizeText(*modifier.Price, limits.PriceString)
+			modifier.Price = &price
+			if price == "" {
+				modifier.Price = nil
+			}
+		}
+		kept = append(kept, modifier)
+	}
+	return kept
+}
+
+// createDishModifiers stores the modifiers of a dish in tx.
+func createDishModifiers(tx *gorm.DB, modifiers []DishModifier) error {
+	if len(modifiers) == 0 {
+		return nil
+	}
+	return tx.Create(&modifiers).Error
+}
+
+// attachDishModifiers loads the modifiers of the menu's dishes for responses.
+func attachDishModifiers(menu *Menu) error {
+	var modifiers []DishModifier
+	if err := db.Where("menu_id = ?", menu.ID).Order("position").Find(&modifiers).Error; err != nil {
+		return err
+	}
+
+	byDish := make(map[string][]DishModifier)
+	for _, modifier := range modifiers {
+		byDish[modifier.DishID] = append(byDish[modifier.DishID], modifier)
+	}
+	for i := range menu.Dishes {
+		menu.Dishes[i].Modifiers = byDish[menu.Dishes[i].ID]
+	}
+	return nil
+}
+
+func toModifierResponses(modifiers []DishModifier) []DishModifierResponse {
+	if len(modifiers) == 0 {
+		return nil
+	}
+	responses := make([]DishModifierResponse, len(modifiers))
+	for i, modifier := range modifiers {
+		responses[i] = DishModifierResponse{
+			Type:           modifier.Type,
+			Group:          modifier.Group,
+			Name:           modifier.Name,
+			PriceCents:     modifier.PriceCents,
+			RawPriceString: modifier.RawPriceString,
+		}
+	}
+	return responses
+}
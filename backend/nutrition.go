@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// With NUTRITION_ESTIMATES_ENABLED, enhancement also estimates the calories
+// and macros of one typical portion of each dish. They are rough estimates
+// from the dish's name and description, not measurements, and are always
+// returned flagged as such.
+
+// DishNutrition is a dish's estimated nutrition per portion.
+type DishNutrition struct {
+	Calories     *int `json:"calories"`
+	ProteinGrams *int `json:"protein_grams"`
+	CarbsGrams   *int `json:"carbs_grams"`
+	FatGrams     *int `json:"fat_grams"`
+	Estimated    bool `json:"estimated"`
+}
+
+func nutritionEstimatesEnabled() bool {
+	return getEnvBool("NUTRITION_ESTIMATES_ENABLED", false)
+}
+
+// estimateNutrition adds the dish's estimated nutrition to updates, when
+// estimates are on. Failures are logged; the dish keeps its old estimates.
+func estimateNutrition(ctx context.Context, dish Dish, description string, updates map[string]interface{}) {
+	if !nutritionEstimatesEnabled() {
+		return
+	}
+
+	systemPrompt := "You are a nutritionist. From the dish name and description, estimate the calories and the grams of protein, carbohydrates, and fat " +
+		"in one typical restaurant portion of the dish. Give whole numbers."
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"calories":      map[string]interface{}{"type": "integer"},
+			"protein_grams": map[string]interface{}{"type": "integer"},
+			"carbs_grams":   map[string]interface{}{"type": "integer"},
+			"fat_grams":     map[string]interface{}{"type": "integer"},
+		},
+		"required": []string{"calories", "protein_grams", "carbs_grams", "fat_grams"},
+	}
+
+	var result struct {
+		Calories     int `json:"calories"`
+		ProteinGrams int `json:"protein_grams"`
+		CarbsGrams   int `json:"carbs_grams"`
+		FatGrams     int `json:"fat_grams"`
+	}
+	if err := classifyDish(ctx, dish.MenuID, "nutrition", systemPrompt, dishPrompt(dish.Name, description), schema, 60, &result); err != nil {
+		logFor(ctx).Warn("Failed to estimate nutrition", zap.String("dishID", dish.ID), zap.String("menuID", dish.MenuID), zap.Error(err))
+		return
+	}
+	if result.Calories <= 0 {
+		return
+	}
+
+	updates["calories"] = result.Calories
+	updates["protein_grams"] = max(result.ProteinGrams, 0)
+	updates["carbs_grams"] = max(result.CarbsGrams, 0)
+	updates["fat_grams"] = max(result.FatGrams, 0)
+}
+
+// dishNutrition returns the dish's estimated nutrition, or nil when it has
+// none.
+func dishNutrition(dish Dish) *DishNutrition {
+	if dish.Calories == nil {
+		return nil
+	}
+	return &DishNutrition{
+		Calories:     dish.Calories,
+		ProteinGrams: dish.ProteinGrams,
+		CarbsGrams:   dish.CarbsGrams,
+		FatGrams:     dish.FatGrams,
+		Estimated:    true,
+	}
+}
+
+// formatOptionalInt writes value, or "" when it is nil.
+func formatOptionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
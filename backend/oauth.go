@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an OAuth provider. A user can
+// have several, alongside or instead of a password.
+type UserIdentity struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    string    `json:"user_id" gorm:"type:uuid;index"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_user_identities_provider_subject"`
+	Subject   string    `json:"-" gorm:"uniqueIndex:idx_user_identities_provider_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// oauthProfile is what a provider tells us about the signed-in account.
+type oauthProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// oauthProvider is a supported login provider. Providers are enabled by
+// setting their client ID and secret.
+type oauthProvider struct {
+	Name     string
+	Endpoint oauth2.Endpoint
+	Scopes   []string
+	EnvKey   string
+	Profile  func(ctx context.Context, client *http.Client) (oauthProfile, error)
+}
+
+var oauthProviders = map[string]oauthProvider{
+	"google": {
+		Name:     "google",
+		Endpoint: endpoints.Google,
+		Scopes:   []string{"openid", "email", "profile"},
+		EnvKey:   "GOOGLE",
+		Profile:  fetchGoogleProfile,
+	},
+	"github": {
+		Name:     "github",
+		Endpoint: endpoints.GitHub,
+		Scopes:   []string{"read:user", "user:email"},
+		EnvKey:   "GITHUB",
+		Profile:  fetchGitHubProfile,
+	},
+}
+
+const (
+	oauthStateCookie = "menugen_oauth"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+// oauthState travels through the provider as the state parameter. It is
+// signed with the session key and bound to the browser that started the flow
+// by Nonce, the hash of the PKCE verifier kept in a cookie.
+type oauthState struct {
+	Provider    string `json:"provider"`
+	RedirectURI string `json:"redirect_uri,omitempty"`
+	LinkUserID  string `json:"link_user_id,omitempty"`
+	Nonce       string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// oauthConfig returns the provider's client configuration, or false when the
+// provider is unknown or not configured.
+func oauthConfig(name string) (oauthProvider, *oauth2.Config, bool) {
+	provider, ok := oauthProviders[name]
+	if !ok {
+		return provider, nil, false
+	}
+	clientID := os.Getenv(provider.EnvKey + "_CLIENT_ID")
+	clientSecret := os.Getenv(provider.EnvKey + "_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return provider, nil, false
+	}
+	return provider, &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     provider.Endpoint,
+		Scopes:       provider.Scopes,
+		RedirectURL:  strings.TrimRight(os.Getenv("OAUTH_CALLBACK_BASE_URL"), "/") + "/api/auth/oauth/" + name + "/callback",
+	}, true
+}
+
+// oauthRedirectAllowed reports whether the frontend URL may receive session
+// tokens. It must have the scheme and host of one of OAUTH_REDIRECT_URLS,
+// and a path under that URL's, ending at a slash: https://app.example.com
+// allows https://app.example.com/login but not https://app.example.com.evil.net.
+func oauthRedirectAllowed(redirectURI string) bool {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" || parsed.User != nil {
+		return false
+	}
+	for _, entry := range strings.Split(os.Getenv("OAUTH_REDIRECT_URLS"), ",") {
+		allowed, err := url.Parse(strings.TrimSpace(entry))
+		if err != nil || allowed.Host == "" {
+			continue
+		}
+		if !strings.EqualFold(parsed.Scheme, allowed.Scheme) || !strings.EqualFold(parsed.Host, allowed.Host) {
+			continue
+		}
+		prefix := strings.TrimSuffix(allowed.Path, "/")
+		if parsed.Path == prefix || strings.HasPrefix(parsed.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// startOAuthHandler sends the browser to the provider's consent page. A
+// signed-in user (access_token query parameter) links the provider account
+// to their user instead of signing in.
+func startOAuthHandler(c *gin.Context) {
+	provider, config, ok := oauthConfig(c.Param("provider"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "OAUTH_PROVIDER_NOT_FOUND", "Login provider is not available")
+		return
+	}
+	secret, err := sessionSecret()
+	if err != nil {
+		respondError(c, http.StatusServiceUnavailable, "ACCOUNTS_DISABLED", "Accounts are not enabled on this server")
+		return
+	}
+
+	redirectURI := c.Query("redirect_uri")
+	if redirectURI != "" && !oauthRedirectAllowed(redirectURI) {
+		respondFieldError(c, "redirect_uri", "oneof", "redirect_uri is not an allowed frontend URL")
+		return
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	now := clock.Now()
+	state, err := jwt.NewWithClaims(jwt.SigningMethodHS256, oauthState{
+		Provider:    provider.Name,
+		RedirectURI: redirectURI,
+		LinkUserID:  currentUserID(c),
+		Nonce:       oauthNonce(verifier),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    sessionIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oauthStateTTL)),
+		},
+	}).SignedString(secret)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start login")
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, verifier, int(oauthStateTTL.Seconds()), "/api/auth/oauth/", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)))
+}
+
+func oauthNonce(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return hex.EncodeToString(sum[:])
+}
+
+// oauthCallbackHandler finishes the flow: it exchanges the code, finds or
+// creates the user, and hands a session token to the frontend in the
+// redirect's URL fragment, or as JSON when no redirect was requested.
+func oauthCallbackHandler(c *gin.Context) {
+	provider, config, ok := oauthConfig(c.Param("provider"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "OAUTH_PROVIDER_NOT_FOUND", "Login provider is not available")
+		return
+	}
+
+	state, verifier, err := verifyOAuthState(c, provider.Name)
+	if err != nil {
+		zapLog.Info("Rejected OAuth callback", zap.String("provider", provider.Name), zap.Error(err))
+		respondError(c, http.StatusBadRequest, "INVALID_OAUTH_STATE", "Login expired or was started in another browser; please try again")
+		return
+	}
+	c.SetCookie(oauthStateCookie, "", -1, "/api/auth/oauth/", "", c.Request.TLS != nil, true)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		respondOAuthError(c, state, http.StatusUnauthorized, "OAUTH_DENIED", "Login was cancelled at "+provider.Name)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	token, err := config.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		zapLog.Warn("OAuth code exchange failed", zap.String("provider", provider.Name), zap.Error(err))
+		respondOAuthError(c, state, http.StatusBadGateway, "OAUTH_FAILED", "Could not complete login with "+provider.Name)
+		return
+	}
+	profile, err := provider.Profile(ctx, config.Client(ctx, token))
+	if err != nil {
+		zapLog.Warn("Failed to fetch OAuth profile", zap.String("provider", provider.Name), zap.Error(err))
+		respondOAuthError(c, state, http.StatusBadGateway, "OAUTH_FAILED", "Could not complete login with "+provider.Name)
+		return
+	}
+
+	user, err := resolveOAuthUser(provider.Name, profile, state.LinkUserID)
+	if errors.Is(err, errIdentityLinked) {
+		respondOAuthError(c, state, http.StatusConflict, "IDENTITY_ALREADY_LINKED", "This "+provider.Name+" account is linked to another user")
+		return
+	}
+	if errors.Is(err, errAccountExists) {
+		respondOAuthError(c, state, http.StatusConflict, "ACCOUNT_EXISTS", "An account with this email exists; sign in with its password and link "+provider.Name+" from there")
+		return
+	}
+	if err != nil {
+		zapLog.Error("Failed to resolve OAuth user", zap.String("provider", provider.Name), zap.Error(err))
+		respondOAuthError(c, state, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to sign in")
+		return
+	}
+
+	session, err := issueSession(*user)
+	if err != nil {
+		respondOAuthError(c, state, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start session")
+		return
+	}
+	if state.RedirectURI == "" {
+		c.JSON(http.StatusOK, session)
+		return
+	}
+	fragment := url.Values{
+		"token":      {session.Token},
+		"expires_at": {session.ExpiresAt.UTC().Format(time.RFC3339)},
+	}
+	c.Redirect(http.StatusFound, state.RedirectURI+"#"+fragment.Encode())
+}
+
+// verifyOAuthState checks the state's signature and expiry and that it was
+// issued to this browser, and returns it with the browser's PKCE verifier.
+func verifyOAuthState(c *gin.Context, provider string) (*oauthState, string, error) {
+	secret, err := sessionSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	var state oauthState
+	_, err = jwt.ParseWithClaims(c.Query("state"), &state, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(sessionIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(clock.Now),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	if state.Provider != provider {
+		return nil, "", fmt.Errorf("state was issued for %s", state.Provider)
+	}
+	verifier, err := c.Cookie(oauthStateCookie)
+	if err != nil || oauthNonce(verifier) != state.Nonce {
+		return nil, "", errors.New("state does not match the browser's login cookie")
+	}
+	return &state, verifier, nil
+}
+
+// respondOAuthError reports a failed login to the frontend that started it,
+// as error and error_description fragment parameters, or as a JSON error.
+func respondOAuthError(c *gin.Context, state *oauthState, status int, code, message string) {
+	if state.RedirectURI == "" {
+		respondError(c, status, code, message)
+		return
+	}
+	fragment := url.Values{"error": {code}, "error_description": {message}}
+	c.Redirect(http.StatusFound, state.RedirectURI+"#"+fragment.Encode())
+}
+
+var errIdentityLinked = errors.New("identity is linked to another user")
+
+// errAccountExists is returned for a provider account whose email belongs to
+// a user that registered it with a password. Anyone can register any email,
+// so joining them could hand the account to whoever registered it first; the
+// user signs in with the password and links the provider instead.
+var errAccountExists = errors.New("email belongs to an account with unverified email")
+
+// resolveOAuthUser returns the user for a provider account. A known identity
+// signs in its user. Otherwise the identity is linked to linkUserID when
+// given, or to the user with the same email when both the provider and that
+// user's account verified it, or to a new user.
+func resolveOAuthUser(provider string, profile oauthProfile, linkUserID string) (*User, error) {
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var identity UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, profile.Subject).First(&identity).Error
+		if err == nil {
+			if linkUserID != "" && identity.UserID != linkUserID {
+				return errIdentityLinked
+			}
+			return tx.Where("id = ?", identity.UserID).First(&user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		email := normalizeEmail(profile.Email)
+		switch {
+		case linkUserID != "":
+			err = tx.Where("id = ?", linkUserID).First(&user).Error
+		case email != "" && profile.EmailVerified:
+			err = tx.Where("email = ?", email).First(&user).Error
+		default:
+			err = gorm.ErrRecordNotFound
+		}
+		if err == nil && linkUserID == "" && !user.EmailVerified {
+			return errAccountExists
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if linkUserID != "" {
+				return fmt.Errorf("user %s to link no longer exists", linkUserID)
+			}
+			now := clock.Now()
+			user = User{ID: idGen.NewID(), Name: profile.Name, CreatedAt: now, UpdatedAt: now}
+			if profile.EmailVerified {
+				// Unverified addresses must not claim the email of a future
+				// password account
+				user.Email = email
+				user.EmailVerified = true
+			}
+			err = tx.Create(&user).Error
+		} else if err == nil && !user.EmailVerified && profile.EmailVerified && email != "" && email == user.Email {
+			// Linking by hand proves the user holds the provider account,
+			// and the provider vouches for the email
+			user.EmailVerified = true
+			err = tx.Model(&user).Update("email_verified", true).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&UserIdentity{
+			ID:        idGen.NewID(),
+			UserID:    user.ID,
+			Provider:  provider,
+			Subject:   profile.Subject,
+			Email:     email,
+			CreatedAt: clock.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func fetchGoogleProfile(ctx context.Context, client *http.Client) (oauthProfile, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := getOAuthJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return oauthProfile{}, err
+	}
+	if info.Sub == "" {
+		return oauthProfile{}, errors.New("userinfo has no subject")
+	}
+	return oauthProfile{Subject: info.Sub, Email: info.Email, EmailVerified: info.EmailVerified, Name: info.Name}, nil
+}
+
+// fetchGitHubProfile reads the account and its primary email, which GitHub
+// only includes in the profile when the user made it public.
+func fetchGitHubProfile(ctx context.Context, client *http.Client) (oauthProfile, error) {
+	var account struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getOAuthJSON(ctx, client, "https://api.github.com/user", &account); err != nil {
+		return oauthProfile{}, err
+	}
+	if account.ID == 0 {
+		return oauthProfile{}, errors.New("user has no id")
+	}
+	profile := oauthProfile{Subject: fmt.Sprint(account.ID), Name: account.Name}
+	if profile.Name == "" {
+		profile.Name = account.Login
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getOAuthJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return oauthProfile{}, err
+	}
+	for _, email := range emails {
+		if email.Primary {
+			profile.Email = email.Email
+			profile.EmailVerified = email.Verified
+		}
+	}
+	return profile, nil
+}
+
+func getOAuthJSON(ctx context.Context, client *http.Client, endpoint string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// listIdentitiesHandler lists the provider accounts linked to the signed-in
+// user.
+func listIdentitiesHandler(c *gin.Context) {
+	identities := []UserIdentity{}
+	if err := db.Where("user_id = ?", currentUserID(c)).Order("created_at").Find(&identities).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load linked accounts")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestOAuthRedirectAllowed(t *testing.T) {
+	t.Setenv("OAUTH_REDIRECT_URLS", "https://app.example.com, http://localhost:5173/app/")
+	for redirectURI, want := range map[string]bool{
+		"https://app.example.com":           true,
+		"https://app.example.com/login":     true,
+		"https://APP.example.com/login":     true,
+		"http://localhost:5173/app":         true,
+		"http://localhost:5173/app/login":   true,
+		"https://app.example.com.evil.net/": false,
+		"https://app.example.com@evil.net/": false,
+		"https://user@app.example.com/":     false,
+		"http://app.example.com/":           false,
+		"https://app.example.com:8443/":     false,
+		"http://localhost:5173/apple":       false,
+		"http://localhost:5174/app/":        false,
+		"javascript:alert(1)":               false,
+	} {
+		if got := oauthRedirectAllowed(redirectURI); got != want {
+			t.Errorf("oauthRedirectAllowed(%q) = %v, want %v", redirectURI, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// finishReasonLength is the finish_reason of an answer cut off at max_tokens.
+const finishReasonLength = "length"
+
+// errOutputTruncated is returned for answers cut off at max_tokens, which
+// are not kept: a partial structure would pass for a complete one.
+var errOutputTruncated = errors.New("model output cut off at the token limit")
+
+// structuredRequest is a gpt-4o-mini request whose answer is JSON in the
+// shape Schema describes.
+type structuredRequest struct {
+	Stage        string
+	SchemaName   string
+	SystemPrompt string
+	UserPrompt   string
+	Schema       map[string]interface{}
+	MaxTokens    int
+	Timeout      time.Duration
+}
+
+// requestStructured sends r to OpenAI and decodes the answer into result.
+func requestStructured(ctx context.Context, menuID string, r structuredRequest, result interface{}) error {
+	defer jobStats.beginStage(r.Stage)()
+
+	openaiAPIKey := lookupOpenAIKey()
+	if openaiAPIKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY not set")
+	}
+
+	request := OpenAITextRequest{
+		Model: "gpt-4o-mini",
+		Messages: []OpenAITextMessage{
+			{Role: "system", Content: r.SystemPrompt},
+			{Role: "user", Content: r.UserPrompt},
+		},
+		ResponseFormat: &OpenAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: OpenAIJSONSchema{Name: r.SchemaName, Schema: r.Schema},
+		},
+		MaxTokens: r.MaxTokens,
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL()+"/v1/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+openaiAPIKey)
+
+	client := &http.Client{Timeout: r.Timeout}
+	resp, err := callProvider(menuID, client, req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("OpenAI API error: %s", string(body))
+	}
+
+	var openaiResp OpenAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	recordProviderUsage(menuID, "openai", request.Model, openaiResp.Usage.PromptTokens, openaiResp.Usage.CompletionTokens, 0)
+
+	if len(openaiResp.Choices) == 0 {
+		return fmt.Errorf("no choices in OpenAI response")
+	}
+	if openaiResp.Choices[0].FinishReason == finishReasonLength {
+		return fmt.Errorf("%s: %w at %d tokens", r.SchemaName, errOutputTruncated, r.MaxTokens)
+	}
+	content := openaiResp.Choices[0].Message.Content
+	if err := json.Unmarshal([]byte(content), result); err != nil {
+		if !jsonRepairEnabled() || json.Unmarshal([]byte(repairJSON(content)), result) != nil {
+			return fmt.Errorf("failed to unmarshal %s: %w", r.SchemaName, err)
+		}
+	}
+	return nil
+}
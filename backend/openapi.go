@@ -0,0 +1,813 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiOperation documents one route for the OpenAPI spec. Request and
+// response schemas are derived from the same Go types the handlers bind and
+// return, so the spec cannot drift from the code; `admin check-openapi`
+// makes sure every route is listed here.
+type apiOperation struct {
+	Method  string
+	Path    string // gin path, e.g. /api/menu/:id
+	Tag     string
+	Summary string
+	// Admin operations need the admin token, Public ones no credentials,
+	// and all others an API key. Login operations also need a session
+	// token, which the others accept to identify the user.
+	Admin  bool
+	Public bool
+	Login  bool
+	Query  []apiParam
+	Header []apiParam
+	// Request is the JSON body, if any.
+	Request reflect.Type
+	Status  int
+	// Response is the JSON body returned with Status, or nil when the
+	// operation returns no JSON (see Content).
+	Response reflect.Type
+	// Content lists the non-JSON media types returned with Status.
+	Content []string
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Enum        []string
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/api/config", Tag: "config", Summary: "Get client configuration", Public: true, Status: 200, Response: reflect.TypeOf(struct {
+		ImageGenerationEnabled bool `json:"image_generation_enabled"`
+	}{})},
+	{Method: "GET", Path: "/api/errors", Tag: "config", Summary: "List the error, failure, and warning codes the API uses", Public: true, Status: 200, Response: reflect.TypeOf(struct {
+		Codes []ErrorCode `json:"codes"`
+	}{})},
+	{Method: "GET", Path: "/api/graphql", Tag: "graphql", Summary: "Run a GraphQL query", Status: 200, Query: []apiParam{
+		{Name: "query", Description: "The GraphQL query"},
+		{Name: "operationName", Description: "Operation to run when the query has several"},
+		{Name: "variables", Description: "Variables as a JSON object"},
+	}, Response: typeOf[interface{}]()},
+	{Method: "POST", Path: "/api/graphql", Tag: "graphql", Summary: "Run a GraphQL query", Request: typeOf[GraphQLRequest](), Status: 200, Response: typeOf[interface{}]()},
+
+	// Accounts
+	{Method: "POST", Path: "/api/auth/register", Tag: "accounts", Summary: "Create an account", Request: typeOf[RegisterRequest](), Status: 201, Response: typeOf[SessionResponse]()},
+	{Method: "POST", Path: "/api/auth/login", Tag: "accounts", Summary: "Sign in", Request: typeOf[LoginRequest](), Status: 200, Response: typeOf[SessionResponse]()},
+	{Method: "GET", Path: "/api/auth/me", Tag: "accounts", Summary: "Get the signed-in user", Login: true, Status: 200, Response: typeOf[User]()},
+	{Method: "GET", Path: "/api/auth/identities", Tag: "accounts", Summary: "List linked provider accounts", Login: true, Status: 200, Response: reflect.TypeOf(struct {
+		Identities []UserIdentity `json:"identities"`
+	}{})},
+	{Method: "GET", Path: "/api/auth/oauth/:provider/start", Tag: "accounts", Summary: "Sign in with google or github; a signed-in caller links the account instead", Public: true, Status: 302, Query: []apiParam{
+		{Name: "redirect_uri", Description: "Frontend URL that receives the session as #token=...&expires_at=...; must be listed in OAUTH_REDIRECT_URLS"},
+		{Name: "access_token", Description: "Session token of the user to link the provider account to"},
+	}},
+	{Method: "GET", Path: "/api/auth/oauth/:provider/callback", Tag: "accounts", Summary: "Provider redirect target; redirects to redirect_uri, or returns a SessionResponse when there is none", Public: true, Status: 302, Query: []apiParam{
+		{Name: "code"},
+		{Name: "state"},
+	}},
+
+	// Restaurants
+	{Method: "GET", Path: "/api/restaurants", Tag: "restaurants", Summary: "List the signed-in user's restaurants", Login: true, Status: 200, Response: reflect.TypeOf(struct {
+		Restaurants []Restaurant `json:"restaurants"`
+	}{})},
+	{Method: "POST", Path: "/api/restaurants", Tag: "restaurants", Summary: "Create a restaurant", Login: true, Request: typeOf[RestaurantCreateRequest](), Status: 201, Response: typeOf[Restaurant]()},
+	{Method: "GET", Path: "/api/restaurants/:id", Tag: "restaurants", Summary: "Get a restaurant", Login: true, Status: 200, Response: typeOf[Restaurant]()},
+	{Method: "PATCH", Path: "/api/restaurants/:id", Tag: "restaurants", Summary: "Update a restaurant", Login: true, Request: typeOf[RestaurantUpdateRequest](), Status: 200, Response: typeOf[Restaurant]()},
+	{Method: "DELETE", Path: "/api/restaurants/:id", Tag: "restaurants", Summary: "Delete a restaurant, keeping its menus", Login: true, Status: 204},
+	{Method: "GET", Path: "/api/restaurants/:id/members", Tag: "restaurants", Summary: "List a restaurant's members and their roles", Login: true, Status: 200, Response: reflect.TypeOf(struct {
+		Members []RestaurantMemberResponse `json:"members"`
+	}{})},
+	{Method: "POST", Path: "/api/restaurants/:id/members", Tag: "restaurants", Summary: "Add a user to a restaurant by email (owners only)", Login: true, Request: typeOf[MemberInviteRequest](), Status: 201, Response: typeOf[RestaurantMemberResponse]()},
+	{Method: "PATCH", Path: "/api/restaurants/:id/members/:userId", Tag: "restaurants", Summary: "Change a member's role (owners only)", Login: true, Request: typeOf[MemberUpdateRequest](), Status: 200, Response: typeOf[RestaurantMemberResponse]()},
+	{Method: "DELETE", Path: "/api/restaurants/:id/members/:userId", Tag: "restaurants", Summary: "Remove a member, or leave a restaurant", Login: true, Status: 204},
+
+	{Method: "GET", Path: "/api/quota", Tag: "config", Summary: "Get the API key's quota and what is left of it this month", Status: 200, Response: typeOf[QuotaResponse]()},
+
+	// Menus
+	{Method: "GET", Path: "/api/menus", Tag: "menus", Summary: "List the signed-in user's menus", Login: true, Status: 200, Query: []apiParam{
+		{Name: "limit", Description: "At most 100; defaults to 20"},
+		{Name: "page_token", Description: "next_page_token from the previous page"},
+		{Name: "status", Description: "Only menus with this status", Enum: []string{"PENDING", "PROCESSING", "AWAITING_REVIEW", "COMPLETE", "FAILED"}},
+		{Name: "restaurant_id", Description: "Only menus of this restaurant"},
+	}, Response: reflect.TypeOf(struct {
+		Menus         []MenuSummary `json:"menus"`
+		NextPageToken string        `json:"next_page_token"`
+	}{})},
+	{Method: "POST", Path: "/api/menu", Tag: "menus", Summary: "Upload a menu photo", Status: 202, Header: []apiParam{
+		{Name: "Idempotency-Key", Description: "Retries with the same key within 24 hours return the first upload's response instead of creating another menu"},
+	}, Response: typeOf[MenuUploadResponse]()},
+	{Method: "GET", Path: "/api/menu/:id", Tag: "menus", Summary: "Get a menu's status, sections, and dishes", Status: 200, Query: []apiParam{
+		{Name: "tag", Description: "Only dishes with this dietary tag; repeat or comma-separate for dishes with all of them", Enum: dietaryTags},
+		{Name: "lang", Description: "Return the menu translated into this language, e.g. es; answers 404 TRANSLATION_NOT_FOUND until it is translated"},
+	}, Header: []apiParam{
+		{Name: "If-None-Match", Description: "An ETag from an earlier response; answers 304 Not Modified while the menu is unchanged"},
+	}, Response: typeOf[MenuStatusResponse]()},
+	{Method: "GET", Path: "/api/menu/:id/events", Tag: "menus", Summary: "Stream menu status as server-sent events", Status: 200, Content: []string{"text/event-stream"}},
+	{Method: "DELETE", Path: "/api/menu/:id", Tag: "menus", Summary: "Delete a menu", Status: 204},
+	{Method: "PUT", Path: "/api/menu/:id/restaurant", Tag: "restaurants", Summary: "Move a menu into or out of a restaurant", Login: true, Request: typeOf[MenuRestaurantRequest](), Status: 200, Response: typeOf[MenuSummary]()},
+	{Method: "GET", Path: "/api/menu/:id/export", Tag: "menus", Summary: "Export a menu", Status: 200, Query: []apiParam{
+		{Name: "format", Description: "Defaults to accessible-html", Enum: []string{"accessible-html", "html", "json-ld", "large-print-pdf", "pdf", "csv", "json"}},
+		{Name: "snippet", Description: "With json-ld, return only the <script> tag", Enum: []string{"true"}},
+		{Name: "images", Description: "With json, link or embed dish images", Enum: []string{"reference", "embed"}},
+	}, Response: typeOf[MenuBackup](), Content: []string{"text/html", "text/plain", "application/ld+json", "application/pdf", "text/csv"}},
+	{Method: "POST", Path: "/api/menu/:id/translate", Tag: "menus", Summary: "Translate a menu's sections and dishes into another language", Status: 200, Query: []apiParam{
+		{Name: "lang", Description: "BCP 47 language tag, e.g. es or pt-BR"},
+	}, Response: typeOf[MenuTranslationResponse]()},
+	{Method: "POST", Path: "/api/menu/:id/approve", Tag: "menus", Summary: "Approve a reviewed menu and start generating its descriptions and images", Status: 202, Response: typeOf[MenuUploadResponse]()},
+	{Method: "GET", Path: "/api/menu/:id/diff", Tag: "menus", Summary: "Compare a menu with another menu or an older version", Status: 200, Query: []apiParam{
+		{Name: "against", Description: "ID of the baseline menu"},
+		{Name: "version", Description: "Baseline version of this menu"},
+	}, Response: typeOf[MenuDiffResponse]()},
+	{Method: "POST", Path: "/api/menu/:id/reorder", Tag: "menus", Summary: "Apply a full section and dish layout", Request: typeOf[MenuReorderRequest](), Status: 200, Response: reflect.TypeOf(struct {
+		Sections []MenuSectionResponse `json:"sections"`
+		Dishes   []DishResponse        `json:"dishes"`
+	}{})},
+	{Method: "GET", Path: "/api/menu/:id/feedback", Tag: "feedback", Summary: "Summarize diner feedback per dish", Status: 200, Response: reflect.TypeOf(struct {
+		MenuID string                `json:"menu_id"`
+		Dishes []DishFeedbackSummary `json:"dishes"`
+	}{})},
+
+	// Share links
+	{Method: "GET", Path: "/api/menu/:id/shares", Tag: "shares", Summary: "List a menu's share links", Status: 200, Response: reflect.TypeOf(struct {
+		Shares []MenuShareResponse `json:"shares"`
+	}{})},
+	{Method: "POST", Path: "/api/menu/:id/share", Tag: "shares", Summary: "Create a share link", Status: 201, Response: typeOf[MenuShareResponse]()},
+	{Method: "DELETE", Path: "/api/menu/:id/share/:slug", Tag: "shares", Summary: "Revoke a share link", Status: 200, Response: typeOf[MenuShareResponse]()},
+
+	// Dishes
+	{Method: "PATCH", Path: "/api/menu/:id/dishes/:dishId", Tag: "dishes", Summary: "Edit a dish", Request: typeOf[DishUpdateRequest](), Status: 200, Response: typeOf[DishResponse]()},
+	{Method: "POST", Path: "/api/menu/:id/dishes/:dishId/regenerate-image", Tag: "dishes", Summary: "Regenerate a dish's image", Request: typeOf[RegenerateImageRequest](), Status: 202, Response: typeOf[RegenerateResponse]()},
+	{Method: "POST", Path: "/api/menu/:id/dishes/:dishId/regenerate-description", Tag: "dishes", Summary: "Regenerate a dish's description", Request: typeOf[RegenerateDescriptionRequest](), Status: 202, Response: typeOf[RegenerateResponse]()},
+	{Method: "GET", Path: "/api/menu/:id/dishes/:dishId/images", Tag: "dishes", Summary: "List a dish's image candidates", Status: 200, Response: reflect.TypeOf(struct {
+		DishID string      `json:"dish_id"`
+		Images []DishImage `json:"images"`
+	}{})},
+	{Method: "POST", Path: "/api/menu/:id/dishes/:dishId/images", Tag: "dishes", Summary: "Generate image candidates", Request: typeOf[GenerateImagesRequest](), Status: 202, Response: typeOf[RegenerateResponse]()},
+	{Method: "POST", Path: "/api/menu/:id/dishes/:dishId/images/:imageId/select", Tag: "dishes", Summary: "Make an image candidate the dish's image", Status: 200, Response: typeOf[DishImage]()},
+	{Method: "GET", Path: "/api/menu/:id/dishes/:dishId/renditions", Tag: "dishes", Summary: "List a dish's renditions", Status: 200, Response: reflect.TypeOf(struct {
+		Renditions []DishRendition `json:"renditions"`
+	}{})},
+	{Method: "POST", Path: "/api/menu/:id/dishes/:dishId/renditions", Tag: "dishes", Summary: "Generate renditions", Request: typeOf[GenerateRenditionsRequest](), Status: 202, Response: typeOf[RegenerateResponse]()},
+	{Method: "POST", Path: "/api/menu/:id/dishes/:dishId/upscale", Tag: "dishes", Summary: "Upscale a dish's image", Request: typeOf[UpscaleImageRequest](), Status: 202, Response: typeOf[RegenerateResponse]()},
+	{Method: "POST", Path: "/api/dish/:id/feedback", Tag: "feedback", Summary: "Vote on a dish's description or image", Request: typeOf[DishFeedbackRequest](), Status: 201, Response: typeOf[DishFeedback]()},
+	{Method: "POST", Path: "/api/dish/:id/social", Tag: "dishes", Summary: "Write a social media post for a dish", Request: typeOf[SocialPostRequest](), Status: 200, Response: typeOf[SocialPostResponse]()},
+
+	// Versions and revisions
+	{Method: "GET", Path: "/api/menu/:id/versions", Tag: "versions", Summary: "List a menu's versions", Status: 200, Response: reflect.TypeOf(struct {
+		MenuID   string               `json:"menu_id"`
+		Versions []MenuVersionSummary `json:"versions"`
+	}{})},
+	{Method: "GET", Path: "/api/menu/:id/versions/:version", Tag: "versions", Summary: "Get a version's snapshot", Status: 200, Response: typeOf[MenuVersion]()},
+	{Method: "POST", Path: "/api/menu/:id/versions/:version/restore", Tag: "versions", Summary: "Restore a version", Status: 200, Response: typeOf[MenuStatusResponse]()},
+	{Method: "GET", Path: "/api/menu/:id/revisions", Tag: "revisions", Summary: "List a menu's revisions", Status: 200, Response: reflect.TypeOf(struct {
+		MenuID            string                `json:"menu_id"`
+		PublishedRevision *int                  `json:"published_revision"`
+		DraftRevision     *int                  `json:"draft_revision"`
+		Revisions         []MenuRevisionSummary `json:"revisions"`
+	}{})},
+	{Method: "GET", Path: "/api/menu/:id/revisions/:rev", Tag: "revisions", Summary: "Get a revision's content", Status: 200, Response: typeOf[MenuRevision]()},
+	{Method: "POST", Path: "/api/menu/:id/revisions/:rev/publish", Tag: "revisions", Summary: "Publish a revision", Status: 200, Response: typeOf[MenuRevisionSummary]()},
+	{Method: "DELETE", Path: "/api/menu/:id/revisions/:rev", Tag: "revisions", Summary: "Discard the draft revision", Status: 204},
+
+	// Sections
+	{Method: "GET", Path: "/api/menu/:id/sections", Tag: "sections", Summary: "List a menu's sections", Status: 200, Response: reflect.TypeOf(struct {
+		Sections []MenuSectionResponse `json:"sections"`
+	}{})},
+	{Method: "POST", Path: "/api/menu/:id/sections", Tag: "sections", Summary: "Create a section", Request: typeOf[SectionCreateRequest](), Status: 201, Response: typeOf[MenuSectionResponse]()},
+	{Method: "PATCH", Path: "/api/menu/:id/sections/:sectionId", Tag: "sections", Summary: "Rename or move a section", Request: typeOf[SectionUpdateRequest](), Status: 200, Response: typeOf[MenuSectionResponse]()},
+	{Method: "DELETE", Path: "/api/menu/:id/sections/:sectionId", Tag: "sections", Summary: "Delete a section", Status: 204, Query: []apiParam{
+		{Name: "move_dishes_to", Description: "Section that receives the deleted section's dishes"},
+	}},
+	{Method: "POST", Path: "/api/menu/:id/sections/:sectionId/dishes", Tag: "sections", Summary: "Move dishes into a section", Request: typeOf[SectionMoveDishesRequest](), Status: 200, Response: reflect.TypeOf(struct {
+		Section MenuSectionResponse `json:"section"`
+		Dishes  []DishResponse      `json:"dishes"`
+	}{})},
+
+	// Webhooks
+	{Method: "GET", Path: "/api/webhooks", Tag: "webhooks", Summary: "List webhooks", Status: 200, Response: reflect.TypeOf(struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}{})},
+	{Method: "POST", Path: "/api/webhooks", Tag: "webhooks", Summary: "Register a webhook", Request: typeOf[WebhookCreateRequest](), Status: 201, Response: reflect.TypeOf(struct {
+		Webhook Webhook `json:"webhook"`
+		Secret  string  `json:"secret"`
+	}{})},
+	{Method: "GET", Path: "/api/webhooks/:id", Tag: "webhooks", Summary: "Get a webhook", Status: 200, Response: typeOf[Webhook]()},
+	{Method: "PATCH", Path: "/api/webhooks/:id", Tag: "webhooks", Summary: "Update a webhook", Request: typeOf[WebhookUpdateRequest](), Status: 200, Response: typeOf[Webhook]()},
+	{Method: "DELETE", Path: "/api/webhooks/:id", Tag: "webhooks", Summary: "Delete a webhook", Status: 204},
+	{Method: "GET", Path: "/api/webhooks/:id/deliveries", Tag: "webhooks", Summary: "List a webhook's deliveries", Status: 200, Response: reflect.TypeOf(struct {
+		WebhookID  string            `json:"webhook_id"`
+		Deliveries []WebhookDelivery `json:"deliveries"`
+	}{})},
+	{Method: "POST", Path: "/api/webhooks/:id/deliveries/:deliveryId/redeliver", Tag: "webhooks", Summary: "Send a delivery again", Status: 200, Response: typeOf[WebhookDelivery]()},
+
+	// Admin
+	{Method: "GET", Path: "/api/admin/dishes/:id/generation", Tag: "admin", Summary: "Show how a dish's content was generated", Admin: true, Status: 200, Response: reflect.TypeOf(struct {
+		DishID             string              `json:"dish_id"`
+		MenuID             string              `json:"menu_id"`
+		Name               string              `json:"name"`
+		GenerationMetadata *GenerationMetadata `json:"generation_metadata"`
+	}{})},
+	{Method: "GET", Path: "/api/admin/spend", Tag: "admin", Summary: "Report provider spend", Admin: true, Status: 200, Query: []apiParam{
+		{Name: "from", Description: "First day (YYYY-MM-DD), defaults to 29 days before to"},
+		{Name: "to", Description: "Last day (YYYY-MM-DD), defaults to today"},
+	}, Response: typeOf[SpendResponse]()},
+	{Method: "GET", Path: "/api/admin/usage", Tag: "admin", Summary: "Report daily menus, dishes, tokens, images, failures, and cost", Admin: true, Status: 200, Query: []apiParam{
+		{Name: "from", Description: "First day (YYYY-MM-DD), defaults to 29 days before to"},
+		{Name: "to", Description: "Last day (YYYY-MM-DD), defaults to today; at most 366 days after from"},
+	}, Response: typeOf[UsageResponse]()},
+	{Method: "GET", Path: "/api/admin/stats", Tag: "admin", Summary: "Report daily uploads, success rate, processing time, and failure codes", Admin: true, Status: 200, Query: []apiParam{
+		{Name: "from", Description: "First day (YYYY-MM-DD), defaults to 29 days before to"},
+		{Name: "to", Description: "Last day (YYYY-MM-DD), defaults to today; at most 366 days after from"},
+	}, Response: typeOf[StatsResponse]()},
+	{Method: "GET", Path: "/api/admin/locks", Tag: "admin", Summary: "List job locks", Admin: true, Status: 200, Response: reflect.TypeOf(struct {
+		Instance string    `json:"instance"`
+		Locks    []JobLock `json:"locks"`
+	}{})},
+	{Method: "GET", Path: "/api/admin/jobs", Tag: "admin", Summary: "Show this replica's job metrics", Admin: true, Status: 200, Response: typeOf[JobMetricsResponse]()},
+	{Method: "GET", Path: "/api/admin/api-keys", Tag: "admin", Summary: "List API keys", Admin: true, Status: 200, Response: reflect.TypeOf(struct {
+		APIKeys []APIKey `json:"api_keys"`
+	}{})},
+	{Method: "POST", Path: "/api/admin/api-keys", Tag: "admin", Summary: "Create an API key", Admin: true, Request: typeOf[APIKeyCreateRequest](), Status: 201, Response: typeOf[APIKeySecretResponse]()},
+	{Method: "POST", Path: "/api/admin/api-keys/:id/rotate", Tag: "admin", Summary: "Replace an API key", Admin: true, Request: typeOf[APIKeyRotateRequest](), Status: 200, Response: typeOf[APIKeySecretResponse]()},
+	{Method: "DELETE", Path: "/api/admin/api-keys/:id", Tag: "admin", Summary: "Revoke an API key", Admin: true, Status: 200, Response: typeOf[APIKey]()},
+	{Method: "GET", Path: "/api/admin/api-keys/:id/quota", Tag: "admin", Summary: "Get an API key's quota and usage", Admin: true, Status: 200, Response: typeOf[QuotaResponse]()},
+	{Method: "PUT", Path: "/api/admin/api-keys/:id/quota", Tag: "admin", Summary: "Set an API key's plan and quota overrides", Admin: true, Request: typeOf[APIKeyQuotaRequest](), Status: 200, Response: typeOf[QuotaResponse]()},
+	{Method: "GET", Path: "/api/admin/menus", Tag: "admin", Summary: "List all menus", Admin: true, Status: 200, Query: []apiParam{
+		{Name: "limit", Description: "At most 500; defaults to 50"},
+		{Name: "page_token", Description: "next_page_token from the previous page"},
+		{Name: "status", Description: "Only menus with this status", Enum: []string{"PENDING", "PROCESSING", "AWAITING_REVIEW", "COMPLETE", "FAILED"}},
+		{Name: "older_than_minutes", Description: "Only menus not updated for this many minutes"},
+	}, Response: reflect.TypeOf(struct {
+		Menus         []AdminMenuSummary `json:"menus"`
+		NextPageToken string             `json:"next_page_token"`
+	}{})},
+	{Method: "GET", Path: "/api/admin/menus/:id/raw-extraction", Tag: "admin", Summary: "Show menu structure answers that did not decode", Admin: true, Status: 200, Response: typeOf[RawExtractionResponse]()},
+	{Method: "POST", Path: "/api/admin/menus/requeue-stuck", Tag: "admin", Summary: "Resume or fail menus stuck in PENDING/PROCESSING", Admin: true, Request: typeOf[BulkMenusRequest](), Status: 200, Response: typeOf[BulkActionResponse]()},
+	{Method: "POST", Path: "/api/admin/menus/fail-stuck", Tag: "admin", Summary: "Fail menus stuck in PENDING/PROCESSING", Admin: true, Request: typeOf[BulkMenusRequest](), Status: 200, Response: typeOf[BulkActionResponse]()},
+	{Method: "POST", Path: "/api/admin/dishes/retry-failed", Tag: "admin", Summary: "Process failed dishes of complete menus again", Admin: true, Request: typeOf[BulkDishRetryRequest](), Status: 200, Response: typeOf[BulkActionResponse]()},
+	{Method: "POST", Path: "/api/admin/menus/:id/purge", Tag: "admin", Summary: "Irreversibly delete a menu and every record of it", Admin: true, Status: 200, Response: typeOf[PurgeReceipt]()},
+	{Method: "POST", Path: "/api/admin/users/:id/purge", Tag: "admin", Summary: "Irreversibly delete an account, its menus, and every record of them", Admin: true, Status: 200, Response: typeOf[PurgeReceipt]()},
+	{Method: "GET", Path: "/api/admin/purges/:id", Tag: "admin", Summary: "Get a purge receipt", Admin: true, Status: 200, Response: typeOf[PurgeReceipt]()},
+	{Method: "GET", Path: "/api/admin/catalog", Tag: "admin", Summary: "List canonical dishes, most linked first", Admin: true, Status: 200, Query: []apiParam{
+		{Name: "q", Description: "Only dishes whose canonical name contains this"},
+		{Name: "cuisine", Description: "Only dishes of this detected cuisine"},
+		{Name: "limit", Description: "At most 500; defaults to 50"},
+	}, Response: reflect.TypeOf(struct {
+		Dishes []CatalogDish `json:"dishes"`
+	}{})},
+	{Method: "GET", Path: "/api/admin/catalog/:id", Tag: "admin", Summary: "Get a canonical dish", Admin: true, Status: 200, Response: typeOf[CatalogDish]()},
+	{Method: "PATCH", Path: "/api/admin/catalog/:id", Tag: "admin", Summary: "Correct a canonical dish and the unedited dishes linked to it", Admin: true, Request: typeOf[CatalogDishUpdateRequest](), Status: 200, Response: typeOf[CatalogDishUpdateResponse]()},
+	{Method: "GET", Path: "/api/admin/debug/runtime", Tag: "admin", Summary: "Show this replica's goroutines, memory, and in-flight menus; needs DEBUG_ENDPOINTS_ENABLED", Admin: true, Status: 200, Response: typeOf[RuntimeDebugResponse]()},
+	{Method: "GET", Path: "/api/admin/metrics", Tag: "admin", Summary: "Job metrics in Prometheus text format", Admin: true, Status: 200, Content: []string{"text/plain"}},
+
+	// Public pages
+	{Method: "GET", Path: "/public/menu/:slug", Tag: "public", Summary: "Published menu behind a share link", Public: true, Status: 200, Query: []apiParam{
+		{Name: "format", Description: "json for the menu as JSON instead of a page", Enum: []string{"json"}},
+	}, Response: typeOf[PublicMenu](), Content: []string{"text/html"}},
+	{Method: "GET", Path: "/public/menu/:slug/widget", Tag: "public", Summary: "Embeddable menu widget", Public: true, Status: 200, Query: []apiParam{
+		{Name: "accent", Description: "Hex color"},
+		{Name: "background", Description: "Hex color"},
+		{Name: "text", Description: "Hex color"},
+		{Name: "font", Enum: []string{"serif", "sans", "mono", "inherit"}},
+		{Name: "layout", Enum: []string{"grid", "list"}},
+		{Name: "images", Enum: []string{"true", "false"}},
+		{Name: "format", Description: "fragment for the markup without a page", Enum: []string{"fragment"}},
+		{Name: "callback", Description: "JSONP callback name"},
+	}, Content: []string{"text/html", "application/javascript"}},
+	{Method: "GET", Path: "/public/images/:id", Tag: "public", Summary: "Watermarked dish image", Public: true, Status: 200, Content: []string{"image/jpeg", "image/png"}},
+	{Method: "GET", Path: "/public/demo/images/:name", Tag: "public", Summary: "Demo mode placeholder image", Public: true, Status: 200, Content: []string{"image/png"}},
+}
+
+// undocumentedRoutes are served but deliberately left out of the spec.
+var undocumentedRoutes = map[string]bool{
+	"GET /api/openapi.json": true,
+	"GET /api/docs":         true,
+	"GET /health":           true,
+	"GET /livez":            true,
+	"GET /readyz":           true,
+	// Go's profiler, not part of the API
+	"GET /debug/pprof/":         true,
+	"GET /debug/pprof/cmdline":  true,
+	"GET /debug/pprof/profile":  true,
+	"GET /debug/pprof/symbol":   true,
+	"POST /debug/pprof/symbol":  true,
+	"GET /debug/pprof/trace":    true,
+	"GET /debug/pprof/:profile": true,
+}
+
+// openAPISpec builds the OpenAPI 3.0 document for apiOperations.
+func openAPISpec() map[string]interface{} {
+	schemas := openAPISchemas{components: map[string]interface{}{
+		"ErrorResponse": map[string]interface{}{
+			"type":     "object",
+			"required": []string{"error"},
+			"properties": map[string]interface{}{
+				"error": map[string]interface{}{"$ref": "#/components/schemas/ErrorDetail"},
+			},
+		},
+	}}
+	// ErrorResponse names the envelope in the spec, so build the detail
+	// schema directly rather than by type name
+	errorDetail := schemas.structSchema(typeOf[ErrorResponse]())
+	var codes []string
+	for code := range responseErrorCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	errorDetail["properties"].(map[string]interface{})["code"] = map[string]interface{}{"type": "string", "enum": codes}
+	schemas.components["ErrorDetail"] = errorDetail
+	requests := openAPISchemas{components: schemas.components, input: true}
+
+	paths := map[string]map[string]interface{}{}
+	for _, op := range apiOperations {
+		path, parameters := openAPIPath(op.Path)
+		parameters = append(parameters, openAPIParameters("query", op.Query)...)
+		parameters = append(parameters, openAPIParameters("header", op.Header)...)
+
+		operation := map[string]interface{}{
+			"operationId": openAPIOperationID(op),
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+			"responses":   openAPIResponses(op, &schemas),
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		switch {
+		case op.Admin:
+			operation["security"] = []map[string][]string{{"adminToken": {}}}
+		case op.Login:
+			operation["security"] = []map[string][]string{{"apiKey": {}, "session": {}}}
+		case !op.Public:
+			operation["security"] = []map[string][]string{{"apiKey": {}}, {"apiKey": {}, "session": {}}}
+		}
+		if op.Request != nil {
+			schema := requests.schemaFor(op.Request)
+			// Bodies whose fields are all optional may be left out
+			_, hasRequired := schemas.components[op.Request.Name()].(map[string]interface{})["required"]
+			operation["requestBody"] = map[string]interface{}{
+				"required": hasRequired,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schema},
+				},
+			}
+		}
+		if op.Method == "POST" && op.Path == "/api/menu" {
+			operation["requestBody"] = uploadRequestBody()
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "MenuGen API",
+			"version":     "1.0.0",
+			"description": "Turns photos of restaurant menus into structured menus with AI-written descriptions and images. Errors use the ErrorResponse envelope.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "A session token from /api/auth/login. Menus uploaded while signed in are only visible to their owner.",
+				},
+				"apiKey": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-API-Key",
+					"description": "An API key issued by an operator. Clients that cannot set headers may send it as the api_key query parameter.",
+				},
+				"adminToken": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The server's ADMIN_TOKEN. It may also be sent as X-Admin-Token.",
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts a gin path to an OpenAPI one and lists its path
+// parameters.
+func openAPIPath(ginPath string) (string, []interface{}) {
+	var parameters []interface{}
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), parameters
+}
+
+// openAPIOperationID derives a stable ID such as getApiMenuIdDishes.
+func openAPIOperationID(op apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool { return r == '/' || r == ':' || r == '-' || r == '.' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func openAPIResponses(op apiOperation, schemas *openAPISchemas) map[string]interface{} {
+	success := map[string]interface{}{"description": http.StatusText(op.Status)}
+	content := map[string]interface{}{}
+	if op.Response != nil {
+		content["application/json"] = map[string]interface{}{"schema": schemas.schemaFor(op.Response)}
+	}
+	for _, mediaType := range op.Content {
+		content[mediaType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+	if len(content) > 0 {
+		success["content"] = content
+	}
+
+	responses := map[string]interface{}{
+		strconv.Itoa(op.Status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/ErrorResponse"}},
+			},
+		},
+	}
+	for _, header := range op.Header {
+		if header.Name == "If-None-Match" {
+			responses["304"] = map[string]interface{}{"description": "Not modified since the ETag in If-None-Match"}
+		}
+	}
+	if op.Method == "POST" && op.Path == "/api/menu" {
+		responses["200"] = map[string]interface{}{
+			"description": "The image was uploaded before; the existing menu is returned",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.schemaFor(typeOf[MenuUploadResponse]())},
+			},
+		}
+		responses["409"] = map[string]interface{}{
+			"description": "The image looks like an existing menu (NEAR_DUPLICATE_MENU), or an upload with the same Idempotency-Key is still running (IDEMPOTENCY_KEY_IN_USE)",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.schemaFor(reflect.TypeOf(struct {
+					Error     ErrorResponse     `json:"error"`
+					Duplicate NearDuplicateMenu `json:"duplicate"`
+				}{}))},
+			},
+		}
+	}
+	return responses
+}
+
+func openAPIParameters(in string, params []apiParam) []interface{} {
+	var parameters []interface{}
+	for _, param := range params {
+		schema := map[string]interface{}{"type": "string"}
+		if param.Enum != nil {
+			schema["enum"] = param.Enum
+		}
+		parameter := map[string]interface{}{"name": param.Name, "in": in, "schema": schema}
+		if param.Description != "" {
+			parameter["description"] = param.Description
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
+
+func uploadRequestBody() map[string]interface{} {
+	return map[string]interface{}{
+		"required": true,
+		"content": map[string]interface{}{
+			"multipart/form-data": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"image"},
+					"properties": map[string]interface{}{
+						"image": map[string]interface{}{
+							"type":        "string",
+							"format":      "binary",
+							"description": "The menu photo, an image of at most 8 MB",
+						},
+						"on_duplicate": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{OnDuplicateWarn, OnDuplicateReuse, OnDuplicateForce},
+							"description": "What to do when the image looks like an existing menu. Defaults to warn.",
+						},
+						"restaurant_id": map[string]interface{}{
+							"type":        "string",
+							"description": "One of the signed-in user's restaurants to add the menu to",
+						},
+						"priority": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{PriorityLow, PriorityNormal, PriorityHigh},
+							"description": "Processing priority. Defaults to high for signed-in users and normal otherwise; higher priorities need an API key plan that allows them.",
+						},
+						"unique_descriptions": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Write new descriptions for every dish instead of reusing cached ones for dishes seen on other menus. Defaults to false.",
+						},
+						"currency": map[string]interface{}{
+							"type":        "string",
+							"description": "ISO 4217 code the menu's prices are in, for every dish. Detected from the menu when omitted.",
+						},
+						"style": map[string]interface{}{
+							"type":        "string",
+							"enum":        imageStyleNames(),
+							"description": "Image style shared by all the menu's dish images. Plain product photos when omitted.",
+						},
+						"aspect_ratio": map[string]interface{}{
+							"type":        "string",
+							"description": "Aspect ratio of the menu's dish images, e.g. 4:3 for cards or 16:9 for banners; any ratio renditions accept. Defaults to 1:1.",
+						},
+						"image_size": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{"standard", "small"},
+							"description": "Resolution of the menu's dish images: standard (about 1 megapixel) or small (about 0.25). Defaults to standard.",
+						},
+						"extraction_prompt": map[string]interface{}{
+							"type":        "string",
+							"description": "Go text/template replacing the deployment's extraction prompt for this menu; may use {{.RestaurantName}}.",
+						},
+						"description_prompt": map[string]interface{}{
+							"type":        "string",
+							"description": "Go text/template replacing the deployment's description prompt for this menu's dishes; may use {{.DishName}}, {{.Cuisine}}, and {{.RestaurantName}}.",
+						},
+						"image_prompt": map[string]interface{}{
+							"type":        "string",
+							"description": "Go text/template replacing the deployment's image prompt for this menu's dishes; may use {{.DishName}}, {{.Cuisine}}, and {{.RestaurantName}}.",
+						},
+						"review": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Stop in AWAITING_REVIEW after extraction until POST /api/menu/:id/approve. Defaults to the deployment's REVIEW_REQUIRED.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// openAPISchemas derives JSON schemas from Go types the way encoding/json
+// encodes them. Named struct types become shared components. input is set
+// while describing request bodies.
+type openAPISchemas struct {
+	components map[string]interface{}
+	input      bool
+}
+
+func (s *openAPISchemas) schemaFor(t reflect.Type) map[string]interface{} {
+	switch {
+	case t.Kind() == reflect.Pointer:
+		return nullableSchema(s.schemaFor(t.Elem()))
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case contractKind(t) == "any":
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		if _, ok := s.components[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			s.components[t.Name()] = nil
+			s.components[t.Name()] = s.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// nullableSchema marks schema as accepting null. OpenAPI 3.0 ignores
+// siblings of $ref, so references are wrapped in allOf.
+func nullableSchema(schema map[string]interface{}) map[string]interface{} {
+	if _, ok := schema["$ref"]; ok {
+		return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+	}
+	schema["nullable"] = true
+	return schema
+}
+
+// structSchema describes a struct's JSON fields. In responses, fields
+// without omitempty are always present and listed as required; in request
+// bodies, only fields whose binding rules demand them are. Binding rules for
+// enums and ranges are carried over.
+func (s *openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	s.addStructFields(t, properties, &required)
+	sort.Strings(required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *openAPISchemas) addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addStructFields(embedded, properties, required)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := s.schemaFor(field.Type)
+		binding := field.Tag.Get("binding")
+		if _, isRef := schema["$ref"]; !isRef {
+			applyBindingRules(schema, binding)
+		}
+		if s.input && strings.Contains(","+binding+",", ",required,") ||
+			!s.input && !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+		properties[name] = schema
+	}
+}
+
+// applyBindingRules carries gin's oneof, min, and max validations over to
+// schema.
+func applyBindingRules(schema map[string]interface{}, binding string) {
+	for _, rule := range strings.Split(binding, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "dive":
+			// The remaining rules apply to the elements
+			return
+		case "oneof":
+			schema["enum"] = strings.Fields(value)
+		case "min", "max", "len":
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			switch schema["type"] {
+			case "string":
+				if key != "max" {
+					schema["minLength"] = number
+				}
+				if key != "min" {
+					schema["maxLength"] = number
+				}
+			case "array":
+				if key != "max" {
+					schema["minItems"] = number
+				}
+				if key != "min" {
+					schema["maxItems"] = number
+				}
+			case "integer", "number":
+				if key != "max" {
+					schema["minimum"] = number
+				}
+				if key != "min" {
+					schema["maximum"] = number
+				}
+			}
+		}
+	}
+}
+
+// openAPIDocument is the spec served at /api/openapi.json, built once.
+var openAPIDocument = func() []byte {
+	data, err := json.MarshalIndent(openAPISpec(), "", "  ")
+	if err != nil {
+		panic("invalid OpenAPI spec: " + err.Error())
+	}
+	return data
+}()
+
+func openAPIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPIDocument)
+}
+
+// apiDocsHandler serves Swagger UI for the spec. The UI's assets come from a
+// CDN so the binary does not have to embed them.
+func apiDocsHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(apiDocsPage))
+}
+
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>MenuGen API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+<script>
+window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+</script>
+</body>
+</html>
+`
+
+// checkOpenAPICommand compares the router's routes with apiOperations, so a
+// route cannot be added without documenting it or removed without dropping
+// it from the spec.
+func checkOpenAPICommand(args []string, out io.Writer) error {
+	flags := newAdminFlagSet("check-openapi", out)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	served := map[string]bool{}
+	for _, route := range newRouter().Routes() {
+		served[route.Method+" "+route.Path] = true
+	}
+	documented := map[string]bool{}
+	for _, op := range apiOperations {
+		key := op.Method + " " + op.Path
+		if documented[key] {
+			return fmt.Errorf("%s is documented twice", key)
+		}
+		documented[key] = true
+	}
+
+	var problems []string
+	for route := range served {
+		if !documented[route] && !undocumentedRoutes[route] {
+			problems = append(problems, "undocumented route "+route)
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			problems = append(problems, "documented route is not served: "+route)
+		}
+	}
+	sort.Strings(problems)
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d differences between the router and the OpenAPI spec", len(problems))
+	}
+	fmt.Fprintf(out, "OpenAPI spec documents all %d routes\n", len(documented))
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TestOpenAPIMatchesRouter walks the router and checks that the spec
+// documents every route it serves, and nothing it does not.
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	if zapLog == nil {
+		zapLog = zap.NewNop()
+	}
+	gin.SetMode(gin.TestMode)
+
+	served := map[string]bool{}
+	for _, route := range newRouter().Routes() {
+		served[route.Method+" "+route.Path] = true
+	}
+	if len(served) == 0 {
+		t.Fatal("the router serves no routes")
+	}
+	documented := map[string]bool{}
+	for _, op := range apiOperations {
+		key := op.Method + " " + op.Path
+		if documented[key] {
+			t.Errorf("%s is documented twice", key)
+		}
+		documented[key] = true
+		if strings.HasPrefix(op.Path, "/api/admin/") && !op.Admin {
+			t.Errorf("%s is an operator route but is not documented as needing the admin token", key)
+		}
+	}
+
+	for route := range served {
+		if !documented[route] && !undocumentedRoutes[route] {
+			t.Errorf("route %s is not in the OpenAPI spec", route)
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			t.Errorf("the OpenAPI spec documents %s, which the router does not serve", route)
+		}
+	}
+}
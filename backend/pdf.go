@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"strings"
+)
+
+// pdfDocument is a deliberately small PDF writer that lays out flowing text
+// with the standard Helvetica fonts. It is enough for printable menu exports
+// without pulling in a full PDF library.
+type pdfDocument struct {
+	title  string
+	pages  []*bytes.Buffer
+	cur    *bytes.Buffer
+	width  float64
+	height float64
+	margin float64
+	y      float64
+	images []pdfImage
+}
+
+// pdfImage is an image XObject ready to be written into the document.
+type pdfImage struct {
+	Width      int
+	Height     int
+	ColorSpace string
+	Filter     string
+	Data       []byte
+}
+
+const (
+	pdfFontRegular = "F1"
+	pdfFontBold    = "F2"
+)
+
+// newPDFDocument creates a US Letter document with one empty page.
+func newPDFDocument(title string) *pdfDocument {
+	d := &pdfDocument{
+		title:  title,
+		width:  612,
+		height: 792,
+		margin: 54,
+	}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.cur = &bytes.Buffer{}
+	d.pages = append(d.pages, d.cur)
+	d.y = d.height - d.margin
+}
+
+// Space advances the cursor by h points, breaking the page when needed.
+func (d *pdfDocument) Space(h float64) {
+	d.y -= h
+	if d.y < d.margin {
+		d.newPage()
+	}
+}
+
+// Text writes a paragraph in the given font and size, wrapping it to the
+// printable width and continuing onto new pages as required.
+func (d *pdfDocument) Text(text, font string, size float64) {
+	d.TextIndented(text, font, size, 0)
+}
+
+// TextIndented is Text with the left edge moved right by indent points.
+func (d *pdfDocument) TextIndented(text, font string, size, indent float64) {
+	leading := size * 1.3
+	maxWidth := d.width - 2*d.margin - indent
+	for _, line := range wrapPDFText(text, font, size, maxWidth) {
+		if d.y-leading < d.margin {
+			d.newPage()
+		}
+		d.y -= leading
+		fmt.Fprintf(d.cur, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+			font, size, d.margin+indent, d.y, escapePDFString(line))
+	}
+}
+
+// Rule draws a thin horizontal line across the printable width.
+func (d *pdfDocument) Rule() {
+	d.Space(6)
+	fmt.Fprintf(d.cur, "0.6 w %.2f %.2f m %.2f %.2f l S\n", d.margin, d.y, d.width-d.margin, d.y)
+	d.Space(6)
+}
+
+// Reserve starts a new page unless h points of vertical space remain.
+func (d *pdfDocument) Reserve(h float64) {
+	if d.y-h < d.margin {
+		d.newPage()
+	}
+}
+
+// Y returns the current vertical cursor position.
+func (d *pdfDocument) Y() float64 {
+	return d.y
+}
+
+// MoveTo sets the vertical cursor, e.g. below an image beside a text column.
+func (d *pdfDocument) MoveTo(y float64) {
+	d.y = y
+}
+
+// Image draws img with its top-left corner at the left margin and the current
+// cursor, scaled to fit within w by h points. The cursor does not move.
+func (d *pdfDocument) Image(img pdfImage, w, h float64) {
+	scale := w / float64(img.Width)
+	if s := h / float64(img.Height); s < scale {
+		scale = s
+	}
+	drawW, drawH := float64(img.Width)*scale, float64(img.Height)*scale
+
+	d.images = append(d.images, img)
+	fmt.Fprintf(d.cur, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n",
+		drawW, drawH, d.margin, d.y-drawH, len(d.images))
+}
+
+// newPDFImage prepares encoded image data for embedding. JPEGs are embedded
+// as-is; other formats the standard library can decode (PNG, GIF) are
+// converted to compressed RGB.
+func newPDFImage(data []byte) (pdfImage, error) {
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(data)); err == nil {
+		colorSpace := "DeviceRGB"
+		switch config.ColorModel {
+		case color.GrayModel:
+			colorSpace = "DeviceGray"
+		case color.CMYKModel:
+			colorSpace = "DeviceCMYK"
+		}
+		return pdfImage{Width: config.Width, Height: config.Height, ColorSpace: colorSpace, Filter: "DCTDecode", Data: data}, nil
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, fmt.Errorf("unsupported image: %w", err)
+	}
+
+	bounds := decoded.Bounds()
+	var raw, compressed bytes.Buffer
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Flatten transparency onto white paper
+			r, g, b, a := decoded.At(x, y).RGBA()
+			blend := func(c uint32) byte { return byte((c + (0xffff - a)) >> 8) }
+			raw.Write([]byte{blend(r), blend(g), blend(b)})
+		}
+	}
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(raw.Bytes()); err != nil {
+		return pdfImage{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return pdfImage{}, err
+	}
+	return pdfImage{Width: bounds.Dx(), Height: bounds.Dy(), ColorSpace: "DeviceRGB", Filter: "FlateDecode", Data: compressed.Bytes()}, nil
+}
+
+// Bytes serializes the document.
+func (d *pdfDocument) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	writeObject := func(body string) int {
+		offsets = append(offsets, out.Len())
+		id := len(offsets)
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", id, body)
+		return id
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Object numbers are fixed up front: catalog, pages, fonts, info, then
+	// one content stream and one page object per page, then images.
+	pageCount := len(d.pages)
+	firstPage := 6
+	kids := make([]string, pageCount)
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+i*2+1)
+	}
+	firstImage := firstPage + pageCount*2
+	xObjects := ""
+	if len(d.images) > 0 {
+		refs := make([]string, len(d.images))
+		for i := range d.images {
+			refs[i] = fmt.Sprintf("/Im%d %d 0 R", i+1, firstImage+i)
+		}
+		xObjects = " /XObject << " + strings.Join(refs, " ") + " >>"
+	}
+
+	writeObject("<< /Type /Catalog /Pages 2 0 R /Lang (en) >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	writeObject(fmt.Sprintf("<< /Title (%s) /Producer (MenuGen) >>", escapePDFString(d.title)))
+
+	for i, page := range d.pages {
+		content := page.String()
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >>%s >> /Contents %d 0 R >>",
+			d.width, d.height, pdfFontRegular, pdfFontBold, xObjects, firstPage+i*2))
+	}
+
+	for _, img := range d.images {
+		writeObject(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s /Length %d >>\nstream\n%s\nendstream",
+			img.Width, img.Height, img.ColorSpace, img.Filter, len(img.Data), img.Data))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// wrapPDFText greedily breaks text into lines no wider than maxWidth using
+// approximate Helvetica glyph widths.
+func wrapPDFText(text, font string, size, maxWidth float64) []string {
+	charWidth := size * 0.5
+	if font == pdfFontBold {
+		charWidth = size * 0.56
+	}
+	maxChars := int(maxWidth / charWidth)
+	if maxChars < 1 {
+		maxChars = 1
+	}
+
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := ""
+		for _, word := range words {
+			for len([]rune(word)) > maxChars {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:maxChars]))
+				word = string(runes[maxChars:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= maxChars:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// winAnsiExtras maps the non-Latin-1 characters that WinAnsiEncoding supports.
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// escapePDFString converts s to a WinAnsi-encoded PDF literal string body.
+// Characters outside the encoding are replaced with '?'.
+func escapePDFString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20:
+			continue
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b.WriteByte(byte(r))
+		default:
+			if code, ok := winAnsiExtras[r]; ok {
+				b.WriteByte(code)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPipeline uploads a menu through a Harness and checks that it completes
+// with every dish described and photographed. It needs the configured
+// database, and is skipped when that cannot be reached.
+func TestPipeline(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		name := "sync predictions"
+		if async {
+			name = "async predictions"
+		}
+		t.Run(name, func(t *testing.T) {
+			h, err := NewHarness()
+			if err != nil {
+				t.Skipf("no database for the harness: %v", err)
+			}
+			defer h.Close()
+			h.Providers.AsyncPredictions = async
+
+			menuID, err := h.UploadMenu(SampleMenuPhoto(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			menu, err := h.WaitForMenu(menuID, 2*time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if menu.Status != "COMPLETE" || menu.Menu == nil {
+				t.Fatalf("menu ended %s", menu.Status)
+			}
+			if len(menu.Menu.Dishes) == 0 {
+				t.Fatal("menu has no dishes")
+			}
+			for _, dish := range menu.Menu.Dishes {
+				switch {
+				case dish.Status != "COMPLETE":
+					t.Errorf("%s is %s", dish.Name, dish.Status)
+				case dish.Description == nil || *dish.Description == "":
+					t.Errorf("%s has no description", dish.Name)
+				case dish.ImageURL == nil:
+					t.Errorf("%s has no image", dish.Name)
+				}
+			}
+			if len(h.Providers.Requests()) == 0 {
+				t.Error("no provider requests were made")
+			}
+			if err := h.Close(); err != nil {
+				t.Errorf("failed to drop the harness schema: %v", err)
+			}
+		})
+	}
+}
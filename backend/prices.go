@@ -0,0 +1,388 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Prices are stored in the minor unit of their currency, as ISO 4217
+// defines it: cents for USD and EUR, whole yen for JPY, fils for KWD. The
+// price_cents fields keep their name for compatibility but hold minor units.
+
+// currencyExponents lists the currencies whose minor unit is not a
+// hundredth of the major one.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// currencyExponent is the number of decimals in the currency's minor unit.
+func currencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// isPriceSeparator reports whether r can separate the digits of a price:
+// decimal points and commas, and the apostrophes and spaces some locales
+// group thousands with.
+func isPriceSeparator(r rune) bool {
+	switch r {
+	case '.', ',', '\'', '’':
+		return true
+	}
+	return isPriceSpace(r)
+}
+
+// isPriceSpace reports whether r is one of the spaces that group thousands.
+func isPriceSpace(r rune) bool {
+	return r == ' ' || r == '\u00a0' || r == '\u202f'
+}
+
+// groupsThousands reports whether rest, the text after a space inside an
+// amount, goes on with a group of exactly three digits, as in "1 250". Other
+// spaces end the amount, so "8.50 12.50" and "12 18" stay two prices.
+func groupsThousands(rest string) bool {
+	if len(rest) < 3 {
+		return false
+	}
+	for i := 0; i < 3; i++ {
+		if rest[i] < '0' || rest[i] > '9' {
+			return false
+		}
+	}
+	return len(rest) == 3 || rest[3] < '0' || rest[3] > '9'
+}
+
+// parsePrice reads the first amount in a raw price such as "$12.50",
+// "€ 9,90", "1.200,50 EUR", "¥1,200", or "CHF 1'250.–" and returns it in
+// minor units of currency. Commas and points are told apart by position: the
+// last one is the decimal separator unless it is followed by exactly three
+// digits (and currency has no three-decimal minor unit), or appears more
+// than once. A space groups thousands only before exactly three digits;
+// otherwise it ends the amount. It returns false when raw has no amount.
+func parsePrice(raw, currency string) (int, bool) {
+	amount, _, ok := scanPrice(raw, currency)
+	return amount, ok
+}
+
+// parsePrices reads every amount in a raw price, e.g. both of "12/18".
+func parsePrices(raw, currency string) []int {
+	var amounts []int
+	for {
+		amount, end, ok := scanPrice(raw, currency)
+		if !ok {
+			return amounts
+		}
+		amounts = append(amounts, amount)
+		raw = raw[end:]
+	}
+}
+
+// scanPrice reads the first amount in raw like parsePrice, and also returns
+// where in raw it ends.
+func scanPrice(raw, currency string) (int, int, bool) {
+	start := strings.IndexFunc(raw, unicode.IsDigit)
+	if start < 0 {
+		return 0, 0, false
+	}
+	if start > 0 && (raw[start-1] == '.' || raw[start-1] == ',') {
+		// ".99", but not the abbreviation in "Rs.250"
+		if before, _ := utf8.DecodeLastRuneInString(raw[:start-1]); !unicode.IsLetter(before) {
+			start--
+		}
+	}
+
+	// The amount runs until the first character that is neither a digit nor
+	// a separator; separators count only between digits, and spaces only
+	// before a group of three
+	var number, pending []rune
+	end := len(raw)
+scan:
+	for i, r := range raw[start:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number = append(number, pending...)
+			number = append(number, r)
+			pending = pending[:0]
+		case isPriceSpace(r) && !groupsThousands(raw[start+i+utf8.RuneLen(r):]):
+			end = start + i
+			break scan
+		case isPriceSeparator(r) && len(pending) == 0:
+			pending = append(pending, r)
+		default:
+			end = start + i
+			break scan
+		}
+	}
+
+	exponent := currencyExponent(currency)
+	integer, fraction := splitPriceNumber(string(number), exponent)
+	if len(integer) > 12 {
+		return 0, end, false
+	}
+
+	amount := 0
+	for _, digit := range integer {
+		amount = amount*10 + int(digit-'0')
+	}
+	for i := 0; i < exponent; i++ {
+		amount *= 10
+		if i < len(fraction) {
+			amount += int(fraction[i] - '0')
+		}
+	}
+	if len(fraction) > exponent && fraction[exponent] >= '5' {
+		// Round half up past the minor unit, e.g. 1,200.5 JPY
+		amount++
+	}
+	return amount, end, true
+}
+
+// splitPriceNumber splits digits and separators into the integer and
+// fraction digits of the amount.
+func splitPriceNumber(number string, exponent int) (string, string) {
+	decimal := strings.LastIndexAny(number, ".,")
+	if decimal >= 0 {
+		separator := number[decimal]
+		digitsAfter := len(number) - decimal - 1
+		repeated := strings.Count(number, string(separator)) > 1
+		other := ","
+		if separator == ',' {
+			other = "."
+		}
+		mixed := strings.Contains(number[:decimal], other)
+		if repeated || (!mixed && digitsAfter == 3 && exponent != 3) {
+			// 1,200 or 1.200.000: thousands separators only
+			decimal = -1
+		}
+	}
+
+	keepDigits := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s)
+	}
+	if decimal < 0 {
+		return keepDigits(number), ""
+	}
+	return keepDigits(number[:decimal]), keepDigits(number[decimal+1:])
+}
+
+// formatMinorUnits writes an amount in minor units with the currency's
+// decimals, e.g. 1250 USD as "12.50" and 1200 JPY as "1200".
+func formatMinorUnits(amount int, currency string) string {
+	exponent := currencyExponent(currency)
+	if exponent == 0 {
+		return strconv.Itoa(amount)
+	}
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.Itoa(amount)
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// A dish's price_type says how to read its price: price_cents is the price
+// for fixed prices, the lowest for ranges ("12/18", with price_max_cents the
+// highest) and "from $10" prices, and the price of one price_unit for
+// per-unit prices ("$14 per lb"). Market prices ("MP") and dishes without a
+// price have no price_cents.
+const (
+	PriceTypeNone    = "none"
+	PriceTypeFixed   = "fixed"
+	PriceTypeRange   = "range"
+	PriceTypeFrom    = "from"
+	PriceTypePerUnit = "per_unit"
+	PriceTypeMarket  = "market"
+)
+
+var priceTypes = []string{PriceTypeNone, PriceTypeFixed, PriceTypeRange, PriceTypeFrom, PriceTypePerUnit, PriceTypeMarket}
+
+// maxPriceUnitLength bounds dishes.price_unit.
+const maxPriceUnitLength = 20
+
+// priceUnitPattern finds the unit of "$14 per lb", "$4/100g", or "9 € / glass".
+var priceUnitPattern = regexp.MustCompile(`(?i)(?:\bper\s+|/\s*)(\d*\s?[a-z][a-z.]*)`)
+
+// quantityPattern finds how many pieces a price is for, as in "2 for $10",
+// "$10 for 2", "6 pcs 12", "6x 9", "x6 9", or "$12 per 6". Each form
+// captures the count in its own group.
+var quantityPattern = regexp.MustCompile(`(?i)\b(\d+)\s*(?:for|pcs?|pieces?|x)\b|\bfor\s+(\d+)\b|\bx\s*(\d+)\b|\bper\s+(\d+)(?:\s*(?:pcs?|pieces?)\b)?`)
+
+// marketPrices are how menus say a price is not fixed in advance.
+var marketPrices = []string{"mp", "m.p.", "market", "market price", "aq", "sq", "seasonal price"}
+
+// DishPrice is a dish's price as read from the menu.
+type DishPrice struct {
+	Type     string
+	Cents    *int
+	MinCents *int
+	MaxCents *int
+	Unit     *string
+}
+
+// readPrice reads a raw price in currency. priceType and unit are what
+// extraction made of it, if anything; they are checked against the raw
+// price and worked out from it when missing.
+func readPrice(raw *string, currency, priceType, unit string) DishPrice {
+	text := ""
+	if raw != nil {
+		text = strings.TrimSpace(*raw)
+	}
+	priceType = strings.ToLower(strings.TrimSpace(priceType))
+	if !slices.Contains(priceTypes, priceType) || priceType == PriceTypeNone {
+		priceType = classifyPrice(text)
+	}
+	if priceType == PriceTypeMarket {
+		return DishPrice{Type: PriceTypeMarket}
+	}
+	if quantity, rest := priceQuantity(text); quantity != "" {
+		// Only the amount is a price; the count is its unit
+		text = rest
+		if priceType != PriceTypeFrom {
+			priceType = PriceTypePerUnit
+		}
+		if strings.TrimSpace(unit) == "" {
+			unit = quantity
+		}
+	}
+
+	var amounts []int
+	for _, amount := range parsePrices(text, currency) {
+		if amount > 0 {
+			amounts = append(amounts, amount)
+		}
+	}
+	if len(amounts) == 0 {
+		return DishPrice{Type: PriceTypeNone}
+	}
+
+	price := DishPrice{Type: priceType, Cents: &amounts[0]}
+	switch priceType {
+	case PriceTypeRange:
+		if len(amounts) < 2 {
+			price.Type = PriceTypeFixed
+			break
+		}
+		low, high := min(amounts[0], amounts[1]), max(amounts[0], amounts[1])
+		price.Cents, price.MinCents, price.MaxCents = &low, &low, &high
+	case PriceTypeFrom:
+		price.MinCents = &amounts[0]
+	case PriceTypePerUnit:
+		unit = strings.TrimSpace(unit)
+		if unit == "" {
+			unit = priceUnit(text)
+		}
+		if unit == "" {
+			price.Type = PriceTypeFixed
+			break
+		}
+		if len(unit) > maxPriceUnitLength {
+			unit = unit[:maxPriceUnitLength]
+		}
+		price.Unit = &unit
+	default:
+		price.Type = PriceTypeFixed
+	}
+	return price
+}
+
+// classifyPrice works out the price type of a raw price.
+func classifyPrice(text string) string {
+	lower := strings.ToLower(text)
+	quantity, _ := priceQuantity(text)
+	switch {
+	case lower == "":
+		return PriceTypeNone
+	case slices.Contains(marketPrices, strings.Trim(lower, " *")):
+		return PriceTypeMarket
+	case strings.HasPrefix(lower, "from ") || strings.HasPrefix(lower, "starting at "):
+		return PriceTypeFrom
+	case priceUnit(lower) != "":
+		return PriceTypePerUnit
+	case quantity != "":
+		// "2 for $10" and "6 pcs 12" are the price of several pieces, not a
+		// range
+		return PriceTypePerUnit
+	case len(parsePrices(text, "")) >= 2:
+		return PriceTypeRange
+	}
+	return PriceTypeFixed
+}
+
+// priceQuantity returns the unit of a raw price for several pieces, such as
+// "2 pcs" for "2 for $10", and the raw price without the quantity. It
+// returns "" and text for prices of one. Numbers that belong to an amount,
+// like the 50 of "12.50 x 2" or the 10 of "$10 for 2", are not counts.
+func priceQuantity(text string) (string, string) {
+	offset := 0
+	for {
+		match := quantityPattern.FindStringSubmatchIndex(text[offset:])
+		if match == nil {
+			return "", text
+		}
+		if match[2] >= 0 {
+			before, _ := utf8.DecodeLastRuneInString(text[:offset+match[2]])
+			if before == '.' || before == ',' || unicode.Is(unicode.Sc, before) {
+				offset += match[3]
+				continue
+			}
+		}
+		for group := 2; group < len(match); group += 2 {
+			if match[group] >= 0 {
+				count := text[offset+match[group] : offset+match[group+1]]
+				rest := strings.TrimSpace(text[:offset+match[0]] + " " + text[offset+match[1]:])
+				if count == "1" {
+					return "1 pc", rest
+				}
+				return count + " pcs", rest
+			}
+		}
+	}
+}
+
+// priceUnit returns the unit a raw price is per, or "".
+func priceUnit(text string) string {
+	match := priceUnitPattern.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimRight(strings.ToLower(match[1]), ".")
+}
+
+// columns are the dish columns that hold the price.
+func (p DishPrice) columns() map[string]interface{} {
+	return map[string]interface{}{
+		"price_type":      p.Type,
+		"price_cents":     p.Cents,
+		"price_min_cents": p.MinCents,
+		"price_max_cents": p.MaxCents,
+		"price_unit":      p.Unit,
+	}
+}
+
+// dishPriceType is the dish's price type, worked out for dishes extracted
+// before price types were recorded.
+func dishPriceType(dish Dish) string {
+	if dish.PriceType != "" {
+		return dish.PriceType
+	}
+	if dish.PriceCents != nil {
+		return PriceTypeFixed
+	}
+	return PriceTypeNone
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	for _, test := range []struct {
+		raw      string
+		currency string
+		want     int
+		ok       bool
+	}{
+		{"$12.50", "USD", 1250, true},
+		{".99", "USD", 99, true},
+		{"Rs.250", "INR", 25000, true},
+		{"12/18", "USD", 1200, true},
+		{"€ 9,90", "EUR", 990, true},
+		{"1.200,50 EUR", "EUR", 120050, true},
+		{"CHF 1'250.–", "CHF", 125000, true},
+		{"¥1,200", "JPY", 1200, true},
+		{"3.500", "KWD", 3500, true},
+		{"1 250,50 €", "EUR", 125050, true},
+		{"1 250 Kč", "CZK", 125000, true},
+		{"12 000", "USD", 1200000, true},
+		{"8.50 12.50", "USD", 850, true},
+		{"12 18", "USD", 1200, true},
+		{"$9 95", "USD", 900, true},
+		{"12 1800", "USD", 1200, true},
+		{"12 €", "EUR", 1200, true},
+		{"MP", "USD", 0, false},
+	} {
+		got, ok := parsePrice(test.raw, test.currency)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parsePrice(%q, %s) = %d, %v; want %d, %v", test.raw, test.currency, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestParsePrices(t *testing.T) {
+	for _, test := range []struct {
+		raw  string
+		want []int
+	}{
+		{"12/18", []int{1200, 1800}},
+		{"8.50 12.50", []int{850, 1250}},
+		{"12 18", []int{1200, 1800}},
+		{"$9 95", []int{900, 9500}},
+		{"1 250 / 1 500", []int{125000, 150000}},
+		{"$14", []int{1400}},
+		{"", nil},
+	} {
+		if got := parsePrices(test.raw, "USD"); !slices.Equal(got, test.want) {
+			t.Errorf("parsePrices(%q) = %v, want %v", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestReadPrice(t *testing.T) {
+	for _, test := range []struct {
+		raw       string
+		priceType string
+		cents     int
+		maxCents  int
+		unit      string
+	}{
+		{"$12.50", PriceTypeFixed, 1250, 0, ""},
+		{"12/18", PriceTypeRange, 1200, 1800, ""},
+		{"8.50 12.50", PriceTypeRange, 850, 1250, ""},
+		{"from $10", PriceTypeFrom, 1000, 0, ""},
+		{"$14 per lb", PriceTypePerUnit, 1400, 0, "lb"},
+		{"2 for $10", PriceTypePerUnit, 1000, 0, "2 pcs"},
+		{"$10 for 2", PriceTypePerUnit, 1000, 0, "2 pcs"},
+		{"6 pcs 12", PriceTypePerUnit, 1200, 0, "6 pcs"},
+		{"1 pc 3.50", PriceTypePerUnit, 350, 0, "1 pc"},
+		{"6x $9", PriceTypePerUnit, 900, 0, "6 pcs"},
+		{"Wings x12 $15", PriceTypePerUnit, 1500, 0, "12 pcs"},
+		{"12.50 x 2", PriceTypePerUnit, 1250, 0, "2 pcs"},
+		{"$12 per 6", PriceTypePerUnit, 1200, 0, "6 pcs"},
+		{"MP", PriceTypeMarket, 0, 0, ""},
+	} {
+		raw := test.raw
+		price := readPrice(&raw, "USD", "", "")
+		got := func(p *int) int {
+			if p == nil {
+				return 0
+			}
+			return *p
+		}
+		unit := ""
+		if price.Unit != nil {
+			unit = *price.Unit
+		}
+		if price.Type != test.priceType || got(price.Cents) != test.cents || got(price.MaxCents) != test.maxCents || unit != test.unit {
+			t.Errorf("readPrice(%q) = %s %d-%d per %q, want %s %d-%d per %q", test.raw,
+				price.Type, got(price.Cents), got(price.MaxCents), unit,
+				test.priceType, test.cents, test.maxCents, test.unit)
+		}
+	}
+}
+
+func TestClassifyPrice(t *testing.T) {
+	for raw, want := range map[string]string{
+		"":           PriceTypeNone,
+		"$12":        PriceTypeFixed,
+		"12/18":      PriceTypeRange,
+		"12 18":      PriceTypeRange,
+		"from $10":   PriceTypeFrom,
+		"$14 per lb": PriceTypePerUnit,
+		"2 for $10":  PriceTypePerUnit,
+		"6 pcs 12":   PriceTypePerUnit,
+		"6 pc 12":    PriceTypePerUnit,
+		"3x 4.50":    PriceTypePerUnit,
+		"$12 per 6":  PriceTypePerUnit,
+		"m.p.":       PriceTypeMarket,
+	} {
+		if got := classifyPrice(raw); got != want {
+			t.Errorf("classifyPrice(%q) = %s, want %s", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Menus are processed at a priority: dishPool hands free slots to the
+// waiting menu with the highest one. Uploads from signed-in users are
+// interactive and default to high; other uploads default to normal. An
+// upload may ask for a priority with the priority field, up to its API
+// key plan's QUOTA_<PLAN>_MAX_PRIORITY (QUOTA_MAX_PRIORITY for the default
+// plan, normal unless set) or its default, whichever is higher. Bulk
+// imports should ask for low. gRPC uploads are normal.
+
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// priorityLevels orders the priorities; dishPool compares these numbers.
+var priorityLevels = map[string]int{
+	PriorityLow:    0,
+	PriorityNormal: 1,
+	PriorityHigh:   2,
+}
+
+// priorityLevel returns the level of priority, treating unknown values as
+// normal.
+func priorityLevel(priority string) int {
+	if level, ok := priorityLevels[priority]; ok {
+		return level
+	}
+	return priorityLevels[PriorityNormal]
+}
+
+// planMaxPriority is the highest priority a plan's uploads may ask for.
+func planMaxPriority(plan string) string {
+	priority := PriorityNormal
+	if value := os.Getenv("QUOTA_MAX_PRIORITY"); value != "" {
+		priority = value
+	}
+	if plan != "" && plan != defaultQuotaPlan {
+		prefix := "QUOTA_" + strings.ToUpper(strings.ReplaceAll(plan, "-", "_")) + "_"
+		if value := os.Getenv(prefix + "MAX_PRIORITY"); value != "" {
+			priority = value
+		}
+	}
+	if _, ok := priorityLevels[priority]; !ok {
+		zapLog.Warn("Ignoring unknown max priority", zap.String("plan", plan), zap.String("priority", priority))
+		return PriorityNormal
+	}
+	return priority
+}
+
+// uploadPriority decides the priority of an upload from its priority form
+// field. It answers the request and returns false when the field is invalid
+// or above what the client may ask for.
+func uploadPriority(c *gin.Context) (string, bool) {
+	priority := PriorityNormal
+	if currentUserID(c) != "" {
+		priority = PriorityHigh
+	}
+
+	requested := c.PostForm("priority")
+	if requested == "" {
+		return priority, true
+	}
+	if _, ok := priorityLevels[requested]; !ok {
+		respondFieldError(c, "priority", "oneof", "priority must be low, normal, or high")
+		return "", false
+	}
+
+	plan := defaultQuotaPlan
+	if key, ok := c.Get("apiKey"); ok {
+		plan = key.(*APIKey).Plan
+	}
+	allowed := planMaxPriority(plan)
+	if priorityLevel(priority) > priorityLevel(allowed) {
+		allowed = priority
+	}
+	if priorityLevel(requested) > priorityLevel(allowed) {
+		respondFieldError(c, "priority", "max", "priority may be at most "+allowed+" for this client")
+		return "", false
+	}
+	return requested, true
+}
+
+// menuPriorityLevel returns the level of the priority the menu was uploaded
+// with.
+func menuPriorityLevel(menuID string) int {
+	var menu Menu
+	if err := db.Select("id", "priority").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		zapLog.Warn("Failed to load menu priority", zap.String("menuID", menuID), zap.Error(err))
+		return priorityLevel(PriorityNormal)
+	}
+	return priorityLevel(menu.Priority)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// /livez answers 200 for as long as the process can serve HTTP at all, so an
+// orchestrator only restarts a replica that is wedged. /readyz answers 200
+// only when the replica should get traffic: not while the database is being
+// migrated at startup, not while the database, which also holds the work
+// queue, is unreachable, and not once shutdown has begun. The server listens
+// before migrating so that both can be probed throughout; other routes
+// answer 503 STARTING until then.
+
+// startupComplete is set once the database is migrated and the API routed.
+var startupComplete atomic.Bool
+
+// serving is the handler the HTTP server delegates to: the probes alone
+// while starting, then the full API.
+var serving atomic.Pointer[gin.Engine]
+
+// serveHTTP hands a request to the current handler.
+func serveHTTP(w http.ResponseWriter, r *http.Request) {
+	serving.Load().ServeHTTP(w, r)
+}
+
+// newStartupRouter serves the probes while the server is starting.
+func newStartupRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET("/livez", livezHandler)
+	r.GET("/readyz", readyzHandler)
+	r.NoRoute(func(c *gin.Context) {
+		respondError(c, http.StatusServiceUnavailable, "STARTING", "The server is starting, try again shortly")
+	})
+	return r
+}
+
+func livezHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func readyzHandler(c *gin.Context) {
+	reason := ""
+	if !startupComplete.Load() {
+		reason = "starting"
+	} else if shuttingDown.Load() {
+		reason = "draining"
+	} else if result := runHealthCheck(c.Request.Context(), getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second), pingDatabase); result.Status != HealthOK {
+		reason = "database"
+	}
+
+	if reason != "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "reason": reason})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+)
+
+// The extraction, description, and image prompts are Go text/templates.
+// Deployments replace the built-in ones with EXTRACTION_PROMPT_TEMPLATE,
+// DESCRIPTION_PROMPT_TEMPLATE, and IMAGE_PROMPT_TEMPLATE, and uploads with
+// their extraction_prompt, description_prompt, and image_prompt fields,
+// which are kept with the menu for every later generation. Templates see
+// promptData; a deployment template that fails falls back to the built-in
+// one, while an upload's is checked before the menu is created.
+
+const (
+	promptExtraction  = "extraction"
+	promptDescription = "description"
+	promptImage       = "image"
+)
+
+// maxPromptTemplateLength bounds the templates uploads can send.
+const maxPromptTemplateLength = 4000
+
+// defaultPromptTemplates are the built-in templates.
+var defaultPromptTemplates = map[string]string{
+	promptExtraction: "Extract the menu structure from this image. Organize dishes into sections. Include dish names and prices if visible. " +
+		"List add-ons and choices printed with a dish as its modifiers, and those printed for a whole section as the section's. " +
+		"When dishes come in several sizes or versions with their own prices, such as size columns, list them as variants named after the size. " +
+		"Identify the currency of the prices from currency symbols, explicit mentions, or the menu's language and location, and give it as an ISO 4217 code; leave it empty if it cannot be told. " +
+		"When the menu marks dishes as vegetarian, vegan, gluten-free, or the like, with symbols or letters such as (V) or GF, give the marked diets as the dish's dietary tags and leave the markers out of its name. " +
+		"Give the spice level the menu shows with chili icons or words such as spicy or extra hot. " +
+		"Classify the menu's cuisine, and give a dish its own only when it differs. " +
+		"Give the language the menu is written in, and keep dish names in their original script, adding a romanized name for those not in Latin script. " +
+		"Return the data as structured JSON.",
+	promptDescription: "Generate a description for this {{with .Cuisine}}{{.}} {{end}}dish: {{.DishName}}",
+	promptImage:       "A beautiful, appetizing photo of {{.DishName}}, food photography, professional lighting, clean background",
+}
+
+// promptEnvVars name the environment variables overriding the built-in
+// templates.
+var promptEnvVars = map[string]string{
+	promptExtraction:  "EXTRACTION_PROMPT_TEMPLATE",
+	promptDescription: "DESCRIPTION_PROMPT_TEMPLATE",
+	promptImage:       "IMAGE_PROMPT_TEMPLATE",
+}
+
+// promptData is what prompt templates can use. Extraction only has
+// RestaurantName.
+type promptData struct {
+	// DishName is the dish's name as on the menu
+	DishName string
+	// Cuisine is the dish's cuisine as a label, e.g. Middle Eastern; "" when
+	// unknown
+	Cuisine string
+	// RestaurantName is "" for menus outside a restaurant
+	RestaurantName string
+}
+
+// PromptTemplates are the templates an upload sent, stored as a JSONB
+// object; "" uses the deployment's.
+type PromptTemplates struct {
+	Extraction  string `json:"extraction,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+func (t PromptTemplates) Value() (driver.Value, error) {
+	return marshalJSONColumn(t)
+}
+
+func (t *PromptTemplates) Scan(value interface{}) error {
+	return scanJSONColumn(value, t)
+}
+
+func (t PromptTemplates) get(kind string) string {
+	switch kind {
+	case promptExtraction:
+		return t.Extraction
+	case promptDescription:
+		return t.Description
+	case promptImage:
+		return t.Image
+	}
+	return ""
+}
+
+// menuPrompts renders the prompts of one menu.
+type menuPrompts struct {
+	Templates      PromptTemplates
+	RestaurantName string
+	// ImageStyle and ImageShape are the menu's image style and shape
+	ImageStyle string
+	ImageShape imageShape
+}
+
+// loadMenuPrompts loads the templates and restaurant name the menu's
+// prompts use. Failures are logged and leave the deployment's templates.
+func loadMenuPrompts(menuID string) menuPrompts {
+	var menu Menu
+	if err := db.Select("id", "restaurant_id", "prompt_templates", "image_style", "image_aspect_ratio", "image_size").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		zapLog.Warn("Failed to load menu prompt templates", zap.String("menuID", menuID), zap.Error(err))
+		return menuPrompts{ImageShape: defaultImageShape}
+	}
+	prompts := menuPrompts{ImageStyle: menu.ImageStyle, ImageShape: menuImageShape(menu)}
+	if menu.PromptTemplates != nil {
+		prompts.Templates = *menu.PromptTemplates
+	}
+	if menu.RestaurantID != nil {
+		var restaurant Restaurant
+		if err := db.Select("id", "name").Where("id = ?", *menu.RestaurantID).First(&restaurant).Error; err != nil {
+			zapLog.Warn("Failed to load restaurant for prompts", zap.String("menuID", menuID), zap.Error(err))
+		} else {
+			prompts.RestaurantName = restaurant.Name
+		}
+	}
+	return prompts
+}
+
+// render renders the kind of prompt for a dish (or for the menu, with an
+// empty dishName) from the menu's template, the deployment's, or the
+// built-in one, in that order.
+func (p menuPrompts) render(kind, dishName, cuisine string) string {
+	data := promptData{DishName: dishName, RestaurantName: p.RestaurantName}
+	if cuisine != "" {
+		data.Cuisine = cuisineLabel(cuisine)
+	}
+	for _, source := range []string{p.Templates.get(kind), os.Getenv(promptEnvVars[kind])} {
+		if source == "" {
+			continue
+		}
+		prompt, err := renderPromptTemplate(source, data)
+		if err == nil {
+			return prompt
+		}
+		zapLog.Warn("Failed to render prompt template", zap.String("prompt", kind), zap.Error(err))
+	}
+	prompt, _ := renderPromptTemplate(defaultPromptTemplates[kind], data)
+	return prompt
+}
+
+func renderPromptTemplate(source string, data promptData) (string, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// validatePromptTemplate checks a template an upload sent, rendering it for
+// a sample dish.
+func validatePromptTemplate(source string) error {
+	if len(source) > maxPromptTemplateLength {
+		return fmt.Errorf("must be at most %d characters", maxPromptTemplateLength)
+	}
+	prompt, err := renderPromptTemplate(source, promptData{DishName: "Pad Thai", Cuisine: "Thai", RestaurantName: "Sample Kitchen"})
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		return fmt.Errorf("renders an empty prompt")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// OpenAI reports the requests and tokens left in its rate limit windows in
+// x-ratelimit-* headers on every response. providerLimits keeps the latest
+// report per provider host and holds back calls from all menus once a window
+// is nearly used up, until it resets, so that a big menu does not run into a
+// cascade of 429s. A 429 pauses the host for its Retry-After. Limits are
+// kept in memory per replica; PROVIDER_RATE_LIMIT_ENABLED=false turns this
+// off.
+
+// providerTokenReserve is how many tokens must be left in the window to send
+// another request; a description needs a few hundred.
+const providerTokenReserve = 1000
+
+// maxProviderThrottle bounds a single wait, in case a provider reports an
+// implausible reset time.
+const maxProviderThrottle = time.Minute
+
+type providerLimiter struct {
+	mu    sync.Mutex
+	hosts map[string]*providerWindow
+}
+
+// providerWindow is what a host last reported about its limits. Remaining
+// requests are counted down locally as calls go out, since concurrent calls
+// only learn of each other from later responses.
+type providerWindow struct {
+	requestsKnown     bool
+	remainingRequests int
+	requestsResetAt   time.Time
+	tokensKnown       bool
+	remainingTokens   int
+	tokensResetAt     time.Time
+	pausedUntil       time.Time
+}
+
+var providerLimits = &providerLimiter{hosts: make(map[string]*providerWindow)}
+
+// wait blocks until host may take another request, or ctx ends.
+func (l *providerLimiter) wait(ctx context.Context, host string) error {
+	if !getEnvBool("PROVIDER_RATE_LIMIT_ENABLED", true) {
+		return nil
+	}
+
+	counted := false
+	for {
+		delay := l.reserve(host)
+		if delay <= 0 {
+			return nil
+		}
+		if !counted {
+			counted = true
+			jobStats.throttled.Add(1)
+			logFor(ctx).Info("Waiting for provider rate limit", zap.String("host", host), zap.Duration("delay", delay))
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// reserve takes one request from host's window and returns 0, or returns how
+// long to wait before trying again.
+func (l *providerLimiter) reserve(host string) time.Duration {
+	now := clock.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	window, ok := l.hosts[host]
+	if !ok {
+		return 0
+	}
+	var until time.Time
+	if now.Before(window.pausedUntil) {
+		until = window.pausedUntil
+	}
+	if window.requestsKnown && window.remainingRequests <= 0 && now.Before(window.requestsResetAt) {
+		until = latest(until, window.requestsResetAt)
+	}
+	if window.tokensKnown && window.remainingTokens < providerTokenReserve && now.Before(window.tokensResetAt) {
+		until = latest(until, window.tokensResetAt)
+	}
+	if !until.IsZero() {
+		return min(until.Sub(now), maxProviderThrottle)
+	}
+
+	if window.requestsKnown {
+		window.remainingRequests--
+	}
+	return 0
+}
+
+// observe records the limits a response from host reported.
+func (l *providerLimiter) observe(host string, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	now := clock.Now()
+	header := resp.Header
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	window, ok := l.hosts[host]
+	if !ok {
+		window = &providerWindow{}
+		l.hosts[host] = window
+	}
+
+	if remaining, resetIn, ok := parseRateLimitHeaders(header, "requests"); ok {
+		window.requestsKnown = true
+		window.remainingRequests = remaining
+		window.requestsResetAt = now.Add(resetIn)
+	}
+	if remaining, resetIn, ok := parseRateLimitHeaders(header, "tokens"); ok {
+		window.tokensKnown = true
+		window.remainingTokens = remaining
+		window.tokensResetAt = now.Add(resetIn)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		pause, ok := parseRetryAfter(header.Get("Retry-After"), now)
+		if !ok {
+			pause = time.Second
+		}
+		window.pausedUntil = latest(window.pausedUntil, now.Add(min(pause, maxProviderThrottle)))
+	}
+}
+
+// parseRateLimitHeaders reads x-ratelimit-remaining-<kind> and
+// x-ratelimit-reset-<kind>, whose reset is a duration such as "6m0s" or
+// "20ms".
+func parseRateLimitHeaders(header http.Header, kind string) (int, time.Duration, bool) {
+	remaining, err := strconv.Atoi(header.Get("x-ratelimit-remaining-" + kind))
+	if err != nil {
+		return 0, 0, false
+	}
+	resetIn, err := time.ParseDuration(header.Get("x-ratelimit-reset-" + kind))
+	if err != nil {
+		return 0, 0, false
+	}
+	return remaining, resetIn, true
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Operators purge a menu or a user's account on request, e.g. to honour a
+// right-to-erasure request. Unlike DELETE /api/menu/:id this also removes
+// the webhook deliveries and idempotency keys that refer to the menus, and
+// for an account its menus, identities, memberships, and the restaurants it
+// is the last owner of. Uploaded images are never stored. Watermarked dish
+// images stored for the menus go with them unless other menus share them
+// through the image cache; other dish images are hosted by the image
+// provider, so only our records of them go. Provider usage rows stay: they
+// hold no personal data and are needed to reconcile invoices. Each purge
+// leaves a receipt that names the subject and counts the rows deleted per
+// table, and nothing else.
+
+const (
+	PurgeSubjectMenu = "menu"
+	PurgeSubjectUser = "user"
+)
+
+// PurgeReceipt records a completed purge.
+type PurgeReceipt struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid"`
+	Subject   string    `json:"subject" gorm:"type:varchar(10)"`
+	SubjectID string    `json:"subject_id" gorm:"type:uuid;index"`
+	Deleted   RowCounts `json:"deleted" gorm:"type:jsonb"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// purgeMenuRows deletes the menus and every row that refers to them in tx,
+// and returns how many rows it deleted per table.
+func purgeMenuRows(tx *gorm.DB, menuIDs []string) (RowCounts, error) {
+	deleted, err := deleteMenuRows(tx, menuIDs)
+	if err != nil || len(menuIDs) == 0 {
+		return deleted, err
+	}
+	result := tx.Where("payload->'data'->>'menu_id' IN ?", menuIDs).Delete(&WebhookDelivery{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	deleted["webhook_deliveries"] += result.RowsAffected
+	result = tx.Where("menu_id IN ?", menuIDs).Delete(&IdempotencyKey{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	deleted["idempotency_keys"] += result.RowsAffected
+	return deleted, nil
+}
+
+// purgeUserRows deletes the user, its menus, and everything that refers to
+// either in tx. Restaurants the user is the last owner of are deleted, and
+// other members' menus in them are moved out; restaurants the user created
+// but others own are handed to their longest-standing owner.
+func purgeUserRows(tx *gorm.DB, userID string, menuIDs []string) (RowCounts, error) {
+	deleted, err := purgeMenuRows(tx, menuIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var restaurantIDs []string
+	if err := tx.Raw(`SELECT m.restaurant_id FROM restaurant_members m
+		WHERE m.user_id = ? AND m.role = ?
+			AND NOT EXISTS (SELECT 1 FROM restaurant_members o
+				WHERE o.restaurant_id = m.restaurant_id AND o.role = ? AND o.user_id <> m.user_id)`,
+		userID, RoleOwner, RoleOwner).Scan(&restaurantIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(restaurantIDs) > 0 {
+		if err := tx.Model(&Menu{}).Where("restaurant_id IN ?", restaurantIDs).Update("restaurant_id", nil).Error; err != nil {
+			return nil, err
+		}
+		result := tx.Where("restaurant_id IN ?", restaurantIDs).Delete(&RestaurantMember{})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		deleted["restaurant_members"] += result.RowsAffected
+		result = tx.Where("id IN ?", restaurantIDs).Delete(&Restaurant{})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		deleted["restaurants"] += result.RowsAffected
+	}
+
+	result := tx.Where("user_id = ?", userID).Delete(&RestaurantMember{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	deleted["restaurant_members"] += result.RowsAffected
+	if err := tx.Exec(`UPDATE restaurants SET user_id = (SELECT o.user_id FROM restaurant_members o
+			WHERE o.restaurant_id = restaurants.id AND o.role = ? ORDER BY o.created_at LIMIT 1)
+		WHERE user_id = ?`, RoleOwner, userID).Error; err != nil {
+		return nil, err
+	}
+
+	result = tx.Where("user_id = ?", userID).Delete(&UserIdentity{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	deleted["user_identities"] += result.RowsAffected
+	// Scopes are the user ID, or the API key ID and the user ID
+	result = tx.Where("scope = ? OR scope LIKE ?", userID, "%:"+userID).Delete(&IdempotencyKey{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	deleted["idempotency_keys"] += result.RowsAffected
+	var webhookIDs []string
+	if err := tx.Model(&Webhook{}).Where("user_id = ?", userID).Pluck("id", &webhookIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(webhookIDs) > 0 {
+		result = tx.Where("webhook_id IN ?", webhookIDs).Delete(&WebhookDelivery{})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		deleted["webhook_deliveries"] += result.RowsAffected
+		result = tx.Where("id IN ?", webhookIDs).Delete(&Webhook{})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		deleted["webhooks"] += result.RowsAffected
+	}
+	result = tx.Where("id = ?", userID).Delete(&User{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	deleted["users"] += result.RowsAffected
+	return deleted, nil
+}
+
+// purge cancels processing of the menus, runs deleteRows, and stores the
+// receipt in the same transaction.
+func purge(subject, subjectID string, menuIDs []string, deleteRows func(tx *gorm.DB) (RowCounts, error)) (*PurgeReceipt, error) {
+	for _, menuID := range menuIDs {
+		if processingJobs.cancel(menuID) {
+			zapLog.Info("Cancelled in-flight menu processing", zap.String("menuID", menuID))
+		}
+	}
+
+	owners := make([]eventOwner, len(menuIDs))
+	for i, menuID := range menuIDs {
+		owners[i] = menuEventOwner(menuID)
+	}
+
+	receipt := PurgeReceipt{
+		ID:        idGen.NewID(),
+		Subject:   subject,
+		SubjectID: subjectID,
+		CreatedAt: clock.Now(),
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		deleted, err := deleteRows(tx)
+		if err != nil {
+			return err
+		}
+		receipt.Deleted = deleted
+		return tx.Create(&receipt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, menuID := range menuIDs {
+		emitEvent(EventMenuDeleted, owners[i], gin.H{"menu_id": menuID})
+	}
+	zapLog.Info("Purged "+subject, zap.String("subjectID", subjectID), zap.String("receiptID", receipt.ID))
+	return &receipt, nil
+}
+
+func purgeMenuHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	menuIDs := []string{menu.ID}
+	receipt, err := purge(PurgeSubjectMenu, menu.ID, menuIDs, func(tx *gorm.DB) (RowCounts, error) {
+		return purgeMenuRows(tx, menuIDs)
+	})
+	if err != nil {
+		zapLog.Error("Failed to purge menu", zap.String("menuID", menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to purge menu")
+		return
+	}
+
+	c.JSON(http.StatusOK, receipt)
+}
+
+func purgeUserHandler(c *gin.Context) {
+	var user User
+	if err := db.Select("id").Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+		respondError(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	}
+
+	var menuIDs []string
+	if err := db.Model(&Menu{}).Where("user_id = ?", user.ID).Pluck("id", &menuIDs).Error; err != nil {
+		zapLog.Error("Failed to load user's menus", zap.String("userID", user.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to purge user")
+		return
+	}
+
+	receipt, err := purge(PurgeSubjectUser, user.ID, menuIDs, func(tx *gorm.DB) (RowCounts, error) {
+		return purgeUserRows(tx, user.ID, menuIDs)
+	})
+	if err != nil {
+		zapLog.Error("Failed to purge user", zap.String("userID", user.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to purge user")
+		return
+	}
+
+	c.JSON(http.StatusOK, receipt)
+}
+
+func getPurgeReceiptHandler(c *gin.Context) {
+	var receipt PurgeReceipt
+	if err := db.Where("id = ?", c.Param("id")).First(&receipt).Error; err != nil {
+		respondError(c, http.StatusNotFound, "RECEIPT_NOT_FOUND", "Purge receipt not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, receipt)
+}
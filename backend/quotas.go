@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quotas limit what an API key's clients may upload: menus per calendar
+// month (UTC) and dishes per menu. Limits come from the key's plan and can be
+// overridden per key; 0 means unlimited. Requests without an API key, which
+// only happen with REQUIRE_API_KEY=false, and gRPC uploads are not limited.
+
+const defaultQuotaPlan = "default"
+
+// quotaPlan holds the limits of a plan. The default plan reads
+// QUOTA_MENUS_PER_MONTH and QUOTA_DISHES_PER_MENU; a plan such as "pro" reads
+// QUOTA_PRO_MENUS_PER_MONTH and QUOTA_PRO_DISHES_PER_MENU, falling back to
+// the default plan.
+type quotaPlan struct {
+	Name          string
+	MenusPerMonth int
+	DishesPerMenu int
+}
+
+func loadQuotaPlan(name string) quotaPlan {
+	plan := quotaPlan{
+		Name:          defaultQuotaPlan,
+		MenusPerMonth: getEnvInt("QUOTA_MENUS_PER_MONTH", 0),
+		DishesPerMenu: getEnvInt("QUOTA_DISHES_PER_MENU", 0),
+	}
+	if name == "" || name == defaultQuotaPlan {
+		return plan
+	}
+	prefix := "QUOTA_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+	plan.Name = name
+	plan.MenusPerMonth = getEnvInt(prefix+"MENUS_PER_MONTH", plan.MenusPerMonth)
+	plan.DishesPerMenu = getEnvInt(prefix+"DISHES_PER_MENU", plan.DishesPerMenu)
+	return plan
+}
+
+// quotaPlanFor returns the limits that apply to key: its plan with the key's
+// own overrides.
+func quotaPlanFor(key *APIKey) quotaPlan {
+	plan := loadQuotaPlan(key.Plan)
+	if key.MenusPerMonth != nil {
+		plan.MenusPerMonth = *key.MenusPerMonth
+	}
+	if key.DishesPerMenu != nil {
+		plan.DishesPerMenu = *key.DishesPerMenu
+	}
+	return plan
+}
+
+// QuotaUsage counts the menus an API key created in a month. Counting at
+// upload time, rather than counting menus, keeps deleted menus charged.
+type QuotaUsage struct {
+	APIKeyID  string `gorm:"primaryKey;type:uuid"`
+	Period    string `gorm:"primaryKey;type:varchar(7)"`
+	Menus     int    `gorm:"default:0"`
+	UpdatedAt time.Time
+}
+
+// QuotaResponse is an API key's quota and what is left of it. Null limits
+// are unlimited.
+type QuotaResponse struct {
+	Plan          string     `json:"plan"`
+	Period        string     `json:"period"`
+	ResetsAt      time.Time  `json:"resets_at"`
+	MenusPerMonth QuotaLimit `json:"menus_per_month"`
+	DishesPerMenu *int       `json:"dishes_per_menu"`
+	// RetentionDays is how long the key's menus are kept after their last
+	// update; null keeps them forever
+	RetentionDays *int `json:"retention_days"`
+}
+
+type QuotaLimit struct {
+	Limit     *int `json:"limit"`
+	Used      int  `json:"used"`
+	Remaining *int `json:"remaining"`
+}
+
+// APIKeyQuotaRequest sets a key's plan and overrides. Null overrides use the
+// plan's limits, and a null retention MENU_RETENTION_DAYS.
+type APIKeyQuotaRequest struct {
+	Plan          string `json:"plan" binding:"required,max=50"`
+	MenusPerMonth *int   `json:"menus_per_month" binding:"omitempty,min=0"`
+	DishesPerMenu *int   `json:"dishes_per_menu" binding:"omitempty,min=0"`
+	// RetentionDays of 0 keeps the key's menus forever
+	RetentionDays *int `json:"retention_days" binding:"omitempty,min=0"`
+}
+
+// quotaExceededError reports a quota that stopped an upload.
+type quotaExceededError struct {
+	Limit    int
+	ResetsAt time.Time
+}
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf("Monthly quota of %d menus reached; it resets at %s", e.Limit, e.ResetsAt.Format(time.RFC3339))
+}
+
+// quotaPeriod returns the month containing now, as "2006-01", and when the
+// next one starts.
+func quotaPeriod(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// reserveMenuQuota counts a new menu against key's monthly quota, failing
+// with a *quotaExceededError when none is left. The check and the increment
+// are one statement, so concurrent uploads cannot overshoot.
+func reserveMenuQuota(key *APIKey) error {
+	if key == nil {
+		return nil
+	}
+	plan := quotaPlanFor(key)
+	now := clock.Now()
+	period, resetsAt := quotaPeriod(now)
+
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&QuotaUsage{APIKeyID: key.ID, Period: period, UpdatedAt: now}).Error; err != nil {
+		return err
+	}
+	query := db.Model(&QuotaUsage{}).Where("api_key_id = ? AND period = ?", key.ID, period)
+	if plan.MenusPerMonth > 0 {
+		query = query.Where("menus < ?", plan.MenusPerMonth)
+	}
+	result := query.Updates(map[string]interface{}{"menus": gorm.Expr("menus + 1"), "updated_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &quotaExceededError{Limit: plan.MenusPerMonth, ResetsAt: resetsAt}
+	}
+	return nil
+}
+
+// releaseMenuQuota gives back a reservation for a menu that was not created.
+func releaseMenuQuota(key *APIKey) {
+	if key == nil {
+		return
+	}
+	period, _ := quotaPeriod(clock.Now())
+	if err := db.Model(&QuotaUsage{}).
+		Where("api_key_id = ? AND period = ? AND menus > 0", key.ID, period).
+		Update("menus", gorm.Expr("menus - 1")).Error; err != nil {
+		zapLog.Warn("Failed to release menu quota", zap.String("apiKeyID", key.ID), zap.Error(err))
+	}
+}
+
+// checkDishQuota fails the menu when the extracted menu has more dishes than
+// the uploading key's plan allows, before any dish is enhanced.
+func checkDishQuota(menuID string, dishes int) bool {
+	var menu Menu
+	if err := db.Select("id", "api_key_id").Where("id = ?", menuID).First(&menu).Error; err != nil || menu.APIKeyID == nil {
+		return true
+	}
+	var key APIKey
+	if err := db.Where("id = ?", *menu.APIKeyID).First(&key).Error; err != nil {
+		return true
+	}
+	plan := quotaPlanFor(&key)
+	if plan.DishesPerMenu <= 0 || dishes <= plan.DishesPerMenu {
+		return true
+	}
+
+	zapLog.Info("Menu exceeds dish quota", zap.String("menuID", menuID), zap.Int("dishes", dishes), zap.Int("limit", plan.DishesPerMenu))
+	failMenuWithCode(menuID, "DISH_QUOTA_EXCEEDED", fmt.Sprintf("Menu has %d dishes; the %s plan allows %d per menu", dishes, plan.Name, plan.DishesPerMenu))
+	return false
+}
+
+// getQuotaHandler reports the calling API key's quota for this month.
+func getQuotaHandler(c *gin.Context) {
+	value, ok := c.Get("apiKey")
+	if !ok {
+		respondError(c, http.StatusNotFound, "NO_QUOTA", "Requests without an API key have no quota")
+		return
+	}
+	response, err := buildQuotaResponse(value.(*APIKey))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load quota")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func buildQuotaResponse(key *APIKey) (QuotaResponse, error) {
+	plan := quotaPlanFor(key)
+	period, resetsAt := quotaPeriod(clock.Now())
+
+	var usage QuotaUsage
+	err := db.Where("api_key_id = ? AND period = ?", key.ID, period).First(&usage).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return QuotaResponse{}, err
+	}
+
+	response := QuotaResponse{
+		Plan:          plan.Name,
+		Period:        period,
+		ResetsAt:      resetsAt,
+		MenusPerMonth: QuotaLimit{Used: usage.Menus},
+	}
+	if plan.MenusPerMonth > 0 {
+		remaining := max(plan.MenusPerMonth-usage.Menus, 0)
+		response.MenusPerMonth.Limit = &plan.MenusPerMonth
+		response.MenusPerMonth.Remaining = &remaining
+	}
+	if plan.DishesPerMenu > 0 {
+		response.DishesPerMenu = &plan.DishesPerMenu
+	}
+	retentionDays := getEnvInt("MENU_RETENTION_DAYS", 0)
+	if key.RetentionDays != nil {
+		retentionDays = *key.RetentionDays
+	}
+	if retentionDays > 0 {
+		response.RetentionDays = &retentionDays
+	}
+	return response, nil
+}
+
+// setAPIKeyQuotaHandler moves a key to a plan and sets or clears its
+// overrides.
+func setAPIKeyQuotaHandler(c *gin.Context) {
+	key, ok := loadAPIKey(c)
+	if !ok {
+		return
+	}
+
+	var req APIKeyQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := db.Model(&APIKey{}).Where("id = ?", key.ID).Updates(map[string]interface{}{
+		"plan":            strings.TrimSpace(req.Plan),
+		"menus_per_month": req.MenusPerMonth,
+		"dishes_per_menu": req.DishesPerMenu,
+		"retention_days":  req.RetentionDays,
+	}).Error; err != nil {
+		zapLog.Error("Failed to update API key quota", zap.String("apiKeyID", key.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update quota")
+		return
+	}
+	if err := db.Where("id = ?", key.ID).First(key).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load API key")
+		return
+	}
+
+	response, err := buildQuotaResponse(key)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load quota")
+		return
+	}
+	zapLog.Info("API key quota updated", zap.String("apiKeyID", key.ID), zap.String("plan", response.Plan))
+	c.JSON(http.StatusOK, response)
+}
+
+// getAPIKeyQuotaHandler shows operators a key's quota as its client sees it.
+func getAPIKeyQuotaHandler(c *gin.Context) {
+	key, ok := loadAPIKey(c)
+	if !ok {
+		return
+	}
+	response, err := buildQuotaResponse(key)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load quota")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// windowLimiter is a fixed-window, in-memory limiter keyed by an arbitrary
+// string (typically the client IP).
+type windowLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*limiterWindow
+}
+
+type limiterWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+func newWindowLimiter(limit int, window time.Duration) *windowLimiter {
+	return &windowLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*limiterWindow),
+	}
+}
+
+// Allow records a hit for key and reports whether it is within the limit.
+func (l *windowLimiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock.Now()
+	w, ok := l.windows[key]
+	if !ok || now.After(w.resetAt) {
+		// Drop expired windows opportunistically so the map stays bounded
+		if len(l.windows) > 10000 {
+			for k, existing := range l.windows {
+				if now.After(existing.resetAt) {
+					delete(l.windows, k)
+				}
+			}
+		}
+		w = &limiterWindow{resetAt: now.Add(l.window)}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// tokenBucketLimiter is an in-memory token bucket per key: each key may make
+// burst requests at once and then one per 1/rate seconds.
+type tokenBucketLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newTokenBucketLimiter allows perMinute requests a minute per key, with
+// bursts of up to burst. A non-positive perMinute disables it.
+func newTokenBucketLimiter(perMinute, burst int) *tokenBucketLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucketLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Take spends a token of key's bucket. When the bucket is empty it returns
+// false and how long until the next token.
+func (l *tokenBucketLimiter) Take(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		// Full buckets are the same as no bucket, so drop them to keep the
+		// map bounded
+		if len(l.buckets) > 10000 {
+			for k, existing := range l.buckets {
+				if existing.tokens+now.Sub(existing.updated).Seconds()*l.rate >= l.burst {
+					delete(l.buckets, k)
+				}
+			}
+		}
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// rateLimit throttles an expensive endpoint per client IP and per API key.
+// A key is usually shared by every user of a frontend, so its limit is set
+// separately and should be higher.
+type rateLimit struct {
+	perIP  *tokenBucketLimiter
+	perKey *tokenBucketLimiter
+}
+
+// newRateLimit reads the limits for name from <NAME>_RATE_LIMIT_PER_MINUTE,
+// <NAME>_RATE_LIMIT_BURST, <NAME>_KEY_RATE_LIMIT_PER_MINUTE, and
+// <NAME>_KEY_RATE_LIMIT_BURST; bursts default to twice the rate.
+func newRateLimit(name string, ipPerMinute, keyPerMinute int) *rateLimit {
+	ipPerMinute = getEnvInt(name+"_RATE_LIMIT_PER_MINUTE", ipPerMinute)
+	keyPerMinute = getEnvInt(name+"_KEY_RATE_LIMIT_PER_MINUTE", keyPerMinute)
+	return &rateLimit{
+		perIP:  newTokenBucketLimiter(ipPerMinute, getEnvInt(name+"_RATE_LIMIT_BURST", 2*ipPerMinute)),
+		perKey: newTokenBucketLimiter(keyPerMinute, getEnvInt(name+"_KEY_RATE_LIMIT_BURST", 2*keyPerMinute)),
+	}
+}
+
+var (
+	// uploadRateLimit and regenerateRateLimit guard the endpoints that start
+	// AI work. They are configured in main, before the router is built.
+	uploadRateLimit     *rateLimit
+	regenerateRateLimit *rateLimit
+)
+
+// trustedProxies are the addresses, or CIDR ranges, of the reverse proxies
+// in front of the service, from the comma-separated TRUSTED_PROXIES. Only
+// their X-Forwarded-For is believed when telling the client IP that rate
+// limits are kept by; by default none are, and the IP is that of the
+// connection.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// limitRate answers 429 with Retry-After once the client IP or its API key
+// has used up its tokens. It runs after requireAPIKey; a nil limit lets
+// everything through.
+func limitRate(limit *rateLimit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit == nil {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter := limit.perIP.Take(c.ClientIP())
+		if allowed {
+			if key, ok := c.Get("apiKey"); ok {
+				allowed, retryAfter = limit.perKey.Take(key.(*APIKey).ID)
+			}
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			respondError(c, http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests, try again later")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
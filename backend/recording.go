@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Provider interactions can be recorded to disk and replayed, so a bug seen
+// on a particular menu photo can be reproduced without the provider, or its
+// randomness. With PROVIDER_RECORD_DIR set, every provider request and the
+// response it got are written to that directory as a JSON file, named after
+// the request; Authorization and other secret headers are redacted. With
+// PROVIDER_REPLAY_DIR set, requests are answered from the recordings there
+// and never sent, and provider keys are not needed. A request is matched on
+// its method, path, and body, less the random image seed; one with no
+// recording answers 501 with NOT RECORDED and the file it looked for.
+
+func providerRecordDir() string {
+	return strings.TrimSpace(os.Getenv("PROVIDER_RECORD_DIR"))
+}
+
+func providerReplayDir() string {
+	return strings.TrimSpace(os.Getenv("PROVIDER_REPLAY_DIR"))
+}
+
+// providerRecording is one recorded request and its response.
+type providerRecording struct {
+	Request    recordedMessage `json:"request"`
+	Response   recordedMessage `json:"response"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+// recordedMessage is a request or response. JSON bodies are kept as JSON so
+// recordings can be read and edited; others are kept as text.
+type recordedMessage struct {
+	Method string          `json:"method,omitempty"`
+	URL    string          `json:"url,omitempty"`
+	Status int             `json:"status,omitempty"`
+	Header http.Header     `json:"header"`
+	JSON   json.RawMessage `json:"json,omitempty"`
+	Text   string          `json:"text,omitempty"`
+}
+
+func (m recordedMessage) body() []byte {
+	if len(m.JSON) > 0 {
+		return m.JSON
+	}
+	return []byte(m.Text)
+}
+
+func newRecordedMessage(header http.Header, body []byte) recordedMessage {
+	message := recordedMessage{Header: redactHeaders(header)}
+	// Bodies are indented in the file, so their length changes
+	message.Header.Del("Content-Length")
+	if json.Valid(body) {
+		message.JSON = body
+	} else {
+		message.Text = string(body)
+	}
+	return message
+}
+
+// secretHeaders are the headers whose values recordings leave out.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	"Api-Key":             true,
+	"Openai-Organization": true,
+	"Openai-Project":      true,
+}
+
+// redactHeaders copies header with the values of secretHeaders replaced.
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name := range redacted {
+		if secretHeaders[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{"REDACTED"}
+		}
+	}
+	return redacted
+}
+
+// recordingName is the file name of the recording of a request, readable
+// enough to find a stage's requests in the directory.
+func recordingName(req *http.Request, body []byte) string {
+	// The seed is picked at random per image request, so it is left out
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) == nil {
+		if input, ok := fields["input"].(map[string]interface{}); ok {
+			delete(input, "seed")
+		}
+		// Marshaling sorts the keys, so equal bodies hash the same
+		body, _ = json.Marshal(fields)
+	}
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.RequestURI() + "\n" + string(body)))
+
+	slug := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(req.URL.Hostname()+req.URL.Path))
+	return slug + "-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// requestBody reads req's body, leaving it in place to be sent.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// recordProviderCall sends req and writes it and its response to dir.
+// Failing to write the recording does not fail the request.
+func recordProviderCall(dir string, client *http.Client, req *http.Request) (*http.Response, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err != nil {
+		return resp, err
+	}
+
+	recording := providerRecording{
+		Request:    newRecordedMessage(req.Header, body),
+		Response:   newRecordedMessage(resp.Header, respBody),
+		RecordedAt: clock.Now(),
+	}
+	recording.Request.Method = req.Method
+	recording.Request.URL = req.URL.String()
+	recording.Response.Status = resp.StatusCode
+
+	name := recordingName(req, body)
+	data, err := json.MarshalIndent(recording, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(dir, 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, name), data, 0o600)
+	}
+	if err != nil {
+		logFor(req.Context()).Warn("Failed to record provider call", zap.String("file", name), zap.Error(err))
+	}
+	return resp, nil
+}
+
+// replayProviderCall answers req from its recording in dir.
+func replayProviderCall(dir string, req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	name := recordingName(req, body)
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		logFor(req.Context()).Warn("No recording for provider call", zap.String("method", req.Method), zap.String("url", req.URL.String()), zap.String("file", name))
+		// 501 is not retried
+		return jsonFixtureResponse(req, http.StatusNotImplemented, map[string]interface{}{
+			"error": fmt.Sprintf("NOT RECORDED: no recording %s for %s %s", name, req.Method, req.URL.Path),
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	var recording providerRecording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, fmt.Errorf("failed to decode recording %s: %w", name, err)
+	}
+
+	header := recording.Response.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return fixtureResponse(req, recording.Response.Status, header, recording.Response.body()), nil
+}
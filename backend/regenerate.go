@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type RegenerateImageRequest struct {
+	PromptHint string `json:"prompt_hint" binding:"max=200"`
+	// Style overrides the menu's image style for this image
+	Style string `json:"style" binding:"omitempty,oneof=rustic fine_dining street_food flat_lay"`
+}
+
+type RegenerateDescriptionRequest struct {
+	Tone string `json:"tone" binding:"omitempty,oneof=casual fine-dining playful"`
+}
+
+// descriptionTones maps the tones owners can pick to extra system-prompt guidance.
+var descriptionTones = map[string]string{
+	"casual":      "Write in a relaxed, friendly voice, like a neighborhood bistro chalkboard.",
+	"fine-dining": "Write in a refined, elegant voice suited to a fine-dining tasting menu, highlighting technique and provenance.",
+	"playful":     "Write in a fun, playful voice with a light touch of humor.",
+}
+
+type RegenerateResponse struct {
+	DishID string `json:"dish_id"`
+	Status string `json:"status"`
+}
+
+// regenerateDishImageHandler re-runs image generation for one dish in the
+// background. Clients poll the menu (or dish) until the status leaves
+// REGENERATING; the previous image is kept if generation fails.
+func regenerateDishImageHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	var req RegenerateImageRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	if !requireImageGeneration(c, dish) || !beginDishRegeneration(c, dish) {
+		return
+	}
+
+	target, promptHint := *dish, strings.TrimSpace(req.PromptHint)
+	runInBackground(target.MenuID, func(ctx context.Context) { regenerateDishImage(ctx, target, req.Style, promptHint) })
+
+	c.JSON(http.StatusAccepted, RegenerateResponse{DishID: dish.ID, Status: "REGENERATING"})
+}
+
+// regenerateDishDescriptionHandler rewrites one dish's description in the
+// background with an optional tone, leaving the rest of the menu untouched.
+func regenerateDishDescriptionHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	var req RegenerateDescriptionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	if !beginDishRegeneration(c, dish) {
+		return
+	}
+
+	target := *dish
+	runInBackground(target.MenuID, func(ctx context.Context) { regenerateDishDescription(ctx, target, req.Tone) })
+
+	c.JSON(http.StatusAccepted, RegenerateResponse{DishID: dish.ID, Status: "REGENERATING"})
+}
+
+// beginDishRegeneration atomically moves the dish into REGENERATING, writing a
+// 409 response when another regeneration is already running.
+func beginDishRegeneration(c *gin.Context, dish *Dish) bool {
+	claimed, err := claimDishRegeneration(dish.ID)
+	if err != nil {
+		zapLog.Error("Failed to start regeneration", zap.String("dishID", dish.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to start regeneration")
+		return false
+	}
+	if !claimed {
+		respondError(c, http.StatusConflict, "REGENERATION_IN_PROGRESS", "Dish is already being regenerated")
+		return false
+	}
+	return true
+}
+
+// regenerationTimeout is how long a dish may stay REGENERATING before its
+// regeneration is taken to have died with the process that ran it, set by
+// REGENERATION_TIMEOUT (default 30m).
+func regenerationTimeout() time.Duration {
+	return getEnvDuration("REGENERATION_TIMEOUT", 30*time.Minute)
+}
+
+// claimDishRegeneration moves the dish into REGENERATING, remembering the
+// status it had, and reports whether it did; false means another
+// regeneration is already running. A regeneration older than
+// regenerationTimeout no longer holds the dish.
+func claimDishRegeneration(dishID string) (bool, error) {
+	now := clock.Now()
+	result := db.Model(&Dish{}).
+		Where("id = ? AND (status <> ? OR updated_at < ?)", dishID, "REGENERATING", now.Add(-regenerationTimeout())).
+		Updates(map[string]interface{}{
+			"status_before_regen": gorm.Expr("CASE WHEN status = ? THEN status_before_regen ELSE status END", "REGENERATING"),
+			"status":              "REGENERATING",
+			"updated_at":          now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// finishDishRegeneration applies updates (if any) and restores the dish's
+// previous status.
+func finishDishRegeneration(dish Dish, updates map[string]interface{}) {
+	changed := len(updates) > 0
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	status := dish.Status
+	if status == "REGENERATING" {
+		status = "COMPLETE"
+	}
+	updates["status"] = gorm.Expr("COALESCE(status_before_regen, ?)", status)
+	updates["status_before_regen"] = nil
+	updates["updated_at"] = clock.Now()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if changed {
+			if err := beginMenuEdit(tx, dish.MenuID, "regenerate"); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&Dish{}).Where("id = ?", dish.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return touchMenu(tx, dish.MenuID)
+	})
+	if err != nil {
+		zapLog.Error("Failed to finish regeneration", zap.String("dishID", dish.ID), zap.Error(err))
+	}
+}
+
+// resetStaleRegenerations returns dishes that have been REGENERATING for
+// longer than regenerationTimeout to the status they had before, and
+// reports how many it reset. Their regeneration is not retried.
+func resetStaleRegenerations(ctx context.Context) (int64, error) {
+	now := clock.Now()
+	result := db.WithContext(ctx).Model(&Dish{}).
+		Where("status = ? AND updated_at < ?", "REGENERATING", now.Add(-regenerationTimeout())).
+		Updates(map[string]interface{}{
+			"status":              gorm.Expr("COALESCE(status_before_regen, ?)", "COMPLETE"),
+			"status_before_regen": nil,
+			"updated_at":          now,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// runRegenerationSweeper resets stale regenerations now and then every
+// interval until ctx is cancelled. Only one replica sweeps at a time; the
+// others skip that tick.
+func runRegenerationSweeper(ctx context.Context, interval time.Duration) {
+	sweep := func() {
+		_, err := withJobLock(ctx, jobRegenSweep, func(ctx context.Context) error {
+			reset, err := resetStaleRegenerations(ctx)
+			if reset > 0 {
+				zapLog.Warn("Reset dishes stuck in REGENERATING", zap.Int64("dishes", reset))
+			}
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			zapLog.Error("Regeneration sweep failed", zap.Error(err))
+		}
+	}
+
+	sweep()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep()
+		}
+	}
+}
+
+func regenerateDishImage(ctx context.Context, dish Dish, style, promptHint string) {
+	imageURL, record, err := generateDishImage(ctx, dish.MenuID, dish.Name, dish.Cuisine, style, promptHint)
+	if err != nil {
+		zapLog.Error("Failed to regenerate image", zap.String("dishID", dish.ID), zap.Error(err))
+		finishDishRegeneration(dish, nil)
+		return
+	}
+
+	if err := recordDishImages(db, dish, []string{*imageURL}, record, true); err != nil {
+		zapLog.Error("Failed to store image candidate", zap.String("dishID", dish.ID), zap.Error(err))
+	}
+
+	updates := map[string]interface{}{
+		"image_url":           *imageURL,
+		"generation_metadata": mergeGenerationMetadata(dish.GenerationMetadata, nil, record),
+	}
+	if dish.ImageAlt == nil {
+		updates["image_alt"] = dishImageAlt(dish.Name, dish.Description)
+	}
+	finishDishRegeneration(dish, updates)
+	zapLog.Info("Dish image regenerated", zap.String("dishID", dish.ID))
+}
+
+func regenerateDishDescription(ctx context.Context, dish Dish, tone string) {
+	description, record, err := generateDishDescription(ctx, dish.MenuID, dish.Name, dish.Cuisine, tone)
+	if err != nil {
+		zapLog.Error("Failed to regenerate description", zap.String("dishID", dish.ID), zap.Error(err))
+		finishDishRegeneration(dish, nil)
+		return
+	}
+
+	description, truncated := sanitizeText(description, loadSanitizeLimits().Description)
+	if truncated {
+		addMenuWarnings(dish.MenuID, MenuWarning{
+			Code:    "DESCRIPTION_TRUNCATED",
+			Message: fmt.Sprintf("Description for %q was truncated", dish.Name),
+		})
+	}
+
+	updates := map[string]interface{}{
+		"description":         description,
+		"generation_metadata": mergeGenerationMetadata(dish.GenerationMetadata, record, nil),
+	}
+	// The alt text follows the new description
+	if dish.ImageURL != nil {
+		updates["image_alt"] = dishImageAlt(dish.Name, &description)
+	}
+	finishDishRegeneration(dish, updates)
+	zapLog.Info("Dish description regenerated", zap.String("dishID", dish.ID), zap.String("tone", tone))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DishRendition is a named image variant of a dish generated for a specific
+// use, such as a square card or a wide hero banner. Generating a rendition
+// again under the same name replaces it.
+type DishRendition struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DishID      string    `json:"dish_id" gorm:"type:uuid;uniqueIndex:idx_dish_rendition_name"`
+	MenuID      string    `json:"menu_id" gorm:"type:uuid;index"`
+	Name        string    `json:"name" gorm:"uniqueIndex:idx_dish_rendition_name"`
+	AspectRatio string    `json:"aspect_ratio"`
+	Size        string    `json:"size"`
+	URL         string    `json:"url"`
+	Prompt      string    `json:"prompt"`
+	Seed        *int      `json:"seed"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type RenditionSpec struct {
+	Name        string `json:"name" binding:"required"`
+	AspectRatio string `json:"aspect_ratio"`
+	Size        string `json:"size"`
+}
+
+type GenerateRenditionsRequest struct {
+	Renditions []RenditionSpec `json:"renditions" binding:"required,min=1,max=4,dive"`
+	PromptHint string          `json:"prompt_hint" binding:"max=200"`
+}
+
+// renditionPresets are the aspect ratios of the standard renditions. Other
+// names must give an aspect ratio explicitly.
+var renditionPresets = map[string]string{
+	"card":   "1:1",
+	"hero":   "16:9",
+	"social": "4:5",
+}
+
+// renditionAspectRatios are the aspect ratios the image model accepts.
+var renditionAspectRatios = map[string]bool{
+	"1:1": true, "16:9": true, "21:9": true, "3:2": true, "2:3": true, "4:5": true,
+	"5:4": true, "3:4": true, "4:3": true, "9:16": true, "9:21": true,
+}
+
+// renditionSizes maps size names to the model's megapixels setting.
+var renditionSizes = map[string]string{
+	"standard": "1",
+	"small":    "0.25",
+}
+
+var renditionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// normalizeRenditionSpecs validates the requested renditions and fills in
+// preset aspect ratios and the default size.
+func normalizeRenditionSpecs(specs []RenditionSpec) ([]RenditionSpec, string) {
+	seen := make(map[string]bool, len(specs))
+	normalized := make([]RenditionSpec, len(specs))
+	for i, spec := range specs {
+		spec.Name = strings.ToLower(strings.TrimSpace(spec.Name))
+		if !renditionNamePattern.MatchString(spec.Name) {
+			return nil, "rendition names must be 1-32 lowercase letters, digits, or dashes"
+		}
+		if seen[spec.Name] {
+			return nil, "duplicate rendition name: " + spec.Name
+		}
+		seen[spec.Name] = true
+
+		if spec.AspectRatio == "" {
+			spec.AspectRatio = renditionPresets[spec.Name]
+		}
+		if spec.AspectRatio == "" {
+			return nil, "aspect_ratio is required for rendition " + spec.Name
+		}
+		if !renditionAspectRatios[spec.AspectRatio] {
+			return nil, "unsupported aspect_ratio: " + spec.AspectRatio
+		}
+
+		if spec.Size == "" {
+			spec.Size = "standard"
+		}
+		if _, ok := renditionSizes[spec.Size]; !ok {
+			return nil, "size must be standard or small"
+		}
+		normalized[i] = spec
+	}
+	return normalized, ""
+}
+
+func listDishRenditionsHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	renditions := []DishRendition{}
+	if err := db.Where("dish_id = ?", dish.ID).Order("name").Find(&renditions).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load renditions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"renditions": renditions})
+}
+
+// generateDishRenditionsHandler generates the requested renditions in the
+// background. The dish is REGENERATING until all of them are done; a
+// rendition that fails to generate keeps its previous image.
+func generateDishRenditionsHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	var req GenerateRenditionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	specs, problem := normalizeRenditionSpecs(req.Renditions)
+	if problem != "" {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", problem)
+		return
+	}
+
+	if !requireImageGeneration(c, dish) || !beginDishRegeneration(c, dish) {
+		return
+	}
+
+	runInBackground(dish.MenuID, func(ctx context.Context) {
+		dish := *dish
+		for _, spec := range specs {
+			if ctx.Err() != nil {
+				break
+			}
+			shape := imageShape{AspectRatio: spec.AspectRatio, Megapixels: renditionSizes[spec.Size]}
+			imageURLs, record, err := generateShapedDishImages(ctx, dish.MenuID, dish.Name, dish.Cuisine, "", strings.TrimSpace(req.PromptHint), 1, shape)
+			if err != nil {
+				zapLog.Error("Failed to generate rendition", zap.String("dishID", dish.ID), zap.String("rendition", spec.Name), zap.Error(err))
+				continue
+			}
+
+			if err := saveDishRendition(db, dish, spec, imageURLs[0], record); err != nil {
+				zapLog.Error("Failed to store rendition", zap.String("dishID", dish.ID), zap.String("rendition", spec.Name), zap.Error(err))
+			}
+		}
+		finishDishRegeneration(dish, nil)
+	})
+
+	c.JSON(http.StatusAccepted, RegenerateResponse{DishID: dish.ID, Status: "REGENERATING"})
+}
+
+// saveDishRendition creates or replaces the dish's rendition of spec.Name.
+func saveDishRendition(tx *gorm.DB, dish Dish, spec RenditionSpec, imageURL string, record *GenerationRecord) error {
+	rendition := DishRendition{
+		ID:          idGen.NewID(),
+		DishID:      dish.ID,
+		MenuID:      dish.MenuID,
+		Name:        spec.Name,
+		AspectRatio: spec.AspectRatio,
+		Size:        spec.Size,
+		URL:         imageURL,
+		Prompt:      record.Prompt,
+		Seed:        record.Seed,
+		CreatedAt:   clock.Now(),
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "dish_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"aspect_ratio", "size", "url", "prompt", "seed", "created_at"}),
+	}).Create(&rendition).Error
+}
+
+// attachDishRenditions loads the renditions of the menu's dishes for responses.
+func attachDishRenditions(menu *Menu) error {
+	var renditions []DishRendition
+	if err := db.Where("menu_id = ?", menu.ID).Order("name").Find(&renditions).Error; err != nil {
+		return err
+	}
+
+	byDish := make(map[string][]DishRendition)
+	for _, rendition := range renditions {
+		byDish[rendition.DishID] = append(byDish[rendition.DishID], rendition)
+	}
+	for i := range menu.Dishes {
+		menu.Dishes[i].Renditions = byDish[menu.Dishes[i].ID]
+	}
+	return nil
+}
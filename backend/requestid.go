@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Every request gets an ID, taken from the client's X-Request-ID header when
+// it sends a usable one. The ID is echoed in the response and logged with
+// everything the request starts, including the background processing of an
+// uploaded menu, so a failed dish can be traced back to its upload.
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// withRequestID returns ctx carrying id; an empty id leaves ctx as it is.
+func withRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the request ID carried by ctx, or "".
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logFor returns the logger for work done on behalf of ctx's request.
+func logFor(ctx context.Context) *zap.Logger {
+	if id := requestIDFrom(ctx); id != "" {
+		return zapLog.With(zap.String("requestID", id))
+	}
+	return zapLog
+}
+
+// newRequestID keeps a client's ID if it is short printable ASCII without
+// spaces, so it cannot forge log lines, and generates one otherwise.
+func newRequestID(provided string) string {
+	if provided == "" || len(provided) > maxRequestIDLength {
+		return idGen.NewID()
+	}
+	for _, r := range provided {
+		if r <= ' ' || r > '~' {
+			return idGen.NewID()
+		}
+	}
+	return provided
+}
+
+// assignRequestID gives the request its ID, as "requestID" in the gin context
+// and in the request's context for logFor.
+func assignRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := newRequestID(c.GetHeader(requestIDHeader))
+		c.Set("requestID", id)
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
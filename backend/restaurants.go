@@ -0,0 +1,365 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Restaurant groups menus, e.g. lunch, dinner, and seasonal menus of one
+// place, and the staff who work on them (see RestaurantMember). Dishes
+// extracted from its menus are priced in DefaultCurrency when neither the
+// upload nor the menu itself names a currency.
+type Restaurant struct {
+	ID              string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID          string    `json:"-" gorm:"type:uuid;index"`
+	Name            string    `json:"name"`
+	Address         *string   `json:"address"`
+	LogoURL         *string   `json:"logo_url"`
+	DefaultCurrency string    `json:"default_currency" gorm:"type:varchar(3);default:'USD'"`
+	MenuCount       int64     `json:"menu_count" gorm:"-"`
+	Role            string    `json:"role" gorm:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type RestaurantCreateRequest struct {
+	Name            string  `json:"name" binding:"required,max=200"`
+	Address         *string `json:"address" binding:"omitempty,max=500"`
+	LogoURL         *string `json:"logo_url"`
+	DefaultCurrency string  `json:"default_currency" binding:"omitempty,len=3"`
+}
+
+// RestaurantUpdateRequest carries a partial edit; nil fields are left
+// untouched and empty strings clear the address and logo.
+type RestaurantUpdateRequest struct {
+	Name            *string `json:"name" binding:"omitempty,max=200"`
+	Address         *string `json:"address" binding:"omitempty,max=500"`
+	LogoURL         *string `json:"logo_url"`
+	DefaultCurrency *string `json:"default_currency" binding:"omitempty,len=3"`
+}
+
+// MenuRestaurantRequest moves a menu into a restaurant, or out of it when
+// RestaurantID is null.
+type MenuRestaurantRequest struct {
+	RestaurantID *string `json:"restaurant_id"`
+}
+
+const defaultMenuCurrency = "USD"
+
+// listRestaurantsHandler lists the restaurants the signed-in user is a
+// member of, with their role in each.
+func listRestaurantsHandler(c *gin.Context) {
+	var memberships []RestaurantMember
+	if err := db.Where("user_id = ?", currentUserID(c)).Find(&memberships).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load restaurants")
+		return
+	}
+	roles := make(map[string]string, len(memberships))
+	ids := make([]string, len(memberships))
+	for i, membership := range memberships {
+		roles[membership.RestaurantID] = membership.Role
+		ids[i] = membership.RestaurantID
+	}
+
+	restaurants := []Restaurant{}
+	if len(ids) > 0 {
+		if err := db.Where("id IN ?", ids).Order("name, id").Find(&restaurants).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load restaurants")
+			return
+		}
+	}
+	for i := range restaurants {
+		restaurants[i].Role = roles[restaurants[i].ID]
+	}
+	if err := attachMenuCounts(restaurants); err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load restaurants")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"restaurants": restaurants})
+}
+
+func createRestaurantHandler(c *gin.Context) {
+	var req RestaurantCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		respondFieldError(c, "name", "required", "name must not be empty")
+		return
+	}
+	logoURL, err := normalizeLogoURL(req.LogoURL)
+	if err != nil {
+		respondFieldError(c, "logo_url", "url", err.Error())
+		return
+	}
+	currency := defaultMenuCurrency
+	if req.DefaultCurrency != "" {
+		currency = strings.ToUpper(req.DefaultCurrency)
+	}
+
+	now := clock.Now()
+	restaurant := Restaurant{
+		ID:              idGen.NewID(),
+		UserID:          currentUserID(c),
+		Name:            name,
+		Address:         optionalText(req.Address),
+		LogoURL:         logoURL,
+		DefaultCurrency: currency,
+		Role:            RoleOwner,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&restaurant).Error; err != nil {
+			return err
+		}
+		return tx.Create(&RestaurantMember{
+			ID:           idGen.NewID(),
+			RestaurantID: restaurant.ID,
+			UserID:       restaurant.UserID,
+			Role:         RoleOwner,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}).Error
+	})
+	if err != nil {
+		zapLog.Error("Failed to create restaurant", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create restaurant")
+		return
+	}
+
+	c.JSON(http.StatusCreated, restaurant)
+}
+
+func getRestaurantHandler(c *gin.Context) {
+	restaurant, ok := loadRestaurant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, restaurant)
+}
+
+func updateRestaurantHandler(c *gin.Context) {
+	restaurant, ok := loadRestaurant(c)
+	if !ok {
+		return
+	}
+
+	var req RestaurantUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			respondFieldError(c, "name", "required", "name must not be empty")
+			return
+		}
+		updates["name"] = name
+	}
+	if req.Address != nil {
+		updates["address"] = optionalText(req.Address)
+	}
+	if req.LogoURL != nil {
+		logoURL, err := normalizeLogoURL(req.LogoURL)
+		if err != nil {
+			respondFieldError(c, "logo_url", "url", err.Error())
+			return
+		}
+		updates["logo_url"] = logoURL
+	}
+	if req.DefaultCurrency != nil {
+		updates["default_currency"] = strings.ToUpper(*req.DefaultCurrency)
+	}
+	if len(updates) == 0 {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "No fields to update")
+		return
+	}
+	updates["updated_at"] = clock.Now()
+
+	if err := db.Model(&Restaurant{}).Where("id = ?", restaurant.ID).Updates(updates).Error; err != nil {
+		zapLog.Error("Failed to update restaurant", zap.String("restaurantID", restaurant.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update restaurant")
+		return
+	}
+
+	restaurant, ok = loadRestaurant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, restaurant)
+}
+
+// deleteRestaurantHandler removes a restaurant. Its menus are kept and no
+// longer belong to a restaurant.
+func deleteRestaurantHandler(c *gin.Context) {
+	restaurant, ok := loadRestaurant(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Menu{}).Where("restaurant_id = ?", restaurant.ID).Update("restaurant_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("restaurant_id = ?", restaurant.ID).Delete(&RestaurantMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", restaurant.ID).Delete(&Restaurant{}).Error
+	})
+	if err != nil {
+		zapLog.Error("Failed to delete restaurant", zap.String("restaurantID", restaurant.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete restaurant")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// setMenuRestaurantHandler moves the menu into a restaurant the signed-in
+// user edits, or out of its restaurant. Menus without an owner cannot be
+// grouped.
+func setMenuRestaurantHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+	if menu.UserID == nil {
+		respondError(c, http.StatusForbidden, "MENU_NOT_OWNED", "Only menus uploaded while signed in can be added to a restaurant")
+		return
+	}
+
+	var req MenuRestaurantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.RestaurantID != nil && !canAddMenus(*req.RestaurantID, currentUserID(c)) {
+		respondError(c, http.StatusBadRequest, "RESTAURANT_NOT_FOUND", "restaurant_id is not a restaurant you edit")
+		return
+	}
+
+	if err := db.Model(&Menu{}).Where("id = ?", menu.ID).Updates(map[string]interface{}{
+		"restaurant_id": req.RestaurantID,
+		"updated_at":    clock.Now(),
+	}).Error; err != nil {
+		zapLog.Error("Failed to move menu", zap.String("menuID", menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update menu")
+		return
+	}
+
+	menu, ok = loadMenu(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toMenuSummary(*menu))
+}
+
+// loadRestaurant loads the restaurant named by the :id route parameter, with
+// the caller's role from requireRestaurantRole.
+func loadRestaurant(c *gin.Context) (*Restaurant, bool) {
+	var restaurant Restaurant
+	if err := db.Where("id = ?", c.Param("id")).First(&restaurant).Error; err != nil {
+		respondError(c, http.StatusNotFound, "RESTAURANT_NOT_FOUND", "Restaurant not found")
+		return nil, false
+	}
+	restaurant.Role = c.GetString("restaurantRole")
+	restaurants := []Restaurant{restaurant}
+	if err := attachMenuCounts(restaurants); err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load restaurant")
+		return nil, false
+	}
+	return &restaurants[0], true
+}
+
+// canAddMenus reports whether userID may upload or move menus into the
+// restaurant, which takes an editor.
+func canAddMenus(restaurantID, userID string) bool {
+	role, err := restaurantRole(restaurantID, userID)
+	return err == nil && roleAtLeast(role, RoleEditor)
+}
+
+func attachMenuCounts(restaurants []Restaurant) error {
+	if len(restaurants) == 0 {
+		return nil
+	}
+	ids := make([]string, len(restaurants))
+	for i, restaurant := range restaurants {
+		ids[i] = restaurant.ID
+	}
+
+	var counts []struct {
+		RestaurantID string
+		Count        int64
+	}
+	err := db.Model(&Menu{}).
+		Select("restaurant_id, COUNT(*) AS count").
+		Where("restaurant_id IN ?", ids).
+		Group("restaurant_id").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		byID[count.RestaurantID] = count.Count
+	}
+	for i := range restaurants {
+		restaurants[i].MenuCount = byID[restaurants[i].ID]
+	}
+	return nil
+}
+
+// restaurantCurrency is the default currency of the restaurant, or "" for
+// menus outside a restaurant.
+func restaurantCurrency(restaurantID *string) string {
+	if restaurantID == nil {
+		return ""
+	}
+	var restaurant Restaurant
+	if err := db.Select("default_currency").Where("id = ?", *restaurantID).First(&restaurant).Error; err != nil {
+		return ""
+	}
+	return restaurant.DefaultCurrency
+}
+
+// normalizeLogoURL trims the logo URL, returning nil for an empty one.
+func normalizeLogoURL(raw *string) (*string, error) {
+	logoURL := optionalText(raw)
+	if logoURL == nil {
+		return nil, nil
+	}
+	parsed, err := url.Parse(*logoURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errInvalidLogoURL
+	}
+	return logoURL, nil
+}
+
+var errInvalidLogoURL = errors.New("logo_url must be an absolute http(s) URL")
+
+// optionalText trims value, returning nil when nothing is left.
+func optionalText(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
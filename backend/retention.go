@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Menus are deleted, with everything deleteMenu removes, once they have not
+// been updated for MENU_RETENTION_DAYS (0, the default, keeps them forever).
+// An API key's retention_days overrides that for the menus its clients
+// uploaded. Watermarked dish images stored for a menu go with it unless
+// other menus share them; other dish images are hosted by the image
+// provider, so only our records of them go. One replica sweeps every RETENTION_SWEEP_INTERVAL
+// (1h; 0 turns the janitor off), RETENTION_BATCH_SIZE menus at a time, and
+// also deletes expired cached descriptions and images.
+
+// retentionBatchSize bounds how many expired menus one query picks up.
+func retentionBatchSize() int {
+	return max(getEnvInt("RETENTION_BATCH_SIZE", 500), 1)
+}
+
+// expiredMenuIDs returns up to limit menus past their retention at now,
+// least recently updated first.
+func expiredMenuIDs(now time.Time, limit int) ([]string, error) {
+	var menuIDs []string
+	defaultDays := getEnvInt("MENU_RETENTION_DAYS", 0)
+	err := db.Raw(`SELECT m.id FROM menus m
+		LEFT JOIN api_keys k ON k.id = m.api_key_id
+		WHERE COALESCE(k.retention_days, ?) > 0
+			AND m.updated_at < ?::timestamptz - COALESCE(k.retention_days, ?) * INTERVAL '1 day'
+		ORDER BY m.updated_at
+		LIMIT ?`, defaultDays, now, defaultDays, limit).Scan(&menuIDs).Error
+	return menuIDs, err
+}
+
+// purgeExpiredMenus deletes every menu past its retention and returns how
+// many it deleted.
+func purgeExpiredMenus(ctx context.Context) (int, error) {
+	now := clock.Now()
+	limit := retentionBatchSize()
+	deleted := 0
+	for ctx.Err() == nil {
+		menuIDs, err := expiredMenuIDs(now, limit)
+		if err != nil {
+			return deleted, err
+		}
+		for _, menuID := range menuIDs {
+			if err := deleteMenu(menuID); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(menuIDs) < limit {
+			break
+		}
+	}
+	return deleted, ctx.Err()
+}
+
+// runRetentionJanitor purges expired menus and cache entries now and then
+// every interval until ctx is cancelled. Only one replica sweeps at a time;
+// the others skip that tick.
+func runRetentionJanitor(ctx context.Context, interval time.Duration) {
+	sweep := func() {
+		_, err := withJobLock(ctx, jobRetention, func(ctx context.Context) error {
+			deleted, err := purgeExpiredMenus(ctx)
+			if deleted > 0 {
+				zapLog.Info("Deleted menus past their retention", zap.Int("menus", deleted))
+			}
+			if err != nil {
+				return err
+			}
+			descriptions, err := purgeExpiredDescriptions(ctx)
+			if descriptions > 0 {
+				zapLog.Info("Deleted expired cached descriptions", zap.Int64("descriptions", descriptions))
+			}
+			if err != nil {
+				return err
+			}
+			images, err := purgeExpiredImages(ctx)
+			if images > 0 {
+				zapLog.Info("Deleted expired cached images", zap.Int64("images", images))
+			}
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			zapLog.Error("Retention sweep failed", zap.Error(err))
+		}
+	}
+
+	sweep()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestPurgeExpiredMenus checks that menus are deleted once they have not
+// been updated for MENU_RETENTION_DAYS, and not before. It needs the
+// configured database, and is skipped when that cannot be reached.
+func TestPurgeExpiredMenus(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Skipf("no database for the harness: %v", err)
+	}
+	defer h.Close()
+	h.setenv("MENU_RETENTION_DAYS", "30")
+	fixed := h.UseFixedClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	menu, err := h.CreateMenu("Pad Thai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixed.Advance(30*24*time.Hour - time.Minute)
+	if deleted, err := purgeExpiredMenus(context.Background()); err != nil || deleted != 0 {
+		t.Fatalf("purge before the retention ended deleted %d menus (err %v), want 0", deleted, err)
+	}
+
+	fixed.Advance(2 * time.Minute)
+	if deleted, err := purgeExpiredMenus(context.Background()); err != nil || deleted != 1 {
+		t.Fatalf("purge after the retention ended deleted %d menus (err %v), want 1", deleted, err)
+	}
+
+	var remaining int64
+	if err := db.Model(&Dish{}).Where("menu_id = ?", menu.ID).Count(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Errorf("%d dishes of the purged menu remain", remaining)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Provider requests that fail with a network error, 429, or a 5xx other than
+// 501 are retried up to PROVIDER_RETRY_ATTEMPTS times in all (3 by default),
+// with exponential backoff from PROVIDER_RETRY_BASE_DELAY (500ms) up to
+// PROVIDER_RETRY_MAX_DELAY (10s) and jitter, so concurrent dishes do not
+// retry in lockstep. A Retry-After longer than the backoff is waited out;
+// one longer than the maximum delay ends the retries. Other 4xx responses
+// are permanent and returned at once.
+
+type retryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func loadProviderRetryPolicy() retryPolicy {
+	return retryPolicy{
+		Attempts:  max(getEnvInt("PROVIDER_RETRY_ATTEMPTS", 3), 1),
+		BaseDelay: getEnvDuration("PROVIDER_RETRY_BASE_DELAY", 500*time.Millisecond),
+		MaxDelay:  getEnvDuration("PROVIDER_RETRY_MAX_DELAY", 10*time.Second),
+	}
+}
+
+// backoff is the delay after the given failed attempt (1-based): the base
+// delay doubled per attempt and capped, of which the upper half is random.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryableStatus reports whether a provider response is worth retrying.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryDelay decides whether to retry after an attempt that got resp or err,
+// and how long to wait first.
+func (p retryPolicy) retryDelay(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.Attempts {
+		return 0, false
+	}
+	delay := p.backoff(attempt)
+	if err != nil {
+		return delay, true
+	}
+	if !retryableStatus(resp.StatusCode) {
+		return 0, false
+	}
+	if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), clock.Now()); ok {
+		if retryAfter > p.MaxDelay {
+			return 0, false
+		}
+		delay = max(delay, retryAfter)
+	}
+	return delay, true
+}
+
+// rewindRequest prepares req to be sent again, reports false when its body
+// cannot be replayed.
+func rewindRequest(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retry := req.Clone(req.Context())
+	retry.Body = body
+	return retry, true
+}
+
+// discardResponse frees the connection of a response that is being retried.
+func discardResponse(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Menus uploaded for review stop in AWAITING_REVIEW once their dishes are
+// extracted, before anything is generated for them, so a person can check
+// the dishes against the printed menu first. Reviewers fix names, prices,
+// and sections through the usual edit APIs, then POST
+// /api/menu/:id/approve starts descriptions and images. REVIEW_REQUIRED
+// puts every upload up for review; uploads choose with review=true or false.
+
+func reviewRequiredByDefault() bool {
+	return getEnvBool("REVIEW_REQUIRED", false)
+}
+
+// awaitReview stops an extracted menu for review.
+func awaitReview(ctx context.Context, menuID string, totalDishes int) {
+	if err := db.Model(&Menu{}).Where("id = ?", menuID).Updates(map[string]interface{}{
+		"status":     "AWAITING_REVIEW",
+		"updated_at": clock.Now(),
+	}).Error; err != nil {
+		logFor(ctx).Error("Failed to put menu up for review", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+
+	logFor(ctx).Info("Menu awaiting review", zap.String("menuID", menuID), zap.Int("totalDishes", totalDishes))
+	emitEvent(EventMenuAwaitingReview, menuEventOwner(menuID), gin.H{
+		"menu_id":      menuID,
+		"total_dishes": totalDishes,
+	})
+}
+
+func approveMenuHandler(c *gin.Context) {
+	if shuttingDown.Load() {
+		c.Header("Retry-After", "1")
+		respondError(c, http.StatusServiceUnavailable, "SHUTTING_DOWN", "The server is shutting down; retry the approval")
+		return
+	}
+
+	menuID := c.Param("id")
+	// Reviewers may have moved or dropped dishes, so the total is counted
+	// again as enhancement starts
+	result := db.Model(&Menu{}).Where("id = ? AND status = ?", menuID, "AWAITING_REVIEW").Updates(map[string]interface{}{
+		"status":       "PROCESSING",
+		"total_dishes": gorm.Expr("(SELECT COUNT(*) FROM dishes WHERE menu_id = ?)", menuID),
+		"updated_at":   clock.Now(),
+	})
+	if result.Error != nil {
+		zapLog.Error("Failed to approve menu", zap.String("menuID", menuID), zap.Error(result.Error))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to approve menu")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondError(c, http.StatusConflict, "MENU_NOT_AWAITING_REVIEW", "Menu is not awaiting review")
+		return
+	}
+
+	if err := recountSectionDishes(db, menuID); err != nil {
+		zapLog.Warn("Failed to recount section dishes", zap.String("menuID", menuID), zap.Error(err))
+	}
+
+	var menu Menu
+	if err := db.Where("id = ?", menuID).First(&menu).Error; err != nil {
+		zapLog.Error("Failed to load approved menu", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to approve menu")
+		return
+	}
+	zapLog.Info("Menu approved", zap.String("menuID", menuID), zap.String("userID", currentUserID(c)))
+	resumeInBackground(menu)
+
+	c.JSON(http.StatusAccepted, MenuUploadResponse{MenuID: menu.ID, Status: menu.Status})
+}
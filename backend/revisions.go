@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Revision statuses. The menu's sections and dishes are always the working
+// copy; a PUBLISHED revision freezes what the public sees, and the DRAFT
+// revision tracks that the working copy has changed since.
+const (
+	RevisionDraft      = "DRAFT"
+	RevisionPublished  = "PUBLISHED"
+	RevisionSuperseded = "SUPERSEDED"
+	RevisionDiscarded  = "DISCARDED"
+)
+
+// MenuRevision is one publishable state of a menu. Snapshot is empty while
+// the revision is still a draft and frozen when it is published.
+type MenuRevision struct {
+	ID          string        `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MenuID      string        `json:"menu_id" gorm:"type:uuid;uniqueIndex:idx_menu_revisions_menu_revision"`
+	Revision    int           `json:"revision" gorm:"uniqueIndex:idx_menu_revisions_menu_revision"`
+	Status      string        `json:"status" gorm:"type:varchar(20)"`
+	Snapshot    *MenuSnapshot `json:"snapshot,omitempty" gorm:"type:jsonb"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	PublishedAt *time.Time    `json:"published_at"`
+}
+
+type MenuRevisionSummary struct {
+	Revision    int        `json:"revision"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+var (
+	errRevisionNotDraft = errors.New("revision is not an open draft")
+	errNoPublished      = errors.New("menu has no published revision")
+)
+
+func listMenuRevisionsHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	var revisions []MenuRevision
+	if err := db.Omit("snapshot").Where("menu_id = ?", menu.ID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load revisions")
+		return
+	}
+
+	summaries := make([]MenuRevisionSummary, len(revisions))
+	for i, revision := range revisions {
+		summaries[i] = MenuRevisionSummary{
+			Revision:    revision.Revision,
+			Status:      revision.Status,
+			CreatedAt:   revision.CreatedAt,
+			PublishedAt: revision.PublishedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"menu_id":            menu.ID,
+		"published_revision": menu.PublishedRevision,
+		"draft_revision":     menu.DraftRevision,
+		"revisions":          summaries,
+	})
+}
+
+// getMenuRevisionHandler returns a revision's content. A draft has no frozen
+// snapshot yet, so its content is the current working copy.
+func getMenuRevisionHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := loadMenuRevision(c, menu.ID)
+	if !ok {
+		return
+	}
+
+	if revision.Status == RevisionDraft {
+		snapshot, err := loadMenuSnapshot(db, menu.ID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load draft")
+			return
+		}
+		revision.Snapshot = &snapshot
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// publishMenuRevisionHandler freezes the working copy as the draft revision
+// and makes it the published one in a single transaction.
+func publishMenuRevisionHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := loadMenuRevision(c, menu.ID)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockMenu(tx, menu.ID)
+		if err != nil {
+			return err
+		}
+		if locked.DraftRevision == nil || *locked.DraftRevision != revision.Revision {
+			return errRevisionNotDraft
+		}
+		if err := ensureNoRegeneration(tx, menu.ID); err != nil {
+			return err
+		}
+		return publishRevision(tx, locked, revision)
+	})
+	if !handleRevisionError(c, menu.ID, err) {
+		return
+	}
+
+	zapLog.Info("Menu revision published", zap.String("menuID", menu.ID), zap.Int("revision", revision.Revision))
+	c.JSON(http.StatusOK, MenuRevisionSummary{
+		Revision:    revision.Revision,
+		Status:      revision.Status,
+		CreatedAt:   revision.CreatedAt,
+		PublishedAt: revision.PublishedAt,
+	})
+}
+
+// discardMenuRevisionHandler throws away the draft, resetting the working
+// copy to the published revision. The discarded state is kept as a version.
+func discardMenuRevisionHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	revision, ok := loadMenuRevision(c, menu.ID)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockMenu(tx, menu.ID)
+		if err != nil {
+			return err
+		}
+		if locked.DraftRevision == nil || *locked.DraftRevision != revision.Revision {
+			return errRevisionNotDraft
+		}
+		if err := ensureNoRegeneration(tx, menu.ID); err != nil {
+			return err
+		}
+
+		if locked.PublishedRevision == nil {
+			return errNoPublished
+		}
+		var published MenuRevision
+		if err := tx.Where("menu_id = ? AND revision = ?", menu.ID, *locked.PublishedRevision).First(&published).Error; err != nil {
+			return err
+		}
+		if published.Snapshot == nil {
+			return errNoPublished
+		}
+
+		if err := snapshotMenu(tx, menu.ID, "discard-draft"); err != nil {
+			return err
+		}
+		if err := replaceMenuContent(tx, menu.ID, *published.Snapshot); err != nil {
+			return err
+		}
+		if err := tx.Model(&MenuRevision{}).Where("id = ?", revision.ID).Updates(map[string]interface{}{
+			"status":     RevisionDiscarded,
+			"updated_at": clock.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Menu{}).Where("id = ?", menu.ID).Update("draft_revision", nil).Error
+	})
+	if !handleRevisionError(c, menu.ID, err) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func handleRevisionError(c *gin.Context, menuID string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errRevisionNotDraft):
+		respondError(c, http.StatusConflict, "REVISION_NOT_DRAFT", "Only the open draft revision can be published or discarded")
+	case errors.Is(err, errMenuBusy):
+		respondError(c, http.StatusConflict, "REGENERATION_IN_PROGRESS", "Wait for dish regeneration to finish first")
+	case errors.Is(err, errNoPublished):
+		respondError(c, http.StatusConflict, "NO_PUBLISHED_REVISION", "The menu has no published revision to reset the draft to")
+	default:
+		zapLog.Error("Failed to update menu revision", zap.String("menuID", menuID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update revision")
+	}
+	return false
+}
+
+func loadMenuRevision(c *gin.Context, menuID string) (*MenuRevision, bool) {
+	number, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		respondFieldError(c, "revision", "type", "revision must be a number")
+		return nil, false
+	}
+
+	var revision MenuRevision
+	if err := db.Where("menu_id = ? AND revision = ?", menuID, number).First(&revision).Error; err != nil {
+		respondError(c, http.StatusNotFound, "REVISION_NOT_FOUND", "Revision not found")
+		return nil, false
+	}
+	return &revision, true
+}
+
+// lockMenu reloads the menu with a row lock so revision bookkeeping is
+// serialised per menu.
+func lockMenu(tx *gorm.DB, menuID string) (*Menu, error) {
+	var menu Menu
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", menuID).First(&menu).Error; err != nil {
+		return nil, err
+	}
+	return &menu, nil
+}
+
+func ensureNoRegeneration(tx *gorm.DB, menuID string) error {
+	var regenerating int64
+	if err := tx.Model(&Dish{}).Where("menu_id = ? AND status = ?", menuID, "REGENERATING").Count(&regenerating).Error; err != nil {
+		return err
+	}
+	if regenerating > 0 {
+		return errMenuBusy
+	}
+	return nil
+}
+
+// beginMenuEdit must be called inside every transaction that changes a menu's
+// sections or dishes, before the change. It keeps an undo version and opens a
+// draft revision when the menu has been published.
+func beginMenuEdit(tx *gorm.DB, menuID, reason string) error {
+	if err := snapshotMenu(tx, menuID, reason); err != nil {
+		return err
+	}
+	return openDraftRevision(tx, menuID)
+}
+
+// openDraftRevision makes sure a published menu has an open draft. Menus that
+// completed before revisions existed have their current content published as
+// the first revision on their first edit.
+func openDraftRevision(tx *gorm.DB, menuID string) error {
+	menu, err := lockMenu(tx, menuID)
+	if err != nil {
+		return err
+	}
+	if menu.DraftRevision != nil {
+		return nil
+	}
+	if menu.PublishedRevision == nil {
+		if menu.Status != "COMPLETE" {
+			// Not published yet: edits go straight into what completion publishes
+			return nil
+		}
+		if err := publishNewRevision(tx, menu); err != nil {
+			return err
+		}
+	}
+
+	revision, err := createRevision(tx, menuID)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&Menu{}).Where("id = ?", menuID).Update("draft_revision", revision.Revision).Error
+}
+
+// publishCompletedMenu publishes a freshly processed menu's content.
+func publishCompletedMenu(menuID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		menu, err := lockMenu(tx, menuID)
+		if err != nil {
+			return err
+		}
+		if menu.DraftRevision != nil {
+			if err := tx.Model(&MenuRevision{}).Where("menu_id = ? AND revision = ?", menuID, *menu.DraftRevision).
+				Update("status", RevisionSuperseded).Error; err != nil {
+				return err
+			}
+			menu.DraftRevision = nil
+		}
+		return publishNewRevision(tx, menu)
+	})
+}
+
+func publishNewRevision(tx *gorm.DB, menu *Menu) error {
+	revision, err := createRevision(tx, menu.ID)
+	if err != nil {
+		return err
+	}
+	return publishRevision(tx, menu, revision)
+}
+
+func createRevision(tx *gorm.DB, menuID string) (*MenuRevision, error) {
+	var latest int
+	if err := tx.Model(&MenuRevision{}).Where("menu_id = ?", menuID).Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	now := clock.Now()
+	revision := MenuRevision{
+		ID:        idGen.NewID(),
+		MenuID:    menuID,
+		Revision:  latest + 1,
+		Status:    RevisionDraft,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// publishRevision freezes the working copy into revision and points the menu
+// at it, superseding the previously published revision.
+func publishRevision(tx *gorm.DB, menu *Menu, revision *MenuRevision) error {
+	snapshot, err := loadMenuSnapshot(tx, menu.ID)
+	if err != nil {
+		return err
+	}
+
+	now := clock.Now()
+	if menu.PublishedRevision != nil {
+		if err := tx.Model(&MenuRevision{}).Where("menu_id = ? AND revision = ?", menu.ID, *menu.PublishedRevision).Updates(map[string]interface{}{
+			"status":     RevisionSuperseded,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	revision.Status = RevisionPublished
+	revision.Snapshot = &snapshot
+	revision.PublishedAt = &now
+	revision.UpdatedAt = now
+	if err := tx.Model(&MenuRevision{}).Where("id = ?", revision.ID).Updates(map[string]interface{}{
+		"status":       revision.Status,
+		"snapshot":     revision.Snapshot,
+		"published_at": now,
+		"updated_at":   now,
+	}).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&Menu{}).Where("id = ?", menu.ID).Updates(map[string]interface{}{
+		"published_revision": revision.Revision,
+		"draft_revision":     nil,
+	}).Error
+}
+
+// publishedMenuSnapshot returns what the public should see for a menu: the
+// published revision, or the working copy for menus never published through
+// the revision workflow.
+func publishedMenuSnapshot(menu *Menu) (MenuSnapshot, error) {
+	if menu.PublishedRevision == nil {
+		return loadMenuSnapshot(db, menu.ID)
+	}
+
+	var revision MenuRevision
+	if err := db.Where("menu_id = ? AND revision = ?", menu.ID, *menu.PublishedRevision).First(&revision).Error; err != nil {
+		return MenuSnapshot{}, err
+	}
+	if revision.Snapshot == nil {
+		return MenuSnapshot{}, errNoPublished
+	}
+	return *revision.Snapshot, nil
+}
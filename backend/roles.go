@@ -0,0 +1,372 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Roles a user can have in a restaurant. Viewers read its menus, editors
+// also change them, and owners also manage the restaurant and its members.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// roleAtLeast reports whether role grants everything required does. The
+// empty role grants nothing.
+func roleAtLeast(role, required string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[required]
+}
+
+// RestaurantMember gives a user a role in a restaurant. The user who created
+// the restaurant is its first owner.
+type RestaurantMember struct {
+	ID           string    `json:"-" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	RestaurantID string    `json:"-" gorm:"type:uuid;uniqueIndex:idx_restaurant_members_restaurant_user"`
+	UserID       string    `json:"user_id" gorm:"type:uuid;uniqueIndex:idx_restaurant_members_restaurant_user;index"`
+	Role         string    `json:"role" gorm:"type:varchar(10)"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RestaurantMemberResponse is a member as listed to the restaurant's staff.
+type RestaurantMemberResponse struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MemberInviteRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+type MemberUpdateRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+var errLastOwner = errors.New("a restaurant needs at least one owner")
+
+// restaurantRole returns userID's role in the restaurant, or "" when they
+// are not a member.
+func restaurantRole(restaurantID, userID string) (string, error) {
+	if userID == "" {
+		return "", nil
+	}
+	var member RestaurantMember
+	err := db.Where("restaurant_id = ? AND user_id = ?", restaurantID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// menuRole returns the role on a menu of the caller signed in as userID with
+// the API key apiKeyID, or "" when they may not see it. A menu's uploader
+// owns it, and the members of its restaurant have their restaurant role.
+// Menus uploaded without signing in belong to the API key they were uploaded
+// with; callers with other keys may only read them. With API keys turned
+// off, everyone owns them.
+func menuRole(menuID, userID, apiKeyID string) (string, error) {
+	var menu Menu
+	err := db.Select("id", "user_id", "api_key_id", "restaurant_id").Where("id = ?", menuID).First(&menu).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if menu.UserID == nil {
+		if !apiKeysRequired() || menu.APIKeyID != nil && *menu.APIKeyID == apiKeyID {
+			return RoleOwner, nil
+		}
+		return RoleViewer, nil
+	}
+	if *menu.UserID == userID {
+		return RoleOwner, nil
+	}
+	if menu.RestaurantID == nil {
+		return "", nil
+	}
+	return restaurantRole(*menu.RestaurantID, userID)
+}
+
+// menuVisibleTo reports whether the caller may read the menu.
+func menuVisibleTo(menuID, userID, apiKeyID string) (bool, error) {
+	role, err := menuRole(menuID, userID, apiKeyID)
+	return role != "", err
+}
+
+// authorizeMenu checks the caller's role on the menu for the request: reads
+// need viewer and everything else editor. Menus the caller cannot see answer
+// 404 with notFoundCode, exactly like ones that do not exist, so their IDs
+// cannot be probed. The role is kept for requireMenuRole.
+func authorizeMenu(c *gin.Context, menuID, notFoundCode, notFoundMessage string) bool {
+	role, err := menuRole(menuID, currentUserID(c), currentAPIKeyID(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load menu")
+		return false
+	}
+	if role == "" {
+		respondError(c, http.StatusNotFound, notFoundCode, notFoundMessage)
+		return false
+	}
+	required := RoleEditor
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		required = RoleViewer
+	}
+	if !roleAtLeast(role, required) {
+		respondError(c, http.StatusForbidden, "INSUFFICIENT_ROLE", "Your role does not allow changing this menu")
+		return false
+	}
+	c.Set("menuRole", role)
+	return true
+}
+
+// requireMenuAccess guards the routes under /menu/:id.
+func requireMenuAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorizeMenu(c, c.Param("id"), "MENU_NOT_FOUND", "Menu not found") {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireDishAccess is requireMenuAccess for routes under /dish/:id.
+func requireDishAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var dish Dish
+		if err := db.Select("id", "menu_id").Where("id = ?", c.Param("id")).First(&dish).Error; err != nil {
+			respondError(c, http.StatusNotFound, "DISH_NOT_FOUND", "Dish not found")
+			c.Abort()
+			return
+		}
+		if !authorizeMenu(c, dish.MenuID, "DISH_NOT_FOUND", "Dish not found") {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireMenuRole narrows a route under requireMenuAccess to a higher role,
+// such as owner for deleting the menu.
+func requireMenuRole(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !roleAtLeast(c.GetString("menuRole"), required) {
+			respondError(c, http.StatusForbidden, "INSUFFICIENT_ROLE", "Only a menu "+required+" can do this")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireRestaurantRole guards the routes under /restaurants/:id. Non-members
+// get 404; members without the required role get 403.
+func requireRestaurantRole(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := restaurantRole(c.Param("id"), currentUserID(c))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load restaurant")
+			c.Abort()
+			return
+		}
+		if role == "" {
+			respondError(c, http.StatusNotFound, "RESTAURANT_NOT_FOUND", "Restaurant not found")
+			c.Abort()
+			return
+		}
+		if !roleAtLeast(role, required) {
+			respondError(c, http.StatusForbidden, "INSUFFICIENT_ROLE", "Only a restaurant "+required+" can do this")
+			c.Abort()
+			return
+		}
+		c.Set("restaurantRole", role)
+		c.Next()
+	}
+}
+
+func listMembersHandler(c *gin.Context) {
+	members, err := loadMemberResponses(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load members")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// addMemberHandler invites an existing user by email, or changes their role
+// if they are a member already.
+func addMemberHandler(c *gin.Context) {
+	var req MemberInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var user User
+	if err := db.Where("email = ?", normalizeEmail(req.Email)).First(&user).Error; err != nil {
+		respondError(c, http.StatusNotFound, "USER_NOT_FOUND", "No account uses this email; ask them to sign up first")
+		return
+	}
+
+	restaurantID := c.Param("id")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return setMemberRole(tx, restaurantID, user.ID, req.Role)
+	})
+	if errors.Is(err, errLastOwner) {
+		respondError(c, http.StatusConflict, "LAST_OWNER", err.Error())
+		return
+	}
+	if err != nil {
+		zapLog.Error("Failed to add member", zap.String("restaurantID", restaurantID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to add member")
+		return
+	}
+
+	zapLog.Info("Restaurant member added", zap.String("restaurantID", restaurantID), zap.String("userID", user.ID), zap.String("role", req.Role))
+	respondMember(c, http.StatusCreated, restaurantID, user.ID)
+}
+
+func updateMemberHandler(c *gin.Context) {
+	var req MemberUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	restaurantID, userID := c.Param("id"), c.Param("userId")
+	if role, err := restaurantRole(restaurantID, userID); err != nil || role == "" {
+		respondError(c, http.StatusNotFound, "MEMBER_NOT_FOUND", "Member not found")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return setMemberRole(tx, restaurantID, userID, req.Role)
+	})
+	if errors.Is(err, errLastOwner) {
+		respondError(c, http.StatusConflict, "LAST_OWNER", err.Error())
+		return
+	}
+	if err != nil {
+		zapLog.Error("Failed to update member", zap.String("restaurantID", restaurantID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update member")
+		return
+	}
+
+	respondMember(c, http.StatusOK, restaurantID, userID)
+}
+
+// removeMemberHandler removes a member. Owners can remove anyone, and every
+// member can leave on their own.
+func removeMemberHandler(c *gin.Context) {
+	restaurantID, userID := c.Param("id"), c.Param("userId")
+	if userID != currentUserID(c) && c.GetString("restaurantRole") != RoleOwner {
+		respondError(c, http.StatusForbidden, "INSUFFICIENT_ROLE", "Only a restaurant owner can do this")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("restaurant_id = ? AND user_id = ?", restaurantID, userID).Delete(&RestaurantMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return ensureOwnerRemains(tx, restaurantID)
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		respondError(c, http.StatusNotFound, "MEMBER_NOT_FOUND", "Member not found")
+		return
+	case errors.Is(err, errLastOwner):
+		respondError(c, http.StatusConflict, "LAST_OWNER", err.Error())
+		return
+	case err != nil:
+		zapLog.Error("Failed to remove member", zap.String("restaurantID", restaurantID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to remove member")
+		return
+	}
+
+	zapLog.Info("Restaurant member removed", zap.String("restaurantID", restaurantID), zap.String("userID", userID))
+	c.Status(http.StatusNoContent)
+}
+
+// setMemberRole adds the user to the restaurant or changes their role,
+// refusing to leave the restaurant without an owner.
+func setMemberRole(tx *gorm.DB, restaurantID, userID, role string) error {
+	now := clock.Now()
+	result := tx.Model(&RestaurantMember{}).
+		Where("restaurant_id = ? AND user_id = ?", restaurantID, userID).
+		Updates(map[string]interface{}{"role": role, "updated_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := tx.Create(&RestaurantMember{
+			ID:           idGen.NewID(),
+			RestaurantID: restaurantID,
+			UserID:       userID,
+			Role:         role,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return ensureOwnerRemains(tx, restaurantID)
+}
+
+func ensureOwnerRemains(tx *gorm.DB, restaurantID string) error {
+	var owners int64
+	if err := tx.Model(&RestaurantMember{}).Where("restaurant_id = ? AND role = ?", restaurantID, RoleOwner).Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+func respondMember(c *gin.Context, status int, restaurantID, userID string) {
+	members, err := loadMemberResponses(restaurantID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load members")
+		return
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			c.JSON(status, member)
+			return
+		}
+	}
+	respondError(c, http.StatusNotFound, "MEMBER_NOT_FOUND", "Member not found")
+}
+
+func loadMemberResponses(restaurantID string) ([]RestaurantMemberResponse, error) {
+	members := []RestaurantMemberResponse{}
+	err := db.Model(&RestaurantMember{}).
+		Select("restaurant_members.user_id, users.email, users.name, restaurant_members.role, restaurant_members.created_at").
+		Joins("JOIN users ON users.id = restaurant_members.user_id").
+		Where("restaurant_members.restaurant_id = ?", restaurantID).
+		Order("restaurant_members.created_at").
+		Scan(&members).Error
+	return members, err
+}
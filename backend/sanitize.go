@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// MenuWarning is a non-fatal problem noticed while processing a menu.
+type MenuWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type MenuWarnings []MenuWarning
+
+// Value stores no warnings as an empty array rather than null, which
+// addMenuWarnings could not append to.
+func (w MenuWarnings) Value() (driver.Value, error) {
+	if w == nil {
+		return "[]", nil
+	}
+	return marshalJSONColumn(w)
+}
+
+func (w *MenuWarnings) Scan(value interface{}) error {
+	return scanJSONColumn(value, w)
+}
+
+// sanitizeLimits are the maximum lengths (in characters) of LLM-derived strings.
+type sanitizeLimits struct {
+	SectionName int
+	DishName    int
+	Description int
+	PriceString int
+}
+
+func loadSanitizeLimits() sanitizeLimits {
+	return sanitizeLimits{
+		SectionName: getEnvInt("MAX_SECTION_NAME_LENGTH", 100),
+		DishName:    getEnvInt("MAX_DISH_NAME_LENGTH", 150),
+		Description: getEnvInt("MAX_DESCRIPTION_LENGTH", 600),
+		PriceString: getEnvInt("MAX_PRICE_STRING_LENGTH", 40),
+	}
+}
+
+// sanitizeText strips control characters, collapses whitespace and enforces a
+// maximum length (0 disables the limit). It reports whether the value had to
+// be truncated.
+func sanitizeText(value string, maxLength int) (string, bool) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), r == unicode.ReplacementChar:
+			return -1
+		case unicode.Is(unicode.Cf, r):
+			// Zero-width and bidi formatting characters
+			return -1
+		}
+		return r
+	}, value)
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+
+	if maxLength > 0 {
+		if runes := []rune(cleaned); len(runes) > maxLength {
+			return strings.TrimSpace(string(runes[:maxLength])), true
+		}
+	}
+	return cleaned, false
+}
+
+// sanitizeStructuredMenu cleans every string the vision model returned, in
+// place, dropping dishes without a usable name. It returns warnings describing
+// anything that had to be changed beyond whitespace cleanup.
+func sanitizeStructuredMenu(menu *StructuredMenu) []MenuWarning {
+	limits := loadSanitizeLimits()
+	var warnings []MenuWarning
+
+	sections := menu.Sections[:0]
+	for _, section := range menu.Sections {
+		name, truncated := sanitizeText(section.Name, limits.SectionName)
+		if truncated {
+			warnings = append(warnings, MenuWarning{
+				Code:    "SECTION_NAME_TRUNCATED",
+				Message: fmt.Sprintf("Section name truncated to %d characters: %q", limits.SectionName, name),
+			})
+		}
+		if name == "" {
+			name = "Menu"
+		}
+		section.Name = name
+		section.Modifiers = sanitizeModifiers(section.Modifiers, limits)
+
+		dishes := section.Dishes[:0]
+		for _, dish := range section.Dishes {
+			dishName, truncated := sanitizeText(dish.Name, limits.DishName)
+			if dishName == "" {
+				warnings = append(warnings, MenuWarning{
+					Code:    "DISH_DROPPED",
+					Message: fmt.Sprintf("Dropped a dish without a name in section %q", section.Name),
+				})
+				continue
+			}
+			if truncated {
+				warnings = append(warnings, MenuWarning{
+					Code:    "DISH_NAME_TRUNCATED",
+					Message: fmt.Sprintf("Dish name truncated to %d characters: %q", limits.DishName, dishName),
+				})
+			}
+			dish.Name = dishName
+			dish.RomanizedName, _ = sanitizeText(dish.RomanizedName, limits.DishName)
+
+			if dish.Price != nil {
+				price, truncated := sanitizeText(*dish.Price, limits.PriceString)
+				if truncated {
+					warnings = append(warnings, MenuWarning{
+						Code:    "PRICE_TRUNCATED",
+						Message: fmt.Sprintf("Price for %q truncated to %d characters", dishName, limits.PriceString),
+					})
+				}
+				if price == "" {
+					dish.Price = nil
+				} else {
+					dish.Price = &price
+				}
+			}
+
+			variants := dish.Variants[:0]
+			for _, variant := range dish.Variants {
+				variant.Name, _ = sanitizeText(variant.Name, maxVariantNameLength)
+				if variant.Name == "" {
+					continue
+				}
+				if variant.Price != nil {
+					price, _ := sanitizeText(*variant.Price, limits.PriceString)
+					variant.Price = &price
+					if price == "" {
+						variant.Price = nil
+					}
+				}
+				variants = append(variants, variant)
+			}
+			dish.Variants = variants
+			dish.Modifiers = sanitizeModifiers(dish.Modifiers, limits)
+
+			dishes = append(dishes, dish)
+		}
+		section.Dishes = dishes
+
+		sections = append(sections, section)
+	}
+	menu.Sections = sections
+
+	return warnings
+}
+
+// addMenuWarnings appends warnings to the menu record and logs them.
+func addMenuWarnings(menuID string, warnings ...MenuWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+
+	for _, warning := range warnings {
+		zapLog.Warn("Menu warning",
+			zap.String("menuID", menuID),
+			zap.String("code", warning.Code),
+			zap.String("message", warning.Message))
+	}
+
+	data, err := json.Marshal(warnings)
+	if err != nil {
+		zapLog.Error("Failed to encode menu warnings", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+
+	if err := db.Exec("UPDATE menus SET warnings = COALESCE(NULLIF(warnings, 'null'::jsonb), '[]'::jsonb) || ?::jsonb WHERE id = ?", string(data), menuID).Error; err != nil {
+		zapLog.Error("Failed to store menu warnings", zap.String("menuID", menuID), zap.Error(err))
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestMenuWarningsValue(t *testing.T) {
+	for _, test := range []struct {
+		warnings MenuWarnings
+		want     string
+	}{
+		{nil, `[]`},
+		{MenuWarnings{}, `[]`},
+		{MenuWarnings{{Code: "PRICE_TRUNCATED", Message: "cut"}}, `[{"code":"PRICE_TRUNCATED","message":"cut"}]`},
+	} {
+		value, err := test.warnings.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != test.want {
+			t.Errorf("MenuWarnings(%#v).Value() = %v, want %s", test.warnings, value, test.want)
+		}
+	}
+}
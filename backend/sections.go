@@ -0,0 +1,503 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type SectionCreateRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Position *int   `json:"position"`
+}
+
+type SectionUpdateRequest struct {
+	Name     *string `json:"name"`
+	Position *int    `json:"position"`
+}
+
+type SectionMoveDishesRequest struct {
+	DishIDs []string `json:"dish_ids" binding:"required,min=1"`
+}
+
+// MenuReorderRequest describes the complete desired layout of a menu: every
+// section in display order, each with every one of its dishes in order.
+type MenuReorderRequest struct {
+	Sections []MenuReorderSection `json:"sections" binding:"required,dive"`
+}
+
+type MenuReorderSection struct {
+	ID      string   `json:"id" binding:"required"`
+	DishIDs []string `json:"dish_ids"`
+}
+
+var (
+	errSectionNotEmpty    = errors.New("section still has dishes")
+	errInvalidSectionName = errors.New("invalid section name")
+)
+
+func listSectionsHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	var sections []MenuSection
+	if err := db.Where("menu_id = ?", menu.ID).Order("position").Find(&sections).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load sections")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sections": toSectionResponses(sections)})
+}
+
+func createSectionHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	var req SectionCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		respondFieldError(c, "name", "required", "name must not be empty")
+		return
+	}
+
+	section := MenuSection{
+		ID:     idGen.NewID(),
+		MenuID: menu.ID,
+		Name:   name,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := beginMenuEdit(tx, menu.ID, "section-create"); err != nil {
+			return err
+		}
+		ids, err := sectionOrder(tx, menu.ID)
+		if err != nil {
+			return err
+		}
+
+		position := len(ids)
+		if req.Position != nil && *req.Position >= 0 && *req.Position < len(ids) {
+			position = *req.Position
+		}
+
+		if err := tx.Create(&section).Error; err != nil {
+			return err
+		}
+
+		ids = append(ids[:position], append([]string{section.ID}, ids[position:]...)...)
+		if err := setSectionOrder(tx, menu.ID, ids); err != nil {
+			return err
+		}
+		section.Position = position
+		return touchMenu(tx, menu.ID)
+	})
+	if err != nil {
+		zapLog.Error("Failed to create section", zap.String("menuID", menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create section")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toSectionResponse(section))
+}
+
+func updateSectionHandler(c *gin.Context) {
+	section, ok := loadMenuSection(c)
+	if !ok {
+		return
+	}
+
+	var req SectionUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if req.Name == nil && req.Position == nil {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "No fields to update")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := beginMenuEdit(tx, section.MenuID, "section-update"); err != nil {
+			return err
+		}
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				return errInvalidSectionName
+			}
+			if err := tx.Model(&MenuSection{}).Where("id = ?", section.ID).Update("name", name).Error; err != nil {
+				return err
+			}
+		}
+
+		if req.Position != nil {
+			ids, err := sectionOrder(tx, section.MenuID)
+			if err != nil {
+				return err
+			}
+			if err := setSectionOrder(tx, section.MenuID, moveID(ids, section.ID, *req.Position)); err != nil {
+				return err
+			}
+		}
+
+		return touchMenu(tx, section.MenuID)
+	})
+	if errors.Is(err, errInvalidSectionName) {
+		respondFieldError(c, "name", "required", "name must not be empty")
+		return
+	}
+	if err != nil {
+		zapLog.Error("Failed to update section", zap.String("sectionID", section.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update section")
+		return
+	}
+
+	if err := db.Where("id = ?", section.ID).First(section).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load section")
+		return
+	}
+
+	c.JSON(http.StatusOK, toSectionResponse(*section))
+}
+
+// deleteSectionHandler removes a section. Its dishes must either be moved
+// elsewhere via ?move_dishes_to=<sectionId> or the section must be empty.
+func deleteSectionHandler(c *gin.Context) {
+	section, ok := loadMenuSection(c)
+	if !ok {
+		return
+	}
+
+	targetID := c.Query("move_dishes_to")
+	if targetID != "" {
+		if targetID == section.ID {
+			respondFieldError(c, "move_dishes_to", "ne", "move_dishes_to must be a different section")
+			return
+		}
+		var target MenuSection
+		if err := db.Where("id = ? AND menu_id = ?", targetID, section.MenuID).First(&target).Error; err != nil {
+			respondError(c, http.StatusBadRequest, "SECTION_NOT_FOUND", "move_dishes_to does not belong to this menu")
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := beginMenuEdit(tx, section.MenuID, "section-delete"); err != nil {
+			return err
+		}
+		var dishIDs []string
+		if err := tx.Model(&Dish{}).Where("section_id = ?", section.ID).Order("position").Pluck("id", &dishIDs).Error; err != nil {
+			return err
+		}
+
+		if len(dishIDs) > 0 {
+			if targetID == "" {
+				return errSectionNotEmpty
+			}
+			if err := moveDishesToSection(tx, dishIDs, targetID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("id = ?", section.ID).Delete(&MenuSection{}).Error; err != nil {
+			return err
+		}
+
+		ids, err := sectionOrder(tx, section.MenuID)
+		if err != nil {
+			return err
+		}
+		if err := setSectionOrder(tx, section.MenuID, ids); err != nil {
+			return err
+		}
+		if err := recountSectionDishes(tx, section.MenuID); err != nil {
+			return err
+		}
+		return touchMenu(tx, section.MenuID)
+	})
+	if errors.Is(err, errSectionNotEmpty) {
+		respondError(c, http.StatusConflict, "SECTION_NOT_EMPTY", "Section has dishes; pass move_dishes_to to relocate them")
+		return
+	}
+	if err != nil {
+		zapLog.Error("Failed to delete section", zap.String("sectionID", section.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete section")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// moveDishesIntoSectionHandler appends the given dishes of the same menu to
+// the end of the section named by :sectionId.
+func moveDishesIntoSectionHandler(c *gin.Context) {
+	section, ok := loadMenuSection(c)
+	if !ok {
+		return
+	}
+
+	var req SectionMoveDishesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var count int64
+	if err := db.Model(&Dish{}).Where("id IN ? AND menu_id = ?", req.DishIDs, section.MenuID).Count(&count).Error; err != nil || int(count) != len(req.DishIDs) {
+		respondError(c, http.StatusBadRequest, "DISH_NOT_FOUND", "dish_ids must all belong to this menu")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := beginMenuEdit(tx, section.MenuID, "dish-move"); err != nil {
+			return err
+		}
+		if err := moveDishesToSection(tx, req.DishIDs, section.ID); err != nil {
+			return err
+		}
+		if err := recountSectionDishes(tx, section.MenuID); err != nil {
+			return err
+		}
+		return touchMenu(tx, section.MenuID)
+	})
+	if err != nil {
+		zapLog.Error("Failed to move dishes", zap.String("sectionID", section.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to move dishes")
+		return
+	}
+
+	// The section's counts include the dishes moved into it
+	if err := db.Where("id = ?", section.ID).First(section).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load section")
+		return
+	}
+
+	var dishes []Dish
+	if err := db.Where("section_id = ?", section.ID).Order("position").Find(&dishes).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load dishes")
+		return
+	}
+
+	responses := make([]DishResponse, len(dishes))
+	for i, dish := range dishes {
+		responses[i] = toDishResponse(dish)
+	}
+	c.JSON(http.StatusOK, gin.H{"section": toSectionResponse(*section), "dishes": responses})
+}
+
+// reorderMenuHandler applies a full drag-and-drop layout in one transaction.
+// Dishes may change sections as part of the reorder.
+func reorderMenuHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	var req MenuReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var existingSections []string
+	if err := db.Model(&MenuSection{}).Where("menu_id = ?", menu.ID).Pluck("id", &existingSections).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load sections")
+		return
+	}
+	var existingDishes []string
+	if err := db.Model(&Dish{}).Where("menu_id = ? AND section_id IS NOT NULL", menu.ID).Pluck("id", &existingDishes).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load dishes")
+		return
+	}
+
+	sectionIDs := make([]string, len(req.Sections))
+	var dishIDs []string
+	for i, section := range req.Sections {
+		sectionIDs[i] = section.ID
+		dishIDs = append(dishIDs, section.DishIDs...)
+	}
+
+	if !sameIDSet(sectionIDs, existingSections) {
+		respondFieldError(c, "sections", "permutation", "sections must list every section of the menu exactly once")
+		return
+	}
+	if !sameIDSet(dishIDs, existingDishes) {
+		respondFieldError(c, "dish_ids", "permutation", "dish_ids must list every sectioned dish of the menu exactly once")
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := beginMenuEdit(tx, menu.ID, "reorder"); err != nil {
+			return err
+		}
+		if err := setSectionOrder(tx, menu.ID, sectionIDs); err != nil {
+			return err
+		}
+		now := clock.Now()
+		for _, section := range req.Sections {
+			for position, dishID := range section.DishIDs {
+				if err := tx.Model(&Dish{}).Where("id = ? AND menu_id = ?", dishID, menu.ID).Updates(map[string]interface{}{
+					"section_id": section.ID,
+					"position":   position,
+					"updated_at": now,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if err := recountSectionDishes(tx, menu.ID); err != nil {
+			return err
+		}
+		return touchMenu(tx, menu.ID)
+	})
+	if err != nil {
+		zapLog.Error("Failed to reorder menu", zap.String("menuID", menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to reorder menu")
+		return
+	}
+
+	var sections []MenuSection
+	if err := db.Where("menu_id = ?", menu.ID).Order("position").Find(&sections).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load sections")
+		return
+	}
+	var dishes []Dish
+	if err := db.Where("menu_id = ?", menu.ID).Order("position").Find(&dishes).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load dishes")
+		return
+	}
+
+	responses := make([]DishResponse, len(dishes))
+	for i, dish := range dishes {
+		responses[i] = toDishResponse(dish)
+	}
+	c.JSON(http.StatusOK, gin.H{"sections": toSectionResponses(sections), "dishes": responses})
+}
+
+// sameIDSet reports whether got contains exactly the IDs in want, each once.
+func sameIDSet(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[string]bool, len(want))
+	for _, id := range want {
+		seen[id] = false
+	}
+	for _, id := range got {
+		used, ok := seen[id]
+		if !ok || used {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+// loadMenuSection loads the section named by :sectionId, making sure it
+// belongs to the menu named by :id.
+func loadMenuSection(c *gin.Context) (*MenuSection, bool) {
+	var section MenuSection
+	if err := db.Where("id = ? AND menu_id = ?", c.Param("sectionId"), c.Param("id")).First(&section).Error; err != nil {
+		respondError(c, http.StatusNotFound, "SECTION_NOT_FOUND", "Section not found")
+		return nil, false
+	}
+	return &section, true
+}
+
+// sectionOrder returns the menu's section IDs in their current display order.
+func sectionOrder(tx *gorm.DB, menuID string) ([]string, error) {
+	var ids []string
+	err := tx.Model(&MenuSection{}).Where("menu_id = ?", menuID).Order("position, id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// setSectionOrder rewrites section positions to match ids, numbering from 0.
+func setSectionOrder(tx *gorm.DB, menuID string, ids []string) error {
+	for position, id := range ids {
+		if err := tx.Model(&MenuSection{}).Where("id = ? AND menu_id = ?", id, menuID).Update("position", position).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveDishesToSection appends dishIDs, in order, after the dishes already in
+// the target section.
+func moveDishesToSection(tx *gorm.DB, dishIDs []string, sectionID string) error {
+	var next int
+	if err := tx.Model(&Dish{}).
+		Where("section_id = ? AND id NOT IN ?", sectionID, dishIDs).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Scan(&next).Error; err != nil {
+		return err
+	}
+
+	for i, id := range dishIDs {
+		if err := tx.Model(&Dish{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"section_id": sectionID,
+			"position":   next + i,
+			"updated_at": clock.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recountSectionDishes sets the total_dishes and processed_dishes of the
+// menu's sections from the dishes they hold, after dishes were moved between
+// them or dropped.
+func recountSectionDishes(tx *gorm.DB, menuID string) error {
+	return tx.Exec(`UPDATE menu_sections SET
+			total_dishes = (SELECT COUNT(*) FROM dishes WHERE dishes.section_id = menu_sections.id),
+			processed_dishes = (SELECT COUNT(*) FROM dishes WHERE dishes.section_id = menu_sections.id AND dishes.status NOT IN ?)
+		WHERE menu_id = ?`,
+		unprocessedDishStatuses, menuID).Error
+}
+
+// moveID returns ids with id moved to position (clamped to the valid range).
+func moveID(ids []string, id string, position int) []string {
+	rest := make([]string, 0, len(ids))
+	for _, existing := range ids {
+		if existing != id {
+			rest = append(rest, existing)
+		}
+	}
+	if position < 0 {
+		position = 0
+	}
+	if position > len(rest) {
+		position = len(rest)
+	}
+	return append(rest[:position], append([]string{id}, rest[position:]...)...)
+}
+
+func toSectionResponse(section MenuSection) MenuSectionResponse {
+	return MenuSectionResponse{
+		ID:       section.ID,
+		Name:     section.Name,
+		Position: section.Position,
+	}
+}
+
+func toSectionResponses(sections []MenuSection) []MenuSectionResponse {
+	responses := make([]MenuSectionResponse, len(sections))
+	for i, section := range sections {
+		responses[i] = toSectionResponse(section)
+	}
+	return responses
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// As a menu completes, the text model writes a page title, meta description,
+// and OpenGraph title and description for its shared page, stored on the
+// menu as seo; the OpenGraph image is the first dish photo. Shared pages put
+// them in their <head> so links unfurl in chats and social feeds. Shared
+// pages stay out of search engines unless SHARE_PAGES_INDEXABLE is set.
+// SEO_METADATA_ENABLED=false skips generation, and pages fall back to the
+// menu's title.
+
+// Lengths search engines and unfurlers show before cutting text off.
+const (
+	maxSEOTitleLength        = 70
+	maxSEODescriptionLength  = 160
+	maxOGTitleLength         = 90
+	maxOGDescriptionLength   = 200
+	maxSEOPromptDishes       = 30
+	maxSEOPromptDescriptions = 10
+)
+
+// MenuSEO is the generated metadata of a menu's shared page, stored as a
+// JSONB object.
+type MenuSEO struct {
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	OGTitle       string    `json:"og_title"`
+	OGDescription string    `json:"og_description"`
+	OGImage       string    `json:"og_image,omitempty"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+func (s MenuSEO) Value() (driver.Value, error) {
+	return marshalJSONColumn(s)
+}
+
+func (s *MenuSEO) Scan(value interface{}) error {
+	return scanJSONColumn(value, s)
+}
+
+func seoMetadataEnabled() bool {
+	return getEnvBool("SEO_METADATA_ENABLED", true)
+}
+
+func sharePagesIndexable() bool {
+	return getEnvBool("SHARE_PAGES_INDEXABLE", false)
+}
+
+// generateMenuSEO writes and stores the menu's page metadata. Failures are
+// logged; the menu completes without it.
+func generateMenuSEO(ctx context.Context, menuID string) {
+	if !seoMetadataEnabled() {
+		return
+	}
+
+	var menu Menu
+	if err := db.WithContext(ctx).Select("id", "original_file", "cuisine", "language").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		logFor(ctx).Warn("Failed to load menu for SEO metadata", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+	var dishes []Dish
+	if err := db.WithContext(ctx).Select("id", "name", "description", "image_url", "position").
+		Where("menu_id = ?", menuID).Order("position").Limit(maxSEOPromptDishes).Find(&dishes).Error; err != nil {
+		logFor(ctx).Warn("Failed to load dishes for SEO metadata", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+	if len(dishes) == 0 {
+		return
+	}
+
+	systemPrompt := "You write search and social metadata for a restaurant's online menu page. Write a page title of at most 60 characters, " +
+		"a meta description of at most 155 characters that invites diners to look at the menu and names a few signature dishes, " +
+		"and a social sharing title and description that read naturally when the link is posted. Use only what the menu tells; do not invent prices, offers, or locations."
+	if menu.Language != "" {
+		systemPrompt += " Write in the language with the BCP 47 tag " + menu.Language + "."
+	}
+
+	var prompt strings.Builder
+	if name := loadMenuPrompts(menuID).RestaurantName; name != "" {
+		prompt.WriteString("Restaurant: " + name + "\n")
+	} else {
+		prompt.WriteString("Menu: " + menuTitle(&menu) + "\n")
+	}
+	if menu.Cuisine != "" {
+		prompt.WriteString("Cuisine: " + cuisineLabel(menu.Cuisine) + "\n")
+	}
+	prompt.WriteString("Dishes:\n")
+	for i, dish := range dishes {
+		prompt.WriteString("- " + dish.Name)
+		if i < maxSEOPromptDescriptions && dish.Description != nil && *dish.Description != "" {
+			prompt.WriteString(": " + *dish.Description)
+		}
+		prompt.WriteString("\n")
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title":          map[string]interface{}{"type": "string"},
+			"description":    map[string]interface{}{"type": "string"},
+			"og_title":       map[string]interface{}{"type": "string"},
+			"og_description": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"title", "description", "og_title", "og_description"},
+	}
+
+	var result MenuSEO
+	err := requestStructured(ctx, menuID, structuredRequest{
+		Stage:        stageSEO,
+		SchemaName:   "menu_seo",
+		SystemPrompt: systemPrompt,
+		UserPrompt:   prompt.String(),
+		Schema:       schema,
+		MaxTokens:    300,
+		Timeout:      loadProviderTimeouts().Description,
+	}, &result)
+	if err != nil {
+		logFor(ctx).Warn("Failed to generate SEO metadata", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+
+	seo := MenuSEO{GeneratedAt: clock.Now()}
+	seo.Title, _ = sanitizeText(result.Title, maxSEOTitleLength)
+	seo.Description, _ = sanitizeText(result.Description, maxSEODescriptionLength)
+	seo.OGTitle, _ = sanitizeText(result.OGTitle, maxOGTitleLength)
+	seo.OGDescription, _ = sanitizeText(result.OGDescription, maxOGDescriptionLength)
+	for _, dish := range dishes {
+		if dish.ImageURL != nil {
+			seo.OGImage = *dish.ImageURL
+			break
+		}
+	}
+	if seo.Title == "" {
+		seo.Title = menuTitle(&menu)
+	}
+	if seo.OGTitle == "" {
+		seo.OGTitle = seo.Title
+	}
+	if seo.OGDescription == "" {
+		seo.OGDescription = seo.Description
+	}
+
+	if err := db.Model(&Menu{}).Where("id = ?", menuID).Update("seo", &seo).Error; err != nil {
+		logFor(ctx).Error("Failed to store SEO metadata", zap.String("menuID", menuID), zap.Error(err))
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MenuShare is a read-only public link to a menu. The slug is the only
+// credential, so it is long and random; revoked links stop resolving.
+type MenuShare struct {
+	ID        string     `json:"-" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MenuID    string     `json:"-" gorm:"type:uuid;index"`
+	Slug      string     `json:"slug" gorm:"uniqueIndex"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// MenuShareResponse is a share link as returned to the menu's owner.
+type MenuShareResponse struct {
+	Slug      string     `json:"slug"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// PublicMenu is the JSON form of a shared menu. It deliberately carries no
+// internal IDs, statuses, or generation details.
+type PublicMenu struct {
+	Title    string              `json:"title"`
+	Sections []PublicMenuSection `json:"sections"`
+}
+
+type PublicMenuSection struct {
+	Name   string           `json:"name"`
+	Dishes []PublicMenuDish `json:"dishes"`
+}
+
+type PublicMenuDish struct {
+	Name        string  `json:"name"`
+	Price       string  `json:"price,omitempty"`
+	PriceCents  *int    `json:"price_cents"`
+	Currency    string  `json:"currency"`
+	Description *string `json:"description"`
+	ImageURL    *string `json:"image_url"`
+	ImageAlt    string  `json:"image_alt,omitempty"`
+}
+
+func toMenuShareResponse(share MenuShare) MenuShareResponse {
+	return MenuShareResponse{
+		Slug:      share.Slug,
+		URL:       "/public/menu/" + share.Slug,
+		CreatedAt: share.CreatedAt,
+		RevokedAt: share.RevokedAt,
+	}
+}
+
+// generateShareSlug returns 128 random bits, URL-safe encoded.
+func generateShareSlug() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// createMenuShareHandler creates a new public link for a completed menu.
+func createMenuShareHandler(c *gin.Context) {
+	menu, ok := loadCompleteMenu(c)
+	if !ok {
+		return
+	}
+
+	slug, err := generateShareSlug()
+	if err != nil {
+		zapLog.Error("Failed to generate share slug", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create share link")
+		return
+	}
+
+	share := MenuShare{
+		ID:        idGen.NewID(),
+		MenuID:    menu.ID,
+		Slug:      slug,
+		CreatedAt: clock.Now(),
+	}
+	if err := db.Create(&share).Error; err != nil {
+		zapLog.Error("Failed to create share link", zap.String("menuID", menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create share link")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toMenuShareResponse(share))
+}
+
+func listMenuSharesHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	var shares []MenuShare
+	if err := db.Where("menu_id = ?", menu.ID).Order("created_at").Find(&shares).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load share links")
+		return
+	}
+
+	response := make([]MenuShareResponse, len(shares))
+	for i, share := range shares {
+		response[i] = toMenuShareResponse(share)
+	}
+	c.JSON(http.StatusOK, gin.H{"shares": response})
+}
+
+// revokeMenuShareHandler disables a share link. Revoking is permanent; create
+// a new link to share the menu again.
+func revokeMenuShareHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	var share MenuShare
+	if err := db.Where("menu_id = ? AND slug = ?", menu.ID, c.Param("slug")).First(&share).Error; err != nil {
+		respondError(c, http.StatusNotFound, "SHARE_NOT_FOUND", "Share link not found")
+		return
+	}
+
+	if share.RevokedAt == nil {
+		now := clock.Now()
+		if err := db.Model(&share).Update("revoked_at", now).Error; err != nil {
+			zapLog.Error("Failed to revoke share link", zap.String("menuID", menu.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to revoke share link")
+			return
+		}
+		share.RevokedAt = &now
+	}
+
+	c.JSON(http.StatusOK, toMenuShareResponse(share))
+}
+
+// publicMenuHandler serves a shared menu's published content: the hosted
+// HTML page by default, or JSON with ?format=json.
+func publicMenuHandler(c *gin.Context) {
+	doc, ok := loadSharedMenu(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, buildPublicMenu(doc))
+		return
+	}
+
+	if base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/"); base != "" {
+		doc.PageURL = base + "/public/menu/" + c.Param("slug")
+	}
+	// The widget stays out of search results; the page itself may not
+	if sharePagesIndexable() {
+		c.Header("X-Robots-Tag", "all")
+	}
+	page, err := renderMenuPage(doc)
+	if err != nil {
+		zapLog.Error("Failed to render menu page", zap.String("menuID", doc.Menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load menu")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// loadSharedMenu resolves the :slug route parameter to the published content
+// of a completed menu and sets the headers shared by all public responses.
+// Unknown, revoked, and unfinished menus all look the same to the caller.
+func loadSharedMenu(c *gin.Context) (menuDocument, bool) {
+	var share MenuShare
+	if err := db.Where("slug = ? AND revoked_at IS NULL", c.Param("slug")).First(&share).Error; err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return menuDocument{}, false
+	}
+
+	var menu Menu
+	if err := db.Where("id = ? AND status = ?", share.MenuID, "COMPLETE").First(&menu).Error; err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return menuDocument{}, false
+	}
+
+	doc, err := buildPublishedMenuDocument(&menu)
+	if err != nil {
+		zapLog.Error("Failed to load published menu", zap.String("menuID", menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load menu")
+		return menuDocument{}, false
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.Header("X-Robots-Tag", "noindex")
+	return doc, true
+}
+
+func buildPublicMenu(doc menuDocument) PublicMenu {
+	menu := PublicMenu{Title: doc.Title, Sections: []PublicMenuSection{}}
+	for _, section := range doc.Sections {
+		if len(section.Dishes) == 0 {
+			continue
+		}
+		entry := PublicMenuSection{Name: section.Name, Dishes: make([]PublicMenuDish, len(section.Dishes))}
+		for i, dish := range section.Dishes {
+			entry.Dishes[i] = PublicMenuDish{
+				Name:        dish.Dish.Name,
+				Price:       dish.Price,
+				PriceCents:  dish.Dish.PriceCents,
+				Currency:    dish.Dish.Currency,
+				Description: dish.Dish.Description,
+				ImageURL:    dish.Dish.ImageURL,
+			}
+			if dish.Dish.ImageURL != nil {
+				entry.Dishes[i].ImageAlt = dish.ImageAlt
+			}
+		}
+		menu.Sections = append(menu.Sections, entry)
+	}
+	return menu
+}
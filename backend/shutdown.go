@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// On SIGTERM or SIGINT the server stops taking uploads and lets the menus it
+// is processing finish for up to SHUTDOWN_DRAIN_TIMEOUT (25s by default).
+// Menus still running then are handed back: those whose dishes were already
+// extracted stay PROCESSING for `admin requeue-stuck` to resume, and those
+// still being read are failed with INTERRUPTED, since their image is not
+// kept. /readyz fails from the start, and the server keeps accepting
+// connections for SHUTDOWN_READINESS_DELAY (none by default) so that load
+// balancers can stop routing to it first. The database is closed only once
+// processing has stopped writing to it.
+
+// shutdownAbortGrace is how long aborted menus get to record their state
+// before the database is closed under them.
+const shutdownAbortGrace = 5 * time.Second
+
+var errShuttingDown = errors.New("the server is shutting down")
+
+// shuttingDown is set once shutdown begins; uploads are refused from then on.
+var shuttingDown atomic.Bool
+
+// stopping is closed once shutdown begins, to end event streams so their
+// clients reconnect to another replica.
+var stopping = make(chan struct{})
+
+// shutdown stops srv and grpcServer (nil when gRPC is off), drains menu
+// processing and closes the database.
+func shutdown(srv *http.Server, grpcServer *grpc.Server) {
+	drainTimeout := getEnvDuration("SHUTDOWN_DRAIN_TIMEOUT", 25*time.Second)
+	readinessDelay := getEnvDuration("SHUTDOWN_READINESS_DELAY", 0)
+	zapLog.Info("Shutting down",
+		zap.Int64("pipelines", jobStats.pipelines.Load()),
+		zap.Int64("backgroundJobs", jobStats.background.Load()),
+		zap.Duration("drainTimeout", drainTimeout))
+
+	shuttingDown.Store(true)
+	close(stopping)
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	servers := make(chan struct{})
+	go func() {
+		defer close(servers)
+		// Keep accepting connections until load balancers have seen /readyz fail
+		select {
+		case <-time.After(readinessDelay):
+		case <-ctx.Done():
+		}
+		if err := srv.Shutdown(ctx); err != nil {
+			zapLog.Warn("HTTP server did not stop cleanly", zap.Error(err))
+		}
+		if grpcServer != nil {
+			stopGRPCServer(ctx, grpcServer)
+		}
+	}()
+
+	if !waitForProcessing(ctx) {
+		menuIDs := processingJobs.abortAll(errShuttingDown)
+		zapLog.Warn("Handing back menus still processing", zap.Strings("menuIDs", menuIDs))
+
+		graceCtx, cancelGrace := context.WithTimeout(context.Background(), shutdownAbortGrace)
+		if !waitForProcessing(graceCtx) {
+			zapLog.Error("Processing did not stop before shutdown",
+				zap.Int64("pipelines", jobStats.pipelines.Load()),
+				zap.Int64("backgroundJobs", jobStats.background.Load()))
+		}
+		cancelGrace()
+	}
+	<-servers
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			zapLog.Warn("Failed to close database", zap.Error(err))
+		}
+	}
+	zapLog.Info("Shutdown complete")
+}
+
+// stopGRPCServer lets in-flight RPCs finish until ctx ends, then cuts them off.
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+// waitForProcessing waits until no menu is being processed and no
+// regeneration is running, and reports whether that happened before ctx ended.
+func waitForProcessing(ctx context.Context) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if jobStats.pipelines.Load() == 0 && jobStats.background.Load() == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// handBackMenu leaves a menu aborted by shutdown in a state another replica
+// can pick up from.
+func handBackMenu(ctx context.Context, menuID string) {
+	var menu Menu
+	if err := db.Select("id", "total_dishes").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		logFor(ctx).Error("Failed to load menu to hand back", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+	if menu.TotalDishes == 0 {
+		failMenuWithCode(menuID, "INTERRUPTED", "Processing was interrupted before the menu was read; please upload it again")
+		return
+	}
+	logFor(ctx).Info("Menu handed back for requeue-stuck", zap.String("menuID", menuID))
+}
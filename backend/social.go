@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// socialPlatforms is the image format each platform's feed displays without
+// cropping. Facebook's 1.91:1 link format is not a ratio the image model
+// supports, so it gets the nearest one, 16:9.
+var socialPlatforms = map[string]RenditionSpec{
+	"instagram": {Name: "instagram", AspectRatio: "4:5", Size: "standard"},
+	"facebook":  {Name: "facebook", AspectRatio: "16:9", Size: "standard"},
+}
+
+const (
+	maxSocialCaptionLength = 2200 // Instagram's caption limit
+	maxSocialHashtags      = 10
+)
+
+type SocialPostRequest struct {
+	Platform     string `json:"platform" binding:"required,oneof=instagram facebook"`
+	Tone         string `json:"tone" binding:"omitempty,oneof=casual fine-dining playful"`
+	RefreshImage bool   `json:"refresh_image"`
+}
+
+// SocialPostResponse is a ready-to-post caption with the dish's image for the
+// platform. The image is generated in the background the first time it is
+// needed: ImageStatus is READY when ImageURL is set, GENERATING while it is
+// being made, BUSY when another regeneration of the dish is running, and
+// DISABLED when the menu does not generate images.
+type SocialPostResponse struct {
+	DishID      string   `json:"dish_id"`
+	Platform    string   `json:"platform"`
+	Caption     string   `json:"caption"`
+	Hashtags    []string `json:"hashtags"`
+	AspectRatio string   `json:"aspect_ratio"`
+	ImageStatus string   `json:"image_status"`
+	ImageURL    *string  `json:"image_url"`
+}
+
+type socialCaption struct {
+	Caption  string   `json:"caption"`
+	Hashtags []string `json:"hashtags"`
+}
+
+// createDishSocialPostHandler writes a social media caption and hashtags for
+// a dish from its name, description, and price, and pairs it with the dish's
+// rendition for the platform, starting its generation if there is none yet.
+func createDishSocialPostHandler(c *gin.Context) {
+	var req SocialPostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var dish Dish
+	if err := db.Where("id = ?", c.Param("id")).First(&dish).Error; err != nil {
+		respondError(c, http.StatusNotFound, "DISH_NOT_FOUND", "Dish not found")
+		return
+	}
+
+	caption, err := generateSocialCaption(c.Request.Context(), dish, req.Platform, req.Tone)
+	if err != nil {
+		zapLog.Error("Failed to generate social caption", zap.String("dishID", dish.ID), zap.Error(err))
+		respondError(c, http.StatusBadGateway, "GENERATION_FAILED", "Failed to generate caption")
+		return
+	}
+
+	spec := socialPlatforms[req.Platform]
+	response := SocialPostResponse{
+		DishID:      dish.ID,
+		Platform:    req.Platform,
+		Caption:     caption.Caption,
+		Hashtags:    caption.Hashtags,
+		AspectRatio: spec.AspectRatio,
+	}
+
+	var rendition DishRendition
+	found := false
+	if !req.RefreshImage {
+		result := db.Where("dish_id = ? AND name = ?", dish.ID, spec.Name).Limit(1).Find(&rendition)
+		if result.Error != nil {
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load renditions")
+			return
+		}
+		found = result.RowsAffected > 0
+	}
+
+	switch {
+	case found:
+		response.ImageStatus = "READY"
+		response.ImageURL = &rendition.URL
+	case !imageGenerationAllowed(dish.MenuID):
+		response.ImageStatus = "DISABLED"
+	default:
+		claimed, err := claimDishRegeneration(dish.ID)
+		if err != nil {
+			zapLog.Error("Failed to start regeneration", zap.String("dishID", dish.ID), zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to start image generation")
+			return
+		}
+		if !claimed {
+			response.ImageStatus = "BUSY"
+			break
+		}
+		response.ImageStatus = "GENERATING"
+		runInBackground(dish.MenuID, func(ctx context.Context) { generateSocialRendition(ctx, dish, spec) })
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// generateSocialRendition generates the platform's rendition of the dish; the
+// dish must already be REGENERATING.
+func generateSocialRendition(ctx context.Context, dish Dish, spec RenditionSpec) {
+	defer finishDishRegeneration(dish, nil)
+
+	shape := imageShape{AspectRatio: spec.AspectRatio, Megapixels: renditionSizes[spec.Size]}
+	imageURLs, record, err := generateShapedDishImages(ctx, dish.MenuID, dish.Name, dish.Cuisine, "", "styled for a social media post", 1, shape)
+	if err != nil {
+		zapLog.Error("Failed to generate social rendition", zap.String("dishID", dish.ID), zap.String("rendition", spec.Name), zap.Error(err))
+		return
+	}
+	if err := saveDishRendition(db, dish, spec, imageURLs[0], record); err != nil {
+		zapLog.Error("Failed to store social rendition", zap.String("dishID", dish.ID), zap.String("rendition", spec.Name), zap.Error(err))
+	}
+}
+
+// generateSocialCaption asks the text model for a caption and hashtags. The
+// hashtags are normalized here rather than trusted: the model sometimes
+// includes the # sign, spaces, or punctuation.
+func generateSocialCaption(ctx context.Context, dish Dish, platform, tone string) (*socialCaption, error) {
+	defer jobStats.beginStage(stageCaption)()
+
+	openaiAPIKey := lookupOpenAIKey()
+	if openaiAPIKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY not set")
+	}
+
+	systemPrompt := fmt.Sprintf("You write social media posts for restaurants. Write a short, engaging %s caption (at most 3 sentences, no hashtags in the caption) "+
+		"that makes people want to order the dish, and 5 to %d relevant hashtags without the # sign.", platform, maxSocialHashtags)
+	if style, ok := descriptionTones[tone]; ok {
+		systemPrompt += " " + style
+	}
+	userPrompt := "Dish: " + dish.Name
+	if dish.Description != nil && *dish.Description != "" {
+		userPrompt += "\nDescription: " + *dish.Description
+	}
+	if price := formatPrice(dish); price != "" {
+		userPrompt += "\nPrice: " + price
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"caption":  map[string]interface{}{"type": "string"},
+			"hashtags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+		"required": []string{"caption", "hashtags"},
+	}
+
+	request := OpenAITextRequest{
+		Model: "gpt-4o-mini",
+		Messages: []OpenAITextMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+		ResponseFormat: &OpenAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: OpenAIJSONSchema{Name: "social_post", Schema: schema},
+		},
+		MaxTokens: 300,
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIBaseURL()+"/v1/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+openaiAPIKey)
+
+	client := &http.Client{Timeout: loadProviderTimeouts().Description}
+	resp, err := callProvider(dish.MenuID, client, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OpenAI API error: %s", string(body))
+	}
+
+	var openaiResp OpenAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	recordProviderUsage(dish.MenuID, "openai", request.Model, openaiResp.Usage.PromptTokens, openaiResp.Usage.CompletionTokens, 0)
+
+	if len(openaiResp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in OpenAI response")
+	}
+
+	var caption socialCaption
+	if err := json.Unmarshal([]byte(openaiResp.Choices[0].Message.Content), &caption); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal social post: %w", err)
+	}
+	caption.Caption, _ = sanitizeText(caption.Caption, maxSocialCaptionLength)
+	caption.Hashtags = normalizeHashtags(caption.Hashtags)
+	return &caption, nil
+}
+
+// normalizeHashtags strips everything but letters, digits, and underscores
+// from each tag, prefixes it with #, and drops empty and repeated tags.
+func normalizeHashtags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+				return r
+			}
+			return -1
+		}, tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, "#"+tag)
+		if len(normalized) == maxSocialHashtags {
+			break
+		}
+	}
+	return normalized
+}
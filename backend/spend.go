@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ProviderUsage is one successful billable provider request. Costs are
+// estimated at request time from the configured prices, in micro-dollars.
+type ProviderUsage struct {
+	ID                  string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MenuID              string    `json:"menu_id" gorm:"type:uuid;index"`
+	Provider            string    `json:"provider"`
+	Model               string    `json:"model"`
+	PromptTokens        int       `json:"prompt_tokens"`
+	CompletionTokens    int       `json:"completion_tokens"`
+	Images              int       `json:"images"`
+	EstimatedCostMicros int64     `json:"estimated_cost_micros"`
+	CreatedAt           time.Time `json:"created_at" gorm:"index"`
+}
+
+// ProviderSpendRollup aggregates ProviderUsage per UTC day, provider and model.
+type ProviderSpendRollup struct {
+	Day                 time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_spend_rollup_key"`
+	Provider            string    `json:"provider" gorm:"uniqueIndex:idx_spend_rollup_key"`
+	Model               string    `json:"model" gorm:"uniqueIndex:idx_spend_rollup_key"`
+	Requests            int       `json:"requests"`
+	PromptTokens        int64     `json:"prompt_tokens"`
+	CompletionTokens    int64     `json:"completion_tokens"`
+	Images              int64     `json:"images"`
+	EstimatedCostMicros int64     `json:"estimated_cost_micros"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+type SpendRow struct {
+	Day              string  `json:"day,omitempty"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model,omitempty"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Images           int64   `json:"images"`
+	EstimatedUSD     float64 `json:"estimated_usd"`
+}
+
+type SpendResponse struct {
+	From   string     `json:"from"`
+	To     string     `json:"to"`
+	Days   []SpendRow `json:"days"`
+	Totals []SpendRow `json:"totals"`
+}
+
+const spendDateLayout = "2006-01-02"
+
+// modelRate is what a model costs in USD: per million input and output
+// tokens for text models, per image for image models.
+type modelRate struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+	PerImage      float64
+}
+
+// modelRates are the list prices of the models the backend calls. Each
+// operation has its own model, so generating a dish image (flux-dev) and
+// upscaling one (real-esrgan) are priced apart, as are full and mini chat
+// models. Moderation is free. modelRateFor reads overrides from the
+// environment.
+var modelRates = map[string]modelRate{
+	"gpt-4o":        {InputPerMTok: 2.50, OutputPerMTok: 10.00},
+	"gpt-4o-mini":   {InputPerMTok: 0.15, OutputPerMTok: 0.60},
+	moderationModel: {},
+	dishImageModel:  {PerImage: 0.025},
+	upscaleModel:    {PerImage: 0.002},
+}
+
+// modelRateEnvName turns a model into the stem of its price variables:
+// gpt-4o-mini into GPT_4O_MINI and black-forest-labs/flux-dev into
+// FLUX_DEV.
+func modelRateEnvName(model string) string {
+	if slash := strings.LastIndex(model, "/"); slash >= 0 {
+		model = model[slash+1:]
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, model)
+}
+
+// modelRateFor returns the rate of a provider's model. The variables
+// PRICE_<MODEL>_INPUT_PER_MTOK, PRICE_<MODEL>_OUTPUT_PER_MTOK, and
+// PRICE_<MODEL>_PER_IMAGE override the listed prices. Models without a
+// listed price fall back to PRICE_OPENAI_INPUT_PER_MTOK and
+// PRICE_OPENAI_OUTPUT_PER_MTOK, or PRICE_REPLICATE_PER_IMAGE.
+func modelRateFor(provider, model string) modelRate {
+	rate, ok := modelRates[model]
+	if !ok {
+		switch provider {
+		case "openai":
+			rate = modelRate{
+				InputPerMTok:  getEnvFloat("PRICE_OPENAI_INPUT_PER_MTOK", 2.50),
+				OutputPerMTok: getEnvFloat("PRICE_OPENAI_OUTPUT_PER_MTOK", 10.00),
+			}
+		case "replicate":
+			rate = modelRate{PerImage: getEnvFloat("PRICE_REPLICATE_PER_IMAGE", 0.025)}
+		}
+	}
+	stem := "PRICE_" + modelRateEnvName(model)
+	rate.InputPerMTok = getEnvFloat(stem+"_INPUT_PER_MTOK", rate.InputPerMTok)
+	rate.OutputPerMTok = getEnvFloat(stem+"_OUTPUT_PER_MTOK", rate.OutputPerMTok)
+	rate.PerImage = getEnvFloat(stem+"_PER_IMAGE", rate.PerImage)
+	return rate
+}
+
+// estimateCostMicros prices a request to a provider's model at its rate.
+// Token prices are per million tokens, so tokens * price is already in
+// micro-dollars.
+func estimateCostMicros(provider, model string, promptTokens, completionTokens, images int) int64 {
+	rate := modelRateFor(provider, model)
+	cost := float64(promptTokens)*rate.InputPerMTok +
+		float64(completionTokens)*rate.OutputPerMTok +
+		float64(images)*rate.PerImage*1e6
+	return int64(math.Round(cost))
+}
+
+// recordProviderUsage stores a successful provider request for spend
+// reporting. Failures are logged and otherwise ignored.
+func recordProviderUsage(menuID, provider, model string, promptTokens, completionTokens, images int) {
+	usage := ProviderUsage{
+		ID:                  idGen.NewID(),
+		MenuID:              menuID,
+		Provider:            provider,
+		Model:               model,
+		PromptTokens:        promptTokens,
+		CompletionTokens:    completionTokens,
+		Images:              images,
+		EstimatedCostMicros: estimateCostMicros(provider, model, promptTokens, completionTokens, images),
+		CreatedAt:           clock.Now(),
+	}
+	if err := db.Create(&usage).Error; err != nil {
+		zapLog.Error("Failed to record provider usage", zap.String("menuID", menuID), zap.String("provider", provider), zap.Error(err))
+	}
+}
+
+// rollupSpend recomputes the daily rollups for every UTC day on or after
+// since. It is idempotent, so overlapping runs are harmless.
+func rollupSpend(ctx context.Context, since time.Time) error {
+	return db.WithContext(ctx).Exec(`
+		INSERT INTO provider_spend_rollups
+			(day, provider, model, requests, prompt_tokens, completion_tokens, images, estimated_cost_micros, updated_at)
+		SELECT (created_at AT TIME ZONE 'UTC')::date, provider, model,
+			COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(images), SUM(estimated_cost_micros), ?
+		FROM provider_usages
+		WHERE created_at >= ?
+		GROUP BY 1, 2, 3
+		ON CONFLICT (day, provider, model) DO UPDATE SET
+			requests = EXCLUDED.requests,
+			prompt_tokens = EXCLUDED.prompt_tokens,
+			completion_tokens = EXCLUDED.completion_tokens,
+			images = EXCLUDED.images,
+			estimated_cost_micros = EXCLUDED.estimated_cost_micros,
+			updated_at = EXCLUDED.updated_at`,
+		clock.Now(), since.UTC().Truncate(24*time.Hour)).Error
+}
+
+// runSpendRollups rebuilds all rollups once and then refreshes today's and
+// yesterday's every interval until ctx is cancelled.
+// Only one replica rolls up at a time; the others skip that tick.
+func runSpendRollups(ctx context.Context, interval time.Duration) {
+	rollup := func(since time.Time) {
+		_, err := withJobLock(ctx, jobSpendRollup, func(ctx context.Context) error {
+			return rollupSpend(ctx, since)
+		})
+		if err != nil {
+			zapLog.Error("Spend rollup failed", zap.Error(err))
+		}
+	}
+
+	rollup(time.Time{})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rollup(clock.Now().AddDate(0, 0, -1))
+		}
+	}
+}
+
+// getSpendHandler reports rolled-up provider spend between from and to
+// (inclusive UTC dates, defaulting to the last 30 days).
+func getSpendHandler(c *gin.Context) {
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	var rollups []ProviderSpendRollup
+	if err := db.Where("day >= ? AND day <= ?", from.Format(spendDateLayout), to.Format(spendDateLayout)).
+		Order("day, provider, model").Find(&rollups).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load spend")
+		return
+	}
+
+	response := SpendResponse{
+		From: from.Format(spendDateLayout),
+		To:   to.Format(spendDateLayout),
+		Days: make([]SpendRow, len(rollups)),
+	}
+	totals := map[string]*SpendRow{}
+	costs := map[string]int64{}
+	for i, rollup := range rollups {
+		response.Days[i] = SpendRow{
+			Day:              rollup.Day.Format(spendDateLayout),
+			Provider:         rollup.Provider,
+			Model:            rollup.Model,
+			Requests:         rollup.Requests,
+			PromptTokens:     rollup.PromptTokens,
+			CompletionTokens: rollup.CompletionTokens,
+			Images:           rollup.Images,
+			EstimatedUSD:     float64(rollup.EstimatedCostMicros) / 1e6,
+		}
+
+		total, ok := totals[rollup.Provider]
+		if !ok {
+			total = &SpendRow{Provider: rollup.Provider}
+			totals[rollup.Provider] = total
+		}
+		total.Requests += rollup.Requests
+		total.PromptTokens += rollup.PromptTokens
+		total.CompletionTokens += rollup.CompletionTokens
+		total.Images += rollup.Images
+		costs[rollup.Provider] += rollup.EstimatedCostMicros
+	}
+
+	response.Totals = make([]SpendRow, 0, len(totals))
+	for provider, total := range totals {
+		total.EstimatedUSD = float64(costs[provider]) / 1e6
+		response.Totals = append(response.Totals, *total)
+	}
+	sort.Slice(response.Totals, func(i, j int) bool { return response.Totals[i].Provider < response.Totals[j].Provider })
+
+	c.JSON(http.StatusOK, response)
+}
+
+// parseDateRange reads the from and to query parameters, inclusive UTC dates
+// defaulting to the last 30 days, writing a 400 response when they are
+// invalid.
+func parseDateRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := clock.Now().UTC().Truncate(24 * time.Hour)
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(spendDateLayout, value)
+		if err != nil {
+			respondFieldError(c, "to", "date", "to must be a date (YYYY-MM-DD)")
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -29)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(spendDateLayout, value)
+		if err != nil {
+			respondFieldError(c, "from", "date", "from must be a date (YYYY-MM-DD)")
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		respondFieldError(c, "from", "range", "from must not be after to")
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestEstimateCostMicros(t *testing.T) {
+	for _, test := range []struct {
+		provider, model          string
+		prompt, completion, imgs int
+		want                     int64
+	}{
+		{"openai", "gpt-4o", 1000, 500, 0, 7500},
+		{"openai", "gpt-4o-mini", 1000, 500, 0, 450},
+		{"openai", moderationModel, 0, 0, 0, 0},
+		{"replicate", dishImageModel, 0, 0, 2, 50000},
+		{"replicate", upscaleModel, 0, 0, 1, 2000},
+		{"openai", "gpt-unknown", 1000, 500, 0, 7500},
+		{"replicate", "someone/unknown", 0, 0, 1, 25000},
+	} {
+		if got := estimateCostMicros(test.provider, test.model, test.prompt, test.completion, test.imgs); got != test.want {
+			t.Errorf("estimateCostMicros(%s, %s) = %d, want %d", test.provider, test.model, got, test.want)
+		}
+	}
+}
+
+func TestModelRateOverrides(t *testing.T) {
+	t.Setenv("PRICE_GPT_4O_MINI_INPUT_PER_MTOK", "0.30")
+	t.Setenv("PRICE_FLUX_DEV_PER_IMAGE", "0.05")
+	t.Setenv("PRICE_OPENAI_INPUT_PER_MTOK", "1")
+	t.Setenv("PRICE_OPENAI_OUTPUT_PER_MTOK", "2")
+
+	if got := estimateCostMicros("openai", "gpt-4o-mini", 1000, 1000, 0); got != 900 {
+		t.Errorf("gpt-4o-mini with an input override = %d, want 900", got)
+	}
+	if got := estimateCostMicros("replicate", dishImageModel, 0, 0, 1); got != 50000 {
+		t.Errorf("flux-dev with an override = %d, want 50000", got)
+	}
+	if got := estimateCostMicros("openai", "gpt-4o", 1000, 1000, 0); got != 12500 {
+		t.Errorf("gpt-4o ignores the fallback rates: got %d, want 12500", got)
+	}
+	if got := estimateCostMicros("openai", "gpt-unknown", 1000, 1000, 0); got != 3000 {
+		t.Errorf("unlisted model at the fallback rates = %d, want 3000", got)
+	}
+}
+
+func TestModelRateEnvName(t *testing.T) {
+	for model, want := range map[string]string{
+		"gpt-4o":                     "GPT_4O",
+		"gpt-4o-mini":                "GPT_4O_MINI",
+		"black-forest-labs/flux-dev": "FLUX_DEV",
+		"nightmareai/real-esrgan":    "REAL_ESRGAN",
+	} {
+		if got := modelRateEnvName(model); got != want {
+			t.Errorf("modelRateEnvName(%q) = %s, want %s", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Dishes have a spice level from 0 (not spicy) to 3 (very hot), for
+// frontends to show as chili badges. Extraction reads it off the menu's
+// chili icons and words such as "spicy" or "extra hot"; dishes the menu says
+// nothing about get one from the words of their name and description during
+// enhancement, and those without any stay unknown.
+
+const maxSpiceLevel = 3
+
+// spiceWords are the words that give a dish's spice level, qualified ones
+// first so "extra hot" and "mildly spicy" are not read as "hot" and "spicy".
+var spiceWords = []struct {
+	pattern *regexp.Regexp
+	level   int
+}{
+	{regexp.MustCompile(`(?i)\b(extra|very|super|fiery|thai)[ -](hot|spicy)\b|\b(inferno|vindaloo|phaal|ghost pepper|carolina reaper)\b`), 3},
+	{regexp.MustCompile(`(?i)\b(mild(ly)? (spicy|curry|heat)|medium (heat|spicy)|peppery|a (touch|hint) of heat|with a kick)\b`), 1},
+	{regexp.MustCompile(`(?i)\b(hot|spicy|chilli?|chile|jalape[nñ]o|sriracha|harissa|szechuan|sichuan|gochujang|arrabbiata|diablo)\b`), 2},
+}
+
+// notSpicyPattern finds words that use "hot" for temperature or say a dish
+// is not spicy.
+var notSpicyPattern = regexp.MustCompile(`(?i)\bhot (dogs?|chocolate|pot|cakes?|toddy|tea|coffee)\b|\b(served|piping) hot\b|\bhot or cold\b|\b(not spicy|no spice)\b`)
+
+// clampSpiceLevel returns level if it is a spice level, else nil.
+func clampSpiceLevel(level *int) *int {
+	if level == nil || *level < 0 {
+		return nil
+	}
+	clamped := min(*level, maxSpiceLevel)
+	return &clamped
+}
+
+// spiceLevelFromText works out a spice level from the words of a dish's
+// name and description, or returns nil when they say nothing about heat.
+func spiceLevelFromText(texts ...string) *int {
+	text := notSpicyPattern.ReplaceAllString(strings.Join(texts, " "), " ")
+	for _, word := range spiceWords {
+		if word.pattern.MatchString(text) {
+			level := word.level
+			return &level
+		}
+	}
+	return nil
+}
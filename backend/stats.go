@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// StatsBucket is how the menus uploaded in one UTC day, or in the whole
+// range, fared. Menus still being processed count as uploads only. Averages
+// and the success rate are null when no menu qualifies.
+type StatsBucket struct {
+	Day                  string   `json:"day,omitempty"`
+	Uploads              int64    `json:"uploads"`
+	Completed            int64    `json:"completed"`
+	Failed               int64    `json:"failed"`
+	SuccessRate          *float64 `json:"success_rate"`
+	AvgProcessingSeconds *float64 `json:"avg_processing_seconds"`
+	AvgDishesPerMenu     *float64 `json:"avg_dishes_per_menu"`
+}
+
+// StatsFailure counts the menus or dishes that failed with one code.
+type StatsFailure struct {
+	Scope string `json:"scope"`
+	Code  string `json:"code"`
+	Count int64  `json:"count"`
+}
+
+type StatsResponse struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Days     []StatsBucket  `json:"days"`
+	Totals   StatsBucket    `json:"totals"`
+	Failures []StatsFailure `json:"failures"`
+}
+
+// statsRow is one row of the bucket query.
+type statsRow struct {
+	Day                  time.Time
+	Uploads              int64
+	Completed            int64
+	Failed               int64
+	AvgProcessingSeconds *float64
+	AvgDishesPerMenu     *float64
+}
+
+// statsQuery aggregates the menus uploaded in a range; group by 1 for days.
+const statsQuery = `SELECT %s
+		COUNT(*) AS uploads,
+		COUNT(*) FILTER (WHERE status = 'COMPLETE') AS completed,
+		COUNT(*) FILTER (WHERE status = 'FAILED') AS failed,
+		AVG(EXTRACT(EPOCH FROM completed_at - created_at)) FILTER (WHERE status = 'COMPLETE' AND completed_at IS NOT NULL) AS avg_processing_seconds,
+		AVG(total_dishes) FILTER (WHERE total_dishes > 0) AS avg_dishes_per_menu
+	FROM menus WHERE created_at >= ? AND created_at < ?`
+
+func (row statsRow) bucket(day string) StatsBucket {
+	bucket := StatsBucket{
+		Day:                  day,
+		Uploads:              row.Uploads,
+		Completed:            row.Completed,
+		Failed:               row.Failed,
+		AvgProcessingSeconds: row.AvgProcessingSeconds,
+		AvgDishesPerMenu:     row.AvgDishesPerMenu,
+	}
+	if finished := row.Completed + row.Failed; finished > 0 {
+		rate := float64(row.Completed) / float64(finished)
+		bucket.SuccessRate = &rate
+	}
+	return bucket
+}
+
+// getStatsHandler reports, for the menus uploaded between from and to
+// (inclusive UTC dates, defaulting to the last 30 days), uploads, outcomes,
+// and processing time per day and in total, and what menus and dishes
+// failed with.
+func getStatsHandler(c *gin.Context) {
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	if to.Sub(from) >= maxUsageDays*24*time.Hour {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "the range must not be longer than 366 days")
+		return
+	}
+	start, end := from, to.AddDate(0, 0, 1)
+
+	var dayRows []statsRow
+	if err := db.Raw(fmt.Sprintf(statsQuery, "(created_at AT TIME ZONE 'UTC')::date AS day,")+" GROUP BY 1", start, end).Scan(&dayRows).Error; err != nil {
+		zapLog.Error("Failed to load stats", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load stats")
+		return
+	}
+	var totals statsRow
+	if err := db.Raw(fmt.Sprintf(statsQuery, ""), start, end).Scan(&totals).Error; err != nil {
+		zapLog.Error("Failed to load stats", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load stats")
+		return
+	}
+
+	rows := make(map[string]statsRow, len(dayRows))
+	for _, row := range dayRows {
+		rows[row.Day.Format(spendDateLayout)] = row
+	}
+	response := StatsResponse{
+		From:   from.Format(spendDateLayout),
+		To:     to.Format(spendDateLayout),
+		Totals: totals.bucket(""),
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format(spendDateLayout)
+		response.Days = append(response.Days, rows[key].bucket(key))
+	}
+
+	if err := db.Raw(`SELECT 'menu' AS scope, COALESCE(failure_code, 'UNKNOWN') AS code, COUNT(*) AS count FROM menus
+			WHERE status = 'FAILED' AND created_at >= ? AND created_at < ? GROUP BY 2
+		UNION ALL
+		SELECT 'dish' AS scope, COALESCE(d.failure_code, 'UNKNOWN') AS code, COUNT(*) AS count FROM dishes d
+			JOIN menus m ON m.id = d.menu_id
+			WHERE d.status = 'FAILED' AND m.created_at >= ? AND m.created_at < ? GROUP BY 2
+		ORDER BY scope DESC, count DESC, code`, start, end, start, end).Scan(&response.Failures).Error; err != nil {
+		zapLog.Error("Failed to load failure stats", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load stats")
+		return
+	}
+	if response.Failures == nil {
+		response.Failures = []StatsFailure{}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
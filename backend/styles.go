@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Menus can have an image style so all their dish photos share one look. An
+// upload picks it with style, and a dish's images can be regenerated in
+// another one. Each style adds to the image prompt and tunes the generation
+// parameters; menus without a style get the plain product-photo look.
+
+// imageStyle is how a style changes image generation.
+type imageStyle struct {
+	// Prompt is added to the image prompt
+	Prompt string
+	// Guidance and Steps replace the default guidance and inference steps
+	Guidance float64
+	Steps    int
+}
+
+const (
+	defaultImageGuidance = 3.5
+	defaultImageSteps    = 28
+)
+
+var imageStyles = map[string]imageStyle{
+	"rustic": {
+		Prompt:   "rustic styling on a worn wooden table, natural window light, earthy tones, handmade ceramics",
+		Guidance: 3.0,
+		Steps:    28,
+	},
+	"fine_dining": {
+		Prompt:   "fine dining plating on a white porcelain plate, minimalist composition, soft directional light, shallow depth of field",
+		Guidance: 4.0,
+		Steps:    32,
+	},
+	"street_food": {
+		Prompt:   "street food style, served in paper or takeaway packaging, vibrant colors, lively night market atmosphere",
+		Guidance: 3.0,
+		Steps:    28,
+	},
+	"flat_lay": {
+		Prompt:   "flat lay shot from directly overhead, styled on a textured surface with a few scattered ingredients",
+		Guidance: 3.5,
+		Steps:    28,
+	},
+}
+
+// imageStyleNames lists the styles in order, for validation messages.
+func imageStyleNames() []string {
+	names := make([]string, 0, len(imageStyles))
+	for name := range imageStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validImageStyle reports whether style names a style; "" is the default.
+func validImageStyle(style string) bool {
+	return style == "" || slices.Contains(imageStyleNames(), style)
+}
+
+// imageStyleParameters returns the guidance and inference steps of style.
+func imageStyleParameters(style string) (float64, int) {
+	if preset, ok := imageStyles[style]; ok {
+		return preset.Guidance, preset.Steps
+	}
+	return defaultImageGuidance, defaultImageSteps
+}
+
+// imageConstraints is what the deployment requires of every dish image:
+// IMAGE_PROMPT_CONSTRAINTS, such as "white plate, pale grey background", is
+// added as is, and each of the comma-separated IMAGE_NEGATIVE_PROMPT items,
+// such as "people, text, hands", as "no <item>". The image model has no
+// negative prompt input, so both go into the prompt. It returns "" when
+// neither is set.
+func imageConstraints() string {
+	var parts []string
+	if constraints := strings.TrimSpace(os.Getenv("IMAGE_PROMPT_CONSTRAINTS")); constraints != "" {
+		parts = append(parts, constraints)
+	}
+	for _, item := range strings.Split(os.Getenv("IMAGE_NEGATIVE_PROMPT"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(item), "no ") {
+			item = "no " + item
+		}
+		parts = append(parts, item)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Each provider call has its own timeout, and a menu's processing as a whole
+// has MENU_PROCESSING_DEADLINE (15m by default, 0 for none). A menu that runs
+// out of time keeps what it has: dishes enhanced so far stay, the rest are
+// failed with DEADLINE_EXCEEDED, and the menu completes with a
+// PROCESSING_DEADLINE warning. Only a menu still being read fails outright.
+
+var errProcessingDeadline = errors.New("menu processing deadline exceeded")
+
+// providerTimeouts are the per-call limits on provider requests.
+type providerTimeouts struct {
+	// Vision reads the menu image
+	Vision time.Duration
+	// Description writes one dish's copy
+	Description time.Duration
+	// DescriptionBatch writes the copy of a batch of dishes
+	DescriptionBatch time.Duration
+	// Image starts an image generation, waiting for it if the provider
+	// finishes in time
+	Image time.Duration
+	// Poll is how long to keep polling for images that were not ready
+	Poll time.Duration
+	// Translation translates one batch of a menu's sections and dishes
+	Translation time.Duration
+}
+
+func loadProviderTimeouts() providerTimeouts {
+	return providerTimeouts{
+		Vision:           getEnvDuration("VISION_TIMEOUT", 30*time.Second),
+		Description:      getEnvDuration("DESCRIPTION_TIMEOUT", 30*time.Second),
+		DescriptionBatch: getEnvDuration("DESCRIPTION_BATCH_TIMEOUT", 60*time.Second),
+		Image:            getEnvDuration("IMAGE_GENERATION_TIMEOUT", 60*time.Second),
+		Poll:             getEnvDuration("IMAGE_POLL_TIMEOUT", 60*time.Second),
+		Translation:      getEnvDuration("TRANSLATION_TIMEOUT", 60*time.Second),
+	}
+}
+
+// withProcessingDeadline bounds a menu's processing by
+// MENU_PROCESSING_DEADLINE.
+func withProcessingDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline := getEnvDuration("MENU_PROCESSING_DEADLINE", 15*time.Minute)
+	if deadline <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, deadline, errProcessingDeadline)
+}
+
+// interrupted reports whether ctx was cancelled from outside, e.g. by
+// deletion or shutdown, rather than by the menu running out of budget or
+// time. An interrupted dish is left as it was for whoever resumes the menu.
+func interrupted(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	cause := context.Cause(ctx)
+	return !errors.Is(cause, errBudgetExceeded) && !errors.Is(cause, errProcessingDeadline)
+}
+
+// finishAtDeadline completes a menu whose processing ran out of time with the
+// dishes it has, or fails it when no dish was read yet.
+func finishAtDeadline(ctx context.Context, menuID string) {
+	var menu Menu
+	if err := db.Select("id", "total_dishes").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		logFor(ctx).Error("Failed to load menu past its deadline", zap.String("menuID", menuID), zap.Error(err))
+		return
+	}
+	if menu.TotalDishes == 0 {
+		failMenuWithCode(menuID, "DEADLINE_EXCEEDED", "Processing did not finish reading the menu in time")
+		return
+	}
+
+	result := db.Model(&Dish{}).Where("menu_id = ? AND status IN ?", menuID, []string{"PENDING", "PROCESSING"}).Updates(map[string]interface{}{
+		"status":         "FAILED",
+		"failure_code":   "DEADLINE_EXCEEDED",
+		"failure_reason": "The menu's processing deadline passed before the dish was enhanced",
+		"updated_at":     clock.Now(),
+	})
+	if result.Error != nil {
+		logFor(ctx).Error("Failed to fail unfinished dishes", zap.String("menuID", menuID), zap.Error(result.Error))
+	}
+	logFor(ctx).Warn("Menu processing deadline passed", zap.String("menuID", menuID), zap.Int64("unfinishedDishes", result.RowsAffected))
+	addMenuWarnings(menuID, MenuWarning{
+		Code:    "PROCESSING_DEADLINE",
+		Message: fmt.Sprintf("Processing stopped at its deadline; %d dishes were not enhanced", result.RowsAffected),
+	})
+	completeMenu(menuID, menu.TotalDishes)
+}
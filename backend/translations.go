@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Completed menus can be translated into other languages for diners who do
+// not read the original. POST /api/menu/:id/translate?lang=es translates the
+// section names, dish names, and descriptions the menu has now, replacing an
+// earlier translation into the same language; GET /api/menu/:id?lang=es
+// returns the menu with them. Dishes added or renamed since keep their
+// original text until the menu is translated again.
+
+// DishTranslation is a dish's name and description in another language.
+type DishTranslation struct {
+	DishID      string  `gorm:"primaryKey;type:uuid"`
+	Language    string  `gorm:"primaryKey;type:varchar(20)"`
+	MenuID      string  `gorm:"type:uuid;index"`
+	Name        string  `gorm:"type:varchar(200)"`
+	Description *string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SectionTranslation is a section's name in another language.
+type SectionTranslation struct {
+	SectionID string `gorm:"primaryKey;type:uuid"`
+	Language  string `gorm:"primaryKey;type:varchar(20)"`
+	MenuID    string `gorm:"type:uuid;index"`
+	Name      string `gorm:"type:varchar(200)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type MenuTranslationResponse struct {
+	MenuID             string `json:"menu_id"`
+	Language           string `json:"language"`
+	TranslatedSections int    `json:"translated_sections"`
+	TranslatedDishes   int    `json:"translated_dishes"`
+}
+
+// languageTagPattern matches the BCP 47 tags menus are translated into, such
+// as "es", "zh-Hant", or "pt-BR".
+var languageTagPattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8}){0,2}$`)
+
+// translationBatchSize bounds the sections and dishes sent to OpenAI at once.
+const translationBatchSize = 40
+
+// parseLanguage returns raw as a lowercase language tag, or false if it is
+// not one.
+func parseLanguage(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if !languageTagPattern.MatchString(raw) {
+		return "", false
+	}
+	return strings.ToLower(raw), true
+}
+
+// translationItem is a section or dish as sent to and returned by the
+// translator, identified by its position in the request.
+type translationItem struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func translateMenuHandler(c *gin.Context) {
+	language, ok := parseLanguage(c.Query("lang"))
+	if !ok {
+		respondFieldError(c, "lang", "bcp47", "lang must be a language tag such as es or pt-BR")
+		return
+	}
+
+	menu, err := loadMenuStatus(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, "MENU_NOT_FOUND", "Menu not found")
+		return
+	}
+	if menu.Status != "COMPLETE" {
+		respondError(c, http.StatusConflict, "MENU_NOT_READY", "Menu has not finished processing")
+		return
+	}
+
+	// Sections come first, then dishes
+	items := make([]translationItem, 0, len(menu.Sections)+len(menu.Dishes))
+	for _, section := range menu.Sections {
+		items = append(items, translationItem{ID: strconv.Itoa(len(items)), Name: section.Name})
+	}
+	for _, dish := range menu.Dishes {
+		item := translationItem{ID: strconv.Itoa(len(items)), Name: dish.Name}
+		if dish.Description != nil {
+			item.Description = *dish.Description
+		}
+		items = append(items, item)
+	}
+
+	translated := make(map[string]translationItem, len(items))
+	for start := 0; start < len(items); start += translationBatchSize {
+		batch := items[start:min(start+translationBatchSize, len(items))]
+		results, err := translateItems(c.Request.Context(), menu.ID, language, batch)
+		if err != nil {
+			logFor(c.Request.Context()).Error("Failed to translate menu", zap.String("menuID", menu.ID), zap.String("language", language), zap.Error(err))
+			respondError(c, http.StatusBadGateway, "GENERATION_FAILED", "Failed to translate menu")
+			return
+		}
+		for _, result := range results {
+			translated[result.ID] = result
+		}
+	}
+
+	limits := loadSanitizeLimits()
+	now := clock.Now()
+	var sections []SectionTranslation
+	var dishes []DishTranslation
+	for i, section := range menu.Sections {
+		name, _ := sanitizeText(translated[strconv.Itoa(i)].Name, limits.SectionName)
+		if name == "" {
+			continue
+		}
+		sections = append(sections, SectionTranslation{SectionID: section.ID, Language: language, MenuID: menu.ID, Name: name, CreatedAt: now, UpdatedAt: now})
+	}
+	for i, dish := range menu.Dishes {
+		result := translated[strconv.Itoa(len(menu.Sections)+i)]
+		name, _ := sanitizeText(result.Name, limits.DishName)
+		if name == "" {
+			continue
+		}
+		translation := DishTranslation{DishID: dish.ID, Language: language, MenuID: menu.ID, Name: name, CreatedAt: now, UpdatedAt: now}
+		if description, _ := sanitizeText(result.Description, limits.Description); description != "" && dish.Description != nil {
+			translation.Description = &description
+		}
+		dishes = append(dishes, translation)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("menu_id = ? AND language = ?", menu.ID, language).Delete(&SectionTranslation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("menu_id = ? AND language = ?", menu.ID, language).Delete(&DishTranslation{}).Error; err != nil {
+			return err
+		}
+		if len(sections) > 0 {
+			if err := tx.Create(&sections).Error; err != nil {
+				return err
+			}
+		}
+		if len(dishes) > 0 {
+			if err := tx.Create(&dishes).Error; err != nil {
+				return err
+			}
+		}
+		// Localized responses change, so their ETags must too
+		return touchMenu(tx, menu.ID)
+	})
+	if err != nil {
+		zapLog.Error("Failed to store translations", zap.String("menuID", menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to store translations")
+		return
+	}
+
+	c.JSON(http.StatusOK, MenuTranslationResponse{
+		MenuID:             menu.ID,
+		Language:           language,
+		TranslatedSections: len(sections),
+		TranslatedDishes:   len(dishes),
+	})
+}
+
+// translateItems asks OpenAI to translate a batch of sections and dishes.
+func translateItems(ctx context.Context, menuID, language string, items []translationItem) ([]translationItem, error) {
+	input, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal items: %w", err)
+	}
+
+	systemPrompt := fmt.Sprintf("You translate restaurant menus into the language with BCP 47 tag %s. "+
+		"Translate the name and description of each item, keeping its id. Keep dish names diners know in their original form, such as sushi or pizza, "+
+		"and leave the description empty for items without one.", language)
+
+	itemSchema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":          map[string]interface{}{"type": "string"},
+			"name":        map[string]interface{}{"type": "string"},
+			"description": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"id", "name", "description"},
+	}
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"items": map[string]interface{}{"type": "array", "items": itemSchema},
+		},
+		"required": []string{"items"},
+	}
+
+	var result struct {
+		Items []translationItem `json:"items"`
+	}
+	err = requestStructured(ctx, menuID, structuredRequest{
+		Stage:        stageTranslate,
+		SchemaName:   "menu_translation",
+		SystemPrompt: systemPrompt,
+		UserPrompt:   string(input),
+		Schema:       schema,
+		MaxTokens:    4000,
+		Timeout:      loadProviderTimeouts().Translation,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// localizeMenu replaces the menu's section names, dish names, and
+// descriptions with their translations into language, where it has them.
+// It returns false when the menu was never translated into language.
+func localizeMenu(menu *Menu, language string) (bool, error) {
+	var sections []SectionTranslation
+	if err := db.Where("menu_id = ? AND language = ?", menu.ID, language).Find(&sections).Error; err != nil {
+		return false, err
+	}
+	var dishes []DishTranslation
+	if err := db.Where("menu_id = ? AND language = ?", menu.ID, language).Find(&dishes).Error; err != nil {
+		return false, err
+	}
+	if len(sections) == 0 && len(dishes) == 0 {
+		return false, nil
+	}
+
+	sectionNames := make(map[string]string, len(sections))
+	for _, translation := range sections {
+		sectionNames[translation.SectionID] = translation.Name
+	}
+	for i := range menu.Sections {
+		if name, ok := sectionNames[menu.Sections[i].ID]; ok {
+			menu.Sections[i].Name = name
+		}
+	}
+
+	byDish := make(map[string]DishTranslation, len(dishes))
+	for _, translation := range dishes {
+		byDish[translation.DishID] = translation
+	}
+	for i := range menu.Dishes {
+		translation, ok := byDish[menu.Dishes[i].ID]
+		if !ok {
+			continue
+		}
+		// The romanized name reads the original name, not the translation
+		menu.Dishes[i].Name = translation.Name
+		menu.Dishes[i].RomanizedName = nil
+		// Alt text is derived again in the menu's new language
+		menu.Dishes[i].ImageAlt = nil
+		if translation.Description != nil {
+			menu.Dishes[i].Description = translation.Description
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// With UPSCALING_ENABLED, a dish's image can be upscaled for print and large
+// displays. The upscaled image is kept as the dish's "upscaled" rendition;
+// upscaling again, after the image changed or at another scale, replaces it.
+
+// upscaleModel is the Replicate model images are upscaled with. It is not
+// one of Replicate's official models, so it is run by version,
+// UPSCALE_MODEL_VERSION.
+const upscaleModel = "nightmareai/real-esrgan"
+
+const defaultUpscaleModelVersion = "f121d640bd286e1fdc67f9799164c1d5be36ff74576ee11c803ae5b665dd46aa"
+
+// upscaledRenditionName names the rendition upscaled images are kept as.
+const upscaledRenditionName = "upscaled"
+
+type UpscaleImageRequest struct {
+	Scale int `json:"scale" binding:"omitempty,oneof=2 4"`
+}
+
+func upscalingEnabled() bool {
+	return getEnvBool("UPSCALING_ENABLED", false)
+}
+
+// upscaleDishImageHandler upscales the dish's current image in the
+// background. Clients poll the menu until the dish leaves REGENERATING and
+// find the result in its renditions.
+func upscaleDishImageHandler(c *gin.Context) {
+	dish, ok := loadMenuDish(c)
+	if !ok {
+		return
+	}
+
+	var req UpscaleImageRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+	if req.Scale == 0 {
+		req.Scale = 4
+	}
+
+	if !upscalingEnabled() {
+		respondError(c, http.StatusConflict, "UPSCALING_DISABLED", "Image upscaling is disabled")
+		return
+	}
+	if dish.ImageURL == nil {
+		respondError(c, http.StatusConflict, "DISH_HAS_NO_IMAGE", "The dish has no image to upscale")
+		return
+	}
+	if !beginDishRegeneration(c, dish) {
+		return
+	}
+
+	runInBackground(dish.MenuID, func(ctx context.Context) {
+		dish := *dish
+		imageURL, record, err := upscaleImage(ctx, dish.MenuID, *dish.ImageURL, req.Scale)
+		if err != nil {
+			zapLog.Error("Failed to upscale image", zap.String("dishID", dish.ID), zap.Error(err))
+			finishDishRegeneration(dish, nil)
+			return
+		}
+
+		spec := RenditionSpec{Name: upscaledRenditionName, Size: strconv.Itoa(req.Scale) + "x"}
+		if err := saveDishRendition(db, dish, spec, imageURL, record); err != nil {
+			zapLog.Error("Failed to store upscaled image", zap.String("dishID", dish.ID), zap.Error(err))
+		}
+		finishDishRegeneration(dish, nil)
+		zapLog.Info("Dish image upscaled", zap.String("dishID", dish.ID), zap.Int("scale", req.Scale))
+	})
+
+	c.JSON(http.StatusAccepted, RegenerateResponse{DishID: dish.ID, Status: "REGENERATING"})
+}
+
+// upscaleImage asks Replicate for a copy of the image at imageURL scale times
+// larger.
+func upscaleImage(ctx context.Context, menuID, imageURL string, scale int) (string, *GenerationRecord, error) {
+	defer jobStats.beginStage(stageImage)()
+
+	replicateAPIKey := lookupReplicateKey()
+	if replicateAPIKey == "" {
+		return "", nil, fmt.Errorf("REPLICATE_API_KEY not set")
+	}
+
+	version := os.Getenv("UPSCALE_MODEL_VERSION")
+	if version == "" {
+		version = defaultUpscaleModelVersion
+	}
+	request := map[string]interface{}{
+		"version": version,
+		"input": map[string]interface{}{
+			"image":        imageURL,
+			"scale":        scale,
+			"face_enhance": false,
+		},
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", replicateBaseURL()+"/v1/predictions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+replicateAPIKey)
+	req.Header.Set("Prefer", "wait")
+
+	client := &http.Client{Timeout: loadProviderTimeouts().Image}
+	resp, err := callProvider(menuID, client, req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return "", nil, fmt.Errorf("Replicate API error: %s", string(body))
+	}
+
+	var replicateResp ReplicateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&replicateResp); err != nil {
+		return "", nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	imageURLs := replicateResp.Output
+	if len(imageURLs) == 0 {
+		if replicateResp.URLs.Get == "" {
+			return "", nil, fmt.Errorf("no output or polling URL available")
+		}
+		imageURLs, err = pollReplicateResult(ctx, menuID, replicateResp.URLs.Get, replicateAPIKey)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	recordProviderUsage(menuID, "replicate", upscaleModel, 0, 0, 1)
+	record := &GenerationRecord{
+		Provider: "replicate",
+		Model:    upscaleModel,
+		Prompt:   imageURL,
+		Parameters: map[string]interface{}{
+			"prediction_id": replicateResp.ID,
+			"version":       version,
+			"scale":         scale,
+		},
+		GeneratedAt: clock.Now(),
+	}
+	return imageURLs[0], record, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// UsageDay is what the service did on one UTC day, for reconciling provider
+// invoices. Tokens, images, and cost come from ProviderUsage, so they match
+// /api/admin/spend.
+type UsageDay struct {
+	Day              string  `json:"day,omitempty"`
+	MenusProcessed   int64   `json:"menus_processed"`
+	DishesEnhanced   int64   `json:"dishes_enhanced"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	ImagesGenerated  int64   `json:"images_generated"`
+	FailedMenus      int64   `json:"failed_menus"`
+	FailedDishes     int64   `json:"failed_dishes"`
+	EstimatedUSD     float64 `json:"estimated_usd"`
+}
+
+type UsageResponse struct {
+	From   string     `json:"from"`
+	To     string     `json:"to"`
+	Days   []UsageDay `json:"days"`
+	Totals UsageDay   `json:"totals"`
+}
+
+// maxUsageDays bounds the range of one usage report.
+const maxUsageDays = 366
+
+// usageCount is one row of a per-day count query.
+type usageCount struct {
+	Day   time.Time
+	Count int64
+}
+
+// getUsageHandler reports usage for every day between from and to
+// (inclusive UTC dates, defaulting to the last 30 days), including days
+// without any.
+func getUsageHandler(c *gin.Context) {
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	if to.Sub(from) >= maxUsageDays*24*time.Hour {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "the range must not be longer than 366 days")
+		return
+	}
+	start, end := from, to.AddDate(0, 0, 1)
+
+	days := map[string]*UsageDay{}
+	response := UsageResponse{From: from.Format(spendDateLayout), To: to.Format(spendDateLayout)}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		response.Days = append(response.Days, UsageDay{Day: day.Format(spendDateLayout)})
+	}
+	for i := range response.Days {
+		days[response.Days[i].Day] = &response.Days[i]
+	}
+
+	counts := []struct {
+		query  string
+		target func(*UsageDay) *int64
+	}{
+		{`SELECT (completed_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count FROM menus
+			WHERE status = 'COMPLETE' AND completed_at >= ? AND completed_at < ? GROUP BY 1`,
+			func(d *UsageDay) *int64 { return &d.MenusProcessed }},
+		// A regenerated description counts on the day of its latest generation
+		{`SELECT ((generation_metadata->'description'->>'generated_at')::timestamptz AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count FROM dishes
+			WHERE (generation_metadata->'description'->>'generated_at')::timestamptz >= ?
+			AND (generation_metadata->'description'->>'generated_at')::timestamptz < ? GROUP BY 1`,
+			func(d *UsageDay) *int64 { return &d.DishesEnhanced }},
+		{`SELECT (updated_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count FROM menus
+			WHERE status = 'FAILED' AND updated_at >= ? AND updated_at < ? GROUP BY 1`,
+			func(d *UsageDay) *int64 { return &d.FailedMenus }},
+		{`SELECT (updated_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS count FROM dishes
+			WHERE status = 'FAILED' AND updated_at >= ? AND updated_at < ? GROUP BY 1`,
+			func(d *UsageDay) *int64 { return &d.FailedDishes }},
+	}
+	for _, count := range counts {
+		var rows []usageCount
+		if err := db.Raw(count.query, start, end).Scan(&rows).Error; err != nil {
+			zapLog.Error("Failed to load usage", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load usage")
+			return
+		}
+		for _, row := range rows {
+			if day, ok := days[row.Day.Format(spendDateLayout)]; ok {
+				*count.target(day) += row.Count
+			}
+		}
+	}
+
+	var providerRows []struct {
+		Day                 time.Time
+		PromptTokens        int64
+		CompletionTokens    int64
+		Images              int64
+		EstimatedCostMicros int64
+	}
+	if err := db.Raw(`SELECT (created_at AT TIME ZONE 'UTC')::date AS day,
+			SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens,
+			SUM(images) AS images, SUM(estimated_cost_micros) AS estimated_cost_micros
+		FROM provider_usages WHERE created_at >= ? AND created_at < ? GROUP BY 1`, start, end).
+		Scan(&providerRows).Error; err != nil {
+		zapLog.Error("Failed to load provider usage", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load usage")
+		return
+	}
+	var totalMicros int64
+	for _, row := range providerRows {
+		if day, ok := days[row.Day.Format(spendDateLayout)]; ok {
+			day.PromptTokens = row.PromptTokens
+			day.CompletionTokens = row.CompletionTokens
+			day.ImagesGenerated = row.Images
+			day.EstimatedUSD = float64(row.EstimatedCostMicros) / 1e6
+			totalMicros += row.EstimatedCostMicros
+		}
+	}
+
+	for _, day := range response.Days {
+		response.Totals.MenusProcessed += day.MenusProcessed
+		response.Totals.DishesEnhanced += day.DishesEnhanced
+		response.Totals.PromptTokens += day.PromptTokens
+		response.Totals.CompletionTokens += day.CompletionTokens
+		response.Totals.ImagesGenerated += day.ImagesGenerated
+		response.Totals.FailedMenus += day.FailedMenus
+		response.Totals.FailedDishes += day.FailedDishes
+	}
+	response.Totals.EstimatedUSD = float64(totalMicros) / 1e6
+
+	c.JSON(http.StatusOK, response)
+}
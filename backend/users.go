@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// User is an account that owns the menus it uploads. Menus uploaded without
+// signing in have no owner and stay reachable by anyone who knows their ID,
+// as before accounts existed. Users who signed up through a provider without
+// a verified email have none, and no password either.
+type User struct {
+	ID            string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Email         string    `json:"email" gorm:"index:idx_users_email_set,unique,where:email <> ''"`
+	Name          string    `json:"name"`
+	PasswordHash  string    `json:"-"`
+	EmailVerified bool      `json:"email_verified"` // a login provider vouched for Email
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Name     string `json:"name" binding:"max=100"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// SessionResponse carries a session token for the Authorization header.
+type SessionResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      User      `json:"user"`
+}
+
+// sessionClaims are the claims of a session token. The subject is the user
+// ID.
+type sessionClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+const sessionIssuer = "menugen"
+
+var errAccountsDisabled = errors.New("accounts are disabled: JWT_SECRET is not set")
+
+// sessionSecret is the HMAC key for session tokens. Every replica must share
+// it, so accounts are disabled rather than falling back to a random key.
+func sessionSecret() ([]byte, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errAccountsDisabled
+	}
+	return []byte(secret), nil
+}
+
+// issueSession signs a session token for user, valid for JWT_TTL (24h by
+// default).
+func issueSession(user User) (SessionResponse, error) {
+	secret, err := sessionSecret()
+	if err != nil {
+		return SessionResponse{}, err
+	}
+
+	now := clock.Now()
+	expiresAt := now.Add(getEnvDuration("JWT_TTL", 24*time.Hour))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, sessionClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    sessionIssuer,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		return SessionResponse{}, err
+	}
+	return SessionResponse{Token: signed, ExpiresAt: expiresAt, User: user}, nil
+}
+
+// parseSession verifies a session token and returns the user ID it was issued
+// to.
+func parseSession(token string) (string, error) {
+	secret, err := sessionSecret()
+	if err != nil {
+		return "", err
+	}
+
+	var claims sessionClaims
+	_, err = jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(sessionIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(clock.Now),
+	)
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", errors.New("session token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+// authenticateUser identifies the signed-in user from a session token sent
+// as "Authorization: Bearer <token>", or as the access_token query parameter
+// for clients that cannot set headers. Requests without a token continue
+// anonymously; requests with an invalid one are rejected.
+func authenticateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("access_token")
+		}
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		userID, err := parseSession(token)
+		if err != nil {
+			respondError(c, http.StatusUnauthorized, "INVALID_SESSION", "Session token is invalid or expired")
+			c.Abort()
+			return
+		}
+
+		c.Set("userID", userID)
+		c.Next()
+	}
+}
+
+// currentUserID returns the signed-in user's ID, or "" for anonymous
+// requests.
+func currentUserID(c *gin.Context) string {
+	return c.GetString("userID")
+}
+
+// requireUser rejects anonymous requests.
+func requireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentUserID(c) == "" {
+			respondError(c, http.StatusUnauthorized, "LOGIN_REQUIRED", "Sign in to use this endpoint")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// scopeToOwner limits a menu query to the menus of userID, or to the menus
+// uploaded without an owner with the API key apiKeyID when userID is "".
+func scopeToOwner(query *gorm.DB, userID, apiKeyID string) *gorm.DB {
+	if userID == "" {
+		query = query.Where("user_id IS NULL")
+		if apiKeyID != "" {
+			return query.Where("api_key_id = ?", apiKeyID)
+		}
+		return query
+	}
+	return query.Where("user_id = ?", userID)
+}
+
+func registerHandler(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if _, err := sessionSecret(); err != nil {
+		respondError(c, http.StatusServiceUnavailable, "ACCOUNTS_DISABLED", "Accounts are not enabled on this server")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create account")
+		return
+	}
+
+	now := clock.Now()
+	user := User{
+		ID:           idGen.NewID(),
+		Email:        normalizeEmail(req.Email),
+		Name:         strings.TrimSpace(req.Name),
+		PasswordHash: string(hash),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	var existing int64
+	if err := db.Model(&User{}).Where("email = ?", user.Email).Count(&existing).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create account")
+		return
+	}
+	if existing > 0 {
+		respondError(c, http.StatusConflict, "EMAIL_TAKEN", "An account with this email already exists")
+		return
+	}
+	if err := db.Create(&user).Error; err != nil {
+		zapLog.Error("Failed to create user", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create account")
+		return
+	}
+
+	session, err := issueSession(user)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start session")
+		return
+	}
+	zapLog.Info("User registered", zap.String("userID", user.ID))
+	c.JSON(http.StatusCreated, session)
+}
+
+// loginHandler exchanges an email and password for a session token. Unknown
+// emails and wrong passwords get the same answer.
+func loginHandler(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if _, err := sessionSecret(); err != nil {
+		respondError(c, http.StatusServiceUnavailable, "ACCOUNTS_DISABLED", "Accounts are not enabled on this server")
+		return
+	}
+
+	var user User
+	err := db.Where("email = ?", normalizeEmail(req.Email)).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to sign in")
+		return
+	}
+	// Unknown emails and accounts without a password are compared against a
+	// dummy hash, so the answer takes as long as for a wrong password
+	hash := []byte(user.PasswordHash)
+	if err != nil || len(hash) == 0 {
+		hash = dummyPasswordHash()
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || err != nil || user.PasswordHash == "" {
+		respondError(c, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Email or password is incorrect")
+		return
+	}
+
+	session, err := issueSession(user)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start session")
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+func getCurrentUserHandler(c *gin.Context) {
+	var user User
+	if err := db.Where("id = ?", currentUserID(c)).First(&user).Error; err != nil {
+		respondError(c, http.StatusUnauthorized, "INVALID_SESSION", "Account no longer exists")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// dummyPasswordHash is a hash no password is checked against in earnest,
+// at the cost real ones have.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("menugen dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// MenuSummary is a menu as listed for its owner, without its content.
+type MenuSummary struct {
+	MenuID           string     `json:"menu_id"`
+	RestaurantID     *string    `json:"restaurant_id"`
+	Status           string     `json:"status"`
+	OriginalFilename string     `json:"original_filename"`
+	TotalDishes      int        `json:"total_dishes"`
+	ProcessedDishes  int        `json:"processed_dishes"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CompletedAt      *time.Time `json:"completed_at"`
+}
+
+// listMenusHandler lists the signed-in user's menus newest first, paged
+// like the gRPC ListMenus call, or the menus of one of their restaurants.
+func listMenusHandler(c *gin.Context) {
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			respondFieldError(c, "limit", "min", "limit must be a positive number")
+			return
+		}
+		limit = min(parsed, 100)
+	}
+
+	// A restaurant's menus are listed to all its members, whoever uploaded
+	// them
+	query := scopeToOwner(db, currentUserID(c), currentAPIKeyID(c))
+	if restaurantID := c.Query("restaurant_id"); restaurantID != "" {
+		role, err := restaurantRole(restaurantID, currentUserID(c))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list menus")
+			return
+		}
+		if role == "" {
+			respondError(c, http.StatusNotFound, "RESTAURANT_NOT_FOUND", "Restaurant not found")
+			return
+		}
+		query = db.Where("restaurant_id = ?", restaurantID)
+	}
+	query = query.Order("created_at DESC, id DESC").Limit(limit + 1)
+	if token := c.Query("page_token"); token != "" {
+		createdAt, id, err := decodeMenuPageToken(token)
+		if err != nil {
+			respondFieldError(c, "page_token", "format", "invalid page_token")
+			return
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var menus []Menu
+	if err := query.Find(&menus).Error; err != nil {
+		zapLog.Error("Failed to list menus", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to list menus")
+		return
+	}
+
+	nextPageToken := ""
+	if len(menus) > limit {
+		menus = menus[:limit]
+		last := menus[len(menus)-1]
+		nextPageToken = encodeMenuPageToken(last.CreatedAt, last.ID)
+	}
+	summaries := make([]MenuSummary, len(menus))
+	for i, menu := range menus {
+		summaries[i] = toMenuSummary(menu)
+	}
+	c.JSON(http.StatusOK, gin.H{"menus": summaries, "next_page_token": nextPageToken})
+}
+
+func toMenuSummary(menu Menu) MenuSummary {
+	return MenuSummary{
+		MenuID:           menu.ID,
+		RestaurantID:     menu.RestaurantID,
+		Status:           menu.Status,
+		OriginalFilename: menu.OriginalFile,
+		TotalDishes:      menu.TotalDishes,
+		ProcessedDishes:  menu.ProcessedDishes,
+		CreatedAt:        menu.CreatedAt,
+		CompletedAt:      menu.CompletedAt,
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dishes sold in several sizes or versions, such as a pizza in 10" and 14"
+// or a wine by the glass and the bottle, keep a price per variant. Sections
+// that print sizes as columns are extracted as one variant per column. A
+// dish whose only prices are its variants' gets the range of them as its own
+// price, so clients that ignore variants still show something sensible.
+
+// DishVariant is one size or version of a dish with its own price, in the
+// dish's currency.
+type DishVariant struct {
+	ID             string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	DishID         string    `json:"dish_id" gorm:"type:uuid;index"`
+	MenuID         string    `json:"menu_id" gorm:"type:uuid;index"`
+	Name           string    `json:"name" gorm:"type:varchar(50)"`
+	PriceCents     *int      `json:"price_cents"`
+	RawPriceString *string   `json:"raw_price_string"`
+	Position       int       `json:"position"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DishVariantResponse is a variant as returned with its dish.
+type DishVariantResponse struct {
+	Name           string  `json:"name"`
+	PriceCents     *int    `json:"price_cents"`
+	RawPriceString *string `json:"raw_price_string"`
+}
+
+// StructuredVariant is a variant as extracted from the menu image.
+type StructuredVariant struct {
+	Name  string  `json:"name"`
+	Price *string `json:"price"`
+}
+
+// maxVariantNameLength bounds dish_variants.name.
+const maxVariantNameLength = 50
+
+// newDishVariants builds the variants of an extracted dish, priced in the
+// dish's currency. Dishes with fewer than two variants have none.
+func newDishVariants(dish Dish, extracted []StructuredVariant) []DishVariant {
+	if len(extracted) < 2 {
+		return nil
+	}
+	variants := make([]DishVariant, 0, len(extracted))
+	for _, variant := range extracted {
+		variants = append(variants, DishVariant{
+			ID:             idGen.NewID(),
+			DishID:         dish.ID,
+			MenuID:         dish.MenuID,
+			Name:           variant.Name,
+			PriceCents:     optionPrice(variant.Price, dish.Currency),
+			RawPriceString: variant.Price,
+			Position:       len(variants),
+			CreatedAt:      clock.Now(),
+		})
+	}
+	return variants
+}
+
+// optionPrice reads the raw price of a variant or modifier, or nil when it
+// has none.
+func optionPrice(raw *string, currency string) *int {
+	if raw == nil {
+		return nil
+	}
+	if amount, ok := parsePrice(*raw, currency); ok && amount > 0 {
+		return &amount
+	}
+	return nil
+}
+
+// priceFromVariants is the price of a dish priced only through its variants:
+// the range of their prices, or nothing when none has one.
+func priceFromVariants(variants []DishVariant) DishPrice {
+	var low, high *int
+	for _, variant := range variants {
+		if variant.PriceCents == nil {
+			continue
+		}
+		if low == nil || *variant.PriceCents < *low {
+			low = variant.PriceCents
+		}
+		if high == nil || *variant.PriceCents > *high {
+			high = variant.PriceCents
+		}
+	}
+	switch {
+	case low == nil:
+		return DishPrice{Type: PriceTypeNone}
+	case *low == *high:
+		return DishPrice{Type: PriceTypeFixed, Cents: low}
+	}
+	return DishPrice{Type: PriceTypeRange, Cents: low, MinCents: low, MaxCents: high}
+}
+
+// createDishVariants stores the variants of a dish in tx.
+func createDishVariants(tx *gorm.DB, variants []DishVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	return tx.Create(&variants).Error
+}
+
+// attachDishVariants loads the variants of the menu's dishes for responses.
+func attachDishVariants(menu *Menu) error {
+	var variants []DishVariant
+	if err := db.Where("menu_id = ?", menu.ID).Order("position").Find(&variants).Error; err != nil {
+		return err
+	}
+
+	byDish := make(map[string][]DishVariant)
+	for _, variant := range variants {
+		byDish[variant.DishID] = append(byDish[variant.DishID], variant)
+	}
+	for i := range menu.Dishes {
+		menu.Dishes[i].Variants = byDish[menu.Dishes[i].ID]
+	}
+	return nil
+}
+
+func toVariantResponses(variants []DishVariant) []DishVariantResponse {
+	if len(variants) == 0 {
+		return nil
+	}
+	responses := make([]DishVariantResponse, len(variants))
+	for i, variant := range variants {
+		responses[i] = DishVariantResponse{
+			Name:           variant.Name,
+			PriceCents:     variant.PriceCents,
+			RawPriceString: variant.RawPriceString,
+		}
+	}
+	return responses
+}
+
+// formatVariantPrices renders the variants' prices for display, e.g.
+// "Small $10.00 · Large $14.00".
+func formatVariantPrices(dish Dish) string {
+	parts := make([]string, 0, len(dish.Variants))
+	for _, variant := range dish.Variants {
+		price := ""
+		if variant.PriceCents != nil {
+			price = formatPrice(Dish{PriceCents: variant.PriceCents, PriceType: PriceTypeFixed, Currency: dish.Currency})
+		} else if variant.RawPriceString != nil {
+			price = *variant.RawPriceString
+		}
+		parts = append(parts, strings.TrimSpace(variant.Name+" "+price))
+	}
+	return strings.Join(parts, " · ")
+}
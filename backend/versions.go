@@ -0,0 +1,299 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MenuVersion is a snapshot of a menu's sections and dishes taken right
+// before a change, so edits and regenerations can always be undone.
+type MenuVersion struct {
+	ID        string       `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MenuID    string       `json:"menu_id" gorm:"type:uuid;uniqueIndex:idx_menu_versions_menu_version"`
+	Version   int          `json:"version" gorm:"uniqueIndex:idx_menu_versions_menu_version"`
+	Reason    string       `json:"reason"`
+	Snapshot  MenuSnapshot `json:"snapshot" gorm:"type:jsonb"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// MenuSnapshot holds a menu's sections and dishes along with the dishes'
+// variants, modifiers, tags, and allergens. Stored snapshots are upgraded to
+// the current schema when read, like menus and dishes.
+type MenuSnapshot struct {
+	SchemaVersion int            `json:"schema_version"`
+	Sections      []MenuSection  `json:"sections"`
+	Dishes        []Dish         `json:"dishes"`
+	Variants      []DishVariant  `json:"variants"`
+	Modifiers     []DishModifier `json:"modifiers"`
+	Tags          []DishTag      `json:"tags"`
+	Allergens     []DishAllergen `json:"allergens"`
+
+	// childrenMissing is set on snapshots taken before variants, modifiers,
+	// tags, and allergens were recorded.
+	childrenMissing bool
+}
+
+func (s MenuSnapshot) Value() (driver.Value, error) {
+	return marshalJSONColumn(s)
+}
+
+func (s *MenuSnapshot) Scan(value interface{}) error {
+	if err := scanJSONColumn(value, s); err != nil {
+		return err
+	}
+	upgradeSnapshot(s)
+	return nil
+}
+
+type MenuVersionSummary struct {
+	Version      int       `json:"version"`
+	Reason       string    `json:"reason"`
+	SectionCount int       `json:"section_count"`
+	DishCount    int       `json:"dish_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+var errMenuBusy = errors.New("menu has dishes being regenerated")
+
+func listMenuVersionsHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	var versions []MenuVersion
+	if err := db.Where("menu_id = ?", menu.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load versions")
+		return
+	}
+
+	summaries := make([]MenuVersionSummary, len(versions))
+	for i, version := range versions {
+		summaries[i] = MenuVersionSummary{
+			Version:      version.Version,
+			Reason:       version.Reason,
+			SectionCount: len(version.Snapshot.Sections),
+			DishCount:    len(version.Snapshot.Dishes),
+			CreatedAt:    version.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"menu_id": menu.ID, "versions": summaries})
+}
+
+func getMenuVersionHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+
+	version, ok := loadMenuVersion(c, menu.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// restoreMenuVersionHandler replaces the menu's sections and dishes with a
+// snapshot. The current state is snapshotted first, so a restore can itself
+// be undone.
+func restoreMenuVersionHandler(c *gin.Context) {
+	menu, ok := loadMenu(c)
+	if !ok {
+		return
+	}
+	if menu.Status != "COMPLETE" {
+		respondError(c, http.StatusConflict, "MENU_NOT_READY", "Menu is not ready yet")
+		return
+	}
+
+	version, ok := loadMenuVersion(c, menu.ID)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var regenerating int64
+		if err := tx.Model(&Dish{}).Where("menu_id = ? AND status = ?", menu.ID, "REGENERATING").Count(&regenerating).Error; err != nil {
+			return err
+		}
+		if regenerating > 0 {
+			return errMenuBusy
+		}
+
+		if err := beginMenuEdit(tx, menu.ID, "restore"); err != nil {
+			return err
+		}
+		return replaceMenuContent(tx, menu.ID, version.Snapshot)
+	})
+	if errors.Is(err, errMenuBusy) {
+		respondError(c, http.StatusConflict, "REGENERATION_IN_PROGRESS", "Wait for dish regeneration to finish before restoring")
+		return
+	}
+	if err != nil {
+		zapLog.Error("Failed to restore menu version", zap.String("menuID", menu.ID), zap.Int("version", version.Version), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to restore version")
+		return
+	}
+
+	zapLog.Info("Menu version restored", zap.String("menuID", menu.ID), zap.Int("version", version.Version))
+	getMenuHandler(c)
+}
+
+func loadMenuVersion(c *gin.Context, menuID string) (*MenuVersion, bool) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		respondFieldError(c, "version", "type", "version must be a number")
+		return nil, false
+	}
+
+	var version MenuVersion
+	if err := db.Where("menu_id = ? AND version = ?", menuID, number).First(&version).Error; err != nil {
+		respondError(c, http.StatusNotFound, "VERSION_NOT_FOUND", "Version not found")
+		return nil, false
+	}
+	return &version, true
+}
+
+// snapshotMenu records the menu's current sections and dishes as a new
+// version. Call it inside the transaction that is about to change them.
+func snapshotMenu(tx *gorm.DB, menuID, reason string) error {
+	snapshot, err := loadMenuSnapshot(tx, menuID)
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	if err := tx.Model(&MenuVersion{}).Where("menu_id = ?", menuID).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return err
+	}
+
+	version := MenuVersion{
+		ID:        idGen.NewID(),
+		MenuID:    menuID,
+		Version:   latest + 1,
+		Reason:    reason,
+		Snapshot:  snapshot,
+		CreatedAt: clock.Now(),
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return err
+	}
+
+	if limit := getEnvInt("MAX_MENU_VERSIONS", 50); limit > 0 {
+		return tx.Where("menu_id = ? AND version <= ?", menuID, version.Version-limit).Delete(&MenuVersion{}).Error
+	}
+	return nil
+}
+
+// loadMenuSnapshot reads the menu's current sections and dishes, and the
+// dishes' variants, modifiers, tags, and allergens.
+func loadMenuSnapshot(tx *gorm.DB, menuID string) (MenuSnapshot, error) {
+	snapshot := MenuSnapshot{
+		SchemaVersion: currentSchemaVersion,
+		Variants:      []DishVariant{},
+		Modifiers:     []DishModifier{},
+		Tags:          []DishTag{},
+		Allergens:     []DishAllergen{},
+	}
+	if err := tx.Where("menu_id = ?", menuID).Order("position").Find(&snapshot.Sections).Error; err != nil {
+		return snapshot, err
+	}
+	if err := tx.Where("menu_id = ?", menuID).Order("position").Find(&snapshot.Dishes).Error; err != nil {
+		return snapshot, err
+	}
+	if err := tx.Where("menu_id = ?", menuID).Order("dish_id, position").Find(&snapshot.Variants).Error; err != nil {
+		return snapshot, err
+	}
+	if err := tx.Where("menu_id = ?", menuID).Order("dish_id, position").Find(&snapshot.Modifiers).Error; err != nil {
+		return snapshot, err
+	}
+	if err := tx.Where("menu_id = ?", menuID).Order("dish_id, tag").Find(&snapshot.Tags).Error; err != nil {
+		return snapshot, err
+	}
+	if err := tx.Where("menu_id = ?", menuID).Order("dish_id, allergen").Find(&snapshot.Allergens).Error; err != nil {
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// replaceMenuContent swaps the menu's sections, dishes, and the dishes'
+// variants, modifiers, tags, and allergens for a snapshot, then recounts the
+// menu and section dish counters. Feedback and image candidates are keyed by
+// dish ID and left alone, so they reattach when a snapshot containing the
+// dish is restored. Snapshots taken before the dishes' other rows were
+// recorded leave the restored dishes' current ones in place.
+func replaceMenuContent(tx *gorm.DB, menuID string, snapshot MenuSnapshot) error {
+	if err := tx.Where("menu_id = ?", menuID).Delete(&Dish{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("menu_id = ?", menuID).Delete(&MenuSection{}).Error; err != nil {
+		return err
+	}
+
+	now := clock.Now()
+	dishIDs := make([]string, len(snapshot.Dishes))
+	for _, section := range snapshot.Sections {
+		if err := tx.Create(&section).Error; err != nil {
+			return err
+		}
+	}
+	for i, dish := range snapshot.Dishes {
+		if dish.Status == "REGENERATING" {
+			dish.Status = "COMPLETE"
+		}
+		dish.UpdatedAt = now
+		if err := tx.Create(&dish).Error; err != nil {
+			return err
+		}
+		dishIDs[i] = dish.ID
+	}
+
+	if err := replaceDishChildren(tx, menuID, dishIDs, snapshot.Variants, snapshot.childrenMissing); err != nil {
+		return err
+	}
+	if err := replaceDishChildren(tx, menuID, dishIDs, snapshot.Modifiers, snapshot.childrenMissing); err != nil {
+		return err
+	}
+	if err := replaceDishChildren(tx, menuID, dishIDs, snapshot.Tags, snapshot.childrenMissing); err != nil {
+		return err
+	}
+	if err := replaceDishChildren(tx, menuID, dishIDs, snapshot.Allergens, snapshot.childrenMissing); err != nil {
+		return err
+	}
+
+	if err := recountSectionDishes(tx, menuID); err != nil {
+		return err
+	}
+	return tx.Exec(`UPDATE menus SET
+			total_dishes = (SELECT COUNT(*) FROM dishes WHERE menu_id = ?),
+			processed_dishes = (SELECT COUNT(*) FROM dishes WHERE menu_id = ? AND status NOT IN ?),
+			updated_at = ?
+		WHERE id = ?`,
+		menuID, menuID, unprocessedDishStatuses, now, menuID).Error
+}
+
+// replaceDishChildren swaps the menu's rows of one dish child table for rows.
+// With keep, the snapshot did not record the table: the restored dishes keep
+// their current rows and only rows of dishes that are gone are deleted.
+func replaceDishChildren[T any](tx *gorm.DB, menuID string, dishIDs []string, rows []T, keep bool) error {
+	query := tx.Where("menu_id = ?", menuID)
+	if keep && len(dishIDs) > 0 {
+		query = query.Where("dish_id NOT IN ?", dishIDs)
+	}
+	if err := query.Delete(new(T)).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
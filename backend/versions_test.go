@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TestMenuVersionRestore snapshots a menu, changes it, and restores the
+// snapshot. It needs the configured database, and is skipped when that
+// cannot be reached.
+func TestMenuVersionRestore(t *testing.T) {
+	h, err := NewHarness()
+	if err != nil {
+		t.Skipf("no database for the harness: %v", err)
+	}
+	defer h.Close()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixed := h.UseFixedClock(start)
+
+	// IDs 1-4: the menu, its section, and its two dishes
+	menu, err := h.CreateMenu("Pad Thai", "Green Curry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	padThai, curry := menu.Dishes[0], menu.Dishes[1]
+	if err := db.Create(&DishTag{DishID: padThai.ID, Tag: "vegetarian", MenuID: menu.ID, Source: DishTagSourceMenu, CreatedAt: start}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	fixed.Advance(time.Hour)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := snapshotMenu(tx, menu.ID, "edit"); err != nil {
+			return err
+		}
+		if err := tx.Where("dish_id = ?", padThai.ID).Delete(&DishTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", curry.ID).Delete(&Dish{}).Error; err != nil {
+			return err
+		}
+		if err := recountSectionDishes(tx, menu.ID); err != nil {
+			return err
+		}
+		return tx.Model(&Menu{}).Where("id = ?", menu.ID).Updates(map[string]interface{}{"total_dishes": 1, "processed_dishes": 1}).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var version MenuVersion
+	if err := db.Where("menu_id = ? AND version = ?", menu.ID, 1).First(&version).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := "00000000-0000-0000-0000-000000000005"; version.ID != want {
+		t.Errorf("version ID = %s, want %s", version.ID, want)
+	}
+	if want := start.Add(time.Hour); !version.CreatedAt.Equal(want) {
+		t.Errorf("version created_at = %s, want %s", version.CreatedAt, want)
+	}
+	if len(version.Snapshot.Dishes) != 2 || len(version.Snapshot.Tags) != 1 {
+		t.Fatalf("snapshot has %d dishes and %d tags, want 2 and 1", len(version.Snapshot.Dishes), len(version.Snapshot.Tags))
+	}
+
+	fixed.Advance(time.Hour)
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return replaceMenuContent(tx, menu.ID, version.Snapshot)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dishes []Dish
+	if err := db.Where("menu_id = ?", menu.ID).Order("position").Find(&dishes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(dishes) != 2 || dishes[1].ID != curry.ID {
+		t.Fatalf("restored dishes = %+v, want both dishes back", dishes)
+	}
+	if !dishes[0].UpdatedAt.Equal(fixed.Now()) {
+		t.Errorf("restored dish updated_at = %s, want %s", dishes[0].UpdatedAt, fixed.Now())
+	}
+
+	var tags int64
+	if err := db.Model(&DishTag{}).Where("dish_id = ?", padThai.ID).Count(&tags).Error; err != nil {
+		t.Fatal(err)
+	}
+	if tags != 1 {
+		t.Errorf("restored dish has %d tags, want 1", tags)
+	}
+
+	var restored Menu
+	if err := db.Preload("Sections").Where("id = ?", menu.ID).First(&restored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if restored.TotalDishes != 2 || restored.ProcessedDishes != 2 {
+		t.Errorf("menu counts %d/%d dishes, want 2/2", restored.ProcessedDishes, restored.TotalDishes)
+	}
+	if section := restored.Sections[0]; section.TotalDishes != 2 || section.ProcessedDishes != 2 {
+		t.Errorf("section counts %d/%d dishes, want 2/2", section.ProcessedDishes, section.TotalDishes)
+	}
+}
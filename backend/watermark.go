@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Deployments that must label generated images set WATERMARK_ENABLED. Each
+// generated dish image is then downloaded, stamped with WATERMARK_TEXT in its
+// bottom-right corner, and stored in the database, and dishes get its
+// PUBLIC_BASE_URL/public/images/:id URL instead of the provider's. An image
+// that cannot be watermarked fails like a failed generation, so unlabeled
+// images are never served. Go cannot encode WebP, so watermarked images are
+// generated as JPEG when IMAGE_OUTPUT_FORMAT is webp.
+
+const defaultWatermarkText = "AI-generated image"
+
+// maxWatermarkTextLength bounds WATERMARK_TEXT; longer labels are cut.
+const maxWatermarkTextLength = 60
+
+// StoredImage is an image the service serves itself. It belongs to the menu
+// it was generated for, and goes with it unless the image cache has shared
+// it with other menus (see deleteUnsharedImages).
+type StoredImage struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	MenuID      *string   `json:"menu_id" gorm:"type:uuid;index"`
+	ContentType string    `json:"content_type" gorm:"type:varchar(50)"`
+	Data        []byte    `json:"-" gorm:"type:bytea"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// watermarkText returns the label stamped on generated images, or "" when
+// watermarking is off.
+func watermarkText() string {
+	if !getEnvBool("WATERMARK_ENABLED", false) {
+		return ""
+	}
+	text := strings.TrimSpace(os.Getenv("WATERMARK_TEXT"))
+	if text == "" {
+		text = defaultWatermarkText
+	}
+	text = strings.Map(func(r rune) rune {
+		if _, ok := watermarkGlyphs[r]; ok {
+			return r
+		}
+		return ' '
+	}, strings.ToUpper(text))
+	if len(text) > maxWatermarkTextLength {
+		text = text[:maxWatermarkTextLength]
+	}
+	return text
+}
+
+// watermarkImages stamps text on each image and returns the URLs of the
+// copies stored for menuID.
+func watermarkImages(ctx context.Context, menuID string, imageURLs []string, text string) ([]string, error) {
+	baseURL := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("PUBLIC_BASE_URL not set")
+	}
+
+	client := newImageFetchClient()
+	watermarked := make([]string, 0, len(imageURLs))
+	for _, imageURL := range imageURLs {
+		data, _, err := fetchImage(client, imageURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download image to watermark: %w", err)
+		}
+		data, contentType, err := stampWatermark(data, text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watermark image: %w", err)
+		}
+
+		stored := StoredImage{ID: idGen.NewID(), ContentType: contentType, Data: data, CreatedAt: clock.Now()}
+		if menuID != "" {
+			stored.MenuID = &menuID
+		}
+		if err := db.WithContext(ctx).Create(&stored).Error; err != nil {
+			return nil, fmt.Errorf("failed to store watermarked image: %w", err)
+		}
+		watermarked = append(watermarked, baseURL+"/public/images/"+stored.ID)
+	}
+	return watermarked, nil
+}
+
+// stampWatermark draws text, white on a translucent dark box, in the
+// bottom-right corner of a JPEG or PNG image and encodes it in the same
+// format.
+func stampWatermark(data []byte, text string) ([]byte, string, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	bounds := src.Bounds()
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, src, bounds.Min, draw.Src)
+
+	// Glyphs are scaled with the image so the label reads the same at any size
+	scale := max(1, min(bounds.Dx(), bounds.Dy())/400)
+	advance := (watermarkGlyphWidth + 1) * scale
+	padding := 3 * scale
+	margin := 4 * scale
+	if fit := (bounds.Dx() - 2*margin - 2*padding) / advance; len(text) > fit {
+		text = text[:max(fit, 0)]
+	}
+	if text == "" {
+		return nil, "", fmt.Errorf("image too small for the watermark")
+	}
+
+	box := image.Rect(0, 0, len(text)*advance-scale+2*padding, watermarkGlyphHeight*scale+2*padding)
+	box = box.Add(image.Pt(bounds.Max.X-margin-box.Dx(), bounds.Max.Y-margin-box.Dy()))
+	draw.Draw(img, box, image.NewUniform(color.NRGBA{A: 140}), image.Point{}, draw.Over)
+
+	x, y := box.Min.X+padding, box.Min.Y+padding
+	for _, r := range text {
+		glyph := watermarkGlyphs[r]
+		for row, bits := range glyph {
+			for col := 0; col < watermarkGlyphWidth; col++ {
+				if bits&(1<<(watermarkGlyphWidth-1-col)) == 0 {
+					continue
+				}
+				dot := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, dot, image.White, image.Point{}, draw.Src)
+			}
+		}
+		x += advance
+	}
+
+	var out bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&out, img)
+		return out.Bytes(), "image/png", err
+	case "jpeg":
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+		return out.Bytes(), "image/jpeg", err
+	}
+	return nil, "", fmt.Errorf("cannot watermark %s images", format)
+}
+
+// storedImageInUse is true for the stored_images rows that a dish, an image
+// candidate, the image cache, or the catalog still shows, by their URL.
+const storedImageInUse = `(EXISTS (SELECT 1 FROM dishes WHERE dishes.image_url LIKE '%/public/images/' || stored_images.id::text)
+	OR EXISTS (SELECT 1 FROM dish_images WHERE dish_images.url LIKE '%/public/images/' || stored_images.id::text)
+	OR EXISTS (SELECT 1 FROM image_cache_entries WHERE image_cache_entries.image_url LIKE '%/public/images/' || stored_images.id::text)
+	OR EXISTS (SELECT 1 FROM catalog_dishes WHERE catalog_dishes.image_url LIKE '%/public/images/' || stored_images.id::text))`
+
+// deleteUnsharedImages deletes the images stored for the menus in tx, once
+// their dishes are gone, and returns how many it deleted. Images the image
+// cache handed to other menus pass to one of those, or to no menu while only
+// the cache or the catalog shows them; deleteOrphanedImages removes them
+// once nothing does.
+func deleteUnsharedImages(tx *gorm.DB, menuIDs []string) (int64, error) {
+	result := tx.Where("menu_id IN ? AND NOT "+storedImageInUse, menuIDs).Delete(&StoredImage{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	err := tx.Exec(`UPDATE stored_images SET menu_id = COALESCE(
+			(SELECT menu_id FROM dishes WHERE dishes.image_url LIKE '%/public/images/' || stored_images.id::text LIMIT 1),
+			(SELECT menu_id FROM dish_images WHERE dish_images.url LIKE '%/public/images/' || stored_images.id::text LIMIT 1))
+		WHERE menu_id IN ?`, menuIDs).Error
+	return result.RowsAffected, err
+}
+
+// deleteOrphanedImages deletes the stored images of no menu that nothing
+// shows any more, and returns how many it deleted.
+func deleteOrphanedImages(ctx context.Context) (int64, error) {
+	result := db.WithContext(ctx).Where("menu_id IS NULL AND NOT " + storedImageInUse).Delete(&StoredImage{})
+	return result.RowsAffected, result.Error
+}
+
+func storedImageHandler(c *gin.Context) {
+	var stored StoredImage
+	if err := db.Where("id = ?", c.Param("id")).First(&stored).Error; err != nil {
+		respondError(c, http.StatusNotFound, "IMAGE_NOT_FOUND", "Image not found")
+		return
+	}
+	// Stored images never change
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(http.StatusOK, stored.ContentType, stored.Data)
+}
+
+const (
+	watermarkGlyphWidth  = 5
+	watermarkGlyphHeight = 7
+)
+
+// watermarkGlyphs is a 5x7 pixel font for watermark labels, one row per
+// byte from the top, the leftmost pixel in the highest of the five bits.
+// Labels are upper-cased, and characters without a glyph become spaces.
+var watermarkGlyphs = map[rune][watermarkGlyphHeight]byte{
+	'A':  {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B':  {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C':  {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D':  {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G':  {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H':  {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I':  {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M':  {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P':  {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q':  {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R':  {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S':  {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T':  {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X':  {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'0':  {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1':  {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3':  {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4':  {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5':  {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6':  {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9':  {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'-':  {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'+':  {0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08},
+	':':  {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'\'': {0x0C, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'&':  {0x0C, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0D},
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Webhook events emitted by the backend.
+const (
+	EventMenuCompleted      = "menu.completed"
+	EventMenuFailed         = "menu.failed"
+	EventMenuDeleted        = "menu.deleted"
+	EventMenuAwaitingReview = "menu.awaiting_review"
+)
+
+var webhookEvents = []string{EventMenuCompleted, EventMenuFailed, EventMenuDeleted, EventMenuAwaitingReview}
+
+// Webhook is a subscription that receives signed POSTs for the listed events.
+// It belongs to the user who created it, or to the API key it was created
+// with when nobody was signed in, and hears only of the menus uploaded by
+// that user or with that key.
+type Webhook struct {
+	ID        string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    *string    `json:"-" gorm:"type:uuid;index"`
+	APIKeyID  *string    `json:"-" gorm:"type:uuid;index"`
+	URL       string     `json:"url"`
+	Secret    string     `json:"-"`
+	Events    StringList `json:"events" gorm:"type:jsonb"`
+	Active    bool       `json:"active" gorm:"default:true"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery records one attempt to deliver an event to a webhook. Only
+// the status code of the response is kept, never its body.
+type WebhookDelivery struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	WebhookID  string    `json:"webhook_id" gorm:"type:uuid;index"`
+	Event      string    `json:"event"`
+	Payload    string    `json:"payload" gorm:"type:jsonb"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code"`
+	Error      *string   `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookCreateRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events" binding:"required,min=1"`
+}
+
+type WebhookUpdateRequest struct {
+	URL    *string   `json:"url"`
+	Secret *string   `json:"secret"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
+}
+
+// WebhookEvent is the body POSTed to subscribers.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// webhookClient only connects to public addresses (see publicAddress),
+// checked on every dial, so neither a host that resolves differently after
+// validation nor a redirect can reach services inside the deployment's
+// network. It ignores proxy settings, which would hide the address dialled.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: refuseNonPublicAddress,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// nonPublicPrefixes are the ranges publicAddress refuses beyond the
+// loopback, private, link-local, and unspecified ones the netip package
+// knows: "this network" and carrier-grade NAT, where some clouds keep their
+// metadata services.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// publicAddress reports whether webhooks may be delivered to ip.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// refuseNonPublicAddress is webhookClient's dial control: address is the
+// resolved IP and port about to be connected to.
+func refuseNonPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+// eventOwner is whom a webhook, or the menu an event is about, belongs to:
+// a user, an API key, or both for menus uploaded signed in with a key.
+type eventOwner struct {
+	UserID   string
+	APIKeyID string
+}
+
+// callerEventOwner is the owner of the webhooks the request manages: the
+// signed-in user, or else the request's API key.
+func callerEventOwner(c *gin.Context) eventOwner {
+	if userID := currentUserID(c); userID != "" {
+		return eventOwner{UserID: userID}
+	}
+	return eventOwner{APIKeyID: currentAPIKeyID(c)}
+}
+
+// menuEventOwner is the owner of the menu's events; zero when the menu
+// cannot be loaded.
+func menuEventOwner(menuID string) eventOwner {
+	var menu Menu
+	if err := db.Select("id", "user_id", "api_key_id").Where("id = ?", menuID).First(&menu).Error; err != nil {
+		zapLog.Warn("Failed to load menu owner for webhooks", zap.String("menuID", menuID), zap.Error(err))
+		return eventOwner{}
+	}
+	var owner eventOwner
+	if menu.UserID != nil {
+		owner.UserID = *menu.UserID
+	}
+	if menu.APIKeyID != nil {
+		owner.APIKeyID = *menu.APIKeyID
+	}
+	return owner
+}
+
+// requireWebhookOwner rejects requests with neither a session nor an API
+// key, whose webhooks could not be told apart from anyone else's.
+func requireWebhookOwner() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if owner := callerEventOwner(c); owner.UserID == "" && owner.APIKeyID == "" {
+			respondError(c, http.StatusUnauthorized, "LOGIN_REQUIRED", "Sign in or send an API key to manage webhooks")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// scopeToWebhookOwner limits a webhook query to the caller's webhooks.
+func scopeToWebhookOwner(query *gorm.DB, c *gin.Context) *gorm.DB {
+	owner := callerEventOwner(c)
+	if owner.UserID != "" {
+		return query.Where("user_id = ?", owner.UserID)
+	}
+	return query.Where("user_id IS NULL AND api_key_id = ?", owner.APIKeyID)
+}
+
+func listWebhooksHandler(c *gin.Context) {
+	webhooks := []Webhook{}
+	if err := scopeToWebhookOwner(db, c).Order("created_at").Find(&webhooks).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load webhooks")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+func getWebhookHandler(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+// createWebhookHandler registers a subscription. The signing secret is only
+// ever returned here; one is generated when the caller does not supply it.
+func createWebhookHandler(c *gin.Context) {
+	var req WebhookCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	webhookURL, err := validateWebhookURL(req.URL)
+	if err != nil {
+		respondFieldError(c, "url", "url", err.Error())
+		return
+	}
+	if err := validateWebhookEvents(req.Events); err != nil {
+		respondFieldError(c, "events", "oneof", err.Error())
+		return
+	}
+
+	secret := strings.TrimSpace(req.Secret)
+	if secret == "" {
+		if secret, err = generateWebhookSecret(); err != nil {
+			respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to generate secret")
+			return
+		}
+	}
+
+	now := clock.Now()
+	webhook := Webhook{
+		ID:        idGen.NewID(),
+		URL:       webhookURL,
+		Secret:    secret,
+		Events:    StringList(req.Events),
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if owner := callerEventOwner(c); owner.UserID != "" {
+		webhook.UserID = &owner.UserID
+	} else {
+		webhook.APIKeyID = &owner.APIKeyID
+	}
+	if err := db.Create(&webhook).Error; err != nil {
+		zapLog.Error("Failed to create webhook", zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create webhook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+func updateWebhookHandler(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.URL != nil {
+		webhookURL, err := validateWebhookURL(*req.URL)
+		if err != nil {
+			respondFieldError(c, "url", "url", err.Error())
+			return
+		}
+		updates["url"] = webhookURL
+	}
+	if req.Secret != nil {
+		secret := strings.TrimSpace(*req.Secret)
+		if secret == "" {
+			respondFieldError(c, "secret", "required", "secret cannot be empty")
+			return
+		}
+		updates["secret"] = secret
+	}
+	if req.Events != nil {
+		if len(*req.Events) == 0 {
+			respondFieldError(c, "events", "required", "events cannot be empty")
+			return
+		}
+		if err := validateWebhookEvents(*req.Events); err != nil {
+			respondFieldError(c, "events", "oneof", err.Error())
+			return
+		}
+		updates["events"] = StringList(*req.Events)
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+
+	if len(updates) == 0 {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", "No fields to update")
+		return
+	}
+	updates["updated_at"] = clock.Now()
+
+	if err := db.Model(&Webhook{}).Where("id = ?", webhook.ID).Updates(updates).Error; err != nil {
+		zapLog.Error("Failed to update webhook", zap.String("webhookID", webhook.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update webhook")
+		return
+	}
+
+	if err := db.Where("id = ?", webhook.ID).First(webhook).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load webhook")
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+func deleteWebhookHandler(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", webhook.ID).Delete(&Webhook{}).Error
+	})
+	if err != nil {
+		zapLog.Error("Failed to delete webhook", zap.String("webhookID", webhook.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete webhook")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listWebhookDeliveriesHandler returns the most recent delivery attempts,
+// newest first.
+func listWebhookDeliveriesHandler(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	deliveries := []WebhookDelivery{}
+	if err := db.Where("webhook_id = ?", webhook.ID).Order("created_at DESC").Limit(100).Find(&deliveries).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook_id": webhook.ID, "deliveries": deliveries})
+}
+
+// redeliverWebhookHandler sends a previous delivery's payload again and
+// records it as a new attempt.
+func redeliverWebhookHandler(c *gin.Context) {
+	webhook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var previous WebhookDelivery
+	if err := db.Where("id = ? AND webhook_id = ?", c.Param("deliveryId"), webhook.ID).First(&previous).Error; err != nil {
+		respondError(c, http.StatusNotFound, "DELIVERY_NOT_FOUND", "Delivery not found")
+		return
+	}
+
+	var attempts int64
+	if err := db.Model(&WebhookDelivery{}).Where("webhook_id = ? AND payload->>'id' = ?", webhook.ID, webhookEventID(previous.Payload)).Count(&attempts).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load deliveries")
+		return
+	}
+
+	delivery := deliverWebhook(*webhook, previous.Event, []byte(previous.Payload), int(attempts)+1)
+	c.JSON(http.StatusOK, delivery)
+}
+
+// loadWebhook loads the caller's webhook; other owners' answer 404 like
+// ones that do not exist.
+func loadWebhook(c *gin.Context) (*Webhook, bool) {
+	var webhook Webhook
+	if err := scopeToWebhookOwner(db, c).Where("id = ?", c.Param("id")).First(&webhook).Error; err != nil {
+		respondError(c, http.StatusNotFound, "WEBHOOK_NOT_FOUND", "Webhook not found")
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// validateWebhookURL accepts absolute http(s) URLs whose host resolves only
+// to public addresses. Deliveries check the address again when they connect.
+func validateWebhookURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return "", fmt.Errorf("url must be an absolute http(s) URL")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil || len(addresses) == 0 {
+		return "", fmt.Errorf("url host %q could not be resolved", parsed.Hostname())
+	}
+	for _, address := range addresses {
+		if !publicAddress(address) {
+			return "", fmt.Errorf("url must not point to a private, loopback, or link-local address")
+		}
+	}
+	return raw, nil
+}
+
+func validateWebhookEvents(events []string) error {
+	for _, event := range events {
+		known := false
+		for _, candidate := range webhookEvents {
+			if event == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q (supported: %s)", event, strings.Join(webhookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// signWebhookPayload returns the X-MenuGen-Signature value for a payload:
+// an HMAC-SHA256 over "<timestamp>.<body>" keyed with the webhook secret.
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookEventID(payload string) string {
+	var event struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal([]byte(payload), &event)
+	return event.ID
+}
+
+// emitEvent delivers an event about a menu of owner to every active webhook
+// of that owner subscribed to it. Menus without an owner have no
+// subscribers. It returns immediately; deliveries run in the background.
+func emitEvent(event string, owner eventOwner, data interface{}) {
+	var scopes []string
+	var args []interface{}
+	if owner.UserID != "" {
+		scopes = append(scopes, "user_id = ?")
+		args = append(args, owner.UserID)
+	}
+	if owner.APIKeyID != "" {
+		scopes = append(scopes, "api_key_id = ?")
+		args = append(args, owner.APIKeyID)
+	}
+	if len(scopes) == 0 {
+		return
+	}
+	scope := strings.Join(scopes, " OR ")
+	var webhooks []Webhook
+	if err := db.Where("active = ? AND events @> ?::jsonb", true, fmt.Sprintf("[%q]", event)).Where(scope, args...).Find(&webhooks).Error; err != nil {
+		zapLog.Error("Failed to load webhooks", zap.String("event", event), zap.Error(err))
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(WebhookEvent{
+		ID:        idGen.NewID(),
+		Event:     event,
+		CreatedAt: clock.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		zapLog.Error("Failed to encode webhook event", zap.String("event", event), zap.Error(err))
+		return
+	}
+
+	for _, webhook := range webhooks {
+		go deliverWebhook(webhook, event, payload, 1)
+	}
+}
+
+// deliverWebhook POSTs a payload to the webhook and records the attempt.
+func deliverWebhook(webhook Webhook, event string, payload []byte, attempt int) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:        idGen.NewID(),
+		WebhookID: webhook.ID,
+		Event:     event,
+		Payload:   string(payload),
+		Attempt:   attempt,
+		CreatedAt: clock.Now(),
+	}
+
+	started := time.Now()
+	statusCode, err := postWebhook(webhook, event, delivery.ID, payload)
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		delivery.Error = stringPtr(err.Error())
+	} else {
+		delivery.StatusCode = &statusCode
+	}
+
+	if err := db.Create(&delivery).Error; err != nil {
+		zapLog.Error("Failed to record webhook delivery", zap.String("webhookID", webhook.ID), zap.Error(err))
+	}
+
+	if err != nil || statusCode >= 300 {
+		zapLog.Warn("Webhook delivery failed",
+			zap.String("webhookID", webhook.ID),
+			zap.String("event", event),
+			zap.Int("statusCode", statusCode),
+			zap.Error(err))
+	}
+	return delivery
+}
+
+func postWebhook(webhook Webhook, event, deliveryID string, payload []byte) (int, error) {
+	timestamp := clock.Now().Unix()
+
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MenuGen-Webhooks/1.0")
+	req.Header.Set("X-MenuGen-Event", event)
+	req.Header.Set("X-MenuGen-Delivery", deliveryID)
+	req.Header.Set("X-MenuGen-Timestamp", fmt.Sprintf("%d", timestamp))
+	req.Header.Set("X-MenuGen-Signature", signWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	for raw, want := range map[string]bool{
+		"https://93.184.216.34/hook":               true,
+		"http://93.184.216.34:8080/hook":           true,
+		"http://127.0.0.1/hook":                    false,
+		"http://localhost:8080/hook":               false,
+		"http://[::1]/hook":                        false,
+		"http://10.1.2.3/hook":                     false,
+		"http://172.16.0.1/hook":                   false,
+		"http://192.168.1.1/hook":                  false,
+		"http://169.254.169.254/latest/meta-data/": false,
+		"http://[fe80::1]/hook":                    false,
+		"http://[::ffff:127.0.0.1]/hook":           false,
+		"http://0.0.0.0/hook":                      false,
+		"http://100.100.100.200/hook":              false,
+		"ftp://93.184.216.34/hook":                 false,
+		"/hook":                                    false,
+	} {
+		_, err := validateWebhookURL(raw)
+		if got := err == nil; got != want {
+			t.Errorf("validateWebhookURL(%q) error = %v, want accepted %v", raw, err, want)
+		}
+	}
+}
+
+func TestWebhookClientRefusesNonPublicAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	resp, err := webhookClient.Post(server.URL, "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("webhookClient reached %s", server.URL)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// widgetTheme styles an embedded menu. Every value is validated against a
+// fixed pattern or list before it reaches the markup, so the CSS values can be
+// trusted by the template.
+type widgetTheme struct {
+	Accent     template.CSS
+	Background template.CSS
+	Text       template.CSS
+	Font       template.CSS
+	Layout     string
+	Images     bool
+}
+
+// widgetFonts maps the font query parameter to a font stack. Web fonts are
+// not loaded, so only stacks every browser can resolve are offered.
+var widgetFonts = map[string]template.CSS{
+	"serif":   `Georgia, "Times New Roman", serif`,
+	"sans":    `system-ui, -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif`,
+	"mono":    `ui-monospace, Menlo, Consolas, monospace`,
+	"inherit": `inherit`,
+}
+
+var (
+	widgetColorPattern    = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	widgetCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+)
+
+// parseWidgetTheme reads the theme query parameters, falling back to the
+// hosted page's look for anything not given.
+func parseWidgetTheme(c *gin.Context) (widgetTheme, string) {
+	theme := widgetTheme{
+		Accent:     "#8a3b12",
+		Background: "#faf8f5",
+		Text:       "#222222",
+		Font:       widgetFonts["serif"],
+		Layout:     "grid",
+		Images:     true,
+	}
+
+	colors := []struct {
+		param string
+		value *template.CSS
+	}{
+		{"accent", &theme.Accent},
+		{"background", &theme.Background},
+		{"text", &theme.Text},
+	}
+	for _, color := range colors {
+		value := c.Query(color.param)
+		if value == "" {
+			continue
+		}
+		if !widgetColorPattern.MatchString(value) {
+			return theme, color.param + " must be a hex color such as 8a3b12"
+		}
+		*color.value = template.CSS("#" + strings.TrimPrefix(value, "#"))
+	}
+
+	if font := c.Query("font"); font != "" {
+		stack, ok := widgetFonts[font]
+		if !ok {
+			return theme, "font must be serif, sans, mono, or inherit"
+		}
+		theme.Font = stack
+	}
+
+	switch layout := c.DefaultQuery("layout", "grid"); layout {
+	case "grid", "list":
+		theme.Layout = layout
+	default:
+		return theme, "layout must be grid or list"
+	}
+
+	switch c.DefaultQuery("images", "true") {
+	case "true", "1":
+	case "false", "0":
+		theme.Images = false
+	default:
+		return theme, "images must be true or false"
+	}
+
+	return theme, ""
+}
+
+type widgetView struct {
+	Menu  menuDocument
+	Theme widgetTheme
+}
+
+// publicMenuWidgetHandler serves a shared menu for embedding in another site.
+// By default it returns a complete page meant for an <iframe>; with
+// ?format=fragment it returns only the widget markup, and with ?callback=fn it
+// wraps that markup in a JSONP call so a <script> tag can insert it. Theme
+// parameters: accent, background, text (hex colors), font (serif, sans, mono,
+// inherit), layout (grid, list), and images (true, false).
+func publicMenuWidgetHandler(c *gin.Context) {
+	theme, problem := parseWidgetTheme(c)
+	if problem != "" {
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST", problem)
+		return
+	}
+	callback := c.Query("callback")
+	if callback != "" && (len(callback) > 64 || !widgetCallbackPattern.MatchString(callback)) {
+		respondFieldError(c, "callback", "format", "callback must be a JavaScript identifier")
+		return
+	}
+
+	doc, ok := loadSharedMenu(c)
+	if !ok {
+		return
+	}
+
+	view := widgetView{Menu: doc, Theme: theme}
+	name := "widget"
+	if callback == "" && c.Query("format") != "fragment" {
+		name = "frame"
+	}
+	var buf bytes.Buffer
+	if err := menuWidgetTemplate.ExecuteTemplate(&buf, name, view); err != nil {
+		zapLog.Error("Failed to render menu widget", zap.String("menuID", doc.Menu.ID), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load menu")
+		return
+	}
+
+	// Embedding on other origins is the point of this endpoint
+	c.Header("Content-Security-Policy", "frame-ancestors *")
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	if callback != "" {
+		payload, err := json.Marshal(gin.H{"html": buf.String()})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load menu")
+			return
+		}
+		c.Header("X-Content-Type-Options", "nosniff")
+		// The leading comment stops the response being read as anything but a call
+		c.Data(http.StatusOK, "application/javascript; charset=utf-8", []byte("/**/"+callback+"("+string(payload)+");"))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// The widget's styles are scoped under .menugen-widget and read the theme
+// from custom properties on the root element, so several widgets with
+// different themes can share a host page without clashing with its CSS.
+var menuWidgetTemplate = template.Must(template.New("widget").Parse(`{{define "widget" -}}
+<div class="menugen-widget menugen-{{.Theme.Layout}}" style="--mg-accent: {{.Theme.Accent}}; --mg-background: {{.Theme.Background}}; --mg-text: {{.Theme.Text}}; --mg-font: {{.Theme.Font}};">
+<style>
+  .menugen-widget { font-family: var(--mg-font); color: var(--mg-text); background: var(--mg-background); line-height: 1.5; padding: 1rem; }
+  .menugen-widget *, .menugen-widget *::before, .menugen-widget *::after { box-sizing: border-box; }
+  .menugen-widget .mg-title { margin: 0 0 1rem; font-size: 1.75rem; font-weight: normal; text-align: center; }
+  .menugen-widget .mg-section { margin: 0 0 1.5rem; }
+  .menugen-widget .mg-section-name { margin: 0 0 0.75rem; font-size: 1.3rem; font-weight: normal; border-bottom: 2px solid var(--mg-accent); padding-bottom: 0.2rem; }
+  .menugen-widget .mg-dishes { list-style: none; margin: 0; padding: 0; }
+  .menugen-widget .mg-dish img { display: block; object-fit: cover; background: rgba(0, 0, 0, 0.06); }
+  .menugen-widget .mg-heading { display: flex; justify-content: space-between; align-items: baseline; gap: 0.75rem; }
+  .menugen-widget .mg-name { margin: 0; font-size: 1.05rem; }
+  .menugen-widget .mg-price { font-weight: 600; white-space: nowrap; color: var(--mg-accent); }
+  .menugen-widget .mg-description { margin: 0.35rem 0 0; font-size: 0.92rem; opacity: 0.8; }
+  .menugen-grid .mg-dishes { display: grid; grid-template-columns: repeat(auto-fill, minmax(14rem, 1fr)); gap: 1rem; }
+  .menugen-grid .mg-dish { border-radius: 0.5rem; overflow: hidden; box-shadow: 0 1px 3px rgba(0, 0, 0, 0.1); }
+  .menugen-grid .mg-dish img { width: 100%; aspect-ratio: 1 / 1; }
+  .menugen-grid .mg-body { padding: 0.75rem 0.9rem 0.9rem; }
+  .menugen-list .mg-dish { display: flex; gap: 0.9rem; align-items: flex-start; padding: 0.75rem 0; border-bottom: 1px solid rgba(0, 0, 0, 0.08); }
+  .menugen-list .mg-dish:last-child { border-bottom: none; }
+  .menugen-list .mg-dish img { width: 4.5rem; height: 4.5rem; flex: none; border-radius: 0.35rem; }
+  .menugen-list .mg-body { flex: 1; min-width: 0; }
+</style>
+<h2 class="mg-title">{{.Menu.Title}}</h2>
+{{- $images := .Theme.Images}}
+{{- range .Menu.Sections}}{{if .Dishes}}
+<section class="mg-section">
+  <h3 class="mg-section-name">{{.Name}}</h3>
+  <ul class="mg-dishes">
+  {{- range .Dishes}}
+    <li class="mg-dish">
+      {{- if and $images .Dish.ImageURL}}
+      <img src="{{.Dish.ImageURL}}" alt="{{.ImageAlt}}" loading="lazy">
+      {{- end}}
+      <div class="mg-body">
+        <div class="mg-heading">
+          <h4 class="mg-name">{{.Dish.Name}}</h4>
+          {{- if .Price}}
+          <span class="mg-price">{{.Price}}</span>
+          {{- end}}
+        </div>
+        {{- if .Dish.Description}}
+        <p class="mg-description">{{.Dish.Description}}</p>
+        {{- end}}
+      </div>
+    </li>
+  {{- end}}
+  </ul>
+</section>
+{{- end}}{{end}}
+</div>
+{{- end}}
+
+{{define "frame" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Menu.Title}}</title>
+<base target="_blank">
+<style>html, body { margin: 0; background: {{.Theme.Background}}; }</style>
+</head>
+<body>
+{{template "widget" .}}
+<script>
+  (function () {
+    function report() {
+      parent.postMessage({ type: "menugen:resize", height: document.documentElement.scrollHeight }, "*");
+    }
+    window.addEventListener("load", report);
+    window.addEventListener("resize", report);
+  })();
+</script>
+</body>
+</html>
+{{- end}}`))
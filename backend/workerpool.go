@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// dishPool is the process-wide pool of dish workers, sized by
+// DISH_WORKER_POOL_SIZE (8 by default), so the number of concurrent
+// provider calls stays the same however many menus are being processed.
+// Free slots go to the waiting menu of the highest priority, and to menus
+// of the same priority in turn, so a large menu cannot starve the ones
+// uploaded after it. A waiting menu gains a priority level for every
+// PRIORITY_AGING_INTERVAL (30s) it goes without a slot, so low priority
+// menus still progress while high priority ones keep arriving. It is
+// configured in main.
+var dishPool = newWorkerPool(8, 30*time.Second)
+
+// workerPool hands out a fixed number of slots to the menus waiting for one,
+// and reports queueing and saturation to jobStats.
+type workerPool struct {
+	mu    sync.Mutex
+	size  int
+	used  int
+	aging time.Duration
+	// waiting holds each menu's waiters; turns is the round-robin order of
+	// the menus in waiting
+	waiting map[string]*menuWaiters
+	turns   []string
+}
+
+// menuWaiters are the workers of one menu waiting for a slot, in arrival
+// order. since is when the menu last got a slot or started waiting.
+type menuWaiters struct {
+	priority int
+	since    time.Time
+	waiters  []chan struct{}
+}
+
+func newWorkerPool(size int, aging time.Duration) *workerPool {
+	size = max(size, 1)
+	jobStats.slotsTotal.Store(int64(size))
+	return &workerPool{size: size, aging: aging, waiting: make(map[string]*menuWaiters)}
+}
+
+// acquire waits for a slot for one of menuID's workers, at the given
+// priority level. It fails with ctx's cause when ctx ends first.
+func (p *workerPool) acquire(ctx context.Context, menuID string, priority int) error {
+	p.mu.Lock()
+	if p.used < p.size && len(p.turns) == 0 {
+		p.used++
+		p.mu.Unlock()
+		jobStats.slotsInUse.Add(1)
+		return nil
+	}
+	granted := make(chan struct{})
+	queue, ok := p.waiting[menuID]
+	if !ok {
+		queue = &menuWaiters{priority: priority, since: clock.Now()}
+		p.waiting[menuID] = queue
+		p.turns = append(p.turns, menuID)
+	}
+	queue.waiters = append(queue.waiters, granted)
+	p.mu.Unlock()
+
+	jobStats.queued.Add(1)
+	defer jobStats.queued.Add(-1)
+	select {
+	case <-granted:
+		jobStats.slotsInUse.Add(1)
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-granted:
+		// Granted while giving up; pass the slot on
+		p.used--
+		p.dispatch()
+	default:
+		p.removeWaiter(menuID, granted)
+	}
+	return context.Cause(ctx)
+}
+
+// release returns a slot taken by acquire.
+func (p *workerPool) release() {
+	jobStats.slotsInUse.Add(-1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.used--
+	p.dispatch()
+}
+
+// dispatch hands free slots to waiters. p.mu must be held.
+func (p *workerPool) dispatch() {
+	now := clock.Now()
+	for p.used < p.size && len(p.turns) > 0 {
+		next := p.next(now)
+		menuID := p.turns[next]
+		queue := p.waiting[menuID]
+		close(queue.waiters[0])
+		p.used++
+
+		p.turns = append(p.turns[:next], p.turns[next+1:]...)
+		if len(queue.waiters) > 1 {
+			queue.waiters = queue.waiters[1:]
+			queue.since = now
+			p.turns = append(p.turns, menuID)
+		} else {
+			delete(p.waiting, menuID)
+		}
+	}
+}
+
+// next picks the index in turns of the menu to serve: the highest priority
+// after aging, the earliest in turn among equals.
+func (p *workerPool) next(now time.Time) int {
+	best, bestLevel := 0, -1
+	for i, menuID := range p.turns {
+		queue := p.waiting[menuID]
+		level := queue.priority
+		if p.aging > 0 {
+			level += int(now.Sub(queue.since) / p.aging)
+		}
+		if level > bestLevel {
+			best, bestLevel = i, level
+		}
+	}
+	return best
+}
+
+// removeWaiter drops a waiter that gave up. p.mu must be held.
+func (p *workerPool) removeWaiter(menuID string, granted chan struct{}) {
+	queue := p.waiting[menuID]
+	for i, waiter := range queue.waiters {
+		if waiter == granted {
+			queue.waiters = append(queue.waiters[:i], queue.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(queue.waiters) > 0 {
+		return
+	}
+	delete(p.waiting, menuID)
+	for i, turn := range p.turns {
+		if turn == menuID {
+			p.turns = append(p.turns[:i], p.turns[i+1:]...)
+			break
+		}
+	}
+}
@@ -5,6 +5,12 @@ const getApiUrl = () => {
   return window?.configs?.apiUrl || import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
 }
 
+// API key sent to the backend's /api routes, when the deployment requires one
+const getApiHeaders = () => {
+  const apiKey = window?.configs?.apiKey || import.meta.env.VITE_API_KEY
+  return apiKey ? { 'X-API-Key': apiKey } : {}
+}
+
 function App() {
   const [user, setUser] = useState(null)
   const [isAuthenticated, setIsAuthenticated] = useState(false)
@@ -14,6 +20,7 @@ function App() {
   const [menuData, setMenuData] = useState(null)
   const [isUploading, setIsUploading] = useState(false)
   const [error, setError] = useState(null)
+  const [duplicate, setDuplicate] = useState(null)
 
   const BASE_URL = getApiUrl()
 
@@ -76,12 +83,13 @@ function App() {
       
       setSelectedFile(file)
       setError(null)
+      setDuplicate(null)
       setMenuData(null)
       setMenuId(null)
     }
   }
 
-  const handleUpload = async () => {
+  const handleUpload = async (onDuplicate = 'warn') => {
     if (!selectedFile) {
       setError('Please select a file first')
       return
@@ -89,19 +97,27 @@ function App() {
 
     setIsUploading(true)
     setError(null)
+    setDuplicate(null)
 
     try {
       const formData = new FormData()
       formData.append('image', selectedFile)
+      formData.append('on_duplicate', onDuplicate)
 
       const response = await fetch(`${BASE_URL}/api/menu`, {
         method: 'POST',
         credentials: 'include',
+        headers: getApiHeaders(),
         body: formData,
       })
 
       if (!response.ok) {
         const errorData = await response.json()
+        if (errorData.error?.code === 'NEAR_DUPLICATE_MENU') {
+          // Let the user choose between the existing menu and a fresh run
+          setDuplicate(errorData.duplicate)
+          return
+        }
         throw new Error(errorData.error?.message || 'Upload failed')
       }
 
@@ -120,7 +136,8 @@ function App() {
   const pollMenuStatus = async (id) => {
     try {
       const response = await fetch(`${BASE_URL}/api/menu/${id}`, {
-        credentials: 'include'
+        credentials: 'include',
+        headers: getApiHeaders(),
       })
       
       if (!response.ok) {
@@ -145,6 +162,7 @@ function App() {
     setMenuId(null)
     setMenuData(null)
     setError(null)
+    setDuplicate(null)
     document.getElementById('file-input').value = ''
   }
 
@@ -293,9 +311,59 @@ function App() {
             </div>
           )}
 
+          {duplicate && (
+            <div className="mt-4 p-4 bg-yellow-50 border border-yellow-200 rounded-lg">
+              <p className="text-yellow-800 font-medium">
+                This looks like a menu you already uploaded ({Math.round(duplicate.similarity * 100)}% similar)
+              </p>
+              <p className="text-sm text-gray-700 mt-1">
+                {duplicate.original_filename} &middot; {new Date(duplicate.created_at).toLocaleString()} &middot; {duplicate.status} &middot; {duplicate.dish_count} dishes
+              </p>
+              {duplicate.sections.length > 0 && (
+                <p className="text-sm text-gray-600 mt-1">
+                  {duplicate.sections.map((section) => `${section.name} (${section.dish_count})`).join(', ')}
+                </p>
+              )}
+              {duplicate.diff_preview && (
+                <div className="mt-3 flex items-center space-x-3">
+                  <div
+                    className="grid gap-px bg-gray-300 border border-gray-300"
+                    style={{ gridTemplateColumns: `repeat(${duplicate.diff_preview.grid}, 0.75rem)` }}
+                    aria-hidden="true"
+                  >
+                    {duplicate.diff_preview.changed_regions.flat().map((changed, index) => (
+                      <div key={index} className={`h-4 ${changed ? 'bg-orange-400' : 'bg-white'}`} />
+                    ))}
+                  </div>
+                  <p className="text-sm text-gray-600">
+                    {duplicate.diff_preview.changed_fraction > 0
+                      ? `About ${Math.round(duplicate.diff_preview.changed_fraction * 100)}% of the page looks different`
+                      : 'No visible differences'}
+                  </p>
+                </div>
+              )}
+              <div className="mt-3 flex space-x-3">
+                <button
+                  onClick={() => handleUpload('reuse')}
+                  disabled={isUploading}
+                  className="px-4 py-2 bg-yellow-600 text-white text-sm font-medium rounded-lg hover:bg-yellow-700 disabled:bg-gray-400"
+                >
+                  Use existing menu
+                </button>
+                <button
+                  onClick={() => handleUpload('force')}
+                  disabled={isUploading}
+                  className="px-4 py-2 bg-white text-gray-700 text-sm font-medium border border-gray-300 rounded-lg hover:bg-gray-50 disabled:bg-gray-100"
+                >
+                  Process as new menu
+                </button>
+              </div>
+            </div>
+          )}
+
           <div className="mt-6 flex space-x-4">
             <button
-              onClick={handleUpload}
+              onClick={() => handleUpload()}
               disabled={!selectedFile || isUploading}
               className="px-6 py-3 bg-blue-600 text-white font-medium rounded-lg hover:bg-blue-700 disabled:bg-gray-400 disabled:cursor-not-allowed transition-colors"
             >
@@ -380,6 +448,11 @@ function App() {
                             }}
                           />
                         )}
+                        {!dish.image_url && dish.status === 'IMAGE_DISABLED' && (
+                          <div className="w-full h-48 rounded-lg mb-3 bg-gray-100 flex items-center justify-center text-sm text-gray-400">
+                            No photo
+                          </div>
+                        )}
                         
                         <div className="space-y-2">
                           <h4 className="font-semibold text-gray-900">{dish.name}</h4>
@@ -400,6 +473,8 @@ function App() {
                             <span className={`text-xs px-2 py-1 rounded-full ${
                               dish.status === 'COMPLETE' 
                                 ? 'bg-green-100 text-green-800' 
+                                : dish.status === 'IMAGE_DISABLED'
+                                ? 'bg-gray-100 text-gray-600'
                                 : 'bg-yellow-100 text-yellow-800'
                             }`}>
                               {dish.status}